@@ -50,6 +50,7 @@ type options struct {
 type bitbucketArtifactClientInterface interface {
 	bitbucket.BranchClientInterface
 	bitbucket.TagClientInterface
+	bitbucket.CommitClientInterface
 	bitbucket.RawClientInterface
 }
 
@@ -268,7 +269,8 @@ func getODSConfig(opts options, bitbucketClient bitbucket.RawClientInterface, wo
 
 // getSubrepoODSContext returns an ODS context for the given subrepo.
 // The ODS context points to a Git commit, which is either retrieved from the
-// best matching branch (if tag=WIP) or the Git tag identified by options.tag.
+// tag or commit the subrepo is pinned to or the best matching branch (if
+// tag=WIP), or the Git tag identified by options.tag.
 func getSubrepoODSContext(
 	ctxt *pipelinectxt.ODSContext,
 	subrepo config.Repository,
@@ -279,6 +281,14 @@ func getSubrepoODSContext(
 	// For WIP versions, select the best matching branches of subrepositories,
 	// and retrieve the latest commit from those branches.
 	if opts.tag == pipelinectxt.WIP {
+		pin, err := repository.ResolvePinnedRevision(bitbucketClient, subrepoCtxt.Project, subrepo)
+		if err != nil {
+			return nil, err
+		}
+		if pin != nil {
+			subrepoCtxt.GitCommitSHA = pin.CommitSHA
+			return subrepoCtxt, nil
+		}
 		br, err := repository.BestMatchingBranch(bitbucketClient, subrepoCtxt.Project, subrepo, pipelinectxt.WIP)
 		if err != nil {
 			return nil, err
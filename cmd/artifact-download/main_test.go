@@ -103,6 +103,7 @@ func TestGetSubrepoODSContext(t *testing.T) {
 		subrepo  config.Repository
 		branches []bitbucket.Branch
 		tags     []bitbucket.Tag
+		commits  []bitbucket.Commit
 		wantCtxt *pipelinectxt.ODSContext
 	}{
 		"tag given": {
@@ -172,6 +173,58 @@ func TestGetSubrepoODSContext(t *testing.T) {
 				GitCommitSHA: "bf31532481bf29dffe02367f050f4a3f4dd7845ed",
 			},
 		},
+		"WIP given and subrepo pinned to tag": {
+			opts: options{
+				namespace:  "foo-cd",
+				project:    "foo",
+				repository: "bar",
+				tag:        pipelinectxt.WIP,
+			},
+			subrepo: config.Repository{Name: "baz", Tag: "v0.9.0"},
+			branches: []bitbucket.Branch{
+				{
+					ID:           "refs/heads/master",
+					LatestCommit: "af31532481bf29dffe02367f050f4a3f4dd7845ed",
+				},
+			},
+			tags: []bitbucket.Tag{
+				{
+					ID:           "refs/tags/v0.9.0",
+					DisplayID:    "v0.9.0",
+					LatestCommit: "c431532481bf29dffe02367f050f4a3f4dd7845ed",
+				},
+			},
+			wantCtxt: &pipelinectxt.ODSContext{
+				Namespace:    "foo-cd",
+				Project:      "foo",
+				Repository:   "baz",
+				GitCommitSHA: "c431532481bf29dffe02367f050f4a3f4dd7845ed",
+			},
+		},
+		"WIP given and subrepo pinned to commit": {
+			opts: options{
+				namespace:  "foo-cd",
+				project:    "foo",
+				repository: "bar",
+				tag:        pipelinectxt.WIP,
+			},
+			subrepo: config.Repository{Name: "baz", Commit: "d531532481bf29dffe02367f050f4a3f4dd7845ed"},
+			branches: []bitbucket.Branch{
+				{
+					ID:           "refs/heads/master",
+					LatestCommit: "af31532481bf29dffe02367f050f4a3f4dd7845ed",
+				},
+			},
+			commits: []bitbucket.Commit{
+				{ID: "d531532481bf29dffe02367f050f4a3f4dd7845ed"},
+			},
+			wantCtxt: &pipelinectxt.ODSContext{
+				Namespace:    "foo-cd",
+				Project:      "foo",
+				Repository:   "baz",
+				GitCommitSHA: "d531532481bf29dffe02367f050f4a3f4dd7845ed",
+			},
+		},
 	}
 
 	for name, tc := range tests {
@@ -179,6 +232,7 @@ func TestGetSubrepoODSContext(t *testing.T) {
 			bitbucketClient := &bitbucket.TestClient{
 				Branches: tc.branches,
 				Tags:     tc.tags,
+				Commits:  tc.commits,
 			}
 			got, err := getSubrepoODSContext(ctxt, tc.subrepo, tc.opts, bitbucketClient)
 			if err != nil {
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/google/shlex"
+	"github.com/opendevstack/pipeline/internal/helm"
+)
+
+// defaultHistoryMax is the number of revisions kept per release, as in the
+// Helm CLI.
+const defaultHistoryMax = 10
+
+// diffFlags are the supported flags of the diff-flags parameter.
+type diffFlags struct {
+	install bool
+	helm.DiffOptions
+}
+
+// parseDiffFlags parses the diff-flags parameter, which supports a subset
+// of the flags of `helm diff upgrade`.
+func parseDiffFlags(s string) (*diffFlags, error) {
+	df := &diffFlags{}
+	fs := newFlagSet("diff-flags")
+	fs.BoolVar(&df.install, "install", false, "")
+	fs.IntVar(&df.Context, "context", -1, "")
+	fs.BoolVar(&df.SuppressSecrets, "suppress-secrets", false, "")
+	// The diff is always computed, and never colored. The flags are
+	// accepted for compatibility with the helm-diff plugin.
+	fs.Bool("detailed-exitcode", false, "")
+	fs.Bool("no-color", false, "")
+	if err := parseFlagSet(fs, s); err != nil {
+		return nil, fmt.Errorf("could not parse diff flags (%s): %w", s, err)
+	}
+	return df, nil
+}
+
+// parseUpgradeFlags parses the upgrade-flags parameter, which supports a
+// subset of the flags of `helm upgrade`.
+func parseUpgradeFlags(s string) (*helm.UpgradeOptions, error) {
+	opts := &helm.UpgradeOptions{}
+	fs := newFlagSet("upgrade-flags")
+	fs.BoolVar(&opts.Install, "install", false, "")
+	fs.BoolVar(&opts.Wait, "wait", false, "")
+	fs.BoolVar(&opts.WaitForJobs, "wait-for-jobs", false, "")
+	fs.DurationVar(&opts.Timeout, "timeout", helm.DefaultTimeout, "")
+	fs.BoolVar(&opts.Atomic, "atomic", false, "")
+	fs.BoolVar(&opts.CleanupOnFail, "cleanup-on-fail", false, "")
+	fs.BoolVar(&opts.Force, "force", false, "")
+	fs.BoolVar(&opts.ResetValues, "reset-values", false, "")
+	fs.BoolVar(&opts.ReuseValues, "reuse-values", false, "")
+	fs.IntVar(&opts.MaxHistory, "history-max", defaultHistoryMax, "")
+	fs.StringVar(&opts.Description, "description", "", "")
+	fs.BoolVar(&opts.SkipCRDs, "skip-crds", false, "")
+	fs.BoolVar(&opts.DisableHooks, "no-hooks", false, "")
+	fs.BoolVar(&opts.DisableOpenAPIValidation, "disable-openapi-validation", false, "")
+	if err := parseFlagSet(fs, s); err != nil {
+		return nil, fmt.Errorf("could not parse upgrade flags (%s): %w", s, err)
+	}
+	return opts, nil
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	return fs
+}
+
+// parseFlagSet splits s like a shell would and parses the result with fs.
+// Positional arguments are not allowed.
+func parseFlagSet(fs *flag.FlagSet, s string) error {
+	args, err := shlex.Split(s)
+	if err != nil {
+		return err
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/internal/helm"
+)
+
+func TestParseDiffFlags(t *testing.T) {
+	tests := map[string]struct {
+		flags   string
+		want    *diffFlags
+		wantErr bool
+	}{
+		"defaults": {
+			flags: "",
+			want:  &diffFlags{DiffOptions: helm.DiffOptions{Context: -1}},
+		},
+		"task default": {
+			flags: "--install",
+			want:  &diffFlags{install: true, DiffOptions: helm.DiffOptions{Context: -1}},
+		},
+		"all supported flags": {
+			flags: "--install --context=3 --suppress-secrets --detailed-exitcode --no-color",
+			want: &diffFlags{
+				install:     true,
+				DiffOptions: helm.DiffOptions{Context: 3, SuppressSecrets: true},
+			},
+		},
+		"unsupported flag": {
+			flags:   "--install --three-way-merge",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseDiffFlags(tc.flags)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(diffFlags{})); diff != "" {
+				t.Fatalf("flags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseUpgradeFlags(t *testing.T) {
+	tests := map[string]struct {
+		flags   string
+		want    *helm.UpgradeOptions
+		wantErr bool
+	}{
+		"task default": {
+			flags: "--install --wait",
+			want: &helm.UpgradeOptions{
+				Install:    true,
+				Wait:       true,
+				Timeout:    5 * time.Minute,
+				MaxHistory: 10,
+			},
+		},
+		"values with spaces": {
+			flags: "--install --timeout 10m --history-max=3 --description 'Deployed by ODS'",
+			want: &helm.UpgradeOptions{
+				Install:     true,
+				Timeout:     10 * time.Minute,
+				MaxHistory:  3,
+				Description: "Deployed by ODS",
+			},
+		},
+		"unsupported flag": {
+			flags:   "--install --set=foo=bar",
+			wantErr: true,
+		},
+		"positional argument": {
+			flags:   "--install my-release",
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := parseUpgradeFlags(tc.flags)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("flags mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opendevstack/pipeline/internal/helm"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+type xunitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []xunitTestCase `xml:"testcase"`
+}
+
+type xunitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *xunitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type xunitFailure struct {
+	Message string `xml:"message,attr"`
+}
+
+// runHelmTest runs the tests of the release and writes the outcome of each
+// test hook as xunit report into pipelinectxt.XUnitReportsPath. An error is
+// returned if any test failed.
+func runHelmTest(client helm.ClientInterface, releaseName, reportName string) error {
+	fmt.Printf("Testing Helm release %s ...\n", releaseName)
+	rel, testErr := client.Test(releaseName, helm.DefaultTimeout, os.Stdout)
+	if rel == nil {
+		return fmt.Errorf("could not test release %s: %w", releaseName, testErr)
+	}
+	suite := helmTestSuite(releaseName, rel.Hooks)
+	err := writeXUnitReport(suite, reportName)
+	if err != nil {
+		return err
+	}
+	if testErr != nil {
+		return fmt.Errorf("tests of release %s failed: %w", releaseName, testErr)
+	}
+	return nil
+}
+
+// helmTestSuite converts the test hooks of a release into a xunit test suite.
+func helmTestSuite(releaseName string, hooks []*release.Hook) *xunitTestSuite {
+	suite := &xunitTestSuite{Name: "helm-test-" + releaseName, TestCases: []xunitTestCase{}}
+	var total time.Duration
+	for _, h := range hooks {
+		if !isTestHook(h) {
+			continue
+		}
+		var d time.Duration
+		startedAt, completedAt := h.LastRun.StartedAt.Time, h.LastRun.CompletedAt.Time
+		if !startedAt.IsZero() && completedAt.After(startedAt) {
+			d = completedAt.Sub(startedAt)
+		}
+		total += d
+		tc := xunitTestCase{
+			Name:      h.Name,
+			ClassName: suite.Name,
+			Time:      fmt.Sprintf("%.3f", d.Seconds()),
+		}
+		switch h.LastRun.Phase {
+		case release.HookPhaseSucceeded:
+		case release.HookPhaseFailed:
+			tc.Failure = &xunitFailure{Message: fmt.Sprintf("%s %s failed", h.Kind, h.Name)}
+			suite.Failures++
+		default:
+			tc.Skipped = &struct{}{}
+			suite.Skipped++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Time = fmt.Sprintf("%.3f", total.Seconds())
+	return suite
+}
+
+func isTestHook(h *release.Hook) bool {
+	for _, e := range h.Events {
+		// "test-success" is the deprecated name of the "test" hook.
+		if e == release.HookTest || e == "test-success" {
+			return true
+		}
+	}
+	return false
+}
+
+func writeXUnitReport(suite *xunitTestSuite, reportName string) error {
+	out, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not marshal xunit report: %w", err)
+	}
+	err = os.MkdirAll(pipelinectxt.XUnitReportsPath, 0755)
+	if err != nil {
+		return fmt.Errorf("could not create %s: %w", pipelinectxt.XUnitReportsPath, err)
+	}
+	return ioutil.WriteFile(
+		filepath.Join(pipelinectxt.XUnitReportsPath, reportName+".xml"),
+		append([]byte(xml.Header), out...),
+		0644,
+	)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestHelmTestSuite(t *testing.T) {
+	var status struct {
+		Hooks []*release.Hook `json:"hooks"`
+	}
+	err := json.Unmarshal([]byte(`{"hooks": [
+  {"name": "foo-migrate", "kind": "Job", "events": ["pre-upgrade"], "last_run": {"phase": "Succeeded"}},
+  {"name": "foo-test-connection", "kind": "Pod", "events": ["test"], "last_run": {"started_at": "2021-10-01T12:00:00Z", "completed_at": "2021-10-01T12:00:03.5Z", "phase": "Succeeded"}},
+  {"name": "foo-test-api", "kind": "Pod", "events": ["test-success"], "last_run": {"started_at": "2021-10-01T12:00:00Z", "completed_at": "2021-10-01T12:00:01Z", "phase": "Failed"}},
+  {"name": "foo-test-ui", "kind": "Pod", "events": ["test"], "last_run": {"started_at": "0001-01-01T00:00:00Z", "completed_at": "0001-01-01T00:00:00Z", "phase": ""}}
+]}`), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := helmTestSuite("foo", status.Hooks)
+	want := &xunitTestSuite{
+		Name:     "helm-test-foo",
+		Tests:    3,
+		Failures: 1,
+		Skipped:  1,
+		Time:     "4.500",
+		TestCases: []xunitTestCase{
+			{Name: "foo-test-connection", ClassName: "helm-test-foo", Time: "3.500"},
+			{Name: "foo-test-api", ClassName: "helm-test-foo", Time: "1.000", Failure: &xunitFailure{Message: "Pod foo-test-api failed"}},
+			{Name: "foo-test-ui", ClassName: "helm-test-foo", Time: "0.000", Skipped: &struct{}{}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("test suite mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -1,65 +1,59 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/fs"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/google/shlex"
-	"github.com/opendevstack/pipeline/internal/command"
+	"github.com/opendevstack/pipeline/internal/deploy"
 	"github.com/opendevstack/pipeline/internal/directory"
 	"github.com/opendevstack/pipeline/internal/file"
+	"github.com/opendevstack/pipeline/internal/helm"
 	k "github.com/opendevstack/pipeline/internal/kubernetes"
 	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
 	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
 	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"helm.sh/helm/v3/pkg/release"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	"sigs.k8s.io/yaml"
 )
 
 const (
-	tokenFile                   = "/var/run/secrets/kubernetes.io/serviceaccount/token"
-	helmBin                     = "helm"
 	kubernetesServiceaccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
 	// file path where to internally store the age-key-secret openshift secret content,
-	// required by helm secrets plugin.
+	// required to decrypt secrets files.
 	ageKeyFilePath = "./key.txt"
+	// default location of the chart, whose artifacts are not prefixed.
+	defaultChartDir = "chart"
 )
 
-// confusingHelmDiffMessage is the message Helm prints when helm-diff is
-// configured to exit with a non-zero exit code when drift is detected,
-// provided helm-secrets is also installed but no secrets are decrypted.
-const confusingHelmDiffMessage = `Error: identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)
-Error: plugin "diff" exited with error
-Error: plugin "secrets" exited with error`
-
-// confusingHelmDiffDecryptionMessage is like confusingHelmDiffMessage but occurs
-// when helm-secrets is required to decrypt secrets to perform the diff.
-const confusingHelmDiffDecryptionMessage = `Error: identified at least one change, exiting with non-zero exit code (detailed-exitcode parameter enabled)
-Error: plugin "diff" exited with error
-
-/usr/local/helm/plugins/helm-secrets/scripts/commands/helm.sh: line 34: xargs: command not found
-Error: plugin "secrets" exited with error`
-
 type options struct {
 	// Location of Helm chart directory.
 	chartDir string
 	// Name of Helm release.
 	releaseName string
-	// Flags to pass to `helm diff upgrade` (in addition to default ones).
+	// Flags of `helm diff upgrade` to apply when diffing the release.
 	diffFlags string
-	// Flags to pass to `helm upgrade`.
+	// Flags of `helm upgrade` to apply when upgrading the release.
 	upgradeFlags string
+	// Whether to roll back the release if the upgrade fails.
+	rollbackOnFailure bool
+	// Whether to wait for the rollout of the release.
+	verifyRollout bool
+	// How long to wait for the rollout of the release.
+	rolloutTimeout time.Duration
+	// Whether to run the tests of the release after the rollout.
+	helmTest bool
 	// Name of K8s secret holding the age key.
 	ageKeySecret string
 	// Field name within the K8s secret holding the age key.
@@ -68,6 +62,15 @@ type options struct {
 	certDir string
 	// Whether to TLS verify the source image registry.
 	srcRegistryTLSVerify bool
+	// Reason to deploy during a freeze window. Deployments during a freeze
+	// are refused if empty.
+	freezeOverrideReason string
+	// Name of the pipeline run, recorded in the deployment artifact.
+	pipelineRunName string
+	// Bitbucket URL, used to collect approvals.
+	bitbucketURL string
+	// Bitbucket access token, used to collect approvals.
+	bitbucketAccessToken string
 	// Whether to enable debug mode.
 	debug bool
 }
@@ -76,19 +79,36 @@ func main() {
 	opts := options{}
 	flag.StringVar(&opts.chartDir, "chart-dir", "", "Chart dir")
 	flag.StringVar(&opts.releaseName, "release-name", "", "Name of Helm release")
-	flag.StringVar(&opts.diffFlags, "diff-flags", "", "Flags to pass to `helm diff upgrade` (in addition to default ones)")
-	flag.StringVar(&opts.upgradeFlags, "upgrade-flags", "", "Flags to pass to `helm upgrade`")
-	flag.StringVar(&opts.ageKeySecret, "age-key-secret", "", "Name of the secret containing the age key to use for helm-secrets")
+	flag.StringVar(&opts.diffFlags, "diff-flags", "", "Flags of `helm diff upgrade` to apply when diffing the release")
+	flag.StringVar(&opts.upgradeFlags, "upgrade-flags", "", "Flags of `helm upgrade` to apply when upgrading the release")
+	flag.BoolVar(&opts.rollbackOnFailure, "rollback-on-failure", false, "Roll back the release to the previous revision if the upgrade fails")
+	flag.BoolVar(&opts.verifyRollout, "verify-rollout", true, "Wait for the rollout of the Deployments and StatefulSets of the release")
+	flag.DurationVar(&opts.rolloutTimeout, "rollout-timeout", 5*time.Minute, "How long to wait for the rollout of the release")
+	flag.BoolVar(&opts.helmTest, "helm-test", false, "Run the tests of the release after the rollout")
+	flag.StringVar(&opts.ageKeySecret, "age-key-secret", "", "Name of the secret containing the age key to decrypt secrets files")
 	flag.StringVar(&opts.ageKeySecretField, "age-key-secret-field", "key.txt", "Name of the field in the secret holding the age private key")
 	flag.StringVar(&opts.certDir, "cert-dir", "/etc/containers/certs.d", "Use certificates at the specified path to access the registry")
 	flag.BoolVar(&opts.srcRegistryTLSVerify, "src-registry-tls-verify", true, "TLS verify source registry")
+	flag.StringVar(&opts.freezeOverrideReason, "freeze-override-reason", "", "Reason to deploy during a freeze window")
+	flag.StringVar(&opts.pipelineRunName, "pipeline-run-name", os.Getenv("PIPELINE_RUN_NAME"), "Name of the pipeline run")
+	flag.StringVar(&opts.bitbucketURL, "bitbucket-url", os.Getenv("BITBUCKET_URL"), "bitbucket-url")
+	flag.StringVar(&opts.bitbucketAccessToken, "bitbucket-access-token", os.Getenv("BITBUCKET_ACCESS_TOKEN"), "bitbucket-access-token")
 	flag.BoolVar(&opts.debug, "debug", (os.Getenv("DEBUG") == "true"), "debug mode")
 	flag.Parse()
 
+	diffFlags, err := parseDiffFlags(opts.diffFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	upgradeOptions, err := parseUpgradeFlags(opts.upgradeFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	checkoutDir := "."
 
 	ctxt := &pipelinectxt.ODSContext{}
-	err := ctxt.ReadCache(checkoutDir)
+	err = ctxt.ReadCache(checkoutDir)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -123,36 +143,21 @@ func main() {
 		log.Fatal(fmt.Sprintf("err during namespace extraction: %s", err))
 	}
 
-	releaseNamespace := targetConfig.Namespace
-	if len(releaseNamespace) == 0 {
-		releaseNamespace = fmt.Sprintf("%s-%s", ctxt.Project, targetConfig.Name)
-	}
+	releaseNamespace := deploy.Namespace(ctxt.Project, targetConfig)
 	fmt.Printf("releaseNamespace=%s\n", releaseNamespace)
-
-	// Find subrepos
-	var subrepos []fs.FileInfo
-	if _, err := os.Stat(pipelinectxt.SubreposPath); err == nil {
-		f, err := ioutil.ReadDir(pipelinectxt.SubreposPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		subrepos = f
+	artifacts := deploy.Artifacts{
+		SourceDir:   opts.chartDir,
+		DefaultDir:  defaultChartDir,
+		Environment: targetConfig.Name,
 	}
 
-	// Find image artifacts.
-	var files []string
-	id, err := collectImageDigests(pipelinectxt.ImageDigestsPath)
+	subrepos, err := deploy.Subrepos()
 	if err != nil {
 		log.Fatal(err)
 	}
-	files = append(files, id...)
-	for _, s := range subrepos {
-		subrepoImageDigestsPath := filepath.Join(pipelinectxt.SubreposPath, s.Name(), pipelinectxt.ImageDigestsPath)
-		id, err := collectImageDigests(subrepoImageDigestsPath)
-		if err != nil {
-			log.Fatal(err)
-		}
-		files = append(files, id...)
+	imageArtifactFiles, err := deploy.ImageArtifactFiles(subrepos)
+	if err != nil {
+		log.Fatal(err)
 	}
 
 	clientset, err := k.NewInClusterClientset()
@@ -160,114 +165,51 @@ func main() {
 		log.Fatalf("could not create Kubernetes client: %s", err)
 	}
 
-	if targetConfig.APIServer != "" {
-		token, err := tokenFromSecret(clientset, ctxt.Namespace, targetConfig.APICredentialsSecret)
-		if err != nil {
-			log.Fatalf("could not get token from secret %s: %s", targetConfig.APICredentialsSecret, err)
-		}
-		targetConfig.APIToken = token
+	logger := &logging.LeveledLogger{Level: logging.LevelInfo}
+	err = deploy.CheckFreeze(clientset, deploy.FreezeOptions{
+		Namespace:        ctxt.Namespace,
+		Environment:      targetConfig,
+		CommitSHA:        ctxt.GitCommitSHA,
+		OverrideReason:   opts.freezeOverrideReason,
+		ArtifactFilename: artifacts.Filename("freeze-override") + ".json",
+	}, time.Now(), logger)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	// Copy images into release namespace if there are any image artifacts.
-	if len(files) > 0 {
-		// Get destination registry token from secret or file in pod.
-		var destRegistryToken string
-		if targetConfig.APIToken != "" {
-			destRegistryToken = targetConfig.APIToken
-		} else {
-			token, err := getTrimmedFileContent(tokenFile)
-			if err != nil {
-				log.Fatalf("could not get token from file %s: %s", tokenFile, err)
-			}
-			destRegistryToken = token
-		}
-
-		fmt.Println("Copying images into release namespace ...")
-		for _, artifactFile := range files {
-			var imageArtifact artifact.Image
-			artifactContent, err := ioutil.ReadFile(artifactFile)
-			if err != nil {
-				log.Fatalf("could not read image artifact file %s: %s", artifactFile, err)
-			}
-			err = json.Unmarshal(artifactContent, &imageArtifact)
-			if err != nil {
-				log.Fatalf(
-					"could not unmarshal image artifact file %s: %s.\nFile content:\n%s",
-					artifactFile, err, string(artifactContent),
-				)
-			}
-			imageStream := imageArtifact.Name
-			fmt.Printf("Copying image %s ...\n", imageStream)
-			srcImageURL := imageArtifact.Image
-			var destImageURL string
-			// If the source registry should be TLS verified, the destination
-			// should be verified by default as well.
-			destRegistryTLSVerify := opts.srcRegistryTLSVerify
-			srcRegistryTLSVerify := opts.srcRegistryTLSVerify
-			// TLS verification of the KinD registry is not possible at the moment as
-			// requests error out with "server gave HTTP response to HTTPS client".
-			if strings.HasPrefix(imageArtifact.Registry, "kind-registry.kind") {
-				srcRegistryTLSVerify = false
-			}
-			if len(targetConfig.RegistryHost) > 0 {
-				destImageURL = fmt.Sprintf("%s/%s/%s", targetConfig.RegistryHost, releaseNamespace, imageStream)
-				if targetConfig.RegistryTLSVerify != nil {
-					destRegistryTLSVerify = *targetConfig.RegistryTLSVerify
-				}
-			} else {
-				destImageURL = strings.Replace(imageArtifact.Image, "/"+imageArtifact.Repository+"/", "/"+releaseNamespace+"/", -1)
-			}
-			fmt.Printf("src=%s\n", srcImageURL)
-			fmt.Printf("dest=%s\n", destImageURL)
-			// TODO: for QA and PROD we want to ensure that the SHA recorded in Nexus
-			// matches the SHA referenced by the Git commit tag.
-			skopeoCopyArgs := []string{
-				"copy",
-				fmt.Sprintf("--src-tls-verify=%v", srcRegistryTLSVerify),
-				fmt.Sprintf("--dest-tls-verify=%v", destRegistryTLSVerify),
-			}
-			if srcRegistryTLSVerify {
-				skopeoCopyArgs = append(skopeoCopyArgs, fmt.Sprintf("--src-cert-dir=%v", opts.certDir))
-			}
-			if destRegistryTLSVerify {
-				skopeoCopyArgs = append(skopeoCopyArgs, fmt.Sprintf("--dest-cert-dir=%v", opts.certDir))
-			}
-			if len(destRegistryToken) > 0 {
-				skopeoCopyArgs = append(skopeoCopyArgs, "--dest-registry-token", destRegistryToken)
-			}
-			if opts.debug {
-				skopeoCopyArgs = append(skopeoCopyArgs, "--debug")
-			}
-			stdout, stderr, err := command.Run(
-				"skopeo", append(
-					skopeoCopyArgs,
-					fmt.Sprintf("docker://%s", srcImageURL),
-					fmt.Sprintf("docker://%s", destImageURL),
-				),
-			)
-			if err != nil {
-				fmt.Println(string(stderr))
-				log.Fatal(err)
-			}
-			fmt.Println(string(stdout))
-		}
+	err = deploy.SetAPIToken(clientset, ctxt.Namespace, targetConfig)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	fmt.Println("List Helm plugins...")
-	helmPluginArgs := []string{"plugin", "list"}
-	if opts.debug {
-		helmPluginArgs = append(helmPluginArgs, "--debug")
+	bitbucketClient := bitbucket.NewClient(&bitbucket.ClientConfig{
+		APIToken: opts.bitbucketAccessToken,
+		BaseURL:  opts.bitbucketURL,
+	})
+	err = deploy.WaitForApproval(bitbucketClient, deploy.ApprovalOptions{
+		Context:          ctxt,
+		Environment:      targetConfig,
+		ArtifactFilename: artifacts.Filename("approval") + ".json",
+	}, logger)
+	if err != nil {
+		log.Fatal(err)
 	}
-	stdout, stderr, err := command.Run(helmBin, helmPluginArgs)
+
+	// Copy images into release namespace if there are any image artifacts.
+	deployedImages, err := deploy.CopyImages(imageArtifactFiles, deploy.CopyImagesOptions{
+		Namespace:            releaseNamespace,
+		Environment:          targetConfig,
+		CertDir:              opts.certDir,
+		SrcRegistryTLSVerify: opts.srcRegistryTLSVerify,
+		Debug:                opts.debug,
+	}, logger)
 	if err != nil {
-		fmt.Println(string(stderr))
 		log.Fatal(err)
 	}
-	fmt.Println(string(stdout))
 
-	// Collect values to be set via the CLI.
-	cliValues := []string{
-		fmt.Sprintf("--set=image.tag=%s", ctxt.GitCommitSHA),
+	// Collect values to be set in addition to the values files.
+	setValues := []string{
+		fmt.Sprintf("image.tag=%s", ctxt.GitCommitSHA),
 	}
 
 	fmt.Println("Adding dependencies from subrepos into the charts/ directory ...")
@@ -294,11 +236,11 @@ func main() {
 		if err != nil {
 			log.Fatal(err)
 		}
-		cliValues = append(cliValues, fmt.Sprintf("--set=%s.image.tag=%s", hc.Name, gitCommitSHA))
+		setValues = append(setValues, fmt.Sprintf("%s.image.tag=%s", hc.Name, gitCommitSHA))
 		if releaseName == ctxt.Component {
-			cliValues = append(cliValues, fmt.Sprintf("--set=%s.fullnameOverride=%s", hc.Name, hc.Name))
+			setValues = append(setValues, fmt.Sprintf("%s.fullnameOverride=%s", hc.Name, hc.Name))
 		}
-		helmArchive, err := packageHelmChart(subchart, ctxt.Version, gitCommitSHA, opts.debug)
+		helmArchive, err := packageHelmChart(subchart, ctxt.Version, gitCommitSHA)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -322,7 +264,7 @@ func main() {
 	}
 
 	fmt.Println("Packaging Helm chart ...")
-	helmArchive, err := packageHelmChart(opts.chartDir, ctxt.Version, ctxt.GitCommitSHA, opts.debug)
+	helmArchive, err := packageHelmChart(opts.chartDir, ctxt.Version, ctxt.GitCommitSHA)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -351,84 +293,153 @@ func main() {
 	}
 
 	if len(opts.ageKeySecret) == 0 {
-		fmt.Println("Skipping import of age key for helm-secrets as parameter is not set ...")
+		fmt.Println("Skipping import of age key as parameter is not set ...")
 	} else {
-		fmt.Println("Storing age key for helm-secrets ...")
+		fmt.Println("Storing age key to decrypt secrets files ...")
 		secret, err := clientset.CoreV1().Secrets(ctxt.Namespace).Get(
 			context.TODO(), opts.ageKeySecret, metav1.GetOptions{},
 		)
 		if err != nil {
 			fmt.Printf("No secret %s found, skipping.\n", opts.ageKeySecret)
 		} else {
-			stderr, err = storeAgeKey(secret, opts.ageKeySecretField)
+			err = storeAgeKey(secret, opts.ageKeySecretField)
 			if err != nil {
-				fmt.Println(string(stderr))
 				log.Fatal(err)
 			}
 			fmt.Printf("Age key secret %s stored.\n", opts.ageKeySecret)
 		}
 	}
 
+	fmt.Println("Reading Helm values ...")
+	values, err := helm.ReadValues(valuesFiles, setValues)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	helmClient, err := helm.NewClient(&helm.ClientConfig{
+		Namespace: releaseNamespace,
+		APIServer: targetConfig.APIServer,
+		Token:     targetConfig.APIToken,
+		Debug:     opts.debug,
+		Logs:      os.Stdout,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	recovery := &releaseRecovery{
+		client:           helmClient,
+		releaseName:      releaseName,
+		releaseNamespace: releaseNamespace,
+		stuckAfter:       stuckReleaseThreshold(upgradeOptions.Timeout),
+	}
+	err = recovery.recoverStuckRelease(time.Now())
+	writeRollbackArtifact(recovery.rollbacks, artifacts)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fmt.Printf("Diffing Helm release against %s...\n", helmArchive)
-	helmDiffArgs := []string{
-		"--namespace=" + releaseNamespace,
-		"secrets",
-		"diff",
-		"upgrade",
-		"--detailed-exitcode",
-		"--no-color",
-	}
-	helmDiffFlags, err := shlex.Split(opts.diffFlags)
-	if err != nil {
-		log.Fatalf("could not parse diff flags (%s): %s", opts.diffFlags, err)
-	}
-	helmDiffArgs = append(helmDiffArgs, helmDiffFlags...)
-	for _, vf := range valuesFiles {
-		helmDiffArgs = append(helmDiffArgs, fmt.Sprintf("--values=%s", vf))
-	}
-	helmDiffArgs = append(helmDiffArgs, cliValues...)
-	helmDiffArgs = append(helmDiffArgs, releaseName, helmArchive)
-	stdout, stderr, err = runHelmCmd(helmDiffArgs, targetConfig, opts.debug)
-	if err == nil {
+	diff, changed, err := diffRelease(helmClient, releaseName, helmArchive, values, diffFlags)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !changed {
 		fmt.Println("no diff ...")
+		// Record the deployment nevertheless, so that the commit can be promoted.
+		revisions, err := recovery.history()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if current := latestRevision(revisions); current != nil {
+			record, err := deploymentRecord(
+				current, ctxt, targetConfig, deployedImages,
+				opts.chartDir, valuesFiles, setValues, opts.pipelineRunName, true,
+			)
+			if err != nil {
+				log.Fatal(err)
+			}
+			err = artifacts.WriteJSON("deployment", record)
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
 		os.Exit(0)
 	}
-	// Replace confusing stderr messages while still printing stderr in general
-	// to surface any other issues that might be logged there.
-	diffStderr := replaceConfusingHelmLogMessages(stderr)
-	fmt.Println(string(stdout))
-	fmt.Println(string(diffStderr))
-	err = writeDeploymentArtifact(stdout, "diff", opts.chartDir, targetConfig.Name)
+	fmt.Println(diff)
+	fmt.Println("Diff identified at least one change")
+	err = artifacts.WriteText("diff", []byte(diff))
 	if err != nil {
 		log.Fatal(err)
 	}
 
 	fmt.Printf("Upgrading Helm release to %s...\n", helmArchive)
-	helmUpgradeArgs := []string{
-		"--namespace=" + releaseNamespace,
-		"secrets",
-		"upgrade",
+	var baseRevision int
+	if opts.rollbackOnFailure {
+		baseRevision, err = recovery.currentRevision()
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	helmUpgradeFlags, err := shlex.Split(opts.upgradeFlags)
+	rel, err := helmClient.Upgrade(releaseName, helmArchive, values, *upgradeOptions)
 	if err != nil {
-		log.Fatalf("could not parse upgrade flags (%s): %s", opts.upgradeFlags, err)
+		if opts.rollbackOnFailure {
+			rollbackErr := recovery.recoverFailedUpgrade(baseRevision, err, time.Now())
+			writeRollbackArtifact(recovery.rollbacks, artifacts)
+			if rollbackErr != nil {
+				log.Fatalf("upgrade failed: %s. Rollback failed as well: %s", err, rollbackErr)
+			}
+		}
+		log.Fatalf("upgrade failed: %s", err)
 	}
-	helmUpgradeArgs = append(helmUpgradeArgs, helmUpgradeFlags...)
-	for _, vf := range valuesFiles {
-		helmUpgradeArgs = append(helmUpgradeArgs, fmt.Sprintf("--values=%s", vf))
+	summary := releaseSummary(rel)
+	fmt.Println(summary)
+	err = artifacts.WriteText("release", []byte(summary))
+	if err != nil {
+		log.Fatal(err)
 	}
-	helmUpgradeArgs = append(helmUpgradeArgs, cliValues...)
-	helmUpgradeArgs = append(helmUpgradeArgs, releaseName, helmArchive)
-	stdout, stderr, err = runHelmCmd(helmUpgradeArgs, targetConfig, opts.debug)
+	record, err := deploymentRecord(
+		rel, ctxt, targetConfig, deployedImages,
+		opts.chartDir, valuesFiles, setValues, opts.pipelineRunName, false,
+	)
 	if err != nil {
-		fmt.Println(string(stderr))
 		log.Fatal(err)
 	}
-	fmt.Println(string(stdout))
-	err = writeDeploymentArtifact(stdout, "release", opts.chartDir, targetConfig.Name)
+	err = artifacts.WriteJSON("deployment", record)
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	if opts.verifyRollout {
+		fmt.Printf("Verifying rollout of release %s ...\n", releaseName)
+		err = deploy.VerifyRollout(clientset, deploy.RolloutOptions{
+			Namespace:   releaseNamespace,
+			Environment: targetConfig,
+			Filter:      k.HelmReleaseFilter(releaseName),
+			Timeout:     opts.rolloutTimeout,
+		}, logger)
+		if err != nil {
+			if opts.rollbackOnFailure {
+				rollbackErr := recovery.recoverUnhealthyRelease(baseRevision, err, time.Now())
+				writeRollbackArtifact(recovery.rollbacks, artifacts)
+				if rollbackErr != nil {
+					log.Fatalf("rollout of release %s failed: %s. Rollback failed as well: %s", releaseName, err, rollbackErr)
+				}
+			}
+			log.Fatalf("rollout of release %s failed: %s", releaseName, err)
+		}
+		fmt.Printf("Release %s rolled out.\n", releaseName)
+	}
+
+	if opts.helmTest {
+		err = runHelmTest(
+			helmClient, releaseName,
+			artifacts.Filename("helm-test"),
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 }
 
 type helmChart struct {
@@ -457,88 +468,79 @@ func getChartVersion(contextVersion string, hc *helmChart) string {
 	return hc.Version
 }
 
-// replaceConfusingHelmLogMessages replaces confusing stderr messages with
-// easier to understand ones. The tests in ods-deploy-helm_test.go ensure this
-// still works when Helm is upgraded.
-func replaceConfusingHelmLogMessages(logs []byte) []byte {
-	cleaned := bytes.Replace(
-		logs,
-		[]byte(confusingHelmDiffMessage),
-		[]byte("plugin \"diff\" identified at least one change"),
-		1,
-	)
-	cleaned = bytes.Replace(
-		cleaned,
-		[]byte(confusingHelmDiffDecryptionMessage),
-		[]byte("plugin \"diff\" identified at least one change"),
-		1,
-	)
-	return cleaned
-}
-
-func artifactFilename(filename, chartDir, targetEnv string) string {
-	trimmedChartDir := strings.TrimPrefix(chartDir, "./")
-	if trimmedChartDir != "chart" {
-		filename = fmt.Sprintf("%s-%s", strings.Replace(trimmedChartDir, "/", "-", -1), filename)
+// writeRollbackArtifact writes the performed rollbacks, if any, as
+// deployment artifact. Errors are only reported as the deployment outcome
+// is more important.
+func writeRollbackArtifact(rollbacks []artifact.Rollback, artifacts deploy.Artifacts) {
+	if len(rollbacks) == 0 {
+		return
+	}
+	err := artifacts.WriteJSON("rollback", rollbacks)
+	if err != nil {
+		fmt.Printf("could not write rollback artifact: %s\n", err)
 	}
-	return fmt.Sprintf("%s-%s", filename, targetEnv)
 }
 
-func writeDeploymentArtifact(content []byte, filename, chartDir, targetEnv string) error {
-	err := os.MkdirAll(pipelinectxt.DeploymentsPath, 0755)
+// storeAgeKey writes the age key held by secret to ageKeyFilePath, from
+// where it is picked up to decrypt secrets files.
+func storeAgeKey(secret *corev1.Secret, ageKeySecretField string) error {
+	err := ioutil.WriteFile(ageKeyFilePath, secret.Data[ageKeySecretField], 0600)
 	if err != nil {
-		return err
+		return fmt.Errorf("could not store age key: %w", err)
 	}
-	f := artifactFilename(filename, chartDir, targetEnv) + ".txt"
-	return ioutil.WriteFile(filepath.Join(pipelinectxt.DeploymentsPath, f), content, 0644)
+	return os.Setenv("SOPS_AGE_KEY_FILE", ageKeyFilePath)
 }
 
-func storeAgeKey(secret *corev1.Secret, ageKeySecretField string) (errBytes []byte, err error) {
-	file, err := os.Create(ageKeyFilePath)
+// diffRelease renders the chart at chartPath without applying it and
+// compares the result with the latest revision of the release.
+func diffRelease(client helm.ClientInterface, releaseName, chartPath string, values map[string]interface{}, df *diffFlags) (string, bool, error) {
+	var current *release.Release
+	revisions, err := client.History(releaseName)
 	if err != nil {
-		return errBytes, err
+		if !errors.Is(err, helm.ErrReleaseNotFound) {
+			return "", false, fmt.Errorf("could not get history of release %s: %w", releaseName, err)
+		}
+		if !df.install {
+			return "", false, fmt.Errorf("release %s does not exist, add --install to the diff flags to diff against an empty release", releaseName)
+		}
+	} else {
+		current = latestRevision(revisions)
 	}
-	defer file.Close()
-	_, err = file.Write(secret.Data[ageKeySecretField])
+	next, err := client.Upgrade(releaseName, chartPath, values, helm.UpgradeOptions{
+		Install: df.install,
+		DryRun:  true,
+	})
 	if err != nil {
-		return errBytes, err
+		return "", false, fmt.Errorf("could not render release %s: %w", releaseName, err)
 	}
-	return errBytes, err
-}
-
-func runHelmCmd(args []string, targetConfig *config.Environment, debug bool) (outBytes, errBytes []byte, err error) {
-	if debug {
-		args = append([]string{"--debug"}, args...)
-	}
-	printableArgs := args
-	if targetConfig.APIServer != "" {
-		printableArgs = append(
-			[]string{
-				fmt.Sprintf("--kube-apiserver=%s", targetConfig.APIServer),
-				"--kube-token=***",
-			},
-			args...,
-		)
-		args = append(
-			[]string{
-				fmt.Sprintf("--kube-apiserver=%s", targetConfig.APIServer),
-				fmt.Sprintf("--kube-token=%s", targetConfig.APIToken),
-			},
-			args...,
-		)
+	diff, changed, err := helm.Diff(current, next, df.DiffOptions)
+	if err != nil {
+		return "", false, fmt.Errorf("could not diff release %s: %w", releaseName, err)
 	}
-	fmt.Println(helmBin, strings.Join(printableArgs, " "))
-
-	var extraEnvs = []string{fmt.Sprintf("SOPS_AGE_KEY_FILE=%s", ageKeyFilePath)}
-	return command.RunWithExtraEnvs(helmBin, args, extraEnvs)
+	return diff, changed, nil
 }
 
-func tokenFromSecret(clientset *kubernetes.Clientset, namespace, name string) (string, error) {
-	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
-	if err != nil {
-		return "", err
+// releaseSummary describes the release like `helm upgrade` does.
+func releaseSummary(rel *release.Release) string {
+	var sb strings.Builder
+	if rel.Version == 1 {
+		fmt.Fprintf(&sb, "Release %q does not exist. Installing it now.\n", rel.Name)
+	} else {
+		fmt.Fprintf(&sb, "Release %q has been upgraded. Happy Helming!\n", rel.Name)
+	}
+	fmt.Fprintf(&sb, "NAME: %s\n", rel.Name)
+	if rel.Info != nil {
+		if !rel.Info.LastDeployed.IsZero() {
+			fmt.Fprintf(&sb, "LAST DEPLOYED: %s\n", rel.Info.LastDeployed.Format(time.ANSIC))
+		}
+		fmt.Fprintf(&sb, "NAMESPACE: %s\n", rel.Namespace)
+		fmt.Fprintf(&sb, "STATUS: %s\n", rel.Info.Status.String())
+		fmt.Fprintf(&sb, "REVISION: %d\n", rel.Version)
+		if notes := strings.TrimSpace(rel.Info.Notes); notes != "" {
+			fmt.Fprintf(&sb, "NOTES:\n%s\n", notes)
+		}
 	}
-	return string(secret.Data["token"]), nil
+	return sb.String()
 }
 
 func getTrimmedFileContent(filename string) (string, error) {
@@ -549,43 +551,17 @@ func getTrimmedFileContent(filename string) (string, error) {
 	return strings.TrimSpace(string(content)), nil
 }
 
-func packageHelmChart(chartDir, ctxtVersion, gitCommitSHA string, debug bool) (string, error) {
+func packageHelmChart(chartDir, ctxtVersion, gitCommitSHA string) (string, error) {
 	hc, err := getHelmChart(filepath.Join(chartDir, "Chart.yaml"))
 	if err != nil {
 		return "", fmt.Errorf("could not read chart: %w", err)
 	}
 	chartVersion := getChartVersion(ctxtVersion, hc)
 	packageVersion := fmt.Sprintf("%s+%s", chartVersion, gitCommitSHA)
-	helmPackageArgs := []string{
-		"package",
-		fmt.Sprintf("--app-version=%s", gitCommitSHA),
-		fmt.Sprintf("--version=%s", packageVersion),
-	}
-	if debug {
-		helmPackageArgs = append(helmPackageArgs, "--debug")
-	}
-	stdout, stderr, err := command.Run(helmBin, append(helmPackageArgs, chartDir))
+	helmArchive, err := helm.Package(chartDir, packageVersion, gitCommitSHA, ".")
 	if err != nil {
-		return "", fmt.Errorf(
-			"could not package chart %s. stderr: %s, err: %s", chartDir, string(stderr), err,
-		)
+		return "", err
 	}
-	fmt.Println(string(stdout))
-
-	helmArchive := fmt.Sprintf("%s-%s.tgz", hc.Name, packageVersion)
+	fmt.Printf("Successfully packaged chart and saved it to: %s\n", helmArchive)
 	return helmArchive, nil
 }
-
-func collectImageDigests(imageDigestsDir string) ([]string, error) {
-	var files []string
-	if _, err := os.Stat(imageDigestsDir); err == nil {
-		f, err := ioutil.ReadDir(imageDigestsDir)
-		if err != nil {
-			return files, fmt.Errorf("could not read image digests dir: %w", err)
-		}
-		for _, fi := range f {
-			files = append(files, filepath.Join(imageDigestsDir, fi.Name()))
-		}
-	}
-	return files, nil
-}
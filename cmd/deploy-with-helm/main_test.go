@@ -2,52 +2,62 @@ package main
 
 import (
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
 )
 
-func TestArtifactFilename(t *testing.T) {
+func TestReleaseSummary(t *testing.T) {
+	lastDeployed := helmtime.Time{Time: time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)}
 	tests := map[string]struct {
-		filename  string
-		chartDir  string
-		targetEnv string
-		want      string
+		release *release.Release
+		want    string
 	}{
-		"default chart dir": {
-			filename:  "diff",
-			chartDir:  "./chart",
-			targetEnv: "foo-dev",
-			want:      "diff-foo-dev",
-		},
-		"default chart dir without prefix": {
-			filename:  "diff",
-			chartDir:  "chart",
-			targetEnv: "dev",
-			want:      "diff-dev",
-		},
-		"other chart dir": {
-			filename:  "diff",
-			chartDir:  "./foo-chart",
-			targetEnv: "qa",
-			want:      "foo-chart-diff-qa",
-		},
-		"other chart dir without prefix": {
-			filename:  "diff",
-			chartDir:  "bar-chart",
-			targetEnv: "foo-qa",
-			want:      "bar-chart-diff-foo-qa",
+		"install": {
+			release: &release.Release{
+				Name:      "foo",
+				Namespace: "foo-dev",
+				Version:   1,
+				Info:      &release.Info{Status: release.StatusDeployed, LastDeployed: lastDeployed},
+			},
+			want: `Release "foo" does not exist. Installing it now.
+NAME: foo
+LAST DEPLOYED: Fri Oct  1 12:00:00 2021
+NAMESPACE: foo-dev
+STATUS: deployed
+REVISION: 1
+`,
 		},
-		"nested chart dir": {
-			filename:  "diff",
-			chartDir:  "./some/path/chart",
-			targetEnv: "prod",
-			want:      "some-path-chart-diff-prod",
+		"upgrade with notes": {
+			release: &release.Release{
+				Name:      "foo",
+				Namespace: "foo-dev",
+				Version:   3,
+				Info: &release.Info{
+					Status:       release.StatusDeployed,
+					LastDeployed: lastDeployed,
+					Notes:        "Visit http://foo.example.com\n",
+				},
+			},
+			want: `Release "foo" has been upgraded. Happy Helming!
+NAME: foo
+LAST DEPLOYED: Fri Oct  1 12:00:00 2021
+NAMESPACE: foo-dev
+STATUS: deployed
+REVISION: 3
+NOTES:
+Visit http://foo.example.com
+`,
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			got := artifactFilename(tc.filename, tc.chartDir, tc.targetEnv)
-			if got != tc.want {
-				t.Fatalf("want: %s, got: %s", tc.want, got)
+			got := releaseSummary(tc.release)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("summary mismatch (-want +got):\n%s", diff)
 			}
 		})
 	}
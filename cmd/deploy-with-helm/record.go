@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/opendevstack/pipeline/internal/helm"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// deploymentRecord describes the deployed release for audit purposes. The
+// values of secrets files are redacted. Next to the given values files, the
+// values.yaml file of the chart is recorded if present. If the release
+// already matched the chart, rel is its latest revision and the record is
+// marked as unchanged.
+func deploymentRecord(rel *release.Release, ctxt *pipelinectxt.ODSContext, targetConfig *config.Environment, images []artifact.DeployedImage, chartDir string, valuesFiles, setValues []string, pipelineRun string, unchanged bool) (*artifact.Deployment, error) {
+	record := &artifact.Deployment{
+		Environment: targetConfig.Name,
+		Namespace:   rel.Namespace,
+		APIServer:   targetConfig.APIServer,
+		Release:     rel.Name,
+		Revision:    rel.Version,
+		CommitSHA:   ctxt.GitCommitSHA,
+		Images:      images,
+		ValuesFiles: []artifact.DeployedValuesFile{},
+		SetValues:   setValues,
+		PipelineRun: pipelineRun,
+		Unchanged:   unchanged,
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		record.Chart = rel.Chart.Metadata.Name
+		record.ChartVersion = rel.Chart.Metadata.Version
+		record.AppVersion = rel.Chart.Metadata.AppVersion
+	}
+	if rel.Info != nil {
+		record.Date = rel.Info.LastDeployed.UTC().Format(time.RFC3339)
+	}
+	files := valuesFiles
+	chartValues := filepath.Join(chartDir, "values.yaml")
+	if _, err := os.Stat(chartValues); err == nil {
+		files = append([]string{chartValues}, valuesFiles...)
+	}
+	for _, f := range files {
+		values, encrypted, err := helm.ReadRedactedValuesFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("could not record values file: %w", err)
+		}
+		record.ValuesFiles = append(record.ValuesFiles, artifact.DeployedValuesFile{
+			Path:      filepath.Clean(f),
+			Encrypted: encrypted,
+			Values:    values,
+		})
+	}
+	return record, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/internal/projectpath"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+func TestDeploymentRecord(t *testing.T) {
+	chartDir := filepath.Join(projectpath.Root, "test/testdata/workspaces/helm-sample-app/chart")
+	rel := &release.Release{
+		Name:      "foo",
+		Namespace: "foo-qa",
+		Version:   4,
+		Chart: &chart.Chart{Metadata: &chart.Metadata{
+			Name:       "helm-sample-app",
+			Version:    "1.0.0+abc123",
+			AppVersion: "abc123",
+		}},
+		Info: &release.Info{
+			LastDeployed: helmtime.Time{Time: time.Date(2021, 10, 1, 14, 0, 0, 0, time.FixedZone("CEST", 7200))},
+		},
+	}
+	images := []artifact.DeployedImage{
+		{Name: "foo", Image: "registry/foo-qa/foo:abc123", Digest: "sha256:1"},
+		{Name: "bar", Image: "registry/foo-qa/bar:def456", Digest: "sha256:2", Subrepo: "bar"},
+	}
+	got, err := deploymentRecord(
+		rel,
+		&pipelinectxt.ODSContext{GitCommitSHA: "abc123"},
+		&config.Environment{Name: "qa", APIServer: "https://api.example.com"},
+		images,
+		chartDir,
+		[]string{filepath.Join(chartDir, "secrets.yaml")},
+		[]string{"image.tag=abc123"},
+		"foo-abc123-xyz",
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ValuesFiles) != 2 {
+		t.Fatalf("want values.yaml and secrets.yaml, got: %v", got.ValuesFiles)
+	}
+	if got.ValuesFiles[0].Path != filepath.Join(chartDir, "values.yaml") || got.ValuesFiles[0].Encrypted {
+		t.Fatalf("want unencrypted values.yaml first, got: %s (encrypted: %v)", got.ValuesFiles[0].Path, got.ValuesFiles[0].Encrypted)
+	}
+	wantSecrets := artifact.DeployedValuesFile{
+		Path:      filepath.Join(chartDir, "secrets.yaml"),
+		Encrypted: true,
+		Values:    map[string]interface{}{"password": "++++++++"},
+	}
+	if diff := cmp.Diff(wantSecrets, got.ValuesFiles[1]); diff != "" {
+		t.Fatalf("secrets file mismatch (-want +got):\n%s", diff)
+	}
+	got.ValuesFiles = nil
+	want := &artifact.Deployment{
+		Environment:  "qa",
+		Namespace:    "foo-qa",
+		APIServer:    "https://api.example.com",
+		Release:      "foo",
+		Revision:     4,
+		Chart:        "helm-sample-app",
+		ChartVersion: "1.0.0+abc123",
+		AppVersion:   "abc123",
+		CommitSHA:    "abc123",
+		Images:       images,
+		SetValues:    []string{"image.tag=abc123"},
+		PipelineRun:  "foo-abc123-xyz",
+		Date:         "2021-10-01T12:00:00Z",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("record mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploymentRecordRedactsUnencryptedSecretsFile(t *testing.T) {
+	chartDir := filepath.Join(projectpath.Root, "test/testdata/fixtures/helm")
+	secretsFile := filepath.Join(chartDir, "secrets.dev.yaml")
+	got, err := deploymentRecord(
+		&release.Release{Name: "foo", Namespace: "foo-dev", Version: 1},
+		&pipelinectxt.ODSContext{GitCommitSHA: "abc123"},
+		&config.Environment{Name: "dev"},
+		nil,
+		chartDir,
+		[]string{secretsFile},
+		nil,
+		"foo-abc123-xyz",
+		false,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := artifact.DeployedValuesFile{
+		Path: secretsFile,
+		Values: map[string]interface{}{
+			"database": map[string]interface{}{"user": "++++++++", "password": "++++++++"},
+		},
+	}
+	if diff := cmp.Diff(want, got.ValuesFiles[len(got.ValuesFiles)-1]); diff != "" {
+		t.Fatalf("secrets file mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestDeploymentRecordUnchanged(t *testing.T) {
+	chartDir := filepath.Join(projectpath.Root, "test/testdata/fixtures/helm")
+	current := &release.Release{
+		Name:      "foo",
+		Namespace: "foo-dev",
+		Version:   3,
+		Info: &release.Info{
+			LastDeployed: helmtime.Time{Time: time.Date(2021, 9, 1, 12, 0, 0, 0, time.UTC)},
+		},
+	}
+	got, err := deploymentRecord(
+		current,
+		&pipelinectxt.ODSContext{GitCommitSHA: "def456"},
+		&config.Environment{Name: "dev"},
+		nil,
+		chartDir,
+		nil,
+		[]string{"image.tag=def456"},
+		"foo-def456-xyz",
+		true,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.ValuesFiles = nil
+	want := &artifact.Deployment{
+		Environment: "dev",
+		Namespace:   "foo-dev",
+		Release:     "foo",
+		Revision:    3,
+		CommitSHA:   "def456",
+		SetValues:   []string{"image.tag=def456"},
+		PipelineRun: "foo-def456-xyz",
+		Date:        "2021-09-01T12:00:00Z",
+		Unchanged:   true,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("record mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opendevstack/pipeline/internal/helm"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const (
+	// stuckReleaseAge is the minimum age after which a release in a
+	// pending-* state is considered stuck (e.g. because a previous deployment
+	// was interrupted) instead of being operated on by a concurrent
+	// deployment.
+	stuckReleaseAge = 15 * time.Minute
+	// stuckReleaseMargin is added to the upgrade timeout to account for the
+	// time a concurrent deployment needs before and after waiting.
+	stuckReleaseMargin = 5 * time.Minute
+)
+
+// stuckReleaseThreshold returns the age after which a pending release is
+// considered stuck. A concurrent deployment may keep the release pending
+// for as long as its upgrade timeout, so the threshold is at least the
+// upgrade timeout plus stuckReleaseMargin.
+func stuckReleaseThreshold(upgradeTimeout time.Duration) time.Duration {
+	if upgradeTimeout == 0 {
+		upgradeTimeout = helm.DefaultTimeout
+	}
+	if threshold := upgradeTimeout + stuckReleaseMargin; threshold > stuckReleaseAge {
+		return threshold
+	}
+	return stuckReleaseAge
+}
+
+// releaseRecovery rolls back or uninstalls a Helm release.
+type releaseRecovery struct {
+	client           helm.ClientInterface
+	releaseName      string
+	releaseNamespace string
+	// stuckAfter is the age after which a pending release is considered
+	// stuck, see stuckReleaseThreshold.
+	stuckAfter time.Duration
+	// rollbacks performed so far, written as deployment artifact.
+	rollbacks []artifact.Rollback
+}
+
+// history returns the revisions of the release. The history is empty if the
+// release does not exist.
+func (r *releaseRecovery) history() ([]*release.Release, error) {
+	revisions, err := r.client.History(r.releaseName)
+	if err != nil {
+		if errors.Is(err, helm.ErrReleaseNotFound) {
+			return []*release.Release{}, nil
+		}
+		return nil, fmt.Errorf("could not get history of release %s: %w", r.releaseName, err)
+	}
+	return revisions, nil
+}
+
+// recoverStuckRelease recovers the release if its latest revision has been
+// pending for longer than stuckAfter. A release pending for a shorter
+// time is reported as error as another deployment may be in progress.
+func (r *releaseRecovery) recoverStuckRelease(now time.Time) error {
+	revisions, err := r.history()
+	if err != nil {
+		return err
+	}
+	latest := latestRevision(revisions)
+	if latest == nil || !latest.Info.Status.IsPending() {
+		return nil
+	}
+	updated := latest.Info.LastDeployed.Time
+	if now.Sub(updated) < r.stuckAfter {
+		return fmt.Errorf(
+			"release %s is %s since %s, another deployment may be in progress",
+			r.releaseName, latest.Info.Status, updated.Format(time.RFC3339),
+		)
+	}
+	fmt.Printf("Release %s is stuck in %s since %s, recovering ...\n", r.releaseName, latest.Info.Status, updated.Format(time.RFC3339))
+	return r.rollback(revisions, fmt.Sprintf("release stuck in %s", latest.Info.Status), now)
+}
+
+// currentRevision returns the number of the latest revision of the release,
+// or 0 if the release does not exist.
+func (r *releaseRecovery) currentRevision() (int, error) {
+	revisions, err := r.history()
+	if err != nil {
+		return 0, err
+	}
+	if latest := latestRevision(revisions); latest != nil {
+		return latest.Version, nil
+	}
+	return 0, nil
+}
+
+// recoverFailedUpgrade recovers the release after a failed upgrade. Nothing
+// is done if the upgrade did not create a revision after baseRevision.
+func (r *releaseRecovery) recoverFailedUpgrade(baseRevision int, upgradeErr error, now time.Time) error {
+	revisions, err := r.history()
+	if err != nil {
+		return err
+	}
+	latest := latestRevision(revisions)
+	if latest == nil || latest.Version <= baseRevision {
+		fmt.Printf("Upgrade of release %s did not create a new revision, nothing to roll back.\n", r.releaseName)
+		return nil
+	}
+	// The release may have been rolled back already, e.g. due to --atomic.
+	if latest.Info.Status == release.StatusDeployed {
+		fmt.Printf("Release %s is deployed at revision %d, nothing to roll back.\n", r.releaseName, latest.Version)
+		return nil
+	}
+	return r.rollback(revisions, fmt.Sprintf("upgrade failed: %s", upgradeErr), now)
+}
+
+// recoverUnhealthyRelease recovers the release after the upgrade succeeded
+// but the release did not become healthy. Nothing is done if the upgrade did
+// not create a revision after baseRevision.
+func (r *releaseRecovery) recoverUnhealthyRelease(baseRevision int, verifyErr error, now time.Time) error {
+	revisions, err := r.history()
+	if err != nil {
+		return err
+	}
+	latest := latestRevision(revisions)
+	if latest == nil || latest.Version <= baseRevision {
+		fmt.Printf("Upgrade of release %s did not create a new revision, nothing to roll back.\n", r.releaseName)
+		return nil
+	}
+	return r.rollback(revisions, fmt.Sprintf("rollout verification failed: %s", verifyErr), now)
+}
+
+// rollback rolls the release back to the last deployed revision, or
+// uninstalls it if there is none.
+func (r *releaseRecovery) rollback(revisions []*release.Release, reason string, now time.Time) error {
+	latest := latestRevision(revisions)
+	if latest == nil {
+		return nil
+	}
+	record := artifact.Rollback{
+		Release:      r.releaseName,
+		Namespace:    r.releaseNamespace,
+		Reason:       reason,
+		FromRevision: latest.Version,
+		Date:         now.UTC().Format(time.RFC3339),
+	}
+	var err error
+	if previous := previousDeployedRevision(revisions, latest.Version); previous != nil {
+		fmt.Printf("Rolling back release %s to revision %d ...\n", r.releaseName, previous.Version)
+		record.ToRevision = previous.Version
+		err = r.client.Rollback(r.releaseName, previous.Version, helm.DefaultTimeout)
+	} else {
+		fmt.Printf("Release %s has no previous deployed revision, uninstalling ...\n", r.releaseName)
+		record.Uninstalled = true
+		err = r.client.Uninstall(r.releaseName)
+	}
+	if err != nil {
+		record.Error = err.Error()
+		r.rollbacks = append(r.rollbacks, record)
+		return fmt.Errorf("could not recover release %s: %w", r.releaseName, err)
+	}
+	r.rollbacks = append(r.rollbacks, record)
+	return nil
+}
+
+// latestRevision returns the revision with the highest number, or nil.
+func latestRevision(revisions []*release.Release) *release.Release {
+	var latest *release.Release
+	for _, rev := range revisions {
+		if latest == nil || rev.Version > latest.Version {
+			latest = rev
+		}
+	}
+	return latest
+}
+
+// previousDeployedRevision returns the highest revision below before which
+// has been deployed successfully, or nil.
+func previousDeployedRevision(revisions []*release.Release, before int) *release.Release {
+	var previous *release.Release
+	for _, rev := range revisions {
+		status := rev.Info.Status
+		if rev.Version >= before || (status != release.StatusDeployed && status != release.StatusSuperseded) {
+			continue
+		}
+		if previous == nil || rev.Version > previous.Version {
+			previous = rev
+		}
+	}
+	return previous
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/internal/helm"
+	"helm.sh/helm/v3/pkg/release"
+	helmtime "helm.sh/helm/v3/pkg/time"
+)
+
+func revision(version int, status release.Status, lastDeployed time.Time) *release.Release {
+	return &release.Release{
+		Name:    "foo",
+		Version: version,
+		Info: &release.Info{
+			Status:       status,
+			LastDeployed: helmtime.Time{Time: lastDeployed},
+		},
+	}
+}
+
+func TestPreviousDeployedRevision(t *testing.T) {
+	tests := map[string]struct {
+		revisions []*release.Release
+		want      int
+	}{
+		"failed upgrade": {
+			revisions: []*release.Release{
+				revision(1, release.StatusSuperseded, time.Time{}),
+				revision(2, release.StatusSuperseded, time.Time{}),
+				revision(3, release.StatusFailed, time.Time{}),
+			},
+			want: 2,
+		},
+		"stuck upgrade after failed upgrade": {
+			revisions: []*release.Release{
+				revision(1, release.StatusDeployed, time.Time{}),
+				revision(2, release.StatusFailed, time.Time{}),
+				revision(3, release.StatusPendingUpgrade, time.Time{}),
+			},
+			want: 1,
+		},
+		"failed install": {
+			revisions: []*release.Release{
+				revision(1, release.StatusFailed, time.Time{}),
+			},
+		},
+		"stuck install": {
+			revisions: []*release.Release{
+				revision(1, release.StatusPendingInstall, time.Time{}),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			latest := latestRevision(tc.revisions)
+			got := previousDeployedRevision(tc.revisions, latest.Version)
+			if tc.want == 0 {
+				if got != nil {
+					t.Fatalf("want no revision, got: %d", got.Version)
+				}
+				return
+			}
+			if got == nil || got.Version != tc.want {
+				t.Fatalf("want revision: %d, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestStuckReleaseThreshold(t *testing.T) {
+	tests := map[string]struct {
+		upgradeTimeout time.Duration
+		want           time.Duration
+	}{
+		"default timeout": {
+			upgradeTimeout: 0,
+			want:           stuckReleaseAge,
+		},
+		"short timeout": {
+			upgradeTimeout: 2 * time.Minute,
+			want:           stuckReleaseAge,
+		},
+		"long timeout": {
+			upgradeTimeout: 30 * time.Minute,
+			want:           35 * time.Minute,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := stuckReleaseThreshold(tc.upgradeTimeout)
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRecoverStuckRelease(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := map[string]struct {
+		revisions        []*release.Release
+		upgradeTimeout   time.Duration
+		wantErr          bool
+		wantRolledBackTo []int
+		wantUninstalled  []string
+	}{
+		"no release": {},
+		"deployed release": {
+			revisions: []*release.Release{
+				revision(1, release.StatusDeployed, now.Add(-time.Hour)),
+			},
+		},
+		"recently pending release": {
+			revisions: []*release.Release{
+				revision(1, release.StatusDeployed, now.Add(-time.Hour)),
+				revision(2, release.StatusPendingUpgrade, now.Add(-time.Minute)),
+			},
+			wantErr: true,
+		},
+		"stuck upgrade": {
+			revisions: []*release.Release{
+				revision(1, release.StatusSuperseded, now.Add(-2*time.Hour)),
+				revision(2, release.StatusDeployed, now.Add(-time.Hour)),
+				revision(3, release.StatusPendingUpgrade, now.Add(-30*time.Minute)),
+			},
+			wantRolledBackTo: []int{2},
+		},
+		"pending release within long upgrade timeout": {
+			revisions: []*release.Release{
+				revision(1, release.StatusDeployed, now.Add(-time.Hour)),
+				revision(2, release.StatusPendingUpgrade, now.Add(-16*time.Minute)),
+			},
+			upgradeTimeout: 30 * time.Minute,
+			wantErr:        true,
+		},
+		"stuck install": {
+			revisions: []*release.Release{
+				revision(1, release.StatusPendingInstall, now.Add(-30*time.Minute)),
+			},
+			wantUninstalled: []string{"foo"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &helm.TestClient{Releases: map[string][]*release.Release{}}
+			if tc.revisions != nil {
+				client.Releases["foo"] = tc.revisions
+			}
+			r := &releaseRecovery{
+				client:           client,
+				releaseName:      "foo",
+				releaseNamespace: "foo-dev",
+				stuckAfter:       stuckReleaseThreshold(tc.upgradeTimeout),
+			}
+			err := r.recoverStuckRelease(now)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantRolledBackTo, client.RolledBackTo); diff != "" {
+				t.Fatalf("rollbacks mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantUninstalled, client.Uninstalled); diff != "" {
+				t.Fatalf("uninstalls mismatch (-want +got):\n%s", diff)
+			}
+			wantRecords := len(tc.wantRolledBackTo) + len(tc.wantUninstalled)
+			if len(r.rollbacks) != wantRecords {
+				t.Fatalf("want %d rollback records, got: %d", wantRecords, len(r.rollbacks))
+			}
+		})
+	}
+}
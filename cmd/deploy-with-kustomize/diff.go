@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/opendevstack/pipeline/internal/manifest"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/yaml"
+)
+
+// lastAppliedAnnotation is set by client-side `kubectl apply`.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// objectApplier reads and applies objects, see k.Applier.
+type objectApplier interface {
+	Get(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error)
+	Apply(ctx context.Context, obj *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error)
+}
+
+// diffObjects compares the live state of objs and prunable with the state
+// objs would have after applying them, as reported by a server-side dry-run.
+// Secrets are redacted.
+func diffObjects(ctx context.Context, applier objectApplier, namespace string, objs, prunable []*unstructured.Unstructured) (string, bool, error) {
+	current := []*unstructured.Unstructured{}
+	next := []*unstructured.Unstructured{}
+	for _, obj := range objs {
+		live, err := applier.Get(ctx, obj)
+		if err != nil {
+			return "", false, err
+		}
+		if live != nil {
+			current = append(current, live)
+		}
+		dryRun, err := applier.Apply(ctx, obj, true)
+		if err != nil {
+			return "", false, err
+		}
+		next = append(next, dryRun)
+	}
+	current = append(current, prunable...)
+	currentManifest, err := manifestOf(current)
+	if err != nil {
+		return "", false, err
+	}
+	nextManifest, err := manifestOf(next)
+	if err != nil {
+		return "", false, err
+	}
+	return manifest.Diff(currentManifest, nextManifest, namespace, manifest.DiffOptions{
+		Context:         -1,
+		SuppressSecrets: true,
+	})
+}
+
+// manifestOf renders objs as multi-document YAML, without the fields
+// maintained by the server.
+func manifestOf(objs []*unstructured.Unstructured) (string, error) {
+	var sb strings.Builder
+	for _, obj := range objs {
+		out, err := yaml.Marshal(cleanObject(obj).Object)
+		if err != nil {
+			return "", fmt.Errorf("could not marshal %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		sb.WriteString("---\n")
+		sb.Write(out)
+	}
+	return sb.String(), nil
+}
+
+// cleanObject returns a copy of obj without status and the metadata
+// maintained by the server, which would otherwise show up in every diff.
+func cleanObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	c := obj.DeepCopy()
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp", "selfLink"} {
+		unstructured.RemoveNestedField(c.Object, "metadata", field)
+	}
+	unstructured.RemoveNestedField(c.Object, "metadata", "annotations", lastAppliedAnnotation)
+	if len(c.GetAnnotations()) == 0 {
+		unstructured.RemoveNestedField(c.Object, "metadata", "annotations")
+	}
+	unstructured.RemoveNestedField(c.Object, "status")
+	return c
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// fakeApplier returns the live objects keyed by name, and dry-runs by
+// returning the applied object with a server-maintained field added.
+type fakeApplier struct {
+	live map[string]*unstructured.Unstructured
+}
+
+func (a *fakeApplier) Get(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	return a.live[obj.GetName()], nil
+}
+
+func (a *fakeApplier) Apply(ctx context.Context, obj *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	applied := obj.DeepCopy()
+	applied.SetResourceVersion("2")
+	return applied, nil
+}
+
+func configMap(name, greeting string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": name},
+		"data":       map[string]interface{}{"greeting": greeting},
+	}}
+}
+
+func liveObject(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	live := obj.DeepCopy()
+	live.SetResourceVersion("1")
+	live.SetUID("abc")
+	live.SetAnnotations(map[string]string{lastAppliedAnnotation: "{}"})
+	live.Object["status"] = map[string]interface{}{"foo": "bar"}
+	return live
+}
+
+func TestDiffObjects(t *testing.T) {
+	secret := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]interface{}{"name": "old"},
+		"data":       map[string]interface{}{"password": "czNjcjN0"},
+	}}
+	tests := map[string]struct {
+		live        []*unstructured.Unstructured
+		objs        []*unstructured.Unstructured
+		prunable    []*unstructured.Unstructured
+		want        string
+		wantChanged bool
+	}{
+		"unchanged": {
+			live: []*unstructured.Unstructured{liveObject(configMap("foo", "hello"))},
+			objs: []*unstructured.Unstructured{configMap("foo", "hello")},
+		},
+		"changed, added and pruned": {
+			live:     []*unstructured.Unstructured{liveObject(configMap("foo", "hello"))},
+			objs:     []*unstructured.Unstructured{configMap("foo", "hi"), configMap("bar", "hello")},
+			prunable: []*unstructured.Unstructured{secret},
+			want: `foo-dev, bar, ConfigMap (v1) has been added:
++ apiVersion: v1
++ data:
++   greeting: hello
++ kind: ConfigMap
++ metadata:
++   name: bar
+foo-dev, foo, ConfigMap (v1) has changed:
+  apiVersion: v1
+  data:
+-   greeting: hello
++   greeting: hi
+  kind: ConfigMap
+  metadata:
+    name: foo
+foo-dev, old, Secret (v1) has been removed:
+- apiVersion: v1
+- data:
+-   password: ++++++++ # (8 bytes)
+- kind: Secret
+- metadata:
+-   name: old
+`,
+			wantChanged: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			applier := &fakeApplier{live: map[string]*unstructured.Unstructured{}}
+			for _, l := range tc.live {
+				applier.live[l.GetName()] = l
+			}
+			got, gotChanged, err := diffObjects(context.TODO(), applier, "foo-dev", tc.objs, tc.prunable)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotChanged != tc.wantChanged {
+				t.Fatalf("want changed: %v, got: %v", tc.wantChanged, gotChanged)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("diff mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/pipeline/internal/deploy"
+	"github.com/opendevstack/pipeline/internal/directory"
+	k "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/internal/kustomize"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	kubernetesServiceaccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// label identifying the objects of a deployment, used for pruning.
+	deploymentLabel = "pipeline.opendevstack.org/deployment"
+	// default location of the manifests, whose artifacts are not prefixed.
+	defaultManifestsDir = "deploy"
+)
+
+type options struct {
+	// Location of the manifests directory.
+	manifestsDir string
+	// Name of the deployment, used to select objects to prune.
+	deploymentName string
+	// Whether to delete objects of the deployment which are no longer rendered.
+	prune bool
+	// Whether to wait for the rollout of the deployment.
+	verifyRollout bool
+	// How long to wait for the rollout of the deployment.
+	rolloutTimeout time.Duration
+	// Reason to deploy during a freeze window. Deployments during a freeze
+	// are refused if empty.
+	freezeOverrideReason string
+	// Name of the pipeline run, recorded in the deployment artifact.
+	pipelineRunName string
+	// Bitbucket URL, used to collect approvals.
+	bitbucketURL string
+	// Bitbucket access token, used to collect approvals.
+	bitbucketAccessToken string
+	// Location of the certificate directory.
+	certDir string
+	// Whether to TLS verify the source image registry.
+	srcRegistryTLSVerify bool
+	// Whether to enable debug mode.
+	debug bool
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.manifestsDir, "manifests-dir", "./"+defaultManifestsDir, "Manifests dir")
+	flag.StringVar(&opts.deploymentName, "deployment-name", "", "Name of the deployment")
+	flag.BoolVar(&opts.prune, "prune", true, "Delete objects of the deployment which are no longer rendered")
+	flag.BoolVar(&opts.verifyRollout, "verify-rollout", true, "Wait for the rollout of the Deployments and StatefulSets of the deployment")
+	flag.DurationVar(&opts.rolloutTimeout, "rollout-timeout", 5*time.Minute, "How long to wait for the rollout of the deployment")
+	flag.StringVar(&opts.freezeOverrideReason, "freeze-override-reason", "", "Reason to deploy during a freeze window")
+	flag.StringVar(&opts.pipelineRunName, "pipeline-run-name", os.Getenv("PIPELINE_RUN_NAME"), "Name of the pipeline run")
+	flag.StringVar(&opts.bitbucketURL, "bitbucket-url", os.Getenv("BITBUCKET_URL"), "bitbucket-url")
+	flag.StringVar(&opts.bitbucketAccessToken, "bitbucket-access-token", os.Getenv("BITBUCKET_ACCESS_TOKEN"), "bitbucket-access-token")
+	flag.StringVar(&opts.certDir, "cert-dir", "/etc/containers/certs.d", "Use certificates at the specified path to access the registry")
+	flag.BoolVar(&opts.srcRegistryTLSVerify, "src-registry-tls-verify", true, "TLS verify source registry")
+	flag.BoolVar(&opts.debug, "debug", (os.Getenv("DEBUG") == "true"), "debug mode")
+	flag.Parse()
+
+	checkoutDir := "."
+
+	ctxt := &pipelinectxt.ODSContext{}
+	err := ctxt.ReadCache(checkoutDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(ctxt.Environment) == 0 {
+		fmt.Println("No environment to deploy to selected. Skipping deployment ...")
+		return
+	}
+
+	if _, err := os.Stat(kubernetesServiceaccountDir); err == nil {
+		opts.certDir = kubernetesServiceaccountDir
+	}
+	if opts.debug {
+		directory.ListFiles(opts.certDir)
+	}
+
+	deploymentName := opts.deploymentName
+	if len(deploymentName) == 0 {
+		deploymentName = ctxt.Component
+	}
+	fmt.Printf("deploymentName=%s\n", deploymentName)
+
+	odsConfig, err := config.ReadFromDir(checkoutDir)
+	if err != nil {
+		log.Fatalf("err during ods config reading: %s", err)
+	}
+	targetConfig, err := odsConfig.Environment(ctxt.Environment)
+	if err != nil {
+		log.Fatalf("err during namespace extraction: %s", err)
+	}
+	namespace := deploy.Namespace(ctxt.Project, targetConfig)
+	fmt.Printf("namespace=%s\n", namespace)
+	artifacts := deploy.Artifacts{
+		SourceDir:   opts.manifestsDir,
+		DefaultDir:  defaultManifestsDir,
+		Environment: targetConfig.Name,
+	}
+
+	subrepos, err := deploy.Subrepos()
+	if err != nil {
+		log.Fatal(err)
+	}
+	imageArtifactFiles, err := deploy.ImageArtifactFiles(subrepos)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clientset, err := k.NewInClusterClientset()
+	if err != nil {
+		log.Fatalf("could not create Kubernetes client: %s", err)
+	}
+	logger := &logging.LeveledLogger{Level: logging.LevelInfo}
+	err = deploy.CheckFreeze(clientset, deploy.FreezeOptions{
+		Namespace:        ctxt.Namespace,
+		Environment:      targetConfig,
+		CommitSHA:        ctxt.GitCommitSHA,
+		OverrideReason:   opts.freezeOverrideReason,
+		ArtifactFilename: artifacts.Filename("freeze-override") + ".json",
+	}, time.Now(), logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = deploy.SetAPIToken(clientset, ctxt.Namespace, targetConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	bitbucketClient := bitbucket.NewClient(&bitbucket.ClientConfig{
+		APIToken: opts.bitbucketAccessToken,
+		BaseURL:  opts.bitbucketURL,
+	})
+	err = deploy.WaitForApproval(bitbucketClient, deploy.ApprovalOptions{
+		Context:          ctxt,
+		Environment:      targetConfig,
+		ArtifactFilename: artifacts.Filename("approval") + ".json",
+	}, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	deployedImages, err := deploy.CopyImages(imageArtifactFiles, deploy.CopyImagesOptions{
+		Namespace:            namespace,
+		Environment:          targetConfig,
+		CertDir:              opts.certDir,
+		SrcRegistryTLSVerify: opts.srcRegistryTLSVerify,
+		Debug:                opts.debug,
+	}, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	overlay := kustomize.Overlay(opts.manifestsDir, targetConfig)
+	fmt.Printf("Rendering manifests of %s ...\n", overlay)
+	objs, err := kustomize.Render(overlay)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(objs) == 0 {
+		log.Fatalf("no objects rendered from %s", overlay)
+	}
+	err = kustomize.Customize(objs, kustomize.CustomizeOptions{
+		Labels: map[string]string{deploymentLabel: deploymentName},
+		Images: deployedImages,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	restConfig, err := k.NewRESTConfig(targetConfig.APIServer, targetConfig.APIToken)
+	if err != nil {
+		log.Fatalf("could not create Kubernetes config: %s", err)
+	}
+	applier, err := k.NewApplier(restConfig, namespace)
+	if err != nil {
+		log.Fatal(err)
+	}
+	selector := fmt.Sprintf("%s=%s", deploymentLabel, deploymentName)
+
+	fmt.Printf("Diffing %s against namespace %s ...\n", overlay, namespace)
+	ctx := context.Background()
+	var prunable []*unstructured.Unstructured
+	if opts.prune {
+		prunable, err = applier.Prunable(ctx, selector, objs)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	diff, changed, err := diffObjects(ctx, applier, namespace, objs, prunable)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !changed {
+		fmt.Println("no diff ...")
+		// Record the deployment nevertheless, so that the commit can be promoted.
+		record := deploymentRecord(ctxt, targetConfig, namespace, overlay, deployedImages, opts.pipelineRunName, time.Now(), true)
+		err = artifacts.WriteJSON("deployment", record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		os.Exit(0)
+	}
+	fmt.Println(diff)
+	fmt.Println("Diff identified at least one change")
+	err = artifacts.WriteText("diff", []byte(diff))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Applying %s to namespace %s ...\n", overlay, namespace)
+	var applied strings.Builder
+	for _, obj := range objs {
+		_, err := applier.Apply(ctx, obj, false)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&applied, "%s serverside-applied\n", k.ObjectRef(obj))
+	}
+	for _, obj := range prunable {
+		err := applier.Delete(ctx, obj)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(&applied, "%s pruned\n", k.ObjectRef(obj))
+	}
+	fmt.Print(applied.String())
+	err = artifacts.WriteText("apply", []byte(applied.String()))
+	if err != nil {
+		log.Fatal(err)
+	}
+	record := deploymentRecord(ctxt, targetConfig, namespace, overlay, deployedImages, opts.pipelineRunName, time.Now(), false)
+	err = artifacts.WriteJSON("deployment", record)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if opts.verifyRollout {
+		fmt.Printf("Verifying rollout of deployment %s ...\n", deploymentName)
+		err = deploy.VerifyRollout(clientset, deploy.RolloutOptions{
+			Namespace:   namespace,
+			Environment: targetConfig,
+			Filter:      k.LabelFilter(deploymentLabel, deploymentName),
+			Timeout:     opts.rolloutTimeout,
+		}, logger)
+		if err != nil {
+			log.Fatalf("rollout of deployment %s failed: %s", deploymentName, err)
+		}
+		fmt.Printf("Deployment %s rolled out.\n", deploymentName)
+	}
+}
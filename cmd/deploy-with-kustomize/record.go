@@ -0,0 +1,28 @@
+package main
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// deploymentRecord describes the applied manifests for audit purposes, and
+// marks the commit as deployed to the environment for promotions. If the
+// live objects already matched the manifests, the record is marked as
+// unchanged.
+func deploymentRecord(ctxt *pipelinectxt.ODSContext, targetConfig *config.Environment, namespace, overlay string, images []artifact.DeployedImage, pipelineRun string, deployed time.Time, unchanged bool) *artifact.Deployment {
+	return &artifact.Deployment{
+		Environment: targetConfig.Name,
+		Namespace:   namespace,
+		APIServer:   targetConfig.APIServer,
+		Manifests:   filepath.Clean(overlay),
+		CommitSHA:   ctxt.GitCommitSHA,
+		Images:      images,
+		PipelineRun: pipelineRun,
+		Date:        deployed.UTC().Format(time.RFC3339),
+		Unchanged:   unchanged,
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+func TestDeploymentRecord(t *testing.T) {
+	images := []artifact.DeployedImage{
+		{Name: "foo", Image: "registry/foo-qa/foo:abc123", Digest: "sha256:1"},
+	}
+	tests := map[string]struct {
+		unchanged bool
+	}{
+		"applied":   {unchanged: false},
+		"unchanged": {unchanged: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := deploymentRecord(
+				&pipelinectxt.ODSContext{GitCommitSHA: "abc123"},
+				&config.Environment{Name: "qa", APIServer: "https://api.example.com"},
+				"foo-qa",
+				"./deploy/overlays/qa",
+				images,
+				"foo-abc123-xyz",
+				time.Date(2021, 10, 1, 14, 0, 0, 0, time.FixedZone("CEST", 7200)),
+				tc.unchanged,
+			)
+			want := &artifact.Deployment{
+				Environment: "qa",
+				Namespace:   "foo-qa",
+				APIServer:   "https://api.example.com",
+				Manifests:   "deploy/overlays/qa",
+				CommitSHA:   "abc123",
+				Images:      images,
+				PipelineRun: "foo-abc123-xyz",
+				Date:        "2021-10-01T12:00:00Z",
+				Unchanged:   tc.unchanged,
+			}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("record mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
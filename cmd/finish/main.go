@@ -10,6 +10,7 @@ import (
 
 	"github.com/opendevstack/pipeline/internal/kubernetes"
 	"github.com/opendevstack/pipeline/internal/notification"
+	"github.com/opendevstack/pipeline/pkg/artifact"
 	"github.com/opendevstack/pipeline/pkg/bitbucket"
 	"github.com/opendevstack/pipeline/pkg/config"
 	"github.com/opendevstack/pipeline/pkg/logging"
@@ -17,13 +18,6 @@ import (
 	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
 )
 
-type PipelineRunArtifact struct {
-	// Name is the pipeline run name.
-	Name string `json:"name"`
-	// AggregateTaskStatus is the aggregate Tekton task status.
-	AggregateTaskStatus string `json:"aggregateTaskStatus"`
-}
-
 type options struct {
 	bitbucketAccessToken     string
 	bitbucketURL             string
@@ -253,7 +247,7 @@ func artifactGroup(ctxt *pipelinectxt.ODSContext, artifactsSubDir string, opts o
 }
 
 func createPipelineRunArtifact(checkoutDir string, pipelineRunName, aggregateTasksStatus string) error {
-	pra := PipelineRunArtifact{
+	pra := artifact.PipelineRunArtifact{
 		Name:                pipelineRunName,
 		AggregateTaskStatus: aggregateTasksStatus,
 	}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"expvar"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -17,28 +18,40 @@ import (
 	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
 	"github.com/opendevstack/pipeline/pkg/bitbucket"
 	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/nexus"
 	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 )
 
 const (
-	namespaceFile            = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
-	namespaceSuffix          = "-cd"
-	repoBaseEnvVar           = "REPO_BASE"
-	tokenEnvVar              = "ACCESS_TOKEN"
-	webhookSecretEnvVar      = "WEBHOOK_SECRET"
-	taskKindEnvVar           = "ODS_TASK_KIND"
-	taskKindDefault          = "Task"
-	taskSuffixEnvVar         = "ODS_TASK_SUFFIX"
-	storageProvisionerEnvVar = "ODS_STORAGE_PROVISIONER"
-	storageClassNameEnvVar   = "ODS_STORAGE_CLASS_NAME"
-	storageClassNameDefault  = "standard"
-	storageSizeEnvVar        = "ODS_STORAGE_SIZE"
-	storageSizeDefault       = "2Gi"
-	pruneMinKeepHoursEnvVar  = "ODS_PRUNE_MIN_KEEP_HOURS"
-	pruneMinKeepHoursDefault = 48
-	pruneMaxKeepRunsEnvVar   = "ODS_PRUNE_MAX_KEEP_RUNS"
-	pruneMaxKeepRunsDefault  = 20
-	initialWatchWait         = 10 * time.Second
+	namespaceFile                  = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	namespaceSuffix                = "-cd"
+	repoBaseEnvVar                 = "REPO_BASE"
+	tokenEnvVar                    = "ACCESS_TOKEN"
+	webhookSecretEnvVar            = "WEBHOOK_SECRET"
+	taskKindEnvVar                 = "ODS_TASK_KIND"
+	taskKindDefault                = "Task"
+	taskSuffixEnvVar               = "ODS_TASK_SUFFIX"
+	storageProvisionerEnvVar       = "ODS_STORAGE_PROVISIONER"
+	storageClassNameEnvVar         = "ODS_STORAGE_CLASS_NAME"
+	storageClassNameDefault        = "standard"
+	storageSizeEnvVar              = "ODS_STORAGE_SIZE"
+	storageSizeDefault             = "2Gi"
+	pruneMinKeepHoursEnvVar        = "ODS_PRUNE_MIN_KEEP_HOURS"
+	pruneMinKeepHoursDefault       = 48
+	pruneMaxKeepRunsEnvVar         = "ODS_PRUNE_MAX_KEEP_RUNS"
+	pruneMaxKeepRunsDefault        = 20
+	pruneDryRunEnvVar              = "ODS_PRUNE_DRY_RUN"
+	nexusURLEnvVar                 = "NEXUS_URL"
+	nexusUsernameEnvVar            = "NEXUS_USERNAME"
+	nexusPasswordEnvVar            = "NEXUS_PASSWORD"
+	nexusPermanentRepositoryEnvVar = "NEXUS_PERMANENT_REPOSITORY"
+	serviceAccountNameEnvVar       = "ODS_SERVICE_ACCOUNT_NAME"
+	serviceAccountNameDefault      = "pipeline"
+	allowedServiceAccountsEnvVar   = "ODS_ALLOWED_SERVICE_ACCOUNTS"
+	allowedPodTemplateFieldsEnvVar = "ODS_ALLOWED_POD_TEMPLATE_FIELDS"
+	workspaceMaxIdleDaysEnvVar     = "ODS_WORKSPACE_MAX_IDLE_DAYS"
+	workspaceMaxIdleDaysDefault    = 0
+	initialWatchWait               = 10 * time.Second
 	// Allow a few concurrent pipeline triggers before blocking.
 	channelBufferSize = 5
 )
@@ -88,6 +101,12 @@ func serve() error {
 
 	storageSize := readStringFromEnvVar(storageSizeEnvVar, storageSizeDefault)
 
+	serviceAccountName := readStringFromEnvVar(serviceAccountNameEnvVar, serviceAccountNameDefault)
+
+	allowedServiceAccounts := readStringSliceFromEnvVar(allowedServiceAccountsEnvVar)
+
+	allowedPodTemplateFields := readStringSliceFromEnvVar(allowedPodTemplateFieldsEnvVar)
+
 	pruneMinKeepHours, err := readIntFromEnvVar(
 		pruneMinKeepHoursEnvVar, pruneMinKeepHoursDefault,
 	)
@@ -101,6 +120,15 @@ func serve() error {
 		return err
 	}
 
+	pruneDryRun := readStringFromEnvVar(pruneDryRunEnvVar, "false") == "true"
+
+	workspaceMaxIdleDays, err := readIntFromEnvVar(
+		workspaceMaxIdleDaysEnvVar, workspaceMaxIdleDaysDefault,
+	)
+	if err != nil {
+		return err
+	}
+
 	namespace, err := getFileContent(namespaceFile)
 	if err != nil {
 		return err
@@ -156,18 +184,66 @@ func serve() error {
 			ClassName:   storageClassName,
 			Size:        storageSize,
 		},
+		RunSpecConfig: manager.RunSpecConfig{
+			DefaultServiceAccountName: serviceAccountName,
+			AllowedServiceAccounts:    allowedServiceAccounts,
+			AllowedPodTemplateFields:  allowedPodTemplateFields,
+		},
 	}
 	go s.Run(ctx)
 
+	// Initialize archiver if Nexus is configured.
+	var archiver *manager.Archiver
+	if nexusURL := os.Getenv(nexusURLEnvVar); nexusURL != "" {
+		nexusClient, err := nexus.NewClient(&nexus.ClientConfig{
+			BaseURL:  nexusURL,
+			Username: os.Getenv(nexusUsernameEnvVar),
+			Password: os.Getenv(nexusPasswordEnvVar),
+			Logger:   logger,
+		})
+		if err != nil {
+			return err
+		}
+		archiver = &manager.Archiver{
+			KubernetesClient: kClient,
+			NexusClient:      nexusClient,
+			NexusRepository:  readStringFromEnvVar(nexusPermanentRepositoryEnvVar, nexus.PermanentRepositoryDefault),
+			Project:          project,
+			Logger:           logger,
+		}
+	} else {
+		logger.Warnf("%s is not set, pipeline runs will be pruned without archiving them.", nexusURLEnvVar)
+	}
+
 	p := &manager.Pruner{
-		TriggeredRepos: triggeredReposChan,
-		TektonClient:   tClient,
-		Logger:         logger,
-		MinKeepHours:   pruneMinKeepHours,
-		MaxKeepRuns:    pruneMaxKeepRuns,
+		TriggeredRepos:   triggeredReposChan,
+		TektonClient:     tClient,
+		KubernetesClient: kClient,
+		Logger:           logger,
+		MinKeepHours:     pruneMinKeepHours,
+		MaxKeepRuns:      pruneMaxKeepRuns,
+		DryRun:           pruneDryRun,
+		Archiver:         archiver,
+		WebhookSecret:    webhookSecret,
 	}
 	go p.Run(ctx)
 
+	wm := &manager.WorkspaceManager{
+		KubernetesClient: kClient,
+		TektonClient:     tClient,
+		BitbucketClient:  bitbucketClient,
+		Logger:           logger,
+		StorageConfig: manager.StorageConfig{
+			Provisioner: storageProvisioner,
+			ClassName:   storageClassName,
+			Size:        storageSize,
+		},
+		WebhookSecret: webhookSecret,
+		Project:       project,
+		MaxIdleDays:   workspaceMaxIdleDays,
+	}
+	go wm.Run(ctx)
+
 	w := &manager.Watcher{
 		PendingRunRepos: pendingRunReposChan,
 		Queues:          map[string]bool{},
@@ -200,6 +276,11 @@ func serve() error {
 	mux := http.NewServeMux()
 	mux.Handle("/health", http.HandlerFunc(health))
 	mux.Handle("/bitbucket", http.HandlerFunc(r.Handle))
+	mux.Handle("/promote", http.HandlerFunc(r.HandlePromote))
+	mux.Handle("/workspace/reset", http.HandlerFunc(wm.HandleReset))
+	mux.Handle("/prune", http.HandlerFunc(p.HandlePrune))
+	mux.Handle("/prune/status", manager.RequireSignature(webhookSecret, logger, http.HandlerFunc(p.HandleStatus)))
+	mux.Handle("/debug/vars", manager.RequireSignature(webhookSecret, logger, expvar.Handler()))
 	logger.Infof("Ready to accept requests!")
 	return http.ListenAndServe(":8080", mux)
 }
@@ -248,3 +329,13 @@ func readStringFromEnvVar(envVar, fallback string) string {
 	}
 	return val
 }
+
+func readStringSliceFromEnvVar(envVar string) []string {
+	val := []string{}
+	for _, s := range strings.Split(os.Getenv(envVar), ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			val = append(val, s)
+		}
+	}
+	return val
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -8,10 +9,13 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/opendevstack/pipeline/internal/checkout"
 	"github.com/opendevstack/pipeline/internal/command"
 	"github.com/opendevstack/pipeline/internal/repository"
+	"github.com/opendevstack/pipeline/pkg/artifact"
 	"github.com/opendevstack/pipeline/pkg/bitbucket"
 	"github.com/opendevstack/pipeline/pkg/config"
 	"github.com/opendevstack/pipeline/pkg/logging"
@@ -19,6 +23,10 @@ import (
 	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
 )
 
+// releaseTagFile holds the release tag created by ods-start (empty if none).
+// It is exposed as task result so that the pruner keeps the pipeline run.
+const releaseTagFile = pipelinectxt.BaseDir + "/release-tag"
+
 type options struct {
 	bitbucketAccessToken     string
 	bitbucketURL             string
@@ -40,6 +48,8 @@ type options struct {
 	noProxy                  string
 	url                      string
 	gitFullRef               string
+	gitCommitSHA             string
+	promoteFrom              string
 	sslVerify                string
 	submodules               string
 	depth                    string
@@ -62,6 +72,8 @@ func main() {
 	flag.StringVar(&opts.noProxy, "no-proxy", ".", "NO_PROXY")
 	flag.StringVar(&opts.url, "url", ".", "URL to clone")
 	flag.StringVar(&opts.gitFullRef, "git-full-ref", "", "Git (full) ref to clone")
+	flag.StringVar(&opts.gitCommitSHA, "git-commit-sha", "", "(optional) Git commit SHA to clone instead of the head of the Git ref")
+	flag.StringVar(&opts.promoteFrom, "promote-from", "", "(optional) environment the commit is promoted from")
 	flag.StringVar(&opts.sslVerify, "ssl-verify", "true", "defines if http.sslVerify should be set to true or false in the global git config")
 	flag.StringVar(&opts.submodules, "submodules", "true", "defines if the resource should initialize and fetch the submodules")
 	flag.StringVar(&opts.depth, "depth", "1", "performs a shallow clone where only the most recent commit(s) will be fetched")
@@ -124,9 +136,14 @@ func main() {
 		PullRequestBase: opts.prBase,
 		PullRequestKey:  opts.prKey,
 	}
+	revision := opts.gitFullRef
+	if opts.gitCommitSHA != "" {
+		revision = opts.gitCommitSHA
+	}
 	ctxt, err := checkoutAndAssembleContext(
 		checkoutDir,
 		opts.url,
+		revision,
 		opts.gitFullRef,
 		opts.gitRefSpec,
 		opts.sslVerify,
@@ -168,59 +185,30 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	subrepoContexts := []*pipelinectxt.ODSContext{}
-	if len(odsConfig.Repositories) > 0 {
-		logger.Infof("Detected subrepos, checking out subrepos ...")
-		for _, subrepo := range odsConfig.Repositories {
-			subrepoCheckoutDir := filepath.Join(pipelinectxt.SubreposPath, subrepo.Name)
-			err = os.MkdirAll(subrepoCheckoutDir, 0755)
-			if err != nil {
-				log.Fatalf("could not create checkout dir for subrepo %s: %s", subrepo.Name, err)
-			}
-			subrepoURL := subrepo.URL
-			if len(subrepoURL) == 0 {
-				subrepoURL = strings.Replace(
-					opts.url,
-					fmt.Sprintf("/%s.git", ctxt.Repository),
-					fmt.Sprintf("/%s.git", subrepo.Name),
-					1,
-				)
-			}
-			subrepoGitFullRef, err := repository.BestMatchingBranch(bitbucketClient, ctxt.Project, subrepo, ctxt.Version)
-			if err != nil {
-				log.Fatal(err)
-			}
-			subrepoCtxt, err := checkoutAndAssembleContext(
-				subrepoCheckoutDir,
-				subrepoURL,
-				subrepoGitFullRef,
-				opts.gitRefSpec,
-				opts.sslVerify,
-				opts.submodules,
-				opts.depth,
-				baseCtxt,
-				logger,
-			)
-			if err != nil {
-				log.Fatal(err)
-			}
-			subrepoContexts = append(subrepoContexts, subrepoCtxt)
-		}
-	}
-
+	var env *config.Environment
 	if ctxt.Environment != "" {
-		env, err := odsConfig.Environment(ctxt.Environment)
+		env, err = odsConfig.Environment(ctxt.Environment)
 		if err != nil {
 			log.Fatal(fmt.Sprintf("err during namespace extraction: %s", err))
 		}
-		err = applyVersionTags(logger, bitbucketClient, ctxt, subrepoContexts, env)
+	}
+	tagScheme := repository.NewTagScheme(odsConfig.ReleaseTags)
+	if odsConfig.Versioning == config.VersioningAuto && ctxt.Version == pipelinectxt.WIP &&
+		env != nil && env.Stage != config.DevStage {
+		logger.Infof("Computing version from release tags and commit messages ...")
+		version, err := repository.NextVersion(bitbucketClient, ctxt.Project, ctxt.Repository, ctxt.GitCommitSHA, tagScheme)
+		if err != nil {
+			log.Fatal(fmt.Sprintf("could not compute version: %s", err))
+		}
+		logger.Infof("Computed version %s.", version)
+		ctxt.Version = version
+		baseCtxt.Version = version
+		err = ctxt.WriteCache(checkoutDir)
 		if err != nil {
 			log.Fatal(err)
 		}
 	}
 
-	logger.Infof("Downloading any artifacts ...")
-	// If there are subrepos, then all of them need to have a successful pipeline run.
 	nexusClient, err := nexus.NewClient(&nexus.ClientConfig{
 		BaseURL:  opts.nexusURL,
 		Username: opts.nexusUsername,
@@ -230,83 +218,144 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	err = downloadArtifacts(logger, nexusClient, ctxt, opts, pipelinectxt.ArtifactsPath)
+	artifactsDownloaded := false
+	if opts.promoteFrom != "" {
+		// Verify before tagging so that failed promotions leave no traces.
+		logger.Infof("Downloading artifacts of commit %s to promote ...", ctxt.GitCommitSHA)
+		am, err := downloadArtifacts(logger, nexusClient, ctxt, opts, pipelinectxt.ArtifactsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = verifyPromotion(logger, ctxt, am, opts.promoteFrom)
+		if err != nil {
+			log.Fatal(err)
+		}
+		artifactsDownloaded = true
+		if len(odsConfig.Repositories) > 0 {
+			// Check out the subrepo commits the promoted commit was built with.
+			odsConfig.Repositories, err = lockedSubrepos(odsConfig.Repositories, filepath.Join(checkoutDir, pipelinectxt.SubrepoLockPath))
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	subrepoContexts := []*pipelinectxt.ODSContext{}
+	if len(odsConfig.Repositories) > 0 {
+		logger.Infof("Detected subrepos, checking out subrepos ...")
+		subrepoContexts, err = checkoutSubrepos(logger, bitbucketClient, ctxt, baseCtxt, odsConfig.Repositories, opts)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	var releaseTag string
+	if env != nil {
+		releaseTag, err = applyVersionTags(logger, bitbucketClient, ctxt, subrepoContexts, env, tagScheme)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	err = ioutil.WriteFile(filepath.Join(checkoutDir, releaseTagFile), []byte(releaseTag), 0644)
 	if err != nil {
 		log.Fatal(err)
 	}
+	var releaseNotes *artifact.ReleaseNotes
+	if releaseTag != "" {
+		logger.Infof("Collecting release notes for %s ...", releaseTag)
+		releaseNotes, err = collectReleaseNotes(bitbucketClient, ctxt, subrepoContexts, tagScheme, releaseTag, opts.bitbucketURL)
+		if err != nil {
+			// The tag has been created already, so do not fail the run.
+			logger.Warnf("Could not collect release notes: %s", err)
+		}
+	}
+
+	if !artifactsDownloaded {
+		logger.Infof("Downloading any artifacts ...")
+		_, err = downloadArtifacts(logger, nexusClient, ctxt, opts, pipelinectxt.ArtifactsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
 	if len(subrepoContexts) > 0 {
-		for _, src := range subrepoContexts {
-			artifactsDir := filepath.Join(pipelinectxt.SubreposPath, src.Repository, pipelinectxt.ArtifactsPath)
-			err = downloadArtifacts(logger, nexusClient, src, opts, artifactsDir)
-			if err != nil {
-				log.Fatal(err)
-			}
-			// check that a pipeline run exists
-			// TODO: actually check for success.
-			pipelineRunDir := filepath.Join(artifactsDir, pipelinectxt.PipelineRunsDir)
-			if _, err := os.Stat(pipelineRunDir); os.IsNotExist(err) {
-				log.Fatalf(
-					"Pipeline runs with subrepos require a successful pipeline run "+
-						"for all checked out subrepo commits, "+
-						"however no such run was found for %s. "+
-						"Re-run this pipeline once there is a successful pipeline run.", src.Repository,
-				)
-			}
+		// Written after downloading artifacts to replace any lock of a
+		// previous run of the same commit.
+		lock := subrepoLock(odsConfig.Repositories, subrepoContexts)
+		err = pipelinectxt.WriteJsonArtifact(lock, filepath.Join(checkoutDir, pipelinectxt.SubrepoLockPath), pipelinectxt.SubrepoLockFilename)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if releaseNotes != nil {
+		// Written after downloading artifacts for the same reason as the lock.
+		err = writeReleaseNotes(filepath.Join(checkoutDir, pipelinectxt.ReleaseNotesPath), releaseNotes)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if len(subrepoContexts) > 0 {
+		// If there are subrepos, then all of them need to have a successful pipeline run.
+		err = downloadSubrepoArtifacts(logger, nexusClient, subrepoContexts, opts)
+		if err != nil {
+			log.Fatal(err)
 		}
 	}
 }
 
-func applyVersionTags(logger logging.LeveledLoggerInterface, bitbucketClient *bitbucket.Client, ctxt *pipelinectxt.ODSContext, subrepoContexts []*pipelinectxt.ODSContext, env *config.Environment) error {
+// applyVersionTags applies version tags for QA and prod stages, returning the
+// tag created (if any).
+func applyVersionTags(logger logging.LeveledLoggerInterface, bitbucketClient *bitbucket.Client, ctxt *pipelinectxt.ODSContext, subrepoContexts []*pipelinectxt.ODSContext, env *config.Environment, tagScheme *repository.TagScheme) (string, error) {
 	var tags []bitbucket.Tag
 	tagVersion := ctxt.Version
 	if env.Stage != config.DevStage {
 		logger.Infof("Applying version tags ...")
 		if tagVersion == pipelinectxt.WIP {
-			return errors.New("when stage != dev, you must provide a version")
+			return "", errors.New("when stage != dev, you must provide a version or set versioning to auto")
 		}
 		t, err := bitbucketClient.TagList(
 			ctxt.Project,
 			ctxt.Repository,
 			bitbucket.TagListParams{
-				FilterText: fmt.Sprintf("v%s", tagVersion),
+				FilterText: tagScheme.FilterText(tagVersion),
 			},
 		)
 		if err != nil {
-			return fmt.Errorf("could not list tags in %s/%s: %w", ctxt.Project, ctxt.Repository, err)
+			return "", fmt.Errorf("could not list tags in %s/%s: %w", ctxt.Project, ctxt.Repository, err)
 		}
 		tags = t.Values
 	}
 	if env.Stage == config.QAStage {
-		if repository.TagListContainsFinalVersion(tags, tagVersion) {
+		if repository.TagListContainsFinalVersion(tags, tagScheme, tagVersion) {
 			logger.Infof("Final version tag exists already.")
 		} else {
-			_, num := repository.LatestReleaseCandidate(tags, tagVersion)
+			_, num := repository.LatestReleaseCandidate(tags, tagScheme, tagVersion)
 			rcNum := num + 1
-			tagName := fmt.Sprintf("v%s-rc.%d", tagVersion, rcNum)
+			tagName := tagScheme.CandidateTag(tagVersion, rcNum, ctxt.GitCommitSHA)
 			_, err := repository.CreateTag(bitbucketClient, ctxt, tagName)
 			if err != nil {
-				return fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, ctxt.Project, ctxt.Repository, err)
+				return "", fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, ctxt.Project, ctxt.Repository, err)
 			}
 			// subrepos
 			for _, sctxt := range subrepoContexts {
 				_, err := repository.CreateTag(bitbucketClient, sctxt, tagName)
 				if err != nil {
-					return fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, sctxt.Project, sctxt.Repository, err)
+					return "", fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, sctxt.Project, sctxt.Repository, err)
 				}
 			}
+			return tagName, nil
 		}
 	} else if env.Stage == config.ProdStage {
-		if repository.TagListContainsFinalVersion(tags, tagVersion) {
+		if repository.TagListContainsFinalVersion(tags, tagScheme, tagVersion) {
 			logger.Infof("Final version tag exists already.")
 		} else {
-			err := checkProdTagRequirements(tags, ctxt, tagVersion)
+			err := checkProdTagRequirements(tags, ctxt, tagScheme, tagVersion)
 			if err != nil {
-				return fmt.Errorf("cannot proceed to prod stage: %w", err)
+				return "", fmt.Errorf("cannot proceed to prod stage: %w", err)
 			}
-			tagName := fmt.Sprintf("v%s", tagVersion)
+			tagName := tagScheme.FinalTag(tagVersion, ctxt.GitCommitSHA)
 			_, err = repository.CreateTag(bitbucketClient, ctxt, tagName)
 			if err != nil {
-				return fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, ctxt.Project, ctxt.Repository, err)
+				return "", fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, ctxt.Project, ctxt.Repository, err)
 			}
 			// subrepos
 			for _, sctxt := range subrepoContexts {
@@ -315,29 +364,69 @@ func applyVersionTags(logger logging.LeveledLoggerInterface, bitbucketClient *bi
 					sctxt.Project,
 					sctxt.Repository,
 					bitbucket.TagListParams{
-						FilterText: tagName,
+						FilterText: tagScheme.FilterText(tagVersion),
 					},
 				)
 				if err != nil {
-					return fmt.Errorf("could not list tags in %s/%s: %w", sctxt.Project, sctxt.Repository, err)
+					return "", fmt.Errorf("could not list tags in %s/%s: %w", sctxt.Project, sctxt.Repository, err)
 				}
 				subtags = t.Values
-				err = checkProdTagRequirements(subtags, sctxt, tagVersion)
+				err = checkProdTagRequirements(subtags, sctxt, tagScheme, tagVersion)
 				if err != nil {
-					return fmt.Errorf("cannot proceed to prod stage: %w", err)
+					return "", fmt.Errorf("cannot proceed to prod stage: %w", err)
 				}
 				_, err = repository.CreateTag(bitbucketClient, sctxt, tagName)
 				if err != nil {
-					return fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, sctxt.Project, sctxt.Repository, err)
+					return "", fmt.Errorf("could not create tag %s in %s/%s: %w", tagName, sctxt.Project, sctxt.Repository, err)
 				}
 			}
+			return tagName, nil
+		}
+	}
+	return "", nil
+}
+
+// collectReleaseNotes collects the changes of the repository and all subrepos
+// released with releaseTag.
+func collectReleaseNotes(
+	bitbucketClient repository.ReleaseNotesClientInterface,
+	ctxt *pipelinectxt.ODSContext,
+	subrepoContexts []*pipelinectxt.ODSContext,
+	tagScheme *repository.TagScheme,
+	releaseTag, bitbucketURL string) (*artifact.ReleaseNotes, error) {
+	notes := &artifact.ReleaseNotes{
+		Version:      ctxt.Version,
+		Tag:          releaseTag,
+		Repositories: []artifact.ReleaseNotesRepository{},
+	}
+	for _, c := range append([]*pipelinectxt.ODSContext{ctxt}, subrepoContexts...) {
+		r, err := repository.RepositoryReleaseNotes(bitbucketClient, c, tagScheme, bitbucketURL)
+		if err != nil {
+			return nil, err
 		}
+		notes.Repositories = append(notes.Repositories, *r)
+	}
+	return notes, nil
+}
+
+// writeReleaseNotes writes notes as JSON and Markdown into dir. The files are
+// named after the tag, so that the release notes of a release candidate and
+// of the final version of the same commit can coexist.
+func writeReleaseNotes(dir string, notes *artifact.ReleaseNotes) error {
+	basename := strings.ReplaceAll(notes.Tag, "/", "-")
+	err := pipelinectxt.WriteJsonArtifact(notes, dir, basename+".json")
+	if err != nil {
+		return fmt.Errorf("could not write release notes: %w", err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, basename+".md"), []byte(repository.ReleaseNotesMarkdown(*notes)), 0644)
+	if err != nil {
+		return fmt.Errorf("could not write release notes: %w", err)
 	}
 	return nil
 }
 
-func checkProdTagRequirements(tags []bitbucket.Tag, ctxt *pipelinectxt.ODSContext, version string) error {
-	tag, _ := repository.LatestReleaseCandidate(tags, version)
+func checkProdTagRequirements(tags []bitbucket.Tag, ctxt *pipelinectxt.ODSContext, tagScheme *repository.TagScheme, version string) error {
+	tag, _ := repository.LatestReleaseCandidate(tags, tagScheme, version)
 	if tag == nil {
 		return fmt.Errorf("no release candidate tag found for %s. Deploy to QA before deploying to Prod", version)
 	}
@@ -347,12 +436,31 @@ func checkProdTagRequirements(tags []bitbucket.Tag, ctxt *pipelinectxt.ODSContex
 	return nil
 }
 
+// verifyPromotion checks that the downloaded artifacts contain a deployment
+// to environment from by a successful pipeline run of the checked out commit.
+// Artifacts of failed runs are located in "failed-<run>-artifacts" groups,
+// so only deployments directly in the deployments directory are considered.
+func verifyPromotion(logger logging.LeveledLoggerInterface, ctxt *pipelinectxt.ODSContext, am *pipelinectxt.ArtifactsManifest, from string) error {
+	group := pipelinectxt.ArtifactGroupBase(ctxt) + "/"
+	suffix := "deployment-" + from + ".json"
+	for _, a := range am.Artifacts {
+		if a.Directory == pipelinectxt.DeploymentsDir && strings.HasSuffix(a.Name, suffix) && strings.Contains(a.URL, group) {
+			logger.Infof("Found deployment %s of commit %s to %s.", a.Name, ctxt.GitCommitSHA, from)
+			return nil
+		}
+	}
+	return fmt.Errorf(
+		"commit %s of %s has not been deployed to environment %s by a successful pipeline run, refusing to promote it",
+		ctxt.GitCommitSHA, ctxt.Repository, from,
+	)
+}
+
 func downloadArtifacts(
 	logger logging.LeveledLoggerInterface,
 	nexusClient *nexus.Client,
 	ctxt *pipelinectxt.ODSContext,
 	opts options,
-	artifactsDir string) error {
+	artifactsDir string) (*pipelinectxt.ArtifactsManifest, error) {
 	group := pipelinectxt.ArtifactGroupBase(ctxt)
 	am, err := pipelinectxt.DownloadGroup(
 		nexusClient,
@@ -362,80 +470,90 @@ func downloadArtifacts(
 		logger,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return pipelinectxt.WriteJsonArtifact(am, artifactsDir, pipelinectxt.ArtifactsManifestFilename)
-
+	return am, pipelinectxt.WriteJsonArtifact(am, artifactsDir, pipelinectxt.ArtifactsManifestFilename)
 }
 
 func checkoutAndAssembleContext(
-	checkoutDir, url, gitFullRef, gitRefSpec, sslVerify, submodules, depth string,
+	checkoutDir, url, revision, gitFullRef, gitRefSpec, sslVerify, submodules, depth string,
 	baseCtxt *pipelinectxt.ODSContext,
 	logger logging.LeveledLoggerInterface) (*pipelinectxt.ODSContext, error) {
 	absCheckoutDir, err := filepath.Abs(checkoutDir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-	logger.Infof("Checking out %s@%s into %s ...", url, gitFullRef, absCheckoutDir)
-	stdout, stderr, err := command.Run("/ko-app/git-init", []string{
-		"-url", url,
-		"-revision", gitFullRef,
-		"-refspec", gitRefSpec,
-		"-path", absCheckoutDir,
-		"-sslVerify", sslVerify,
-		"-submodules", submodules,
-		"-depth", depth,
-	})
+	logger.Infof("Checking out %s@%s into %s ...", url, revision, absCheckoutDir)
+	checkoutOpts, err := checkoutOptions(url, revision, gitRefSpec, sslVerify, submodules, depth)
 	if err != nil {
-		logger.Errorf(string(stderr))
-		log.Fatal(err)
+		return nil, err
 	}
-	logger.Infof(string(stdout))
+	checkoutOpts.Logger = logger
+	res, err := checkout.Checkout(context.Background(), absCheckoutDir, checkoutOpts)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("Checked out commit %s", res.CommitSHA)
 
 	odsPipelineIgnoreFile := filepath.Join(absCheckoutDir, ".git", "info", "exclude")
 	if err := pipelinectxt.WriteGitIgnore(odsPipelineIgnoreFile); err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	logger.Infof("Wrote gitignore exclude at %s", odsPipelineIgnoreFile)
 
 	// check git LFS state and maybe pull
 	lfs, err := gitLfsInUse(logger, absCheckoutDir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	if lfs {
 		logger.Infof("Git LFS detected, enabling and pulling files...")
-		err := gitLfsEnableAndPullFiles(logger, absCheckoutDir)
+		err := gitLfsEnableAndPullFiles(logger, absCheckoutDir, checkoutOpts.SSLVerify)
 		if err != nil {
-			log.Fatal(err)
+			return nil, err
 		}
 	}
 
 	// write ODS cache
-	sha, err := getCommitSHA(absCheckoutDir)
-	if err != nil {
-		log.Fatal(err)
-	}
 	ctxt := baseCtxt.Copy()
 	ctxt.GitFullRef = gitFullRef
-	ctxt.GitCommitSHA = sha
+	ctxt.GitCommitSHA = res.CommitSHA
 	err = ctxt.Assemble(absCheckoutDir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	err = ctxt.WriteCache(absCheckoutDir)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	return ctxt, nil
 }
 
-func getCommitSHA(dir string) (string, error) {
-	content, err := ioutil.ReadFile(filepath.Join(dir, ".git/HEAD"))
+// checkoutOptions builds the options of the checkout from the (string) flags
+// of ods-start.
+func checkoutOptions(url, gitFullRef, gitRefSpec, sslVerify, submodules, depth string) (checkout.Options, error) {
+	opts := checkout.Options{
+		URL:         url,
+		Revision:    gitFullRef,
+		RefSpecs:    strings.Fields(gitRefSpec),
+		Credentials: checkout.DefaultGitCredentialsStore(),
+	}
+	var err error
+	opts.SSLVerify, err = strconv.ParseBool(sslVerify)
 	if err != nil {
-		return "", err
+		return opts, fmt.Errorf("invalid value for ssl-verify: %w", err)
 	}
-	return strings.TrimSpace(string(content)), nil
+	opts.Submodules, err = strconv.ParseBool(submodules)
+	if err != nil {
+		return opts, fmt.Errorf("invalid value for submodules: %w", err)
+	}
+	if depth != "" {
+		opts.Depth, err = strconv.Atoi(depth)
+		if err != nil {
+			return opts, fmt.Errorf("invalid value for depth: %w", err)
+		}
+	}
+	return opts, nil
 }
 
 func gitLfsInUse(logger logging.LeveledLoggerInterface, dir string) (lfs bool, err error) {
@@ -446,13 +564,21 @@ func gitLfsInUse(logger logging.LeveledLoggerInterface, dir string) (lfs bool, e
 	return strings.TrimSpace(string(stdout)) != "", err
 }
 
-func gitLfsEnableAndPullFiles(logger logging.LeveledLoggerInterface, dir string) (err error) {
-	stdout, stderr, err := command.RunInDir("git", []string{"lfs", "install"}, dir)
+// gitLfsEnableAndPullFiles uses the git CLI as go-git does not support LFS.
+// LFS is installed into the repository configuration only, as subrepos are
+// checked out concurrently and would otherwise compete for the lock of the
+// global Git configuration.
+func gitLfsEnableAndPullFiles(logger logging.LeveledLoggerInterface, dir string, sslVerify bool) (err error) {
+	stdout, stderr, err := command.RunInDir("git", []string{"lfs", "install", "--local"}, dir)
 	if err != nil {
 		return fmt.Errorf("cannot enable git lfs: %s (%w)", stderr, err)
 	}
 	logger.Infof(string(stdout))
-	stdout, stderr, err = command.RunInDir("git", []string{"lfs", "pull"}, dir)
+	pullArgs := []string{"lfs", "pull"}
+	if !sslVerify {
+		pullArgs = append([]string{"-c", "http.sslVerify=false"}, pullArgs...)
+	}
+	stdout, stderr, err = command.RunInDir("git", pullArgs, dir)
 	if err != nil {
 		return fmt.Errorf("cannot git pull lfs files: %s (%w)", stderr, err)
 	}
@@ -7,6 +7,7 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/opendevstack/pipeline/internal/repository"
 	"github.com/opendevstack/pipeline/pkg/bitbucket"
 	"github.com/opendevstack/pipeline/pkg/config"
 	"github.com/opendevstack/pipeline/pkg/logging"
@@ -30,6 +31,7 @@ func TestApplyVersionTags(t *testing.T) {
 
 	tests := map[string]struct {
 		env             *config.Environment
+		releaseTags     config.ReleaseTags
 		prepareServer   func(t *testing.T, srv *testserver.TestServer, ctxt *pipelinectxt.ODSContext)
 		checkServer     func(t *testing.T, srv *testserver.TestServer)
 		wantError       string
@@ -150,6 +152,29 @@ func TestApplyVersionTags(t *testing.T) {
 			wantError:       "",
 			wantOutContains: "",
 		},
+		"custom RC tag for QA stage": {
+			env:         &config.Environment{Name: "foo", Stage: config.QAStage},
+			releaseTags: config.ReleaseTags{Candidate: "release/{{.Version}}-rc{{.Number}}+{{.ShortCommitSHA}}"},
+			prepareServer: func(t *testing.T, srv *testserver.TestServer, ctxt *pipelinectxt.ODSContext) {
+				srv.EnqueueResponse(
+					t, "/rest/api/1.0/projects/PRJ/repos/my-repo/tags",
+					200, "start-cmd/tag-list-related.json",
+				)
+				srv.EnqueueResponse(
+					t, "/rest/api/1.0/projects/PRJ/repos/my-repo/tags",
+					201, "start-cmd/tag-create.json",
+				)
+			},
+			checkServer: func(t *testing.T, srv *testserver.TestServer) {
+				tagPayload := lastTagPayload(t, srv)
+				wantTag := "release/1.0.0-rc1+8d351a1"
+				if tagPayload.Name != wantTag {
+					t.Fatalf("want tag: %s, got %s", wantTag, tagPayload.Name)
+				}
+			},
+			wantError:       "",
+			wantOutContains: "",
+		},
 	}
 
 	for name, tc := range tests {
@@ -161,7 +186,7 @@ func TestApplyVersionTags(t *testing.T) {
 			}
 			var stdout bytes.Buffer
 			logger := &logging.LeveledLogger{Level: logging.LevelDebug, StdoutOverride: &stdout}
-			err := applyVersionTags(logger, bitbucketClient, clonedCtxt, nil, tc.env)
+			_, err := applyVersionTags(logger, bitbucketClient, clonedCtxt, nil, tc.env, repository.NewTagScheme(tc.releaseTags))
 			if len(tc.wantError) > 0 {
 				if err == nil {
 					t.Fatalf("want err: %s, got none", tc.wantError)
@@ -202,3 +227,114 @@ func lastTagPayload(t *testing.T, srv *testserver.TestServer) bitbucket.TagCreat
 	}
 	return tagPayload
 }
+
+func TestVerifyPromotion(t *testing.T) {
+	ctxt := &pipelinectxt.ODSContext{
+		Project:      "foo",
+		Repository:   "foo-bar",
+		GitCommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73",
+	}
+	baseURL := "http://nexus.example.com/repository/ods-permanent-artifacts/foo/foo-bar/"
+	tests := map[string]struct {
+		artifacts []pipelinectxt.ArtifactInfo
+		wantErr   bool
+	}{
+		"deployed to source environment": {
+			artifacts: []pipelinectxt.ArtifactInfo{
+				{URL: baseURL + ctxt.GitCommitSHA + "/deployments/diff-qa.txt", Directory: "deployments", Name: "diff-qa.txt"},
+				{URL: baseURL + ctxt.GitCommitSHA + "/deployments/deployment-qa.json", Directory: "deployments", Name: "deployment-qa.json"},
+			},
+		},
+		"deployed with custom chart dir": {
+			artifacts: []pipelinectxt.ArtifactInfo{
+				{URL: baseURL + ctxt.GitCommitSHA + "/deployments/charts-app-deployment-qa.json", Directory: "deployments", Name: "charts-app-deployment-qa.json"},
+			},
+		},
+		"deployed to other environment": {
+			artifacts: []pipelinectxt.ArtifactInfo{
+				{URL: baseURL + ctxt.GitCommitSHA + "/deployments/deployment-dev.json", Directory: "deployments", Name: "deployment-dev.json"},
+			},
+			wantErr: true,
+		},
+		"deployed by failed run": {
+			artifacts: []pipelinectxt.ArtifactInfo{
+				{URL: baseURL + ctxt.GitCommitSHA + "/failed-foo-bar-abc-artifacts/deployments/deployment-qa.json", Directory: "failed-foo-bar-abc-artifacts/deployments", Name: "deployment-qa.json"},
+			},
+			wantErr: true,
+		},
+		"no artifacts": {
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			logger := &logging.LeveledLogger{Level: logging.LevelNull}
+			am := &pipelinectxt.ArtifactsManifest{Artifacts: tc.artifacts}
+			err := verifyPromotion(logger, ctxt, am, "qa")
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "has not been deployed to environment qa") {
+					t.Fatalf("want promotion error, got: %v", err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestCheckoutOptions(t *testing.T) {
+	tests := map[string]struct {
+		refSpec    string
+		sslVerify  string
+		submodules string
+		depth      string
+		wantErr    string
+	}{
+		"valid flags": {
+			refSpec:    "refs/heads/*:refs/remotes/origin/* refs/tags/*:refs/tags/*",
+			sslVerify:  "false",
+			submodules: "true",
+			depth:      "1",
+		},
+		"empty depth fetches full history": {
+			sslVerify:  "true",
+			submodules: "false",
+			depth:      "",
+		},
+		"invalid ssl-verify": {
+			sslVerify:  "yes please",
+			submodules: "true",
+			depth:      "1",
+			wantErr:    "invalid value for ssl-verify",
+		},
+		"invalid depth": {
+			sslVerify:  "true",
+			submodules: "true",
+			depth:      "one",
+			wantErr:    "invalid value for depth",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			opts, err := checkoutOptions("https://example.com/scm/foo/bar.git", "refs/heads/master", tc.refSpec, tc.sslVerify, tc.submodules, tc.depth)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("want err: %s, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(opts.RefSpecs) != len(strings.Fields(tc.refSpec)) {
+				t.Fatalf("want refspecs: %s, got: %v", tc.refSpec, opts.RefSpecs)
+			}
+			if tc.depth == "1" && opts.Depth != 1 {
+				t.Fatalf("want depth 1, got: %d", opts.Depth)
+			}
+			if opts.SSLVerify != (tc.sslVerify == "true") || opts.Submodules != (tc.submodules == "true") {
+				t.Fatalf("unexpected options: %+v", opts)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/opendevstack/pipeline/internal/repository"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/nexus"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// subrepoConcurrency is the maximum number of subrepos processed at once.
+const subrepoConcurrency = 4
+
+// subrepoTask processes the subrepo with given index. Messages must be logged
+// to the given logger so that the output stays in order of the subrepos.
+type subrepoTask func(i int, logger logging.LeveledLoggerInterface) error
+
+// forEachSubrepo runs task for each of the named subrepos, using at most
+// concurrency workers. The logs of each subrepo are buffered and written to
+// logger in order of the subrepos once all tasks are done. The errors of all
+// failed subrepos are reported together.
+func forEachSubrepo(names []string, concurrency int, logger logging.LeveledLoggerInterface, task subrepoTask) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	loggers := make([]*bufferedLogger, len(names))
+	errs := make([]error, len(names))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < len(names); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				loggers[i] = &bufferedLogger{}
+				errs[i] = task(i, loggers[i])
+			}
+		}()
+	}
+	for i := range names {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	failed := []string{}
+	for i, name := range names {
+		loggers[i].flush(logger)
+		if errs[i] != nil {
+			failed = append(failed, fmt.Sprintf("- %s: %s", name, errs[i]))
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf(
+			"%d of %d subrepos failed:\n%s",
+			len(failed), len(names), strings.Join(failed, "\n"),
+		)
+	}
+	return nil
+}
+
+// subrepoClientInterface is the part of the Bitbucket client needed to
+// determine which commit of a subrepo to check out.
+type subrepoClientInterface interface {
+	bitbucket.BranchClientInterface
+	repository.PinClientInterface
+}
+
+// checkoutSubrepos checks out all subrepos concurrently into
+// pipelinectxt.SubreposPath. The returned contexts are in the order of subrepos.
+func checkoutSubrepos(
+	logger logging.LeveledLoggerInterface,
+	bitbucketClient subrepoClientInterface,
+	ctxt, baseCtxt *pipelinectxt.ODSContext,
+	subrepos []config.Repository,
+	opts options) ([]*pipelinectxt.ODSContext, error) {
+	names := make([]string, len(subrepos))
+	for i, subrepo := range subrepos {
+		names[i] = subrepo.Name
+	}
+	subrepoContexts := make([]*pipelinectxt.ODSContext, len(subrepos))
+	err := forEachSubrepo(names, subrepoConcurrency, logger, func(i int, logger logging.LeveledLoggerInterface) error {
+		subrepo := subrepos[i]
+		subrepoCheckoutDir := filepath.Join(pipelinectxt.SubreposPath, subrepo.Name)
+		err := os.MkdirAll(subrepoCheckoutDir, 0755)
+		if err != nil {
+			return fmt.Errorf("could not create checkout dir: %w", err)
+		}
+		subrepoURL := subrepo.URL
+		if len(subrepoURL) == 0 {
+			subrepoURL = strings.Replace(
+				opts.url,
+				fmt.Sprintf("/%s.git", ctxt.Repository),
+				fmt.Sprintf("/%s.git", subrepo.Name),
+				1,
+			)
+		}
+		pin, err := repository.ResolvePinnedRevision(bitbucketClient, ctxt.Project, subrepo)
+		if err != nil {
+			return err
+		}
+		var subrepoRevision, subrepoGitFullRef string
+		if pin != nil {
+			logger.Infof("Subrepo %s is pinned to %s (commit %s).", subrepo.Name, pin.Revision, pin.CommitSHA)
+			subrepoRevision, subrepoGitFullRef = pin.Revision, pin.GitFullRef
+		} else {
+			subrepoGitFullRef, err = repository.BestMatchingBranch(bitbucketClient, ctxt.Project, subrepo, ctxt.Version)
+			if err != nil {
+				return err
+			}
+			subrepoRevision = subrepoGitFullRef
+		}
+		subrepoCtxt, err := checkoutAndAssembleContext(
+			subrepoCheckoutDir,
+			subrepoURL,
+			subrepoRevision,
+			subrepoGitFullRef,
+			opts.gitRefSpec,
+			opts.sslVerify,
+			opts.submodules,
+			opts.depth,
+			baseCtxt,
+			logger,
+		)
+		if err != nil {
+			return err
+		}
+		if pin != nil && subrepoCtxt.GitCommitSHA != pin.CommitSHA {
+			return fmt.Errorf(
+				"checked out commit %s, but %s points to commit %s in Bitbucket",
+				subrepoCtxt.GitCommitSHA, pin.Revision, pin.CommitSHA,
+			)
+		}
+		subrepoContexts[i] = subrepoCtxt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return subrepoContexts, nil
+}
+
+// downloadSubrepoArtifacts downloads the artifacts of all subrepos
+// concurrently, and checks that a pipeline run exists for each of them.
+func downloadSubrepoArtifacts(
+	logger logging.LeveledLoggerInterface,
+	nexusClient *nexus.Client,
+	subrepoContexts []*pipelinectxt.ODSContext,
+	opts options) error {
+	names := make([]string, len(subrepoContexts))
+	for i, src := range subrepoContexts {
+		names[i] = src.Repository
+	}
+	return forEachSubrepo(names, subrepoConcurrency, logger, func(i int, logger logging.LeveledLoggerInterface) error {
+		src := subrepoContexts[i]
+		artifactsDir := filepath.Join(pipelinectxt.SubreposPath, src.Repository, pipelinectxt.ArtifactsPath)
+		am, err := downloadArtifacts(logger, nexusClient, src, opts, artifactsDir)
+		if err != nil {
+			return err
+		}
+		return verifySubrepoPipelineRun(logger, src, am, artifactsDir)
+	})
+}
+
+// verifySubrepoPipelineRun checks that the downloaded artifacts of the subrepo
+// contain a successful pipeline run for the checked out commit. Pipeline run
+// artifacts of failed runs are located in "failed-<run>-artifacts" groups.
+func verifySubrepoPipelineRun(logger logging.LeveledLoggerInterface, ctxt *pipelinectxt.ODSContext, am *pipelinectxt.ArtifactsManifest, artifactsDir string) error {
+	group := pipelinectxt.ArtifactGroupBase(ctxt) + "/"
+	found := []string{}
+	for _, a := range am.Artifacts {
+		if path.Base(a.Directory) != pipelinectxt.PipelineRunsDir || !strings.Contains(a.URL, group) {
+			continue
+		}
+		var pra artifact.PipelineRunArtifact
+		b, err := ioutil.ReadFile(filepath.Join(artifactsDir, a.Directory, a.Name))
+		if err != nil {
+			return fmt.Errorf("could not read pipeline run artifact %s: %w", a.Name, err)
+		}
+		if err := json.Unmarshal(b, &pra); err != nil {
+			return fmt.Errorf("could not parse pipeline run artifact %s: %w", a.Name, err)
+		}
+		if pra.Successful() {
+			logger.Infof("Found successful pipeline run %s for commit %s of %s.", pra.Name, ctxt.GitCommitSHA, ctxt.Repository)
+			return nil
+		}
+		found = append(found, fmt.Sprintf("%s: %s", pra.Name, pra.AggregateTaskStatus))
+	}
+	foundMsg := "no pipeline runs were found"
+	if len(found) > 0 {
+		sort.Strings(found)
+		foundMsg = "found pipeline runs: " + strings.Join(found, ", ")
+	}
+	return fmt.Errorf(
+		"Pipeline runs with subrepos require a successful pipeline run "+
+			"for all checked out subrepo commits, "+
+			"however no such run was found for commit %s of %s (%s). "+
+			"Re-run this pipeline once there is a successful pipeline run.",
+		ctxt.GitCommitSHA, ctxt.Repository, foundMsg,
+	)
+}
+
+// lockedSubrepos pins subrepos to the commits (and refs) recorded in the
+// subrepo lock located in lockDir.
+func lockedSubrepos(subrepos []config.Repository, lockDir string) ([]config.Repository, error) {
+	var lock artifact.SubrepoLock
+	b, err := ioutil.ReadFile(filepath.Join(lockDir, pipelinectxt.SubrepoLockFilename))
+	if err != nil {
+		return nil, fmt.Errorf("could not read subrepo lock: %w", err)
+	}
+	if err := json.Unmarshal(b, &lock); err != nil {
+		return nil, fmt.Errorf("could not parse subrepo lock: %w", err)
+	}
+	locked := make([]config.Repository, len(subrepos))
+	for i, subrepo := range subrepos {
+		var entry *artifact.SubrepoLockEntry
+		for j, e := range lock.Repositories {
+			if e.Name == subrepo.Name {
+				entry = &lock.Repositories[j]
+				break
+			}
+		}
+		if entry == nil {
+			return nil, fmt.Errorf("subrepo %s is not recorded in the subrepo lock", subrepo.Name)
+		}
+		subrepo.Branch = entry.GitFullRef
+		subrepo.Tag = ""
+		subrepo.Commit = entry.CommitSHA
+		locked[i] = subrepo
+	}
+	return locked, nil
+}
+
+// subrepoLock records the checked out commit of each subrepo.
+func subrepoLock(subrepos []config.Repository, subrepoContexts []*pipelinectxt.ODSContext) artifact.SubrepoLock {
+	lock := artifact.SubrepoLock{Repositories: []artifact.SubrepoLockEntry{}}
+	for i, subrepo := range subrepos {
+		src := subrepoContexts[i]
+		entry := artifact.SubrepoLockEntry{
+			Name:       subrepo.Name,
+			URL:        src.GitURL,
+			GitFullRef: src.GitFullRef,
+			CommitSHA:  src.GitCommitSHA,
+		}
+		if len(subrepo.Tag) > 0 {
+			entry.Pin = "tag"
+		} else if len(subrepo.Commit) > 0 {
+			entry.Pin = "commit"
+		}
+		lock.Repositories = append(lock.Repositories, entry)
+	}
+	return lock
+}
+
+type logEntry struct {
+	level  logging.Level
+	format string
+	v      []interface{}
+}
+
+// bufferedLogger records log messages to replay them later on another logger.
+type bufferedLogger struct {
+	entries []logEntry
+}
+
+func (l *bufferedLogger) Debugf(format string, v ...interface{}) {
+	l.entries = append(l.entries, logEntry{logging.LevelDebug, format, v})
+}
+
+func (l *bufferedLogger) Errorf(format string, v ...interface{}) {
+	l.entries = append(l.entries, logEntry{logging.LevelError, format, v})
+}
+
+func (l *bufferedLogger) Infof(format string, v ...interface{}) {
+	l.entries = append(l.entries, logEntry{logging.LevelInfo, format, v})
+}
+
+func (l *bufferedLogger) Warnf(format string, v ...interface{}) {
+	l.entries = append(l.entries, logEntry{logging.LevelWarn, format, v})
+}
+
+// flush writes all recorded messages to logger.
+func (l *bufferedLogger) flush(logger logging.LeveledLoggerInterface) {
+	for _, e := range l.entries {
+		switch e.level {
+		case logging.LevelDebug:
+			logger.Debugf(e.format, e.v...)
+		case logging.LevelError:
+			logger.Errorf(e.format, e.v...)
+		case logging.LevelInfo:
+			logger.Infof(e.format, e.v...)
+		case logging.LevelWarn:
+			logger.Warnf(e.format, e.v...)
+		}
+	}
+	l.entries = nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+func TestForEachSubrepo(t *testing.T) {
+	tests := map[string]struct {
+		names       []string
+		concurrency int
+		failing     map[string]bool
+		wantErr     string
+	}{
+		"no subrepos": {
+			names:       []string{},
+			concurrency: 4,
+		},
+		"more subrepos than workers": {
+			names:       []string{"a", "b", "c", "d", "e", "f", "g"},
+			concurrency: 3,
+		},
+		"errors are reported together": {
+			names:       []string{"a", "b", "c", "d"},
+			concurrency: 2,
+			failing:     map[string]bool{"b": true, "d": true},
+			wantErr:     "2 of 4 subrepos failed:\n- b: b failed\n- d: d failed",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			logger := &logging.LeveledLogger{
+				Level:          logging.LevelDebug,
+				StdoutOverride: &stdout,
+				StderrOverride: &stderr,
+			}
+			var running, maxRunning int32
+			err := forEachSubrepo(tc.names, tc.concurrency, logger, func(i int, logger logging.LeveledLoggerInterface) error {
+				n := atomic.AddInt32(&running, 1)
+				defer atomic.AddInt32(&running, -1)
+				for {
+					m := atomic.LoadInt32(&maxRunning)
+					if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+						break
+					}
+				}
+				name := tc.names[i]
+				logger.Infof("start %s", name)
+				// Let later subrepos finish first to check the log order.
+				time.Sleep(time.Duration(len(tc.names)-i) * time.Millisecond)
+				logger.Debugf("end %s", name)
+				if tc.failing[name] {
+					logger.Errorf("oops %s", name)
+					return errors.New(name + " failed")
+				}
+				return nil
+			})
+			if tc.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantErr != "" && (err == nil || err.Error() != tc.wantErr) {
+				t.Fatalf("want err: %q, got: %v", tc.wantErr, err)
+			}
+			if int(maxRunning) > tc.concurrency {
+				t.Fatalf("want at most %d concurrent tasks, got: %d", tc.concurrency, maxRunning)
+			}
+			wantStdout := ""
+			wantStderr := ""
+			for _, name := range tc.names {
+				wantStdout += fmt.Sprintf("[INFO] start %s\n[DEBUG] end %s\n", name, name)
+				if tc.failing[name] {
+					wantStderr += fmt.Sprintf("[ERROR] oops %s\n", name)
+				}
+			}
+			if stdout.String() != wantStdout {
+				t.Fatalf("want logs in order of subrepos:\n%s\ngot:\n%s", wantStdout, stdout.String())
+			}
+			if stderr.String() != wantStderr {
+				t.Fatalf("want errors in order of subrepos:\n%s\ngot:\n%s", wantStderr, stderr.String())
+			}
+			if strings.Contains(stdout.String(), "ERROR") {
+				t.Fatal("errors must be logged to stderr")
+			}
+		})
+	}
+}
+
+func TestVerifySubrepoPipelineRun(t *testing.T) {
+	ctxt := &pipelinectxt.ODSContext{
+		Project:      "foo",
+		Repository:   "foo-bar",
+		GitCommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73",
+	}
+	otherCommitSHA := "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e"
+	tests := map[string]struct {
+		runs    []testPipelineRun
+		wantErr string
+	}{
+		"successful run": {
+			runs: []testPipelineRun{
+				{dir: "failed-foo-bar-abc-artifacts/pipeline-runs", status: "Failed", name: "foo-bar-abc"},
+				{dir: "pipeline-runs", status: "Succeeded", name: "foo-bar-def"},
+			},
+		},
+		"completed run with skipped tasks": {
+			runs: []testPipelineRun{
+				{dir: "pipeline-runs", status: "Completed", name: "foo-bar-def"},
+			},
+		},
+		"only failed runs": {
+			runs: []testPipelineRun{
+				{dir: "failed-foo-bar-def-artifacts/pipeline-runs", status: "None", name: "foo-bar-def"},
+				{dir: "failed-foo-bar-abc-artifacts/pipeline-runs", status: "Failed", name: "foo-bar-abc"},
+			},
+			wantErr: "found pipeline runs: foo-bar-abc: Failed, foo-bar-def: None",
+		},
+		"successful run of other commit": {
+			runs: []testPipelineRun{
+				{dir: "pipeline-runs", status: "Succeeded", name: "foo-bar-def", commitSHA: otherCommitSHA},
+			},
+			wantErr: "no pipeline runs were found",
+		},
+		"no runs": {
+			wantErr: "no such run was found for commit " + ctxt.GitCommitSHA + " of foo-bar",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			artifactsDir := t.TempDir()
+			am := &pipelinectxt.ArtifactsManifest{}
+			for _, r := range tc.runs {
+				commitSHA := ctxt.GitCommitSHA
+				if r.commitSHA != "" {
+					commitSHA = r.commitSHA
+				}
+				filename := r.name + ".json"
+				err := pipelinectxt.WriteJsonArtifact(
+					artifact.PipelineRunArtifact{Name: r.name, AggregateTaskStatus: r.status},
+					filepath.Join(artifactsDir, r.dir), filename,
+				)
+				if err != nil {
+					t.Fatal(err)
+				}
+				am.Artifacts = append(am.Artifacts, pipelinectxt.ArtifactInfo{
+					URL:       "http://nexus.example.com/repository/ods-permanent-artifacts/" + path.Join("foo/foo-bar", commitSHA, r.dir, filename),
+					Directory: r.dir,
+					Name:      filename,
+				})
+			}
+			logger := &logging.LeveledLogger{Level: logging.LevelNull}
+			err := verifySubrepoPipelineRun(logger, ctxt, am, artifactsDir)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("want err containing %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+type testPipelineRun struct {
+	dir       string
+	name      string
+	status    string
+	commitSHA string
+}
+
+func TestSubrepoLock(t *testing.T) {
+	subrepos := []config.Repository{
+		{Name: "a"},
+		{Name: "b", Tag: "v1.0.0"},
+		{Name: "c", Branch: "develop", Commit: "0e183aa"},
+	}
+	subrepoContexts := []*pipelinectxt.ODSContext{
+		{GitURL: "https://example.com/scm/foo/a.git", GitFullRef: "refs/heads/master", GitCommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+		{GitURL: "https://example.com/scm/foo/b.git", GitFullRef: "refs/tags/v1.0.0", GitCommitSHA: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+		{GitURL: "https://example.com/scm/foo/c.git", GitFullRef: "refs/heads/develop", GitCommitSHA: "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e"},
+	}
+	want := artifact.SubrepoLock{Repositories: []artifact.SubrepoLockEntry{
+		{Name: "a", URL: "https://example.com/scm/foo/a.git", GitFullRef: "refs/heads/master", CommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+		{Name: "b", URL: "https://example.com/scm/foo/b.git", GitFullRef: "refs/tags/v1.0.0", Pin: "tag", CommitSHA: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+		{Name: "c", URL: "https://example.com/scm/foo/c.git", GitFullRef: "refs/heads/develop", Pin: "commit", CommitSHA: "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e"},
+	}}
+	got := subrepoLock(subrepos, subrepoContexts)
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("lock mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestLockedSubrepos(t *testing.T) {
+	lockDir := t.TempDir()
+	lock := artifact.SubrepoLock{Repositories: []artifact.SubrepoLockEntry{
+		{Name: "a", GitFullRef: "refs/heads/release/1.0.0", CommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+		{Name: "b", GitFullRef: "refs/tags/v1.0.0", Pin: "tag", CommitSHA: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+	}}
+	err := pipelinectxt.WriteJsonArtifact(lock, lockDir, pipelinectxt.SubrepoLockFilename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := lockedSubrepos([]config.Repository{{Name: "a"}, {Name: "b", Tag: "v1.0.0"}}, lockDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []config.Repository{
+		{Name: "a", Branch: "refs/heads/release/1.0.0", Commit: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+		{Name: "b", Branch: "refs/tags/v1.0.0", Commit: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("subrepos mismatch (-want +got):\n%s", diff)
+	}
+	_, err = lockedSubrepos([]config.Repository{{Name: "c"}}, lockDir)
+	if err == nil || !strings.Contains(err.Error(), "subrepo c is not recorded in the subrepo lock") {
+		t.Fatalf("want error for subrepo missing in lock, got: %v", err)
+	}
+}
@@ -3,16 +3,22 @@ module github.com/opendevstack/pipeline
 go 1.16
 
 require (
-	github.com/aws/aws-sdk-go v1.37.1 // indirect
+	github.com/go-git/go-git/v5 v5.4.2
 	github.com/google/go-cmp v0.5.6
 	github.com/google/go-github/v42 v42.0.0
 	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
 	github.com/sonatype-nexus-community/gonexus v0.59.0
 	github.com/tektoncd/pipeline v0.24.0
-	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110
+	go.mozilla.org/sops/v3 v3.7.1
+	golang.org/x/net v0.0.0-20210326060303-6b1517762897
+	helm.sh/helm/v3 v3.6.3
 	k8s.io/api v0.21.6
 	k8s.io/apimachinery v0.21.6
+	k8s.io/cli-runtime v0.21.0
 	k8s.io/client-go v0.21.6
 	knative.dev/pkg v0.0.0-20210331065221-952fdd90dbb0
+	sigs.k8s.io/kustomize/api v0.8.5
 	sigs.k8s.io/yaml v1.2.0
 )
+
+replace github.com/go-openapi/spec => github.com/go-openapi/spec v0.19.6
@@ -0,0 +1,223 @@
+package approval
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+)
+
+// DefaultTimeout is used when the approval configuration does not specify
+// a timeout.
+const DefaultTimeout = 30 * time.Minute
+
+// DefaultPollInterval is the interval in which commit comments are checked
+// for new approvals.
+const DefaultPollInterval = 30 * time.Second
+
+// commandPattern matches approval commands such as "/approve prod" or
+// "/reject prod". Commands must be on a line of their own.
+var commandPattern = regexp.MustCompile(`(?i)^/(approve|reject)\s+(\S+)$`)
+
+// ClientInterface is the part of the Bitbucket client needed to collect
+// approvals.
+type ClientInterface interface {
+	bitbucket.CommitClientInterface
+	bitbucket.CommentClientInterface
+	bitbucket.GroupClientInterface
+}
+
+// ErrRejected is returned when an eligible approver rejected the deployment.
+var ErrRejected = errors.New("deployment has been rejected")
+
+// Request identifies the commit and environment to collect approvals for.
+type Request struct {
+	// ProjectKey is the Bitbucket project key of the repository.
+	ProjectKey string
+	// Repository is the Bitbucket repository slug.
+	Repository string
+	// CommitSHA is the commit to be deployed.
+	CommitSHA string
+	// Environment is the name of the target environment.
+	Environment string
+	// Approval is the approval configuration of the target environment.
+	Approval *config.Approval
+	// Since is the time from which on commands count, usually the start of
+	// the deployment. Earlier commands are ignored, so that an approval
+	// cannot be reused for later deployments of the same commit.
+	Since time.Time
+}
+
+// Wait polls the comments of the commit until enough eligible users approved
+// the deployment. It fails if an eligible user rejects the deployment or when
+// the configured timeout is exceeded. Only commands commented after
+// req.Since count, and commands of the commit author are ignored unless
+// self-approval is allowed.
+func Wait(client ClientInterface, req Request, pollInterval time.Duration, logger logging.LeveledLoggerInterface) (*artifact.DeploymentApproval, error) {
+	timeout := DefaultTimeout
+	if req.Approval.Timeout != nil {
+		timeout = req.Approval.Timeout.Duration
+	}
+	eligible, err := eligibleApprovers(client, req.Approval)
+	if err != nil {
+		return nil, err
+	}
+	var author *bitbucket.Commit
+	if !req.Approval.AllowSelfApproval {
+		author, err = client.CommitGet(req.ProjectKey, req.Repository, req.CommitSHA)
+		if err != nil {
+			return nil, fmt.Errorf("could not get author of commit %s: %w", req.CommitSHA, err)
+		}
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		record, err := collect(client, req, eligible, author)
+		if err != nil {
+			return record, err
+		}
+		if len(record.Approvals) >= record.RequiredApprovals {
+			return record, nil
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return record, fmt.Errorf(
+				"timed out after %s waiting for approvals: got %d of %d",
+				timeout, len(record.Approvals), record.RequiredApprovals,
+			)
+		}
+		logger.Infof(
+			"Waiting for approvals (%d of %d). Comment \"/approve %s\" on commit %s to approve ...",
+			len(record.Approvals), record.RequiredApprovals, req.Environment, req.CommitSHA,
+		)
+		time.Sleep(pollInterval)
+	}
+}
+
+// collect reads the comments of the commit once and returns the approvals
+// given by users in eligible (keyed by user slug) since req.Since. Comments
+// of the author of commit are ignored if commit is given. If a user
+// commented multiple times, the latest command counts. ErrRejected is
+// returned if any eligible user rejected the deployment.
+func collect(client ClientInterface, req Request, eligible map[string]bool, commit *bitbucket.Commit) (*artifact.DeploymentApproval, error) {
+	record := &artifact.DeploymentApproval{
+		Environment:       req.Environment,
+		CommitSHA:         req.CommitSHA,
+		RequiredApprovals: req.Approval.RequiredApprovals(),
+		Approvals:         []artifact.Approval{},
+	}
+	comments, err := commitComments(client, req)
+	if err != nil {
+		return record, err
+	}
+	sort.SliceStable(comments, func(i, j int) bool {
+		return comments[i].CreatedDate < comments[j].CreatedDate
+	})
+	var since int64
+	if !req.Since.IsZero() {
+		since = req.Since.UnixNano() / int64(time.Millisecond)
+	}
+	decisions := map[string]string{}
+	latest := map[string]bitbucket.Comment{}
+	for _, c := range comments {
+		slug := strings.ToLower(c.Author.Slug)
+		if !eligible[slug] || c.CreatedDate < since {
+			continue
+		}
+		if commit != nil && isAuthor(c.Author, commit) {
+			continue
+		}
+		if decision := commentDecision(c.Text, req.Environment); decision != "" {
+			decisions[slug] = decision
+			latest[slug] = c
+		}
+	}
+	for _, c := range comments {
+		slug := strings.ToLower(c.Author.Slug)
+		if l, ok := latest[slug]; !ok || l.ID != c.ID {
+			continue
+		}
+		if decisions[slug] == "reject" {
+			return record, fmt.Errorf("%w by %s", ErrRejected, c.Author.Slug)
+		}
+		record.Approvals = append(record.Approvals, artifact.Approval{
+			User:        c.Author.Slug,
+			DisplayName: c.Author.DisplayName,
+			Date:        time.Unix(0, c.CreatedDate*int64(time.Millisecond)).UTC().Format(time.RFC3339),
+		})
+	}
+	return record, nil
+}
+
+// isAuthor reports whether user authored commit. Bitbucket reports the
+// username as author name if the commit author is linked to a user.
+func isAuthor(user bitbucket.User, commit *bitbucket.Commit) bool {
+	if commit.Author.EmailAddress != "" && strings.EqualFold(user.EmailAddress, commit.Author.EmailAddress) {
+		return true
+	}
+	return commit.Author.Name != "" && strings.EqualFold(user.Name, commit.Author.Name)
+}
+
+// commentDecision returns "approve" or "reject" if text contains a command
+// for environment, and an empty string otherwise.
+func commentDecision(text, environment string) string {
+	decision := ""
+	for _, line := range strings.Split(text, "\n") {
+		m := commandPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m != nil && strings.EqualFold(m[2], environment) {
+			decision = strings.ToLower(m[1])
+		}
+	}
+	return decision
+}
+
+func commitComments(client ClientInterface, req Request) ([]bitbucket.Comment, error) {
+	var comments []bitbucket.Comment
+	start := 0
+	for {
+		page, err := client.CommitCommentList(
+			req.ProjectKey, req.Repository, req.CommitSHA,
+			bitbucket.CommitCommentListParams{Start: start},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not list comments of commit %s: %w", req.CommitSHA, err)
+		}
+		comments = append(comments, page.Values...)
+		if page.IsLastPage || page.NextPageStart <= start {
+			break
+		}
+		start = page.NextPageStart
+	}
+	return comments, nil
+}
+
+// eligibleApprovers returns the slugs of all configured approvers and all
+// members of the configured groups.
+func eligibleApprovers(client ClientInterface, a *config.Approval) (map[string]bool, error) {
+	eligible := map[string]bool{}
+	for _, approver := range a.Approvers {
+		eligible[strings.ToLower(approver)] = true
+	}
+	for _, group := range a.Groups {
+		start := 0
+		for {
+			page, err := client.GroupMemberList(group, bitbucket.GroupMemberListParams{Start: start})
+			if err != nil {
+				return nil, fmt.Errorf("could not list members of group %s: %w", group, err)
+			}
+			for _, u := range page.Values {
+				eligible[strings.ToLower(u.Slug)] = true
+			}
+			if page.IsLastPage || page.NextPageStart <= start {
+				break
+			}
+			start = page.NextPageStart
+		}
+	}
+	return eligible, nil
+}
@@ -0,0 +1,149 @@
+package approval
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWait(t *testing.T) {
+	comment := func(id int, slug, text string, minute int) bitbucket.Comment {
+		return bitbucket.Comment{
+			ID:          id,
+			Text:        text,
+			Author:      bitbucket.User{Slug: slug, Name: slug, EmailAddress: slug + "@example.com", DisplayName: strings.ToUpper(slug)},
+			CreatedDate: time.Date(2021, 10, 1, 12, minute, 0, 0, time.UTC).UnixNano() / int64(time.Millisecond),
+		}
+	}
+	approval := func(slug string, minute int) artifact.Approval {
+		return artifact.Approval{
+			User:        slug,
+			DisplayName: strings.ToUpper(slug),
+			Date:        time.Date(2021, 10, 1, 12, minute, 0, 0, time.UTC).Format(time.RFC3339),
+		}
+	}
+	commit := bitbucket.Commit{ID: "8d351a10fb428c0c1239530256e21cf24f136e73"}
+	commit.Author.Name = "John Smith"
+	commit.Author.EmailAddress = "JSmith@example.com"
+	tests := map[string]struct {
+		approval      *config.Approval
+		comments      []bitbucket.Comment
+		groupMembers  map[string][]bitbucket.User
+		wantApprovals []artifact.Approval
+		wantErr       string
+	}{
+		"approved by approver": {
+			approval: &config.Approval{Approvers: []string{"jdoe"}},
+			comments: []bitbucket.Comment{
+				comment(1, "jdoe", "Looks good.\n/approve prod", 1),
+			},
+			wantApprovals: []artifact.Approval{approval("jdoe", 1)},
+		},
+		"approved by group members": {
+			approval: &config.Approval{Groups: []string{"release-managers"}, MinApprovals: 2},
+			comments: []bitbucket.Comment{
+				comment(2, "jcitizen", "/APPROVE prod", 2),
+				comment(1, "jdoe", "/approve prod", 1),
+			},
+			groupMembers: map[string][]bitbucket.User{
+				"release-managers": {{Slug: "jdoe"}, {Slug: "jcitizen"}},
+			},
+			wantApprovals: []artifact.Approval{approval("jdoe", 1), approval("jcitizen", 2)},
+		},
+		"ignores ineligible users and other environments": {
+			approval: &config.Approval{Approvers: []string{"jdoe"}},
+			comments: []bitbucket.Comment{
+				comment(1, "jcitizen", "/approve prod", 1),
+				comment(2, "jdoe", "/approve qa", 2),
+				comment(3, "jdoe", "I will /approve prod later", 3),
+			},
+			wantErr: "timed out after 10ms waiting for approvals: got 0 of 1",
+		},
+		"counts distinct approvers": {
+			approval: &config.Approval{Approvers: []string{"jdoe", "jcitizen"}, MinApprovals: 2},
+			comments: []bitbucket.Comment{
+				comment(1, "jdoe", "/approve prod", 1),
+				comment(2, "jdoe", "/approve prod", 2),
+			},
+			wantErr: "timed out after 10ms waiting for approvals: got 1 of 2",
+		},
+		"rejected by approver": {
+			approval: &config.Approval{Approvers: []string{"jdoe", "jcitizen"}},
+			comments: []bitbucket.Comment{
+				comment(1, "jdoe", "/approve prod", 1),
+				comment(2, "jcitizen", "/reject prod", 2),
+			},
+			wantErr: "deployment has been rejected by jcitizen",
+		},
+		"ignores commands before the deployment": {
+			approval: &config.Approval{Approvers: []string{"jdoe"}},
+			comments: []bitbucket.Comment{
+				comment(1, "jdoe", "/approve prod", 0),
+			},
+			wantErr: "timed out after 10ms waiting for approvals: got 0 of 1",
+		},
+		"ignores commands of commit author": {
+			approval: &config.Approval{Approvers: []string{"jsmith"}},
+			comments: []bitbucket.Comment{
+				comment(1, "jsmith", "/approve prod", 1),
+			},
+			wantErr: "timed out after 10ms waiting for approvals: got 0 of 1",
+		},
+		"approved by commit author if allowed": {
+			approval: &config.Approval{Approvers: []string{"jsmith"}, AllowSelfApproval: true},
+			comments: []bitbucket.Comment{
+				comment(1, "jsmith", "/approve prod", 1),
+			},
+			wantApprovals: []artifact.Approval{approval("jsmith", 1)},
+		},
+		"latest command of approver counts": {
+			approval: &config.Approval{Approvers: []string{"jdoe"}},
+			comments: []bitbucket.Comment{
+				comment(2, "jdoe", "/approve prod", 2),
+				comment(1, "jdoe", "/reject prod", 1),
+			},
+			wantApprovals: []artifact.Approval{approval("jdoe", 2)},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.approval.Timeout = &metav1.Duration{Duration: 10 * time.Millisecond}
+			client := &bitbucket.TestClient{
+				Commits:      []bitbucket.Commit{commit},
+				Comments:     tc.comments,
+				GroupMembers: tc.groupMembers,
+			}
+			got, err := Wait(client, Request{
+				ProjectKey:  "FOO",
+				Repository:  "foo-bar",
+				CommitSHA:   commit.ID,
+				Environment: "prod",
+				Approval:    tc.approval,
+				Since:       time.Date(2021, 10, 1, 12, 1, 0, 0, time.UTC),
+			}, time.Millisecond, &logging.LeveledLogger{Level: logging.LevelNull})
+			if tc.wantErr != "" {
+				if err == nil || err.Error() != tc.wantErr {
+					t.Fatalf("want err: %q, got: %v", tc.wantErr, err)
+				}
+				if strings.Contains(tc.wantErr, "rejected") && !errors.Is(err, ErrRejected) {
+					t.Fatalf("want ErrRejected, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantApprovals, got.Approvals); diff != "" {
+				t.Fatalf("approvals mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,355 @@
+// Package checkout checks out Git repositories natively using go-git, without
+// depending on the Tekton git-init binary.
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/opendevstack/pipeline/pkg/logging"
+)
+
+const (
+	remoteName = "origin"
+	// maxListedBranches limits the number of branches listed in the error
+	// message when a revision is not found.
+	maxListedBranches = 10
+)
+
+var commitSHARegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// Options configures a checkout.
+type Options struct {
+	// URL of the remote repository.
+	URL string
+	// Revision to check out. Either a full ref (e.g. "refs/heads/master"),
+	// a branch or tag name, or a full commit SHA.
+	Revision string
+	// RefSpecs are fetched in addition to the revision, e.g.
+	// "+refs/heads/*:refs/remotes/origin/*".
+	RefSpecs []string
+	// Depth limits the fetched history to the given number of commits.
+	// 0 fetches the full history. Object filters (partial clones in the
+	// sense of "git clone --filter") are not supported by go-git, however
+	// only the requested revision (plus RefSpecs) is fetched.
+	Depth int
+	// Submodules enables initializing and updating submodules (recursively).
+	Submodules bool
+	// SSLVerify enables verification of the TLS certificate of the remote.
+	SSLVerify bool
+	// Credentials provides the credentials for URL. Optional.
+	Credentials CredentialHelper
+	Logger      logging.LeveledLoggerInterface
+}
+
+// Result describes what has been checked out.
+type Result struct {
+	// Ref is the full ref which was checked out. Empty if a commit SHA was
+	// requested which no ref points to.
+	Ref string
+	// CommitSHA is the SHA of the checked out commit.
+	CommitSHA string
+}
+
+// Checkout fetches opts.Revision from opts.URL into dir and checks it out
+// (leaving HEAD detached). dir may be empty or contain a repository from a
+// previous checkout, in which case the remote is updated.
+func Checkout(ctx context.Context, dir string, opts Options) (*Result, error) {
+	if opts.Logger == nil {
+		opts.Logger = &logging.LeveledLogger{Level: logging.LevelNull}
+	}
+	wrap := func(op string, err error) error {
+		return &Error{Op: op, URL: opts.URL, Revision: opts.Revision, Err: err}
+	}
+
+	repo, err := initRepository(dir, opts.URL)
+	if err != nil {
+		return nil, wrap("init", err)
+	}
+	var auth transport.AuthMethod
+	if opts.Credentials != nil {
+		auth, err = opts.Credentials.Credentials(opts.URL)
+		if err != nil {
+			return nil, wrap("get credentials for", err)
+		}
+	}
+	remote, err := repo.Remote(remoteName)
+	if err != nil {
+		return nil, wrap("init", err)
+	}
+
+	advertised, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, InsecureSkipTLS: !opts.SSLVerify})
+	if err != nil {
+		return nil, wrap("list refs of", classifyTransportError(err))
+	}
+	ref, refSpecs, shallow, err := resolveRevision(opts.Revision, advertised)
+	if err != nil {
+		return nil, wrap("resolve", err)
+	}
+	if shallow && opts.Depth > 0 {
+		opts.Logger.Debugf("Fetching %s with depth %d ...", opts.Revision, opts.Depth)
+	} else {
+		opts.Depth = 0
+	}
+	for _, s := range opts.RefSpecs {
+		refSpecs = append(refSpecs, config.RefSpec(s))
+	}
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs:        refSpecs,
+		Depth:           opts.Depth,
+		Auth:            auth,
+		Tags:            git.NoTags,
+		Force:           true,
+		InsecureSkipTLS: !opts.SSLVerify,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, wrap("fetch", classifyTransportError(err))
+	}
+
+	hash, err := resolveCommit(repo, ref, opts.Revision)
+	if err != nil {
+		return nil, wrap("resolve", err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		return nil, wrap("checkout", err)
+	}
+	err = wt.Checkout(&git.CheckoutOptions{Hash: hash, Force: true})
+	if err != nil {
+		return nil, wrap("checkout", err)
+	}
+
+	if opts.Submodules {
+		err = updateSubmodules(ctx, wt, submoduleFetchOptions{
+			auth:            auth,
+			insecureSkipTLS: !opts.SSLVerify,
+			depth:           int(git.DefaultSubmoduleRecursionDepth),
+			logger:          opts.Logger,
+		})
+		if err != nil {
+			return nil, wrap("update submodules of", classifyTransportError(err))
+		}
+	}
+
+	res := &Result{CommitSHA: hash.String()}
+	if ref != nil {
+		res.Ref = ref.Name().String()
+	}
+	return res, nil
+}
+
+// submoduleFetchOptions configures updateSubmodules.
+type submoduleFetchOptions struct {
+	auth            transport.AuthMethod
+	insecureSkipTLS bool
+	// depth is the number of levels of nested submodules to update.
+	depth  int
+	logger logging.LeveledLoggerInterface
+}
+
+// updateSubmodules initializes the submodules of wt and checks out the
+// commits recorded in the index, recursing into nested submodules. This is
+// what Submodules.UpdateContext does, except that the submodules are
+// fetched with the TLS settings of the checkout, which go-git does not
+// support for submodule updates.
+func updateSubmodules(ctx context.Context, wt *git.Worktree, opts submoduleFetchOptions) error {
+	subs, err := wt.Submodules()
+	if err != nil {
+		return err
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	opts.logger.Infof("Updating %d submodule(s) ...", len(subs))
+	for _, sub := range subs {
+		err := sub.Init()
+		if err != nil && !errors.Is(err, git.ErrSubmoduleAlreadyInitialized) {
+			return fmt.Errorf("could not init submodule %s: %w", sub.Config().Name, err)
+		}
+		status, err := sub.Status()
+		if err != nil {
+			return fmt.Errorf("could not get status of submodule %s: %w", sub.Config().Name, err)
+		}
+		subRepo, err := sub.Repository()
+		if err != nil {
+			return fmt.Errorf("could not open submodule %s: %w", sub.Config().Name, err)
+		}
+		err = subRepo.FetchContext(ctx, &git.FetchOptions{
+			Auth:            opts.auth,
+			InsecureSkipTLS: opts.insecureSkipTLS,
+		})
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return err
+		}
+		// The recorded commit might not be reachable from any ref.
+		if _, err := subRepo.CommitObject(status.Expected); err != nil {
+			err = subRepo.FetchContext(ctx, &git.FetchOptions{
+				RefSpecs:        []config.RefSpec{config.RefSpec("+" + status.Expected.String() + ":" + status.Expected.String())},
+				Auth:            opts.auth,
+				InsecureSkipTLS: opts.insecureSkipTLS,
+			})
+			if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+				return err
+			}
+		}
+		subWt, err := subRepo.Worktree()
+		if err != nil {
+			return err
+		}
+		err = subWt.Checkout(&git.CheckoutOptions{Hash: status.Expected, Force: true})
+		if err != nil {
+			return fmt.Errorf("could not checkout %s in submodule %s: %w", status.Expected, sub.Config().Name, err)
+		}
+		if opts.depth > 1 {
+			nested := opts
+			nested.depth--
+			err = updateSubmodules(ctx, subWt, nested)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// initRepository initializes a repository in dir, or opens the existing one,
+// and points its remote to url.
+func initRepository(dir, url string) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		repo, err = git.PlainOpen(dir)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = repo.DeleteRemote(remoteName)
+	if err != nil && !errors.Is(err, git.ErrRemoteNotFound) {
+		return nil, err
+	}
+	_, err = repo.CreateRemote(&config.RemoteConfig{
+		Name:  remoteName,
+		URLs:  []string{url},
+		Fetch: []config.RefSpec{config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remoteName))},
+	})
+	return repo, err
+}
+
+// resolveRevision finds the advertised ref matching revision. It returns the
+// ref (nil if revision is a commit SHA no ref points to), the refspecs to
+// fetch and whether a shallow fetch is possible.
+func resolveRevision(revision string, advertised []*plumbing.Reference) (*plumbing.Reference, []config.RefSpec, bool, error) {
+	refs := map[plumbing.ReferenceName]*plumbing.Reference{}
+	for _, r := range advertised {
+		refs[r.Name()] = r
+	}
+	candidates := []plumbing.ReferenceName{plumbing.ReferenceName(revision)}
+	if !strings.HasPrefix(revision, "refs/") {
+		candidates = []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(revision),
+			plumbing.NewTagReferenceName(revision),
+		}
+	}
+	for _, c := range candidates {
+		if r, ok := refs[c]; ok {
+			return r, []config.RefSpec{fetchRefSpec(c)}, true, nil
+		}
+	}
+	if commitSHARegexp.MatchString(revision) {
+		for _, r := range advertised {
+			if r.Hash().String() == revision && (r.Name().IsBranch() || r.Name().IsTag()) {
+				return r, []config.RefSpec{fetchRefSpec(r.Name())}, true, nil
+			}
+		}
+		// The commit is not the tip of any ref. As fetching by SHA is not
+		// supported, fetch the full history of all branches and tags.
+		return nil, []config.RefSpec{
+			config.RefSpec(fmt.Sprintf("+refs/heads/*:refs/remotes/%s/*", remoteName)),
+			"+refs/tags/*:refs/tags/*",
+		}, false, nil
+	}
+	return nil, nil, false, fmt.Errorf("%w: %s does not exist in the remote repository%s",
+		ErrRevisionNotFound, revision, availableBranchesHint(advertised))
+}
+
+// resolveCommit returns the commit the fetched ref (or the given SHA) points
+// to, peeling annotated tags.
+func resolveCommit(repo *git.Repository, ref *plumbing.Reference, revision string) (plumbing.Hash, error) {
+	var hash plumbing.Hash
+	if ref == nil {
+		hash = plumbing.NewHash(revision)
+	} else {
+		local, err := repo.Reference(localRefName(ref.Name()), true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("fetched ref %s not found: %w", ref.Name(), err)
+		}
+		hash = local.Hash()
+	}
+	if tag, err := repo.TagObject(hash); err == nil {
+		c, err := tag.Commit()
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("tag %s does not point to a commit: %w", tag.Name, err)
+		}
+		return c.Hash, nil
+	}
+	if _, err := repo.CommitObject(hash); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("%w: commit %s not found in any branch or tag", ErrRevisionNotFound, revision)
+	}
+	return hash, nil
+}
+
+// fetchRefSpec returns a refspec fetching name into its local counterpart.
+func fetchRefSpec(name plumbing.ReferenceName) config.RefSpec {
+	return config.RefSpec(fmt.Sprintf("+%s:%s", name, localRefName(name)))
+}
+
+// localRefName maps branches to remote-tracking refs. Other refs (tags, pull
+// request refs, ...) keep their name.
+func localRefName(name plumbing.ReferenceName) plumbing.ReferenceName {
+	if name.IsBranch() {
+		return plumbing.NewRemoteReferenceName(remoteName, name.Short())
+	}
+	return name
+}
+
+// availableBranchesHint lists (some of) the advertised branches for use in
+// error messages.
+func availableBranchesHint(advertised []*plumbing.Reference) string {
+	branches := []string{}
+	for _, r := range advertised {
+		if r.Name().IsBranch() {
+			branches = append(branches, r.Name().Short())
+		}
+	}
+	if len(branches) == 0 {
+		return " (no branches exist)"
+	}
+	sort.Strings(branches)
+	if len(branches) > maxListedBranches {
+		branches = append(branches[:maxListedBranches], "...")
+	}
+	return fmt.Sprintf(" (available branches: %s)", strings.Join(branches, ", "))
+}
+
+// classifyTransportError maps go-git transport errors to the errors of this
+// package, keeping the original message.
+func classifyTransportError(err error) error {
+	switch {
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return fmt.Errorf("%w: %s", ErrAuthentication, err)
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return ErrRepositoryNotFound
+	case errors.Is(err, git.NoMatchingRefSpecError{}):
+		return fmt.Errorf("%w: %s", ErrRevisionNotFound, err)
+	}
+	return err
+}
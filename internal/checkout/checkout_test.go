@@ -0,0 +1,248 @@
+package checkout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/format/index"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// testRemote is a local repository with a "master" and a "develop" branch,
+// and an annotated tag "v1.0.0" pointing to the first commit of master.
+type testRemote struct {
+	dir     string
+	commits []string // commits of master, oldest first
+	develop string
+}
+
+func TestCheckout(t *testing.T) {
+	remote := createTestRemote(t)
+	tests := map[string]struct {
+		revision   string
+		depth      int
+		wantSHA    string
+		wantRef    string
+		wantErr    error
+		wantErrMsg string
+	}{
+		"full branch ref": {
+			revision: "refs/heads/master",
+			wantSHA:  remote.commits[1],
+			wantRef:  "refs/heads/master",
+		},
+		"short branch name": {
+			revision: "develop",
+			wantSHA:  remote.develop,
+			wantRef:  "refs/heads/develop",
+		},
+		"shallow checkout": {
+			revision: "refs/heads/master",
+			depth:    1,
+			wantSHA:  remote.commits[1],
+			wantRef:  "refs/heads/master",
+		},
+		"annotated tag": {
+			revision: "refs/tags/v1.0.0",
+			wantSHA:  remote.commits[0],
+			wantRef:  "refs/tags/v1.0.0",
+		},
+		"commit which is not the tip of a ref": {
+			revision: remote.commits[0],
+			depth:    1,
+			wantSHA:  remote.commits[0],
+		},
+		"non-existing branch": {
+			revision:   "refs/heads/feature/foo",
+			wantErr:    ErrRevisionNotFound,
+			wantErrMsg: "available branches: develop, master",
+		},
+		"non-existing commit": {
+			revision: strings.Repeat("a", 40),
+			wantErr:  ErrRevisionNotFound,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			res, err := Checkout(context.TODO(), dir, Options{
+				URL:      remote.dir,
+				Revision: tc.revision,
+				Depth:    tc.depth,
+			})
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("want err: %s, got: %v", tc.wantErr, err)
+				}
+				var checkoutErr *Error
+				if !errors.As(err, &checkoutErr) || checkoutErr.Revision != tc.revision {
+					t.Fatalf("want structured error for %s, got: %v", tc.revision, err)
+				}
+				if !strings.Contains(err.Error(), tc.wantErrMsg) {
+					t.Fatalf("want err containing %q, got: %s", tc.wantErrMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.CommitSHA != tc.wantSHA {
+				t.Fatalf("want SHA: %s, got: %s", tc.wantSHA, res.CommitSHA)
+			}
+			if res.Ref != tc.wantRef {
+				t.Fatalf("want ref: %s, got: %s", tc.wantRef, res.Ref)
+			}
+			head, err := ioutil.ReadFile(filepath.Join(dir, ".git", "HEAD"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.TrimSpace(string(head)) != tc.wantSHA {
+				t.Fatalf("want detached HEAD at %s, got: %s", tc.wantSHA, head)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "README.md")); err != nil {
+				t.Fatalf("want worktree to be checked out: %s", err)
+			}
+		})
+	}
+}
+
+func TestCheckoutIntoExistingRepository(t *testing.T) {
+	remote := createTestRemote(t)
+	dir := t.TempDir()
+	for _, revision := range []string{"refs/heads/master", "refs/heads/develop"} {
+		res, err := Checkout(context.TODO(), dir, Options{URL: remote.dir, Revision: revision})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Ref != revision {
+			t.Fatalf("want ref: %s, got: %s", revision, res.Ref)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "develop.txt")); err != nil {
+		t.Fatalf("want develop to be checked out: %s", err)
+	}
+}
+
+func TestCheckoutRepositoryNotFound(t *testing.T) {
+	_, err := Checkout(context.TODO(), t.TempDir(), Options{
+		URL:      filepath.Join(t.TempDir(), "does-not-exist"),
+		Revision: "refs/heads/master",
+	})
+	if !errors.Is(err, ErrRepositoryNotFound) {
+		t.Fatalf("want err: %s, got: %v", ErrRepositoryNotFound, err)
+	}
+}
+
+func TestCheckoutSubmodules(t *testing.T) {
+	sub := createTestRemote(t)
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gitmodules := fmt.Sprintf("[submodule \"lib\"]\n\tpath = lib\n\turl = %s\n", sub.dir)
+	err = ioutil.WriteFile(filepath.Join(dir, ".gitmodules"), []byte(gitmodules), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Add(".gitmodules"); err != nil {
+		t.Fatal(err)
+	}
+	// Record the first commit of the submodule, which is not its tip.
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatal(err)
+	}
+	idx.Entries = append(idx.Entries, &index.Entry{
+		Name: "lib",
+		Mode: filemode.Submodule,
+		Hash: plumbing.NewHash(sub.commits[0]),
+	})
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := wt.Commit("Add submodule", &git.CommitOptions{Author: testSignature()}); err != nil {
+		t.Fatal(err)
+	}
+
+	checkoutDir := t.TempDir()
+	_, err = Checkout(context.TODO(), checkoutDir, Options{
+		URL:        dir,
+		Revision:   "refs/heads/master",
+		Submodules: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	readme, err := ioutil.ReadFile(filepath.Join(checkoutDir, "lib", "README.md"))
+	if err != nil {
+		t.Fatalf("want submodule to be checked out: %s", err)
+	}
+	if string(readme) != "first" {
+		t.Fatalf("want submodule at recorded commit, got README.md: %s", readme)
+	}
+}
+
+func createTestRemote(t *testing.T) *testRemote {
+	dir := t.TempDir()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wt, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote := &testRemote{dir: dir}
+	commit := func(file, content string) string {
+		err := ioutil.WriteFile(filepath.Join(dir, file), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := wt.Add(file); err != nil {
+			t.Fatal(err)
+		}
+		h, err := wt.Commit("Change "+file, &git.CommitOptions{Author: testSignature()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h.String()
+	}
+	remote.commits = append(remote.commits, commit("README.md", "first"))
+	_, err = repo.CreateTag("v1.0.0", plumbing.NewHash(remote.commits[0]), &git.CreateTagOptions{
+		Tagger:  testSignature(),
+		Message: "v1.0.0",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.commits = append(remote.commits, commit("README.md", "second"))
+	err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("develop"), Create: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote.develop = commit("develop.txt", "develop")
+	err = wt.Checkout(&git.CheckoutOptions{Branch: plumbing.Master})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return remote
+}
+
+func testSignature() *object.Signature {
+	return &object.Signature{Name: "Test", Email: "test@example.com", When: time.Now()}
+}
@@ -0,0 +1,35 @@
+package checkout
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrRevisionNotFound is returned when the remote does not advertise the
+	// requested revision.
+	ErrRevisionNotFound = errors.New("revision not found")
+	// ErrRepositoryNotFound is returned when the remote repository does not
+	// exist (or is not visible with the given credentials).
+	ErrRepositoryNotFound = errors.New("repository not found")
+	// ErrAuthentication is returned when the remote rejects the credentials.
+	ErrAuthentication = errors.New("authentication failed")
+)
+
+// Error describes a failed step of a checkout. Use errors.Is to check for
+// ErrRevisionNotFound, ErrRepositoryNotFound or ErrAuthentication.
+type Error struct {
+	// Op is the step which failed, e.g. "fetch" or "checkout".
+	Op       string
+	URL      string
+	Revision string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("could not %s %s@%s: %s", e.Op, e.URL, e.Revision, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opendevstack/pipeline/internal/approval"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// ApprovalOptions configures WaitForApproval.
+type ApprovalOptions struct {
+	// Context of the pipeline run, identifying the commit to deploy.
+	Context *pipelinectxt.ODSContext
+	// Environment to deploy to.
+	Environment *config.Environment
+	// ArtifactFilename is the name of the artifact in
+	// pipelinectxt.DeploymentsPath recording the approvals.
+	ArtifactFilename string
+}
+
+// WaitForApproval waits until the deployment has been approved if the
+// environment requires approval. Only approvals given from now on count. The
+// approvals are recorded in the artifact named opts.ArtifactFilename.
+func WaitForApproval(client approval.ClientInterface, opts ApprovalOptions, logger logging.LeveledLoggerInterface) error {
+	env := opts.Environment
+	if env.Approval == nil {
+		return nil
+	}
+	logger.Infof("Deployments to %s require approval ...", env.Name)
+	record, err := approval.Wait(client, approval.Request{
+		ProjectKey:  opts.Context.Project,
+		Repository:  opts.Context.Repository,
+		CommitSHA:   opts.Context.GitCommitSHA,
+		Environment: env.Name,
+		Approval:    env.Approval,
+		Since:       time.Now(),
+	}, approval.DefaultPollInterval, logger)
+	if err != nil {
+		return fmt.Errorf("deployment to %s not approved: %w", env.Name, err)
+	}
+	for _, a := range record.Approvals {
+		logger.Infof("Approved by %s (%s) at %s.", a.DisplayName, a.User, a.Date)
+	}
+	return pipelinectxt.WriteJsonArtifact(record, pipelinectxt.DeploymentsPath, opts.ArtifactFilename)
+}
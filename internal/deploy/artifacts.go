@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// Artifacts names and writes the artifacts of a deployment of the chart or
+// manifests in SourceDir to an environment.
+type Artifacts struct {
+	// SourceDir is the location of the chart or manifests.
+	SourceDir string
+	// DefaultDir is the default location of the chart or manifests.
+	// Artifacts of any other location are prefixed with the location.
+	DefaultDir string
+	// Environment is the name of the target environment.
+	Environment string
+}
+
+// Filename returns the name of the artifact, without extension.
+func (a Artifacts) Filename(name string) string {
+	trimmedSourceDir := strings.TrimPrefix(a.SourceDir, "./")
+	if trimmedSourceDir != a.DefaultDir {
+		name = fmt.Sprintf("%s-%s", strings.Replace(trimmedSourceDir, "/", "-", -1), name)
+	}
+	return fmt.Sprintf("%s-%s", name, a.Environment)
+}
+
+// WriteText writes content as text artifact into
+// pipelinectxt.DeploymentsPath.
+func (a Artifacts) WriteText(name string, content []byte) error {
+	err := os.MkdirAll(pipelinectxt.DeploymentsPath, 0755)
+	if err != nil {
+		return err
+	}
+	f := a.Filename(name) + ".txt"
+	return ioutil.WriteFile(filepath.Join(pipelinectxt.DeploymentsPath, f), content, 0644)
+}
+
+// WriteJSON writes in as JSON artifact into pipelinectxt.DeploymentsPath.
+func (a Artifacts) WriteJSON(name string, in interface{}) error {
+	return pipelinectxt.WriteJsonArtifact(in, pipelinectxt.DeploymentsPath, a.Filename(name)+".json")
+}
@@ -0,0 +1,58 @@
+package deploy
+
+import (
+	"testing"
+)
+
+func TestArtifactsFilename(t *testing.T) {
+	tests := map[string]struct {
+		name      string
+		artifacts Artifacts
+		want      string
+	}{
+		"default chart dir": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "./chart", DefaultDir: "chart", Environment: "foo-dev"},
+			want:      "diff-foo-dev",
+		},
+		"default chart dir without prefix": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "chart", DefaultDir: "chart", Environment: "dev"},
+			want:      "diff-dev",
+		},
+		"other chart dir": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "./foo-chart", DefaultDir: "chart", Environment: "qa"},
+			want:      "foo-chart-diff-qa",
+		},
+		"other chart dir without prefix": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "bar-chart", DefaultDir: "chart", Environment: "foo-qa"},
+			want:      "bar-chart-diff-foo-qa",
+		},
+		"nested chart dir": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "./some/path/chart", DefaultDir: "chart", Environment: "prod"},
+			want:      "some-path-chart-diff-prod",
+		},
+		"default manifests dir": {
+			name:      "apply",
+			artifacts: Artifacts{SourceDir: "./deploy", DefaultDir: "deploy", Environment: "qa"},
+			want:      "apply-qa",
+		},
+		"nested manifests dir": {
+			name:      "diff",
+			artifacts: Artifacts{SourceDir: "./some/path/k8s", DefaultDir: "deploy", Environment: "prod"},
+			want:      "some-path-k8s-diff-prod",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := tc.artifacts.Filename(tc.name)
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
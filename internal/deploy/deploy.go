@@ -0,0 +1,63 @@
+// Package deploy provides the steps shared by the deployment tasks, such as
+// resolving the target namespace, enforcing freeze windows and approvals,
+// copying images into the target namespace, writing deployment artifacts and
+// verifying the rollout.
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Namespace returns the namespace to deploy into for the given environment.
+// It defaults to "<project>-<environment>".
+func Namespace(project string, env *config.Environment) string {
+	if len(env.Namespace) > 0 {
+		return env.Namespace
+	}
+	return fmt.Sprintf("%s-%s", project, env.Name)
+}
+
+// Subrepos returns the subrepositories checked out into
+// pipelinectxt.SubreposPath, if any.
+func Subrepos() ([]fs.FileInfo, error) {
+	if _, err := os.Stat(pipelinectxt.SubreposPath); err != nil {
+		return nil, nil
+	}
+	subrepos, err := ioutil.ReadDir(pipelinectxt.SubreposPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not read subrepos dir: %w", err)
+	}
+	return subrepos, nil
+}
+
+// SetAPIToken sets the API token of the environment from the secret
+// referenced by env.APICredentialsSecret if the environment is located on
+// another cluster.
+func SetAPIToken(clientset kubernetes.Interface, namespace string, env *config.Environment) error {
+	if env.APIServer == "" {
+		return nil
+	}
+	token, err := tokenFromSecret(clientset, namespace, env.APICredentialsSecret)
+	if err != nil {
+		return fmt.Errorf("could not get token from secret %s: %w", env.APICredentialsSecret, err)
+	}
+	env.APIToken = token
+	return nil
+}
+
+func tokenFromSecret(clientset kubernetes.Interface, namespace, name string) (string, error) {
+	secret, err := clientset.CoreV1().Secrets(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	return string(secret.Data["token"]), nil
+}
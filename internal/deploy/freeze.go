@@ -0,0 +1,106 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// clusterConfigMap is the name of the ConfigMap holding cluster-wide
+	// settings.
+	clusterConfigMap = "ods-cluster"
+	// freezeWindowsKey is the key of clusterConfigMap holding the cluster-wide
+	// freeze windows.
+	freezeWindowsKey = "freezeWindows"
+)
+
+// FreezeOptions configures CheckFreeze.
+type FreezeOptions struct {
+	// Namespace holding the ods-cluster ConfigMap.
+	Namespace string
+	// Environment to deploy to.
+	Environment *config.Environment
+	// CommitSHA is the SHA of the commit to deploy.
+	CommitSHA string
+	// OverrideReason is the reason to deploy during a freeze window.
+	// Deployments during a freeze are refused if empty.
+	OverrideReason string
+	// ArtifactFilename is the name of the artifact in
+	// pipelinectxt.DeploymentsPath recording an override.
+	ArtifactFilename string
+}
+
+// CheckFreeze fails if a freeze window of the environment or of the cluster
+// is active, unless an override reason is given. Overrides are recorded in
+// the artifact named opts.ArtifactFilename.
+func CheckFreeze(clientset kubernetes.Interface, opts FreezeOptions, now time.Time, logger logging.LeveledLoggerInterface) error {
+	clusterWindows, err := ClusterFreezeWindows(clientset, opts.Namespace)
+	if err != nil {
+		return err
+	}
+	freeze, err := ActiveFreeze(opts.Environment, clusterWindows, now)
+	if err != nil {
+		return err
+	}
+	if freeze == nil {
+		return nil
+	}
+	reason := strings.TrimSpace(opts.OverrideReason)
+	if reason == "" {
+		return fmt.Errorf(
+			"deployments to %s are frozen (%s), set the freeze-override-reason parameter to deploy anyway",
+			opts.Environment.Name, freeze,
+		)
+	}
+	logger.Infof("Deploying to %s during freeze (%s). Reason: %s", opts.Environment.Name, freeze, reason)
+	return pipelinectxt.WriteJsonArtifact(
+		artifact.FreezeOverride{
+			Environment: opts.Environment.Name,
+			CommitSHA:   opts.CommitSHA,
+			Freeze:      freeze.String(),
+			Reason:      reason,
+			Date:        now.UTC().Format(time.RFC3339),
+		},
+		pipelinectxt.DeploymentsPath,
+		opts.ArtifactFilename,
+	)
+}
+
+// ClusterFreezeWindows reads the cluster-wide freeze windows. A missing
+// ConfigMap or key is not an error.
+func ClusterFreezeWindows(clientset kubernetes.Interface, namespace string) ([]config.ClusterFreezeWindow, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(context.TODO(), clusterConfigMap, metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get ConfigMap %s: %w", clusterConfigMap, err)
+	}
+	body, ok := cm.Data[freezeWindowsKey]
+	if !ok {
+		return nil, nil
+	}
+	windows, err := config.ReadClusterFreezeWindows([]byte(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not read %s of ConfigMap %s: %w", freezeWindowsKey, clusterConfigMap, err)
+	}
+	return windows, nil
+}
+
+// ActiveFreeze returns the freeze window of the environment or of the
+// cluster which is active at now, or nil if deployments are allowed.
+func ActiveFreeze(env *config.Environment, clusterWindows []config.ClusterFreezeWindow, now time.Time) (*config.FreezeWindow, error) {
+	windows := append([]config.FreezeWindow{}, env.Freezes...)
+	windows = append(windows, config.FreezeWindowsForStage(clusterWindows, env.Stage)...)
+	return config.ActiveFreeze(windows, now)
+}
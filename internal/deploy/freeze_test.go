@@ -0,0 +1,58 @@
+package deploy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+func TestActiveFreeze(t *testing.T) {
+	yearEnd := config.FreezeWindow{Name: "year-end", Start: "2021-12-20", End: "2022-01-02"}
+	clusterWindows := []config.ClusterFreezeWindow{
+		{FreezeWindow: yearEnd, Stages: []config.Stage{config.ProdStage}},
+	}
+	tests := map[string]struct {
+		env  *config.Environment
+		time time.Time
+		want string
+	}{
+		"environment freeze": {
+			env: &config.Environment{Name: "dev", Stage: config.DevStage, Freezes: []config.FreezeWindow{
+				{Name: "migration", Start: "2021-10-01T08:00:00Z", End: "2021-10-01T12:00:00Z"},
+			}},
+			time: time.Date(2021, 10, 1, 10, 0, 0, 0, time.UTC),
+			want: "migration",
+		},
+		"cluster freeze for stage": {
+			env:  &config.Environment{Name: "production", Stage: config.ProdStage},
+			time: time.Date(2021, 12, 24, 10, 0, 0, 0, time.UTC),
+			want: "year-end",
+		},
+		"cluster freeze for other stage": {
+			env:  &config.Environment{Name: "dev", Stage: config.DevStage},
+			time: time.Date(2021, 12, 24, 10, 0, 0, 0, time.UTC),
+		},
+		"no active freeze": {
+			env:  &config.Environment{Name: "production", Stage: config.ProdStage},
+			time: time.Date(2021, 10, 1, 10, 0, 0, 0, time.UTC),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ActiveFreeze(tc.env, clusterWindows, tc.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.want == "" {
+				if got != nil {
+					t.Fatalf("want no freeze, got: %s", got)
+				}
+				return
+			}
+			if got == nil || got.Name != tc.want {
+				t.Fatalf("want freeze: %s, got: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/opendevstack/pipeline/internal/command"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// serviceAccountTokenFile holds the token of the service account of the
+// pod, used to push into the registry of the cluster the pod runs in.
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// ImageArtifactFile is an image artifact file built by the repository or
+// one of its subrepositories.
+type ImageArtifactFile struct {
+	// Path of the artifact file.
+	Path string
+	// Subrepo is the name of the subrepository which built the image. Empty
+	// if the image was built by the repository itself.
+	Subrepo string
+}
+
+// CopyImagesOptions configures how images are copied into the target
+// namespace.
+type CopyImagesOptions struct {
+	// Namespace to copy the images into.
+	Namespace string
+	// Environment to copy the images into.
+	Environment *config.Environment
+	// CertDir is the location of the certificates to access the registries.
+	CertDir string
+	// SrcRegistryTLSVerify controls whether to TLS verify the source
+	// registry. The destination registry is verified by default if set.
+	SrcRegistryTLSVerify bool
+	// Debug enables debug output of skopeo.
+	Debug bool
+}
+
+// ImageArtifactFiles collects the image artifact files of the repository
+// and the given subrepositories.
+func ImageArtifactFiles(subrepos []fs.FileInfo) ([]ImageArtifactFile, error) {
+	files, err := imageArtifactFiles(pipelinectxt.ImageDigestsPath, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range subrepos {
+		f, err := imageArtifactFiles(
+			filepath.Join(pipelinectxt.SubreposPath, s.Name(), pipelinectxt.ImageDigestsPath), s.Name(),
+		)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
+
+func imageArtifactFiles(imageDigestsDir, subrepo string) ([]ImageArtifactFile, error) {
+	var files []ImageArtifactFile
+	if _, err := os.Stat(imageDigestsDir); err != nil {
+		return files, nil
+	}
+	f, err := ioutil.ReadDir(imageDigestsDir)
+	if err != nil {
+		return files, fmt.Errorf("could not read image digests dir: %w", err)
+	}
+	for _, fi := range f {
+		files = append(files, ImageArtifactFile{
+			Path:    filepath.Join(imageDigestsDir, fi.Name()),
+			Subrepo: subrepo,
+		})
+	}
+	return files, nil
+}
+
+// CopyImages copies the images described by the given artifact files into
+// the target namespace using skopeo, and returns the copied images.
+func CopyImages(files []ImageArtifactFile, opts CopyImagesOptions, logger logging.LeveledLoggerInterface) ([]artifact.DeployedImage, error) {
+	deployedImages := []artifact.DeployedImage{}
+	if len(files) == 0 {
+		return deployedImages, nil
+	}
+	// Get destination registry token from secret or file in pod.
+	destRegistryToken := opts.Environment.APIToken
+	if destRegistryToken == "" {
+		token, err := ioutil.ReadFile(serviceAccountTokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not get token from file %s: %w", serviceAccountTokenFile, err)
+		}
+		destRegistryToken = strings.TrimSpace(string(token))
+	}
+
+	logger.Infof("Copying images into namespace %s ...", opts.Namespace)
+	for _, f := range files {
+		var imageArtifact artifact.Image
+		artifactContent, err := ioutil.ReadFile(f.Path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read image artifact file %s: %w", f.Path, err)
+		}
+		err = json.Unmarshal(artifactContent, &imageArtifact)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"could not unmarshal image artifact file %s: %w.\nFile content:\n%s",
+				f.Path, err, string(artifactContent),
+			)
+		}
+		logger.Infof("Copying image %s ...", imageArtifact.Name)
+		srcImageURL := imageArtifact.Image
+		destImageURL, destRegistryTLSVerify := destImage(imageArtifact, opts.Namespace, opts.Environment, opts.SrcRegistryTLSVerify)
+		srcRegistryTLSVerify := opts.SrcRegistryTLSVerify
+		// TLS verification of the KinD registry is not possible at the moment as
+		// requests error out with "server gave HTTP response to HTTPS client".
+		if strings.HasPrefix(imageArtifact.Registry, "kind-registry.kind") {
+			srcRegistryTLSVerify = false
+		}
+		// Outside of DEV, ensure that exactly the image which has been built
+		// (and tested) for the Git commit is promoted.
+		if opts.Environment.Stage != config.DevStage {
+			digest, err := inspectDigest(srcImageURL, srcRegistryTLSVerify, opts.CertDir, opts.Debug)
+			if err != nil {
+				return nil, fmt.Errorf("could not inspect image %s: %w", imageArtifact.Name, err)
+			}
+			srcImageURL, err = verifiedSourceImage(imageArtifact, digest)
+			if err != nil {
+				return nil, err
+			}
+			logger.Infof("Verified digest %s of image %s.", digest, imageArtifact.Name)
+		}
+		logger.Infof("src=%s", srcImageURL)
+		logger.Infof("dest=%s", destImageURL)
+		skopeoCopyArgs := []string{
+			"copy",
+			fmt.Sprintf("--src-tls-verify=%v", srcRegistryTLSVerify),
+			fmt.Sprintf("--dest-tls-verify=%v", destRegistryTLSVerify),
+		}
+		if srcRegistryTLSVerify {
+			skopeoCopyArgs = append(skopeoCopyArgs, fmt.Sprintf("--src-cert-dir=%v", opts.CertDir))
+		}
+		if destRegistryTLSVerify {
+			skopeoCopyArgs = append(skopeoCopyArgs, fmt.Sprintf("--dest-cert-dir=%v", opts.CertDir))
+		}
+		if len(destRegistryToken) > 0 {
+			skopeoCopyArgs = append(skopeoCopyArgs, "--dest-registry-token", destRegistryToken)
+		}
+		if opts.Debug {
+			skopeoCopyArgs = append(skopeoCopyArgs, "--debug")
+		}
+		stdout, stderr, err := command.Run(
+			"skopeo", append(
+				skopeoCopyArgs,
+				fmt.Sprintf("docker://%s", srcImageURL),
+				fmt.Sprintf("docker://%s", destImageURL),
+			),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not copy image %s: %w\n%s", imageArtifact.Name, err, string(stderr))
+		}
+		logger.Infof("%s", stdout)
+		deployedImages = append(deployedImages, artifact.DeployedImage{
+			Name:    imageArtifact.Name,
+			Image:   destImageURL,
+			Digest:  strings.TrimSpace(imageArtifact.Digest),
+			Subrepo: f.Subrepo,
+		})
+	}
+	return deployedImages, nil
+}
+
+// inspectDigest returns the digest of the manifest of imageURL as reported
+// by the registry.
+func inspectDigest(imageURL string, tlsVerify bool, certDir string, debug bool) (string, error) {
+	args := []string{
+		"inspect",
+		fmt.Sprintf("--format=%s", "{{.Digest}}"),
+		fmt.Sprintf("--tls-verify=%v", tlsVerify),
+	}
+	if tlsVerify {
+		args = append(args, fmt.Sprintf("--cert-dir=%v", certDir))
+	}
+	if debug {
+		args = append(args, "--debug")
+	}
+	stdout, stderr, err := command.Run("skopeo", append(args, fmt.Sprintf("docker://%s", imageURL)))
+	if err != nil {
+		return "", fmt.Errorf("%w\n%s", err, string(stderr))
+	}
+	return strings.TrimSpace(string(stdout)), nil
+}
+
+// verifiedSourceImage returns the reference of img pinned to its recorded
+// digest. An error is returned if no digest has been recorded, or if the
+// recorded digest differs from digest, the digest the registry reports for
+// the image.
+func verifiedSourceImage(img artifact.Image, digest string) (string, error) {
+	recorded := strings.TrimSpace(img.Digest)
+	if recorded == "" {
+		return "", fmt.Errorf("no digest recorded for image %s, refusing to promote it", img.Name)
+	}
+	if recorded != digest {
+		return "", fmt.Errorf(
+			"digest of image %s in the registry (%s) does not match the recorded digest (%s), refusing to promote it",
+			img.Image, digest, recorded,
+		)
+	}
+	repository := img.Image
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository = repository[:i]
+	}
+	return fmt.Sprintf("%s@%s", repository, recorded), nil
+}
+
+// destImage returns the location of the image in the target namespace, and
+// whether to TLS verify the destination registry.
+func destImage(img artifact.Image, namespace string, env *config.Environment, srcRegistryTLSVerify bool) (string, bool) {
+	// If the source registry should be TLS verified, the destination
+	// should be verified by default as well.
+	tlsVerify := srcRegistryTLSVerify
+	if len(env.RegistryHost) > 0 {
+		if env.RegistryTLSVerify != nil {
+			tlsVerify = *env.RegistryTLSVerify
+		}
+		return fmt.Sprintf("%s/%s/%s", env.RegistryHost, namespace, img.Name), tlsVerify
+	}
+	return strings.Replace(img.Image, "/"+img.Repository+"/", "/"+namespace+"/", -1), tlsVerify
+}
@@ -0,0 +1,117 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+func TestDestImage(t *testing.T) {
+	img := artifact.Image{
+		Image:      "image-registry.openshift-image-registry.svc:5000/foo-cd/bar:abc123",
+		Registry:   "image-registry.openshift-image-registry.svc:5000",
+		Repository: "foo-cd",
+		Name:       "bar",
+		Tag:        "abc123",
+	}
+	noVerify := false
+	tests := map[string]struct {
+		env           *config.Environment
+		srcTLSVerify  bool
+		wantImage     string
+		wantTLSVerify bool
+	}{
+		"same cluster": {
+			env:           &config.Environment{Name: "dev"},
+			srcTLSVerify:  true,
+			wantImage:     "image-registry.openshift-image-registry.svc:5000/foo-dev/bar:abc123",
+			wantTLSVerify: true,
+		},
+		"external registry": {
+			env:           &config.Environment{Name: "dev", RegistryHost: "registry.example.com"},
+			srcTLSVerify:  true,
+			wantImage:     "registry.example.com/foo-dev/bar",
+			wantTLSVerify: true,
+		},
+		"external registry without TLS verification": {
+			env:           &config.Environment{Name: "dev", RegistryHost: "registry.example.com", RegistryTLSVerify: &noVerify},
+			srcTLSVerify:  true,
+			wantImage:     "registry.example.com/foo-dev/bar",
+			wantTLSVerify: false,
+		},
+		"source registry without TLS verification": {
+			env:           &config.Environment{Name: "dev"},
+			srcTLSVerify:  false,
+			wantImage:     "image-registry.openshift-image-registry.svc:5000/foo-dev/bar:abc123",
+			wantTLSVerify: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotImage, gotTLSVerify := destImage(img, Namespace("foo", tc.env), tc.env, tc.srcTLSVerify)
+			if gotImage != tc.wantImage {
+				t.Fatalf("want image: %s, got: %s", tc.wantImage, gotImage)
+			}
+			if gotTLSVerify != tc.wantTLSVerify {
+				t.Fatalf("want TLS verify: %v, got: %v", tc.wantTLSVerify, gotTLSVerify)
+			}
+		})
+	}
+}
+
+func TestVerifiedSourceImage(t *testing.T) {
+	digest := "sha256:0b1a2a7fa0e5f7e5f1d8b3c2b7f2a6e2f1e8b3a1c2d3e4f5a6b7c8d9e0f1a2b3"
+	img := artifact.Image{
+		Image:      "image-registry.openshift-image-registry.svc:5000/foo-cd/bar:abc123",
+		Registry:   "image-registry.openshift-image-registry.svc:5000",
+		Repository: "foo-cd",
+		Name:       "bar",
+		Tag:        "abc123",
+	}
+	tests := map[string]struct {
+		recordedDigest string
+		digest         string
+		want           string
+		wantErr        bool
+	}{
+		"matching digest": {
+			recordedDigest: digest,
+			digest:         digest,
+			want:           "image-registry.openshift-image-registry.svc:5000/foo-cd/bar@" + digest,
+		},
+		"recorded digest with trailing newline": {
+			recordedDigest: digest + "\n",
+			digest:         digest,
+			want:           "image-registry.openshift-image-registry.svc:5000/foo-cd/bar@" + digest,
+		},
+		"differing digest": {
+			recordedDigest: digest,
+			digest:         "sha256:f00",
+			wantErr:        true,
+		},
+		"no recorded digest": {
+			digest:  digest,
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			i := img
+			i.Digest = tc.recordedDigest
+			got, err := verifiedSourceImage(i, tc.digest)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("want error, got: %s", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	k "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"k8s.io/client-go/kubernetes"
+)
+
+// rolloutPollInterval is the interval in which the rollout status is checked.
+const rolloutPollInterval = 5 * time.Second
+
+// RolloutOptions configures VerifyRollout.
+type RolloutOptions struct {
+	// Namespace deployed into.
+	Namespace string
+	// Environment deployed to.
+	Environment *config.Environment
+	// Filter selects the workloads of the deployment.
+	Filter k.WorkloadFilter
+	// Timeout is how long to wait for the rollout.
+	Timeout time.Duration
+}
+
+// VerifyRollout waits for the rollout of the workloads selected by
+// opts.Filter. clientset is used unless the environment is located on
+// another cluster.
+func VerifyRollout(clientset kubernetes.Interface, opts RolloutOptions, logger logging.LeveledLoggerInterface) error {
+	env := opts.Environment
+	if env.APIServer != "" {
+		c, err := k.NewClientsetForAPIServer(env.APIServer, env.APIToken)
+		if err != nil {
+			return fmt.Errorf("could not create Kubernetes client for %s: %w", env.APIServer, err)
+		}
+		clientset = c
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+	return k.WaitForRollout(ctx, clientset, opts.Namespace, opts.Filter, rolloutPollInterval, logger)
+}
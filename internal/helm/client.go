@@ -0,0 +1,207 @@
+package helm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+)
+
+// storageDriver is the Helm storage driver used for releases.
+const storageDriver = "secret"
+
+// DefaultTimeout is used for operations which wait for resources if no
+// timeout is given.
+const DefaultTimeout = 5 * time.Minute
+
+// ErrReleaseNotFound is returned when the release does not exist.
+var ErrReleaseNotFound = driver.ErrReleaseNotFound
+
+// UpgradeOptions configures an upgrade (or install) of a release.
+type UpgradeOptions struct {
+	// Install the release if it does not exist yet.
+	Install bool
+	// DryRun renders the release without applying it.
+	DryRun bool
+	// Wait until all resources are ready.
+	Wait bool
+	// WaitForJobs waits until all jobs completed. Requires Wait.
+	WaitForJobs bool
+	// Timeout for waiting. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// Atomic rolls back (or uninstalls) the release if the upgrade fails.
+	Atomic bool
+	// CleanupOnFail deletes new resources created by a failed upgrade.
+	CleanupOnFail bool
+	// Force resource updates through delete and recreate if needed.
+	Force bool
+	// ResetValues resets the values to the ones of the chart.
+	ResetValues bool
+	// ReuseValues reuses the values of the last release.
+	ReuseValues bool
+	// MaxHistory limits the number of revisions kept. Unlimited if zero.
+	MaxHistory int
+	// Description of the release.
+	Description string
+	// SkipCRDs skips installing CRDs.
+	SkipCRDs bool
+	// DisableHooks prevents hooks from running.
+	DisableHooks bool
+	// DisableOpenAPIValidation skips validating rendered templates against
+	// the Kubernetes OpenAPI schema.
+	DisableOpenAPIValidation bool
+}
+
+// ClientInterface represents the Helm operations on releases of a namespace.
+type ClientInterface interface {
+	History(releaseName string) ([]*release.Release, error)
+	Upgrade(releaseName, chartPath string, values map[string]interface{}, opts UpgradeOptions) (*release.Release, error)
+	Rollback(releaseName string, revision int, timeout time.Duration) error
+	Uninstall(releaseName string) error
+	Test(releaseName string, timeout time.Duration, logs io.Writer) (*release.Release, error)
+}
+
+// Client performs Helm operations using the Helm SDK.
+type Client struct {
+	cfg       *action.Configuration
+	namespace string
+}
+
+// ClientConfig configures a Helm client.
+type ClientConfig struct {
+	// Namespace of the releases.
+	Namespace string
+	// APIServer of the target cluster. If empty, the cluster in which the
+	// client runs is targeted.
+	APIServer string
+	// Token to authenticate against APIServer.
+	Token string
+	// Debug enables debug logging of Helm to Logs.
+	Debug bool
+	// Logs receives the debug log messages.
+	Logs io.Writer
+}
+
+// NewClient initializes a Helm client.
+func NewClient(clientConfig *ClientConfig) (*Client, error) {
+	if clientConfig.Namespace == "" {
+		return nil, errors.New("namespace is required")
+	}
+	flags := genericclioptions.NewConfigFlags(false)
+	flags.Namespace = &clientConfig.Namespace
+	if clientConfig.APIServer != "" {
+		flags.APIServer = &clientConfig.APIServer
+		flags.BearerToken = &clientConfig.Token
+	}
+	debugLog := func(format string, v ...interface{}) {
+		if clientConfig.Debug && clientConfig.Logs != nil {
+			fmt.Fprintf(clientConfig.Logs, format+"\n", v...)
+		}
+	}
+	cfg := &action.Configuration{}
+	err := cfg.Init(flags, clientConfig.Namespace, storageDriver, debugLog)
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize Helm: %w", err)
+	}
+	return &Client{cfg: cfg, namespace: clientConfig.Namespace}, nil
+}
+
+// History returns all revisions of the release. ErrReleaseNotFound is
+// returned if the release does not exist.
+func (c *Client) History(releaseName string) ([]*release.Release, error) {
+	return action.NewHistory(c.cfg).Run(releaseName)
+}
+
+// Upgrade upgrades the release to the chart at chartPath, using given values.
+// If opts.Install is set and the release does not exist yet, it is installed.
+func (c *Client) Upgrade(releaseName, chartPath string, values map[string]interface{}, opts UpgradeOptions) (*release.Release, error) {
+	ch, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, fmt.Errorf("could not load chart %s: %w", chartPath, err)
+	}
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	if opts.Install {
+		_, err := c.History(releaseName)
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			install := action.NewInstall(c.cfg)
+			install.ReleaseName = releaseName
+			install.Namespace = c.namespace
+			install.DryRun = opts.DryRun
+			install.Wait = opts.Wait
+			install.WaitForJobs = opts.WaitForJobs
+			install.Timeout = timeout
+			install.Atomic = opts.Atomic
+			install.Description = opts.Description
+			install.SkipCRDs = opts.SkipCRDs
+			install.DisableHooks = opts.DisableHooks
+			install.DisableOpenAPIValidation = opts.DisableOpenAPIValidation
+			return install.Run(ch, values)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	upgrade := action.NewUpgrade(c.cfg)
+	upgrade.Namespace = c.namespace
+	upgrade.DryRun = opts.DryRun
+	upgrade.Wait = opts.Wait
+	upgrade.WaitForJobs = opts.WaitForJobs
+	upgrade.Timeout = timeout
+	upgrade.Atomic = opts.Atomic
+	upgrade.CleanupOnFail = opts.CleanupOnFail
+	upgrade.Force = opts.Force
+	upgrade.ResetValues = opts.ResetValues
+	upgrade.ReuseValues = opts.ReuseValues
+	upgrade.MaxHistory = opts.MaxHistory
+	upgrade.Description = opts.Description
+	upgrade.SkipCRDs = opts.SkipCRDs
+	upgrade.DisableHooks = opts.DisableHooks
+	upgrade.DisableOpenAPIValidation = opts.DisableOpenAPIValidation
+	return upgrade.Run(releaseName, ch, values)
+}
+
+// Rollback rolls the release back to given revision and waits until all
+// resources are ready.
+func (c *Client) Rollback(releaseName string, revision int, timeout time.Duration) error {
+	rollback := action.NewRollback(c.cfg)
+	rollback.Version = revision
+	rollback.Wait = true
+	rollback.Timeout = timeout
+	if rollback.Timeout == 0 {
+		rollback.Timeout = DefaultTimeout
+	}
+	return rollback.Run(releaseName)
+}
+
+// Uninstall uninstalls the release.
+func (c *Client) Uninstall(releaseName string) error {
+	_, err := action.NewUninstall(c.cfg).Run(releaseName)
+	return err
+}
+
+// Test runs the test hooks of the release and writes the logs of the test
+// pods to logs. The returned release holds the outcome of each hook, also if
+// an error is returned because tests failed.
+func (c *Client) Test(releaseName string, timeout time.Duration, logs io.Writer) (*release.Release, error) {
+	test := action.NewReleaseTesting(c.cfg)
+	test.Namespace = c.namespace
+	test.Timeout = timeout
+	if test.Timeout == 0 {
+		test.Timeout = DefaultTimeout
+	}
+	rel, err := test.Run(releaseName)
+	if rel != nil && logs != nil {
+		if logErr := test.GetPodLogs(logs, rel); logErr != nil {
+			fmt.Fprintf(logs, "could not get logs of test pods: %s\n", logErr)
+		}
+	}
+	return rel, err
+}
@@ -0,0 +1,35 @@
+package helm
+
+import (
+	"github.com/opendevstack/pipeline/internal/manifest"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ReleaseNotPresentMessage starts the diff when the release does not exist.
+const ReleaseNotPresentMessage = "Release was not present in Helm.  Diff will show entire contents as new."
+
+// redactedValue replaces the values of secrets in diffs and values files.
+const redactedValue = manifest.RedactedValue
+
+// DiffOptions configures how releases are compared.
+type DiffOptions = manifest.DiffOptions
+
+// Diff compares the manifests of the current release with those of next and
+// returns a report of the changed resources, and whether there are any
+// changes. If current is nil, all resources of next are reported as added.
+// Resources are reported in a stable order, independent of the order in the
+// manifests. Hooks are not compared.
+func Diff(current, next *release.Release, opts DiffOptions) (string, bool, error) {
+	prefix := ""
+	currentManifest := ""
+	if current == nil {
+		prefix = ReleaseNotPresentMessage + "\n"
+	} else {
+		currentManifest = current.Manifest
+	}
+	diff, changed, err := manifest.Diff(currentManifest, next.Manifest, next.Namespace, opts)
+	if err != nil {
+		return "", false, err
+	}
+	return prefix + diff, changed, nil
+}
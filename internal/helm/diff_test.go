@@ -0,0 +1,165 @@
+package helm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+const deploymentManifest = `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:%s
+`
+
+const serviceManifest = `---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  ports:
+    - port: 8080
+`
+
+const secretManifest = `---
+# Source: app/templates/secret.yaml
+apiVersion: v1
+kind: Secret
+metadata:
+  name: app
+data:
+  password: %s
+  username: YWRtaW4=
+`
+
+func TestDiff(t *testing.T) {
+	tests := map[string]struct {
+		current     *release.Release
+		next        *release.Release
+		opts        DiffOptions
+		want        string
+		wantChanged bool
+	}{
+		"new release": {
+			next: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  serviceManifest + fmt.Sprintf(deploymentManifest, "v1"),
+			},
+			opts: DiffOptions{Context: -1},
+			want: `Release was not present in Helm.  Diff will show entire contents as new.
+foo-dev, app, Deployment (apps) has been added:
++ # Source: app/templates/deployment.yaml
++ apiVersion: apps/v1
++ kind: Deployment
++ metadata:
++   name: app
++ spec:
++   replicas: 1
++   template:
++     spec:
++       containers:
++         - name: app
++           image: app:v1
+foo-dev, app, Service (v1) has been added:
++ # Source: app/templates/service.yaml
++ apiVersion: v1
++ kind: Service
++ metadata:
++   name: app
++ spec:
++   ports:
++     - port: 8080
+`,
+			wantChanged: true,
+		},
+		"unchanged release in different order": {
+			current: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  serviceManifest + fmt.Sprintf(deploymentManifest, "v1"),
+			},
+			next: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  fmt.Sprintf(deploymentManifest, "v1") + serviceManifest,
+			},
+			opts: DiffOptions{Context: -1},
+			want: "",
+		},
+		"changed and removed resources with context": {
+			current: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  serviceManifest + fmt.Sprintf(deploymentManifest, "v1"),
+			},
+			next: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  fmt.Sprintf(deploymentManifest, "v2"),
+			},
+			opts: DiffOptions{Context: 1},
+			want: `foo-dev, app, Deployment (apps) has changed:
+...
+          - name: app
+-           image: app:v1
++           image: app:v2
+foo-dev, app, Service (v1) has been removed:
+- # Source: app/templates/service.yaml
+- apiVersion: v1
+- kind: Service
+- metadata:
+-   name: app
+- spec:
+-   ports:
+-     - port: 8080
+`,
+			wantChanged: true,
+		},
+		"suppressed secrets": {
+			current: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  fmt.Sprintf(secretManifest, "czNjcjN0"),
+			},
+			next: &release.Release{
+				Namespace: "foo-dev",
+				Manifest:  fmt.Sprintf(secretManifest, "bjN3czNjcjN0"),
+			},
+			opts: DiffOptions{Context: -1, SuppressSecrets: true},
+			want: `foo-dev, app, Secret (v1) has changed:
+  # Source: app/templates/secret.yaml
+  apiVersion: v1
+  kind: Secret
+  metadata:
+    name: app
+  data:
+-   password: ++++++++ # (8 bytes) changed
++   password: ++++++++ # (12 bytes) changed
+    username: ++++++++ # (8 bytes)
+`,
+			wantChanged: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, changed, err := Diff(tc.current, tc.next, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tc.wantChanged {
+				t.Fatalf("want changed: %v, got: %v", tc.wantChanged, changed)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("diff mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
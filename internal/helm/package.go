@@ -0,0 +1,21 @@
+package helm
+
+import (
+	"fmt"
+
+	"helm.sh/helm/v3/pkg/action"
+)
+
+// Package packages the chart in chartDir into an archive in dest, setting
+// the chart version and app version. It returns the path to the archive.
+func Package(chartDir, version, appVersion, dest string) (string, error) {
+	p := action.NewPackage()
+	p.Version = version
+	p.AppVersion = appVersion
+	p.Destination = dest
+	archive, err := p.Run(chartDir, nil)
+	if err != nil {
+		return "", fmt.Errorf("could not package chart %s: %w", chartDir, err)
+	}
+	return archive, nil
+}
@@ -0,0 +1,79 @@
+package helm
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// TestClient returns mocked releases.
+type TestClient struct {
+	// Releases contains the revisions of each release, keyed by name.
+	Releases map[string][]*release.Release
+	// UpgradeRelease is returned by Upgrade.
+	UpgradeRelease *release.Release
+	// FailUpgrade lets Upgrade fail.
+	FailUpgrade bool
+	// FailRollback lets Rollback and Uninstall fail.
+	FailRollback bool
+	// RolledBackTo contains the revisions passed to Rollback.
+	RolledBackTo []int
+	// Uninstalled contains the names of uninstalled releases.
+	Uninstalled []string
+	// TestRelease is returned by Test.
+	TestRelease *release.Release
+	// TestLogs are written to the logs passed to Test.
+	TestLogs string
+	// FailTest lets Test fail.
+	FailTest bool
+}
+
+// History returns the registered revisions of the release.
+func (c *TestClient) History(releaseName string) ([]*release.Release, error) {
+	revisions, ok := c.Releases[releaseName]
+	if !ok {
+		return nil, ErrReleaseNotFound
+	}
+	return revisions, nil
+}
+
+// Upgrade returns UpgradeRelease.
+func (c *TestClient) Upgrade(releaseName, chartPath string, values map[string]interface{}, opts UpgradeOptions) (*release.Release, error) {
+	if c.FailUpgrade {
+		return nil, errors.New("upgrade failed")
+	}
+	return c.UpgradeRelease, nil
+}
+
+// Rollback records the revision rolled back to.
+func (c *TestClient) Rollback(releaseName string, revision int, timeout time.Duration) error {
+	if c.FailRollback {
+		return errors.New("rollback failed")
+	}
+	c.RolledBackTo = append(c.RolledBackTo, revision)
+	return nil
+}
+
+// Uninstall records the uninstalled release.
+func (c *TestClient) Uninstall(releaseName string) error {
+	if c.FailRollback {
+		return errors.New("uninstall failed")
+	}
+	c.Uninstalled = append(c.Uninstalled, releaseName)
+	return nil
+}
+
+// Test writes TestLogs to logs and returns TestRelease.
+func (c *TestClient) Test(releaseName string, timeout time.Duration, logs io.Writer) (*release.Release, error) {
+	if logs != nil {
+		if _, err := io.WriteString(logs, c.TestLogs); err != nil {
+			return nil, err
+		}
+	}
+	if c.FailTest {
+		return c.TestRelease, errors.New("test failed")
+	}
+	return c.TestRelease, nil
+}
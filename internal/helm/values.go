@@ -0,0 +1,126 @@
+package helm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"go.mozilla.org/sops/v3/decrypt"
+	"helm.sh/helm/v3/pkg/strvals"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// sopsMetadataKey is the top-level key SOPS adds to encrypted files.
+	sopsMetadataKey = "sops"
+	// secretsFilePattern matches the names of secrets files, such as
+	// secrets.yaml or secrets.<ENVIRONMENT>.yaml.
+	secretsFilePattern = "secrets*.yaml"
+)
+
+// ReadValues reads the given values files and merges them in order, later
+// files taking precedence. Files encrypted with SOPS are decrypted, using
+// the age key referenced by the SOPS_AGE_KEY_FILE environment variable.
+// Finally, setValues (in the format of `helm --set`) are applied.
+func ReadValues(files []string, setValues []string) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, f := range files {
+		v, err := readValuesFile(f)
+		if err != nil {
+			return nil, err
+		}
+		values = mergeValues(values, v)
+	}
+	for _, s := range setValues {
+		if err := strvals.ParseInto(s, values); err != nil {
+			return nil, fmt.Errorf("could not parse value %q: %w", s, err)
+		}
+	}
+	return values, nil
+}
+
+func readValuesFile(filename string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not read values file: %w", err)
+	}
+	v := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("could not unmarshal values file %s: %w", filename, err)
+	}
+	if _, ok := v[sopsMetadataKey]; !ok {
+		return v, nil
+	}
+	cleartext, err := decrypt.Data(data, "yaml")
+	if err != nil {
+		return nil, fmt.Errorf("could not decrypt values file %s: %w", filename, err)
+	}
+	v = map[string]interface{}{}
+	if err := yaml.Unmarshal(cleartext, &v); err != nil {
+		return nil, fmt.Errorf("could not unmarshal decrypted values file %s: %w", filename, err)
+	}
+	return v, nil
+}
+
+// mergeValues merges src into dest, recursing into nested maps. Values of
+// src take precedence. This is how Helm merges multiple values files.
+func mergeValues(dest, src map[string]interface{}) map[string]interface{} {
+	for k, v := range src {
+		if nextSrc, ok := v.(map[string]interface{}); ok {
+			if nextDest, ok := dest[k].(map[string]interface{}); ok {
+				dest[k] = mergeValues(nextDest, nextSrc)
+				continue
+			}
+		}
+		dest[k] = v
+	}
+	return dest
+}
+
+// ReadRedactedValuesFile reads the values file without decrypting it. If the
+// file has been encrypted with SOPS, the SOPS metadata is removed and all
+// values are redacted, keeping only the structure of the file. Values of
+// secrets files (see IsSecretsFile) are redacted as well, even if they have
+// been committed unencrypted. The returned boolean is true if the file has
+// been encrypted.
+func ReadRedactedValuesFile(filename string) (map[string]interface{}, bool, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read values file: %w", err)
+	}
+	v := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, false, fmt.Errorf("could not unmarshal values file %s: %w", filename, err)
+	}
+	_, encrypted := v[sopsMetadataKey]
+	if !encrypted && !IsSecretsFile(filename) {
+		return v, false, nil
+	}
+	delete(v, sopsMetadataKey)
+	return redactValues(v).(map[string]interface{}), encrypted, nil
+}
+
+// IsSecretsFile returns true if filename is named like a secrets file
+// (secrets.yaml, secrets.<STAGE>.yaml or secrets.<ENVIRONMENT>.yaml).
+func IsSecretsFile(filename string) bool {
+	matched, _ := filepath.Match(secretsFilePattern, filepath.Base(filename))
+	return matched
+}
+
+// redactValues replaces all scalar values within v.
+func redactValues(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, e := range t {
+			t[k] = redactValues(e)
+		}
+		return t
+	case []interface{}:
+		for i, e := range t {
+			t[i] = redactValues(e)
+		}
+		return t
+	default:
+		return redactedValue
+	}
+}
@@ -0,0 +1,177 @@
+package helm
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/internal/projectpath"
+)
+
+func TestReadValues(t *testing.T) {
+	fixtures := filepath.Join(projectpath.Root, "test/testdata/fixtures/helm")
+	tests := map[string]struct {
+		files     []string
+		setValues []string
+		want      map[string]interface{}
+	}{
+		"single file": {
+			files: []string{"values.yaml"},
+			want: map[string]interface{}{
+				"replicaCount": float64(1),
+				"image": map[string]interface{}{
+					"repository": "helm-sample-app",
+					"tag":        "latest",
+					"pullPolicy": "IfNotPresent",
+				},
+			},
+		},
+		"later files take precedence": {
+			files: []string{"values.yaml", "values.dev.yaml"},
+			want: map[string]interface{}{
+				"replicaCount": float64(2),
+				"image": map[string]interface{}{
+					"repository": "helm-sample-app",
+					"tag":        "latest",
+					"pullPolicy": "Always",
+				},
+			},
+		},
+		"set values take precedence": {
+			files:     []string{"values.yaml"},
+			setValues: []string{"image.tag=abc123", "sub.image.tag=def456"},
+			want: map[string]interface{}{
+				"replicaCount": float64(1),
+				"image": map[string]interface{}{
+					"repository": "helm-sample-app",
+					"tag":        "abc123",
+					"pullPolicy": "IfNotPresent",
+				},
+				"sub": map[string]interface{}{
+					"image": map[string]interface{}{"tag": "def456"},
+				},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var files []string
+			for _, f := range tc.files {
+				files = append(files, filepath.Join(fixtures, f))
+			}
+			got, err := ReadValues(files, tc.setValues)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("values mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadValuesDecryptsSecrets(t *testing.T) {
+	secrets := filepath.Join(projectpath.Root, "test/testdata/workspaces/helm-sample-app/chart/secrets.yaml")
+	tests := map[string]struct {
+		ageKeyFile string
+		want       map[string]interface{}
+		wantErr    bool
+	}{
+		"with key": {
+			ageKeyFile: filepath.Join(projectpath.Root, "test/testdata/fixtures/helm/age-key.txt"),
+			want:       map[string]interface{}{"password": "s3cr3t"},
+		},
+		"without key": {
+			ageKeyFile: filepath.Join(projectpath.Root, "test/testdata/fixtures/helm/missing.txt"),
+			wantErr:    true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			previous, isSet := os.LookupEnv("SOPS_AGE_KEY_FILE")
+			os.Setenv("SOPS_AGE_KEY_FILE", tc.ageKeyFile)
+			defer func() {
+				if isSet {
+					os.Setenv("SOPS_AGE_KEY_FILE", previous)
+				} else {
+					os.Unsetenv("SOPS_AGE_KEY_FILE")
+				}
+			}()
+			got, err := ReadValues([]string{secrets}, nil)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("values mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestReadRedactedValuesFile(t *testing.T) {
+	tests := map[string]struct {
+		filename      string
+		want          map[string]interface{}
+		wantEncrypted bool
+	}{
+		"plain values file": {
+			filename: "test/testdata/fixtures/helm/values.dev.yaml",
+			want: map[string]interface{}{
+				"replicaCount": float64(2),
+				"image":        map[string]interface{}{"pullPolicy": "Always"},
+			},
+		},
+		"secrets file": {
+			filename:      "test/testdata/workspaces/helm-sample-app/chart/secrets.yaml",
+			want:          map[string]interface{}{"password": "++++++++"},
+			wantEncrypted: true,
+		},
+		"unencrypted secrets file": {
+			filename: "test/testdata/fixtures/helm/secrets.dev.yaml",
+			want: map[string]interface{}{
+				"database": map[string]interface{}{"user": "++++++++", "password": "++++++++"},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, encrypted, err := ReadRedactedValuesFile(filepath.Join(projectpath.Root, tc.filename))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if encrypted != tc.wantEncrypted {
+				t.Fatalf("want encrypted: %v, got: %v", tc.wantEncrypted, encrypted)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("values mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestIsSecretsFile(t *testing.T) {
+	tests := map[string]struct {
+		filename string
+		want     bool
+	}{
+		"secrets file":             {filename: "chart/secrets.yaml", want: true},
+		"stage secrets file":       {filename: "chart/secrets.qa.yaml", want: true},
+		"environment secrets file": {filename: "chart/secrets.prod-eu.yaml", want: true},
+		"values file":              {filename: "chart/values.yaml", want: false},
+		"secrets directory":        {filename: "secrets.yaml/values.yaml", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := IsSecretsFile(tc.filename); got != tc.want {
+				t.Fatalf("want: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+)
+
+// applyFieldManager owns the fields applied by the pipeline.
+const applyFieldManager = "ods-pipeline"
+
+// DefaultPruneKinds are the kinds considered for pruning next to the kinds
+// which are applied. Kinds unknown to the cluster are ignored.
+var DefaultPruneKinds = []schema.GroupKind{
+	{Group: "", Kind: "ConfigMap"},
+	{Group: "", Kind: "PersistentVolumeClaim"},
+	{Group: "", Kind: "Pod"},
+	{Group: "", Kind: "ReplicationController"},
+	{Group: "", Kind: "Secret"},
+	{Group: "", Kind: "Service"},
+	{Group: "apps", Kind: "DaemonSet"},
+	{Group: "apps", Kind: "Deployment"},
+	{Group: "apps", Kind: "StatefulSet"},
+	{Group: "batch", Kind: "CronJob"},
+	{Group: "batch", Kind: "Job"},
+	{Group: "networking.k8s.io", Kind: "Ingress"},
+	{Group: "route.openshift.io", Kind: "Route"},
+}
+
+// Applier applies objects into a namespace using server-side apply.
+type Applier struct {
+	client    dynamic.Interface
+	mapper    meta.RESTMapper
+	namespace string
+}
+
+// NewRESTConfig returns the config for the cluster at apiServer,
+// authenticating with given bearer token. If apiServer is empty, the
+// in-cluster config is returned.
+func NewRESTConfig(apiServer, token string) (*rest.Config, error) {
+	if apiServer == "" {
+		return rest.InClusterConfig()
+	}
+	return &rest.Config{
+		Host:        apiServer,
+		BearerToken: token,
+	}, nil
+}
+
+// NewApplier creates an applier for namespace in the cluster described by
+// config.
+func NewApplier(config *rest.Config, namespace string) (*Applier, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create dynamic client: %w", err)
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("could not create discovery client: %w", err)
+	}
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))
+	return newApplier(client, mapper, namespace), nil
+}
+
+func newApplier(client dynamic.Interface, mapper meta.RESTMapper, namespace string) *Applier {
+	return &Applier{client: client, mapper: mapper, namespace: namespace}
+}
+
+// Apply applies obj, taking ownership of conflicting fields. With dryRun,
+// the object is not persisted. The object as returned by the server is
+// returned. Namespaced objects without namespace are applied into the
+// namespace of the applier, objects in other namespaces are refused.
+func (a *Applier) Apply(ctx context.Context, obj *unstructured.Unstructured, dryRun bool) (*unstructured.Unstructured, error) {
+	ri, err := a.resourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal %s: %w", ObjectRef(obj), err)
+	}
+	force := true
+	opts := metav1.PatchOptions{FieldManager: applyFieldManager, Force: &force}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+	applied, err := ri.Patch(ctx, obj.GetName(), types.ApplyPatchType, data, opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not apply %s: %w", ObjectRef(obj), err)
+	}
+	return applied, nil
+}
+
+// Get returns the live state of obj, or nil if it does not exist.
+func (a *Applier) Get(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	ri, err := a.resourceFor(obj)
+	if err != nil {
+		return nil, err
+	}
+	live, err := ri.Get(ctx, obj.GetName(), metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get %s: %w", ObjectRef(obj), err)
+	}
+	return live, nil
+}
+
+// Delete deletes obj, ignoring objects which are already gone.
+func (a *Applier) Delete(ctx context.Context, obj *unstructured.Unstructured) error {
+	ri, err := a.resourceFor(obj)
+	if err != nil {
+		return err
+	}
+	propagation := metav1.DeletePropagationBackground
+	err = ri.Delete(ctx, obj.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !kerrors.IsNotFound(err) {
+		return fmt.Errorf("could not delete %s: %w", ObjectRef(obj), err)
+	}
+	return nil
+}
+
+// Prunable returns the objects in the namespace of the applier which match
+// selector but are not part of objs. The kinds of objs and
+// DefaultPruneKinds are considered. Cluster-scoped objects are never pruned.
+func (a *Applier) Prunable(ctx context.Context, selector string, objs []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	keep := map[string]bool{}
+	kinds := append([]schema.GroupKind{}, DefaultPruneKinds...)
+	for _, o := range objs {
+		keep[ObjectRef(o)] = true
+		kinds = append(kinds, o.GroupVersionKind().GroupKind())
+	}
+	prunable := []*unstructured.Unstructured{}
+	seen := map[schema.GroupVersionResource]bool{}
+	for _, gk := range kinds {
+		mapping, err := a.mapper.RESTMapping(gk)
+		if err != nil {
+			if meta.IsNoMatchError(err) {
+				continue
+			}
+			return nil, fmt.Errorf("could not map %s: %w", gk, err)
+		}
+		if seen[mapping.Resource] || mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+			continue
+		}
+		seen[mapping.Resource] = true
+		list, err := a.client.Resource(mapping.Resource).Namespace(a.namespace).List(
+			ctx, metav1.ListOptions{LabelSelector: selector},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("could not list %s: %w", mapping.Resource.Resource, err)
+		}
+		for i := range list.Items {
+			o := &list.Items[i]
+			if !keep[ObjectRef(o)] {
+				prunable = append(prunable, o)
+			}
+		}
+	}
+	return prunable, nil
+}
+
+// ObjectRef identifies obj like kubectl does, e.g. "deployment.apps/foo".
+func ObjectRef(obj *unstructured.Unstructured) string {
+	gk := obj.GroupVersionKind().GroupKind()
+	return fmt.Sprintf("%s/%s", strings.ToLower(gk.String()), obj.GetName())
+}
+
+// resourceFor returns the client for the resource of obj, and sets the
+// namespace of namespaced objects.
+func (a *Applier) resourceFor(obj *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := obj.GroupVersionKind()
+	mapping, err := a.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("could not map %s: %w", ObjectRef(obj), err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		return a.client.Resource(mapping.Resource), nil
+	}
+	switch obj.GetNamespace() {
+	case "":
+		obj.SetNamespace(a.namespace)
+	case a.namespace:
+	default:
+		return nil, fmt.Errorf(
+			"%s is in namespace %s, but objects can only be applied into %s",
+			ObjectRef(obj), obj.GetNamespace(), a.namespace,
+		)
+	}
+	return a.client.Resource(mapping.Resource).Namespace(a.namespace), nil
+}
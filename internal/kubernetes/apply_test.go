@@ -0,0 +1,125 @@
+package kubernetes
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+func object(apiVersion, kind, namespace, name string, labels map[string]string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(apiVersion)
+	obj.SetKind(kind)
+	obj.SetNamespace(namespace)
+	obj.SetName(name)
+	obj.SetLabels(labels)
+	return obj
+}
+
+func testApplier(objects ...runtime.Object) *Applier {
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{{Version: "v1"}, {Group: "apps", Version: "v1"}})
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Secret"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			{Version: "v1", Resource: "configmaps"}:                 "ConfigMapList",
+			{Version: "v1", Resource: "secrets"}:                    "SecretList",
+			{Group: "apps", Version: "v1", Resource: "deployments"}: "DeploymentList",
+			{Version: "v1", Resource: "namespaces"}:                 "NamespaceList",
+		},
+		objects...,
+	)
+	return newApplier(client, mapper, "foo-dev")
+}
+
+func TestPrunable(t *testing.T) {
+	labels := map[string]string{"pipeline.opendevstack.org/deployment": "foo"}
+	otherLabels := map[string]string{"pipeline.opendevstack.org/deployment": "bar"}
+	applier := testApplier(
+		object("v1", "ConfigMap", "foo-dev", "kept", labels),
+		object("v1", "ConfigMap", "foo-dev", "removed", labels),
+		object("v1", "ConfigMap", "foo-dev", "unlabeled", nil),
+		object("v1", "ConfigMap", "foo-dev", "other", otherLabels),
+		object("v1", "ConfigMap", "foo-qa", "other-namespace", labels),
+		object("v1", "Secret", "foo-dev", "removed", labels),
+		object("apps/v1", "Deployment", "foo-dev", "kept", labels),
+		object("v1", "Namespace", "", "cluster-scoped", labels),
+	)
+	got, err := applier.Prunable(
+		context.TODO(),
+		"pipeline.opendevstack.org/deployment=foo",
+		[]*unstructured.Unstructured{
+			object("v1", "ConfigMap", "", "kept", labels),
+			object("apps/v1", "Deployment", "", "kept", labels),
+			object("v1", "Namespace", "", "cluster-scoped", labels),
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotRefs := []string{}
+	for _, o := range got {
+		gotRefs = append(gotRefs, ObjectRef(o))
+	}
+	sort.Strings(gotRefs)
+	want := []string{"configmap/removed", "secret/removed"}
+	if diff := cmp.Diff(want, gotRefs); diff != "" {
+		t.Fatalf("prunable mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestApplierNamespace(t *testing.T) {
+	tests := map[string]struct {
+		obj           *unstructured.Unstructured
+		wantNamespace string
+		wantErr       bool
+	}{
+		"namespaced object without namespace": {
+			obj:           object("v1", "ConfigMap", "", "foo", nil),
+			wantNamespace: "foo-dev",
+		},
+		"namespaced object in target namespace": {
+			obj:           object("v1", "ConfigMap", "foo-dev", "foo", nil),
+			wantNamespace: "foo-dev",
+		},
+		"namespaced object in other namespace": {
+			obj:     object("v1", "ConfigMap", "foo-qa", "foo", nil),
+			wantErr: true,
+		},
+		"cluster-scoped object": {
+			obj: object("v1", "Namespace", "", "foo", nil),
+		},
+		"unknown kind": {
+			obj:     object("example.com/v1", "Foo", "", "foo", nil),
+			wantErr: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			applier := testApplier()
+			_, err := applier.resourceFor(tc.obj)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("want error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.obj.GetNamespace() != tc.wantNamespace {
+				t.Fatalf("want namespace: %q, got: %q", tc.wantNamespace, tc.obj.GetNamespace())
+			}
+		})
+	}
+}
@@ -57,6 +57,15 @@ func NewInClusterClientset() (*kubernetes.Clientset, error) {
 	return kubernetes.NewForConfig(config)
 }
 
+// NewClientsetForAPIServer creates a clientset for the cluster at apiServer,
+// authenticating with given bearer token.
+func NewClientsetForAPIServer(apiServer, token string) (*kubernetes.Clientset, error) {
+	return kubernetes.NewForConfig(&rest.Config{
+		Host:        apiServer,
+		BearerToken: token,
+	})
+}
+
 // Client represents a Kubernetes client, wrapping
 // k8s.io/client-go/kubernetes.Clientset
 type Client struct {
@@ -76,6 +85,7 @@ type ClientConfig struct {
 type ClientInterface interface {
 	ClientPersistentVolumeClaimInterface
 	ClientConfigMapInterface
+	ClientPodInterface
 }
 
 // NewInClusterClient initializes a Kubernetes client from within a cluster.
@@ -132,3 +142,7 @@ func (c *Client) persistentVolumeClaimsClient() clientCoreV1.PersistentVolumeCla
 func (c *Client) configMapsClient() clientCoreV1.ConfigMapInterface {
 	return c.coreV1Client().ConfigMaps(c.namespace())
 }
+
+func (c *Client) podsClient() clientCoreV1.PodInterface {
+	return c.coreV1Client().Pods(c.namespace())
+}
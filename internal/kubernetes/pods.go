@@ -0,0 +1,21 @@
+package kubernetes
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+type ClientPodInterface interface {
+	GetPodLogs(ctxt context.Context, podName string, options *corev1.PodLogOptions) (string, error)
+}
+
+// GetPodLogs retrieves the logs of a container of the pod identified by podName.
+func (c *Client) GetPodLogs(ctxt context.Context, podName string, options *corev1.PodLogOptions) (string, error) {
+	c.logger().Debugf("Get logs of pod %s", podName)
+	b, err := c.podsClient().GetLogs(podName, options).DoRaw(ctxt)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
@@ -10,6 +10,9 @@ import (
 type ClientPersistentVolumeClaimInterface interface {
 	GetPersistentVolumeClaim(ctxt context.Context, name string, options metav1.GetOptions) (*corev1.PersistentVolumeClaim, error)
 	CreatePersistentVolumeClaim(ctxt context.Context, pipeline *corev1.PersistentVolumeClaim, options metav1.CreateOptions) (*corev1.PersistentVolumeClaim, error)
+	UpdatePersistentVolumeClaim(ctxt context.Context, pvc *corev1.PersistentVolumeClaim, options metav1.UpdateOptions) (*corev1.PersistentVolumeClaim, error)
+	DeletePersistentVolumeClaim(ctxt context.Context, name string, options metav1.DeleteOptions) error
+	ListPersistentVolumeClaims(ctxt context.Context, options metav1.ListOptions) (*corev1.PersistentVolumeClaimList, error)
 }
 
 func (c *Client) GetPersistentVolumeClaim(ctxt context.Context, name string, options metav1.GetOptions) (*corev1.PersistentVolumeClaim, error) {
@@ -21,3 +24,18 @@ func (c *Client) CreatePersistentVolumeClaim(ctxt context.Context, pvc *corev1.P
 	c.logger().Debugf("Create persistent volume claim %s", pvc.Name)
 	return c.persistentVolumeClaimsClient().Create(ctxt, pvc, options)
 }
+
+func (c *Client) UpdatePersistentVolumeClaim(ctxt context.Context, pvc *corev1.PersistentVolumeClaim, options metav1.UpdateOptions) (*corev1.PersistentVolumeClaim, error) {
+	c.logger().Debugf("Update persistent volume claim %s", pvc.Name)
+	return c.persistentVolumeClaimsClient().Update(ctxt, pvc, options)
+}
+
+func (c *Client) DeletePersistentVolumeClaim(ctxt context.Context, name string, options metav1.DeleteOptions) error {
+	c.logger().Debugf("Delete persistent volume claim %s", name)
+	return c.persistentVolumeClaimsClient().Delete(ctxt, name, options)
+}
+
+func (c *Client) ListPersistentVolumeClaims(ctxt context.Context, options metav1.ListOptions) (*corev1.PersistentVolumeClaimList, error) {
+	c.logger().Debugf("List persistent volume claims")
+	return c.persistentVolumeClaimsClient().List(ctxt, options)
+}
@@ -0,0 +1,212 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// helmReleaseNameAnnotation is set by Helm on all resources of a release.
+const helmReleaseNameAnnotation = "meta.helm.sh/release-name"
+
+// crashLoopReasons are the waiting reasons of containers which will not
+// become ready without intervention.
+var crashLoopReasons = map[string]bool{
+	"CrashLoopBackOff":           true,
+	"ImagePullBackOff":           true,
+	"ErrImagePull":               true,
+	"CreateContainerConfigError": true,
+	"InvalidImageName":           true,
+}
+
+// ErrCrashLoop is returned when a pod of a workload is crash-looping.
+var ErrCrashLoop = errors.New("pod is crash-looping")
+
+// WorkloadFilter selects the workloads to wait for.
+type WorkloadFilter func(meta metav1.ObjectMeta) bool
+
+// HelmReleaseFilter selects the workloads belonging to given Helm release.
+func HelmReleaseFilter(release string) WorkloadFilter {
+	return func(meta metav1.ObjectMeta) bool {
+		return meta.Annotations[helmReleaseNameAnnotation] == release
+	}
+}
+
+// LabelFilter selects the workloads labeled with given key and value.
+func LabelFilter(key, value string) WorkloadFilter {
+	return func(meta metav1.ObjectMeta) bool {
+		return meta.Labels[key] == value
+	}
+}
+
+// WaitForRollout waits until all Deployments and StatefulSets in namespace
+// selected by filter are rolled out completely. It fails early if any of
+// their pods is crash-looping, and when ctx is done (e.g. on timeout).
+func WaitForRollout(ctx context.Context, clientset kubernetes.Interface, namespace string, filter WorkloadFilter, interval time.Duration, logger logging.LeveledLoggerInterface) error {
+	for {
+		pending, err := pendingRollouts(ctx, clientset, namespace, filter)
+		if err != nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		logger.Infof("Waiting for rollout: %s", strings.Join(pending, "; "))
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("rollout did not complete: %s: %w", strings.Join(pending, "; "), ctx.Err())
+		case <-time.After(interval):
+		}
+	}
+}
+
+// pendingRollouts returns a description of each workload which is not rolled
+// out yet.
+func pendingRollouts(ctx context.Context, clientset kubernetes.Interface, namespace string, filter WorkloadFilter) ([]string, error) {
+	var pending []string
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list deployments: %w", err)
+	}
+	for _, d := range deployments.Items {
+		if !filter(d.ObjectMeta) {
+			continue
+		}
+		msg, err := deploymentStatus(&d)
+		if err != nil {
+			return nil, err
+		}
+		if msg != "" {
+			if err := checkCrashLoop(ctx, clientset, namespace, d.Spec.Selector); err != nil {
+				return nil, fmt.Errorf("deployment %s: %w", d.Name, err)
+			}
+			pending = append(pending, msg)
+		}
+	}
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("could not list statefulsets: %w", err)
+	}
+	for _, s := range statefulSets.Items {
+		if !filter(s.ObjectMeta) {
+			continue
+		}
+		if msg := statefulSetStatus(&s); msg != "" {
+			if err := checkCrashLoop(ctx, clientset, namespace, s.Spec.Selector); err != nil {
+				return nil, fmt.Errorf("statefulset %s: %w", s.Name, err)
+			}
+			pending = append(pending, msg)
+		}
+	}
+	return pending, nil
+}
+
+// deploymentStatus returns a description of the rollout progress, or an
+// empty string if the rollout is complete. It fails if the progress deadline
+// of the deployment has been exceeded. The logic follows
+// `kubectl rollout status`.
+func deploymentStatus(d *appsv1.Deployment) (string, error) {
+	if d.Generation > d.Status.ObservedGeneration {
+		return fmt.Sprintf("deployment %s: waiting for spec update to be observed", d.Name), nil
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing && c.Reason == "ProgressDeadlineExceeded" {
+			return "", fmt.Errorf("deployment %s exceeded its progress deadline", d.Name)
+		}
+	}
+	replicas := int32(1)
+	if d.Spec.Replicas != nil {
+		replicas = *d.Spec.Replicas
+	}
+	switch {
+	case d.Status.UpdatedReplicas < replicas:
+		return fmt.Sprintf("deployment %s: %d of %d replicas updated", d.Name, d.Status.UpdatedReplicas, replicas), nil
+	case d.Status.Replicas > d.Status.UpdatedReplicas:
+		return fmt.Sprintf("deployment %s: %d old replicas pending termination", d.Name, d.Status.Replicas-d.Status.UpdatedReplicas), nil
+	case d.Status.AvailableReplicas < d.Status.UpdatedReplicas:
+		return fmt.Sprintf("deployment %s: %d of %d updated replicas available", d.Name, d.Status.AvailableReplicas, d.Status.UpdatedReplicas), nil
+	}
+	return "", nil
+}
+
+// statefulSetStatus returns a description of the rollout progress, or an
+// empty string if the rollout is complete. The logic follows
+// `kubectl rollout status`.
+func statefulSetStatus(s *appsv1.StatefulSet) string {
+	if s.Spec.UpdateStrategy.Type == appsv1.OnDeleteStatefulSetStrategyType {
+		return ""
+	}
+	if s.Generation > s.Status.ObservedGeneration {
+		return fmt.Sprintf("statefulset %s: waiting for spec update to be observed", s.Name)
+	}
+	replicas := int32(1)
+	if s.Spec.Replicas != nil {
+		replicas = *s.Spec.Replicas
+	}
+	if s.Status.ReadyReplicas < replicas {
+		return fmt.Sprintf("statefulset %s: %d of %d replicas ready", s.Name, s.Status.ReadyReplicas, replicas)
+	}
+	if ru := s.Spec.UpdateStrategy.RollingUpdate; ru != nil && ru.Partition != nil && *ru.Partition > 0 {
+		if s.Status.UpdatedReplicas < replicas-*ru.Partition {
+			return fmt.Sprintf("statefulset %s: %d of %d replicas updated", s.Name, s.Status.UpdatedReplicas, replicas-*ru.Partition)
+		}
+		return ""
+	}
+	if s.Status.UpdateRevision != s.Status.CurrentRevision {
+		return fmt.Sprintf("statefulset %s: %d of %d replicas updated", s.Name, s.Status.UpdatedReplicas, replicas)
+	}
+	return ""
+}
+
+// checkCrashLoop returns an error wrapping ErrCrashLoop if any pod matched
+// by selector has a container which is crash-looping.
+func checkCrashLoop(ctx context.Context, clientset kubernetes.Interface, namespace string, selector *metav1.LabelSelector) error {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: s.String()})
+	if err != nil {
+		return fmt.Errorf("could not list pods: %w", err)
+	}
+	for _, p := range pods.Items {
+		if msg := crashLoopMessage(&p); msg != "" {
+			return fmt.Errorf("%w: %s", ErrCrashLoop, msg)
+		}
+	}
+	return nil
+}
+
+// crashLoopMessage describes the first crash-looping container of the pod,
+// or returns an empty string if there is none.
+func crashLoopMessage(p *corev1.Pod) string {
+	statuses := append([]corev1.ContainerStatus{}, p.Status.InitContainerStatuses...)
+	statuses = append(statuses, p.Status.ContainerStatuses...)
+	for _, cs := range statuses {
+		if cs.State.Waiting == nil || !crashLoopReasons[cs.State.Waiting.Reason] {
+			continue
+		}
+		msg := fmt.Sprintf(
+			"pod %s, container %s: %s (%d restarts)",
+			p.Name, cs.Name, cs.State.Waiting.Reason, cs.RestartCount,
+		)
+		if t := cs.LastTerminationState.Terminated; t != nil {
+			msg += fmt.Sprintf(", last exit code %d (%s)", t.ExitCode, t.Reason)
+			if t.Message != "" {
+				msg += ": " + strings.TrimSpace(t.Message)
+			}
+		} else if cs.State.Waiting.Message != "" {
+			msg += ": " + cs.State.Waiting.Message
+		}
+		return msg
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/logging"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestWaitForRollout(t *testing.T) {
+	replicas := int32(2)
+	deployment := func(name, release string, status appsv1.DeploymentStatus) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "foo-dev",
+				Annotations: map[string]string{helmReleaseNameAnnotation: release},
+			},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": name}},
+			},
+			Status: status,
+		}
+	}
+	crashingPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "api-7d4b9-x2x8z", Namespace: "foo-dev", Labels: map[string]string{"app": "api"}},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:         "api",
+			RestartCount: 4,
+			State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{
+				Reason: "CrashLoopBackOff",
+			}},
+			LastTerminationState: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{
+				ExitCode: 1, Reason: "Error", Message: "missing DATABASE_URL\n",
+			}},
+		}}},
+	}
+	ready := appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+	tests := map[string]struct {
+		objects  []runtime.Object
+		wantErr  string
+		crashing bool
+	}{
+		"rolled out": {
+			objects: []runtime.Object{deployment("api", "foo", ready)},
+		},
+		"ignores other releases": {
+			objects: []runtime.Object{
+				deployment("api", "foo", ready),
+				deployment("other", "bar", appsv1.DeploymentStatus{Replicas: 2}),
+			},
+		},
+		"not rolled out": {
+			objects: []runtime.Object{
+				deployment("api", "foo", appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 2, AvailableReplicas: 2}),
+			},
+			wantErr: "rollout did not complete: deployment api: 1 old replicas pending termination: context deadline exceeded",
+		},
+		"crash-looping": {
+			objects: []runtime.Object{
+				deployment("api", "foo", appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2}),
+				crashingPod,
+			},
+			wantErr:  "deployment api: pod is crash-looping: pod api-7d4b9-x2x8z, container api: CrashLoopBackOff (4 restarts), last exit code 1 (Error): missing DATABASE_URL",
+			crashing: true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tc.objects...)
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := WaitForRollout(
+				ctx, clientset, "foo-dev", HelmReleaseFilter("foo"), time.Millisecond,
+				&logging.LeveledLogger{Level: logging.LevelNull},
+			)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("want err: %q, got: %v", tc.wantErr, err)
+			}
+			if errors.Is(err, ErrCrashLoop) != tc.crashing {
+				t.Fatalf("want ErrCrashLoop: %v, got: %v", tc.crashing, err)
+			}
+		})
+	}
+}
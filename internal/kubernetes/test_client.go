@@ -18,8 +18,14 @@ type TestClient struct {
 	FailCreatePVC bool
 	// CreatedPVCs is a slice of created PVC names.
 	CreatedPVCs []string
+	// UpdatedPVCs is a slice of updated PVCs.
+	UpdatedPVCs []*corev1.PersistentVolumeClaim
+	// DeletedPVCs is a slice of deleted PVC names.
+	DeletedPVCs []string
 	// ConfigMaps which can be retrieved
 	CMs []*corev1.ConfigMap
+	// PodLogs contains logs per pod and container, keyed by "<pod>/<container>".
+	PodLogs map[string]string
 }
 
 func (c *TestClient) GetPersistentVolumeClaim(ctxt context.Context, name string, options metav1.GetOptions) (*corev1.PersistentVolumeClaim, error) {
@@ -42,6 +48,30 @@ func (c *TestClient) CreatePersistentVolumeClaim(ctxt context.Context, pipeline
 	return pipeline, nil
 }
 
+func (c *TestClient) UpdatePersistentVolumeClaim(ctxt context.Context, pvc *corev1.PersistentVolumeClaim, options metav1.UpdateOptions) (*corev1.PersistentVolumeClaim, error) {
+	c.UpdatedPVCs = append(c.UpdatedPVCs, pvc)
+	return pvc, nil
+}
+
+func (c *TestClient) DeletePersistentVolumeClaim(ctxt context.Context, name string, options metav1.DeleteOptions) error {
+	c.DeletedPVCs = append(c.DeletedPVCs, name)
+	for i, p := range c.PVCs {
+		if p.Name == name {
+			c.PVCs = append(c.PVCs[:i], c.PVCs[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (c *TestClient) ListPersistentVolumeClaims(ctxt context.Context, options metav1.ListOptions) (*corev1.PersistentVolumeClaimList, error) {
+	items := []corev1.PersistentVolumeClaim{}
+	for _, p := range c.PVCs {
+		items = append(items, *p)
+	}
+	return &corev1.PersistentVolumeClaimList{Items: items}, nil
+}
+
 func (c *TestClient) GetConfigMap(ctxt context.Context, cmName string, options metav1.GetOptions) (*corev1.ConfigMap, error) {
 	for _, cm := range c.CMs {
 		if cm.Name == cmName {
@@ -67,3 +97,14 @@ func (c *TestClient) GetConfigMapKey(ctxt context.Context, cmName, key string, o
 
 	return v, err
 }
+
+func (c *TestClient) GetPodLogs(ctxt context.Context, podName string, options *corev1.PodLogOptions) (string, error) {
+	key := podName + "/" + options.Container
+	if l, ok := c.PodLogs[key]; ok {
+		return l, nil
+	}
+	return "", kerrors.NewNotFound(kschema.GroupResource{
+		Group:    "core",
+		Resource: "Pod",
+	}, podName)
+}
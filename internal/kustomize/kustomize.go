@@ -0,0 +1,262 @@
+// Package kustomize renders Kustomize overlays and plain manifests into
+// Kubernetes objects ready to be applied.
+package kustomize
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/kustomize/api/filesys"
+	"sigs.k8s.io/kustomize/api/konfig"
+	"sigs.k8s.io/kustomize/api/krusty"
+)
+
+const (
+	// overlaysDir is the directory holding the overlays, relative to the
+	// manifests directory.
+	overlaysDir = "overlays"
+	// baseDir is the directory holding the base, relative to the manifests
+	// directory.
+	baseDir = "base"
+)
+
+// podSpecPaths are the locations of pod specs within the supported kinds.
+var podSpecPaths = map[string][]string{
+	"Pod":                   {"spec"},
+	"Deployment":            {"spec", "template", "spec"},
+	"DeploymentConfig":      {"spec", "template", "spec"},
+	"StatefulSet":           {"spec", "template", "spec"},
+	"DaemonSet":             {"spec", "template", "spec"},
+	"ReplicaSet":            {"spec", "template", "spec"},
+	"ReplicationController": {"spec", "template", "spec"},
+	"Job":                   {"spec", "template", "spec"},
+	"CronJob":               {"spec", "jobTemplate", "spec", "template", "spec"},
+}
+
+// Overlay returns the directory to render for env. This is the first
+// present of the overlay named after the environment, the overlay named
+// after the stage of the environment and the base. If none of them is
+// present, dir itself is rendered.
+func Overlay(dir string, env *config.Environment) string {
+	candidates := []string{filepath.Join(dir, overlaysDir, env.Name)}
+	if string(env.Stage) != env.Name && env.Stage != "" {
+		candidates = append(candidates, filepath.Join(dir, overlaysDir, string(env.Stage)))
+	}
+	candidates = append(candidates, filepath.Join(dir, baseDir))
+	for _, c := range candidates {
+		if fi, err := os.Stat(c); err == nil && fi.IsDir() {
+			return c
+		}
+	}
+	return dir
+}
+
+// Render renders the manifests in dir. If dir contains a kustomization file,
+// it is built with Kustomize. Otherwise, all YAML files in dir are read as
+// they are.
+func Render(dir string) ([]*unstructured.Unstructured, error) {
+	var manifests []byte
+	if isKustomization(dir) {
+		opts := krusty.MakeDefaultOptions()
+		// Order resources like `kustomize build` does by default, so that
+		// e.g. config maps are applied before the workloads using them.
+		opts.DoLegacyResourceSort = true
+		k := krusty.MakeKustomizer(opts)
+		resources, err := k.Run(filesys.MakeFsOnDisk(), dir)
+		if err != nil {
+			return nil, fmt.Errorf("could not build %s: %w", dir, err)
+		}
+		manifests, err = resources.AsYaml()
+		if err != nil {
+			return nil, fmt.Errorf("could not convert resources of %s to YAML: %w", dir, err)
+		}
+	} else {
+		m, err := readManifests(dir)
+		if err != nil {
+			return nil, err
+		}
+		manifests = m
+	}
+	objs, err := decode(manifests)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode manifests of %s: %w", dir, err)
+	}
+	return objs, nil
+}
+
+// CustomizeOptions configures how rendered objects are adapted to the
+// target environment.
+type CustomizeOptions struct {
+	// Labels are added to all objects.
+	Labels map[string]string
+	// Images are the images deployed into the target namespace. Containers
+	// using an image of the same name are pointed to it.
+	Images []artifact.DeployedImage
+}
+
+// Customize adds the labels to objs and replaces the images of their
+// containers with the deployed images. Images are referenced by digest if
+// it is known.
+func Customize(objs []*unstructured.Unstructured, opts CustomizeOptions) error {
+	images := map[string]string{}
+	for _, img := range opts.Images {
+		images[img.Name] = imageReference(img)
+	}
+	for _, obj := range objs {
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		for k, v := range opts.Labels {
+			labels[k] = v
+		}
+		obj.SetLabels(labels)
+
+		path, ok := podSpecPaths[obj.GetKind()]
+		if !ok {
+			continue
+		}
+		for _, field := range []string{"initContainers", "containers"} {
+			err := replaceImages(obj, append(path, field), images)
+			if err != nil {
+				return fmt.Errorf("could not replace images of %s %s: %w", obj.GetKind(), obj.GetName(), err)
+			}
+		}
+	}
+	return nil
+}
+
+func replaceImages(obj *unstructured.Unstructured, fields []string, images map[string]string) error {
+	containers, found, err := unstructured.NestedSlice(obj.Object, fields...)
+	if err != nil || !found {
+		return err
+	}
+	for _, c := range containers {
+		container, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		image, ok := container["image"].(string)
+		if !ok {
+			continue
+		}
+		if ref, ok := images[imageName(image)]; ok {
+			container["image"] = ref
+		}
+	}
+	return unstructured.SetNestedSlice(obj.Object, containers, fields...)
+}
+
+// imageReference returns the reference of the deployed image, pinned to its
+// digest if known.
+func imageReference(img artifact.DeployedImage) string {
+	if img.Digest == "" {
+		return img.Image
+	}
+	return stripTagAndDigest(img.Image) + "@" + img.Digest
+}
+
+// imageName returns the last path segment of image without tag and digest,
+// e.g. "foo" for "registry.example.com/bar/foo:latest".
+func imageName(image string) string {
+	repository := stripTagAndDigest(image)
+	return repository[strings.LastIndex(repository, "/")+1:]
+}
+
+func stripTagAndDigest(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	// A colon after the last slash separates the tag, a colon before it
+	// separates the port of the registry.
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+func isKustomization(dir string) bool {
+	for _, f := range konfig.RecognizedKustomizationFileNames() {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readManifests concatenates all YAML files in dir, in lexical order.
+func readManifests(dir string) ([]byte, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read manifests dir: %w", err)
+	}
+	names := []string{}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if !f.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, n := range names {
+		content, err := ioutil.ReadFile(filepath.Join(dir, n))
+		if err != nil {
+			return nil, fmt.Errorf("could not read manifest: %w", err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(content)
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// decode splits manifests into objects. Empty documents are skipped, and
+// lists are expanded into their items.
+func decode(manifests []byte) ([]*unstructured.Unstructured, error) {
+	objs := []*unstructured.Unstructured{}
+	decoder := utilyaml.NewYAMLOrJSONDecoder(bytes.NewReader(manifests), 4096)
+	for {
+		var raw runtime.RawExtension
+		err := decoder.Decode(&raw)
+		if errors.Is(err, io.EOF) {
+			return objs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		raw.Raw = bytes.TrimSpace(raw.Raw)
+		if len(raw.Raw) == 0 || bytes.Equal(raw.Raw, []byte("null")) {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		err = obj.UnmarshalJSON(raw.Raw)
+		if err != nil {
+			return nil, err
+		}
+		if obj.IsList() {
+			err := obj.EachListItem(func(o runtime.Object) error {
+				item := o.(*unstructured.Unstructured)
+				objs = append(objs, item)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		objs = append(objs, obj)
+	}
+}
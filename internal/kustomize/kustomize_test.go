@@ -0,0 +1,153 @@
+package kustomize
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/internal/projectpath"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var sampleAppDir = filepath.Join(projectpath.Root, "test/testdata/workspaces/kustomize-sample-app/deploy")
+
+func TestOverlay(t *testing.T) {
+	tests := map[string]struct {
+		dir  string
+		env  *config.Environment
+		want string
+	}{
+		"overlay of environment": {
+			dir:  sampleAppDir,
+			env:  &config.Environment{Name: "dev", Stage: config.DevStage},
+			want: filepath.Join(sampleAppDir, "overlays/dev"),
+		},
+		"overlay of stage": {
+			dir:  sampleAppDir,
+			env:  &config.Environment{Name: "qa-eu", Stage: config.QAStage},
+			want: filepath.Join(sampleAppDir, "overlays/qa"),
+		},
+		"base": {
+			dir:  sampleAppDir,
+			env:  &config.Environment{Name: "prod", Stage: config.ProdStage},
+			want: filepath.Join(sampleAppDir, "base"),
+		},
+		"plain manifests": {
+			dir:  filepath.Join(projectpath.Root, "test/testdata/fixtures/kustomize"),
+			env:  &config.Environment{Name: "dev", Stage: config.DevStage},
+			want: filepath.Join(projectpath.Root, "test/testdata/fixtures/kustomize"),
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := Overlay(tc.dir, tc.env)
+			if got != tc.want {
+				t.Fatalf("want: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := map[string]struct {
+		dir          string
+		want         []string
+		wantReplicas int64
+	}{
+		"dev overlay": {
+			dir:          filepath.Join(sampleAppDir, "overlays/dev"),
+			want:         []string{"ConfigMap/kustomize-sample-app-", "Service/kustomize-sample-app", "Deployment/kustomize-sample-app"},
+			wantReplicas: 1,
+		},
+		"qa overlay": {
+			dir:          filepath.Join(sampleAppDir, "overlays/qa"),
+			want:         []string{"Service/kustomize-sample-app", "Deployment/kustomize-sample-app"},
+			wantReplicas: 2,
+		},
+		"plain manifests": {
+			dir:  filepath.Join(projectpath.Root, "test/testdata/fixtures/kustomize"),
+			want: []string{"ConfigMap/foo", "Secret/foo", "Service/foo"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			objs, err := Render(tc.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for _, o := range objs {
+				ref := o.GetKind() + "/" + o.GetName()
+				// Names of generated objects end with a hash of their content.
+				if generateName := "ConfigMap/kustomize-sample-app-"; len(ref) > len(generateName) && ref[:len(generateName)] == generateName {
+					ref = generateName
+				}
+				got = append(got, ref)
+				if o.GetKind() == "Deployment" {
+					replicas, _, _ := unstructured.NestedInt64(o.Object, "spec", "replicas")
+					if replicas != tc.wantReplicas {
+						t.Fatalf("want replicas: %d, got: %d", tc.wantReplicas, replicas)
+					}
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("objects mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCustomize(t *testing.T) {
+	objs, err := Render(filepath.Join(sampleAppDir, "base"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Customize(objs, CustomizeOptions{
+		Labels: map[string]string{"pipeline.opendevstack.org/deployment": "foo"},
+		Images: []artifact.DeployedImage{
+			{Name: "kustomize-sample-app", Image: "registry.example.com:5000/foo-dev/hello-world:abc123", Digest: "sha256:1"},
+			{Name: "hello-world", Image: "registry.example.com:5000/foo-dev/hello-world:abc123", Digest: "sha256:2"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range objs {
+		if got := o.GetLabels()["pipeline.opendevstack.org/deployment"]; got != "foo" {
+			t.Fatalf("want deployment label on %s, got labels: %v", o.GetName(), o.GetLabels())
+		}
+		if got := o.GetLabels()["app.kubernetes.io/name"]; got != "kustomize-sample-app" {
+			t.Fatalf("want existing labels to be kept on %s, got labels: %v", o.GetName(), o.GetLabels())
+		}
+		if o.GetKind() != "Deployment" {
+			continue
+		}
+		containers, _, _ := unstructured.NestedSlice(o.Object, "spec", "template", "spec", "containers")
+		got := containers[0].(map[string]interface{})["image"]
+		want := "registry.example.com:5000/foo-dev/hello-world@sha256:2"
+		if got != want {
+			t.Fatalf("want image: %s, got: %s", want, got)
+		}
+	}
+}
+
+func TestImageName(t *testing.T) {
+	tests := map[string]string{
+		"foo":                                 "foo",
+		"foo:latest":                          "foo",
+		"registry.example.com/bar/foo":        "foo",
+		"registry.example.com:5000/bar/foo:1": "foo",
+		"registry.example.com/bar/foo@sha256:abc":        "foo",
+		"registry.example.com/bar/foo:latest@sha256:abc": "foo",
+	}
+	for image, want := range tests {
+		t.Run(image, func(t *testing.T) {
+			got := imageName(image)
+			if got != want {
+				t.Fatalf("want: %s, got: %s", want, got)
+			}
+		})
+	}
+}
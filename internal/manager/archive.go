@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/nexus"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// commitResult is the name of the ods-start task result holding the
+	// checked out commit SHA.
+	commitResult = "commit"
+	// unknownCommitSHA is used in the artifact group of runs for which no
+	// commit was checked out.
+	unknownCommitSHA = "unknown"
+)
+
+// Archiver archives pipeline runs (including the status of their task runs
+// and the logs of their steps) in Nexus, so that no history is lost when
+// pipeline runs are pruned.
+type Archiver struct {
+	KubernetesClient kubernetesClient.ClientPodInterface
+	NexusClient      nexus.ClientInterface
+	// NexusRepository is the (permanent) Nexus repository to upload to.
+	NexusRepository string
+	// Project is used when the project cannot be determined from the run.
+	Project string
+	Logger  logging.LeveledLoggerInterface
+}
+
+// archive builds a compressed archive of pr and uploads it into the artifact
+// group of the run. It returns the URL of the uploaded archive.
+func (a *Archiver) archive(ctxt context.Context, pr tekton.PipelineRun) (string, error) {
+	dir, err := ioutil.TempDir("", "ods-pipeline-archive-")
+	if err != nil {
+		return "", fmt.Errorf("could not create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	b, err := a.buildArchive(ctxt, pr)
+	if err != nil {
+		return "", fmt.Errorf("could not build archive of %s: %w", pr.Name, err)
+	}
+	file := filepath.Join(dir, pr.Name+".tar.gz")
+	err = ioutil.WriteFile(file, b, 0644)
+	if err != nil {
+		return "", fmt.Errorf("could not write archive of %s: %w", pr.Name, err)
+	}
+	group := a.artifactGroup(pr)
+	a.Logger.Debugf("Archiving pipeline run %s in Nexus repository %s, group %s ...", pr.Name, a.NexusRepository, group)
+	link, err := a.NexusClient.Upload(a.NexusRepository, group, file)
+	if err != nil {
+		return "", fmt.Errorf("could not upload archive of %s: %w", pr.Name, err)
+	}
+	return link, nil
+}
+
+// buildArchive returns a gzipped tarball containing the pipeline run (with
+// the status of all task runs) as JSON, and the logs of each step.
+func (a *Archiver) buildArchive(ctxt context.Context, pr tekton.PipelineRun) ([]byte, error) {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	now := time.Now()
+
+	prJSON, err := json.MarshalIndent(pr, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addToTar(tw, "pipelinerun.json", prJSON, now); err != nil {
+		return nil, err
+	}
+
+	// Sort task runs to get a deterministic archive layout.
+	taskRunNames := []string{}
+	for name := range pr.Status.TaskRuns {
+		taskRunNames = append(taskRunNames, name)
+	}
+	sort.Strings(taskRunNames)
+	for _, name := range taskRunNames {
+		tr := pr.Status.TaskRuns[name]
+		if tr == nil || tr.Status == nil || tr.Status.PodName == "" {
+			continue
+		}
+		for _, step := range tr.Status.Steps {
+			logs, err := a.KubernetesClient.GetPodLogs(
+				ctxt, tr.Status.PodName, &corev1.PodLogOptions{Container: step.ContainerName},
+			)
+			if err != nil {
+				a.Logger.Warnf("Could not get logs of step %s of task run %s: %s", step.Name, name, err)
+				logs = fmt.Sprintf("logs not available: %s\n", err)
+			}
+			filename := fmt.Sprintf("logs/%s/%s.log", name, step.Name)
+			if err := addToTar(tw, filename, []byte(logs), now); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// artifactGroup returns the Nexus group of the pipeline run archive, which
+// is located in the artifact group of the checked out commit.
+func (a *Archiver) artifactGroup(pr tekton.PipelineRun) string {
+	project := pipelineRunParamDefault(pr, "project")
+	if project == "" {
+		project = a.Project
+	}
+	repository := pipelineRunParamDefault(pr, "repository")
+	if repository == "" {
+		repository = pr.Labels[repositoryLabel]
+	}
+	commitSHA := taskRunResult(pr, commitResult)
+	if commitSHA == "" {
+		commitSHA = unknownCommitSHA
+	}
+	return nexus.ArtifactGroup(project, repository, commitSHA, pipelinectxt.PipelineRunArchivesDir)
+}
+
+// pipelineRunParamDefault returns the default value of the pipeline param
+// name as recorded in the status of pr.
+func pipelineRunParamDefault(pr tekton.PipelineRun, name string) string {
+	if pr.Status.PipelineSpec == nil {
+		return ""
+	}
+	for _, p := range pr.Status.PipelineSpec.Params {
+		if p.Name == name && p.Default != nil {
+			return p.Default.StringVal
+		}
+	}
+	return ""
+}
+
+// taskRunResult returns the first non-empty result name of any task run of pr.
+func taskRunResult(pr tekton.PipelineRun, name string) string {
+	for _, tr := range pr.Status.TaskRuns {
+		if tr == nil || tr.Status == nil {
+			continue
+		}
+		for _, r := range tr.Status.TaskRunResults {
+			if r.Name == name && r.Value != "" {
+				return r.Value
+			}
+		}
+	}
+	return ""
+}
+
+func addToTar(tw *tar.Writer, name string, content []byte, modTime time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return fmt.Errorf("could not write header of %s: %w", name, err)
+	}
+	_, err = tw.Write(content)
+	if err != nil {
+		return fmt.Errorf("could not write %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package manager
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/ioutil"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	"github.com/opendevstack/pipeline/pkg/nexus"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+type failingNexusClient struct {
+	nexus.TestClient
+}
+
+func (c *failingNexusClient) Upload(repository, group, file string) (string, error) {
+	return "", errors.New("upload failed")
+}
+
+func TestBuildArchive(t *testing.T) {
+	pr := archivablePipelineRun("pr-a", "p-one", time.Now())
+	a := &Archiver{
+		KubernetesClient: &kubernetesClient.TestClient{
+			PodLogs: map[string]string{"pr-a-ods-start-pod/step-ods-start": "checked out\n"},
+		},
+		Logger: &logging.LeveledLogger{Level: logging.LevelNull},
+	}
+	b, err := a.buildArchive(context.TODO(), *pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := readTarGz(t, b)
+	wantFiles := []string{"logs/pr-a-ods-start/build.log", "logs/pr-a-ods-start/ods-start.log", "pipelinerun.json"}
+	gotFiles := []string{}
+	for name := range got {
+		gotFiles = append(gotFiles, name)
+	}
+	sort.Strings(gotFiles)
+	if diff := cmp.Diff(wantFiles, gotFiles); diff != "" {
+		t.Fatalf("archive content mismatch (-want +got):\n%s", diff)
+	}
+	if got["logs/pr-a-ods-start/ods-start.log"] != "checked out\n" {
+		t.Fatalf("unexpected logs: %s", got["logs/pr-a-ods-start/ods-start.log"])
+	}
+	if !bytes.Contains([]byte(got["logs/pr-a-ods-start/build.log"]), []byte("logs not available")) {
+		t.Fatalf("expected missing logs to be noted, got: %s", got["logs/pr-a-ods-start/build.log"])
+	}
+}
+
+func TestArtifactGroup(t *testing.T) {
+	a := &Archiver{Project: "fallback"}
+	pr := archivablePipelineRun("pr-a", "p-one", time.Now())
+	want := "/foo/foo-bar/abcdef/pipeline-run-archives"
+	if got := a.artifactGroup(*pr); got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+	bare := pipelineRun("pr-b", "p-one", config.DevStage, time.Now())
+	bare.Labels[repositoryLabel] = "foo-baz"
+	want = "/fallback/foo-baz/unknown/pipeline-run-archives"
+	if got := a.artifactGroup(*bare); got != want {
+		t.Fatalf("want: %s, got: %s", want, got)
+	}
+}
+
+func TestPruneArchivesRuns(t *testing.T) {
+	tests := map[string]struct {
+		nexusClient         nexus.ClientInterface
+		wantArchived        []string
+		wantDeletedRuns     []string
+		wantDeletedPipeline []string
+	}{
+		"archives before deletion": {
+			nexusClient:         &nexus.TestClient{URLs: map[string][]string{}},
+			wantArchived:        []string{"/foo/foo-bar/abcdef/pipeline-run-archives/pr-c.tar.gz", "/foo/foo-bar/abcdef/pipeline-run-archives/pr-d.tar.gz"},
+			wantDeletedRuns:     []string{"pr-c"},
+			wantDeletedPipeline: []string{"p-two"},
+		},
+		"does not delete if archiving fails": {
+			nexusClient:         &failingNexusClient{},
+			wantArchived:        nil,
+			wantDeletedRuns:     nil,
+			wantDeletedPipeline: nil,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tclient := &tektonClient.TestClient{
+				PipelineRuns: []*tekton.PipelineRun{
+					archivablePipelineRun("pr-a", "p-one", time.Now().Add(time.Minute*-1)),
+					archivablePipelineRun("pr-c", "p-one", time.Now().Add(time.Hour*-4)),
+					archivablePipelineRun("pr-d", "p-two", time.Now().Add(time.Hour*-5)),
+				},
+			}
+			p := &Pruner{
+				TektonClient: tclient,
+				Logger:       &logging.LeveledLogger{Level: logging.LevelNull},
+				MinKeepHours: 2,
+				MaxKeepRuns:  1,
+				Archiver: &Archiver{
+					KubernetesClient: &kubernetesClient.TestClient{},
+					NexusClient:      tc.nexusClient,
+					NexusRepository:  nexus.PermanentRepositoryDefault,
+					Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+				},
+			}
+			err := p.prune(context.TODO(), "foo-bar")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if nc, ok := tc.nexusClient.(*nexus.TestClient); ok {
+				got := nc.URLs[nexus.PermanentRepositoryDefault]
+				sort.Strings(got)
+				if diff := cmp.Diff(tc.wantArchived, got); diff != "" {
+					t.Fatalf("archives mismatch (-want +got):\n%s", diff)
+				}
+			}
+			if diff := cmp.Diff(tc.wantDeletedRuns, tclient.DeletedPipelineRuns); diff != "" {
+				t.Fatalf("pipeline run prune mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantDeletedPipeline, tclient.DeletedPipelines); diff != "" {
+				t.Fatalf("pipeline prune mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func archivablePipelineRun(name, pipeline string, creationTime time.Time) *tekton.PipelineRun {
+	pr := pipelineRun(name, pipeline, config.DevStage, creationTime)
+	pr.Labels[repositoryLabel] = "foo-bar"
+	pr.Status.PipelineSpec = &tekton.PipelineSpec{
+		Params: []tekton.ParamSpec{
+			tektonStringParamSpec("project", "foo"),
+			tektonStringParamSpec("repository", "foo-bar"),
+		},
+	}
+	pr.Status.TaskRuns = map[string]*tekton.PipelineRunTaskRunStatus{
+		name + "-ods-start": {
+			PipelineTaskName: "ods-start",
+			Status: &tekton.TaskRunStatus{
+				TaskRunStatusFields: tekton.TaskRunStatusFields{
+					PodName: name + "-ods-start-pod",
+					Steps: []tekton.StepState{
+						{Name: "ods-start", ContainerName: "step-ods-start"},
+						{Name: "build", ContainerName: "step-build"},
+					},
+					TaskRunResults: []tekton.TaskRunResult{{Name: commitResult, Value: "abcdef"}},
+				},
+			},
+		},
+	}
+	return pr
+}
+
+func readTarGz(t *testing.T, b []byte) map[string]string {
+	gr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gr)
+	files := map[string]string{}
+	for {
+		h, err := tr.Next()
+		if err != nil {
+			break
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[h.Name] = string(content)
+	}
+	return files
+}
@@ -79,6 +79,27 @@ func extractPullRequestInfo(bitbucketClient bitbucket.CommitClientInterface, pro
 	return i, nil
 }
 
+// getChangedFiles retrieves the paths of all files changed in gitCommit
+// compared to since. If since is empty, gitCommit is compared to its first
+// parent.
+func getChangedFiles(bitbucketClient bitbucket.CommitClientInterface, projectKey, repositorySlug, gitCommit, since string) ([]string, error) {
+	files := []string{}
+	params := bitbucket.CommitChangeListParams{Since: since}
+	for {
+		changePage, err := bitbucketClient.CommitChangeList(projectKey, repositorySlug, gitCommit, params)
+		if err != nil {
+			return nil, fmt.Errorf("could not get changes: %w", err)
+		}
+		for _, c := range changePage.Values {
+			files = append(files, c.Path.ToString)
+		}
+		if changePage.IsLastPage {
+			return files, nil
+		}
+		params.Start = changePage.NextPageStart
+	}
+}
+
 func shouldSkip(bitbucketClient bitbucket.CommitClientInterface, projectKey, repositorySlug, gitCommit string) bool {
 	c, err := bitbucketClient.CommitGet(projectKey, repositorySlug, gitCommit)
 	if err != nil {
@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/config"
 	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -21,22 +22,41 @@ const (
 	labelPrefix = "pipeline.opendevstack.org/"
 	// Label specifying the Bitbucket repository related to the pipeline.
 	repositoryLabel = labelPrefix + "repository"
+	// Label specifying the Bitbucket project of the repository related to a
+	// workspace PVC.
+	projectLabel = labelPrefix + "project"
 	// Label specifying the Git ref (e.g. branch) related to the pipeline.
 	gitRefLabel = labelPrefix + "git-ref"
+	// Annotation holding the unmodified Git ref related to the pipeline run,
+	// as label values cannot contain all characters allowed in Git refs.
+	gitRefAnnotation = labelPrefix + "git-ref"
 	// Label specifying the target stage of the pipeline.
 	stageLabel = labelPrefix + "stage"
 	// tektonAPIVersion specifies the Tekton API version in use
 	tektonAPIVersion = "tekton.dev/v1beta1"
 	// sharedWorkspaceName is the name of the workspace shared by all tasks
-	sharedWorkspaceName = "shared-workspace"
+	sharedWorkspaceName = config.SharedWorkspaceName
+	// changedPathsParamPrefix is the prefix of the params holding whether
+	// the changedPaths condition of a task is met.
+	changedPathsParamPrefix = config.ChangedPathsParamPrefix
 )
 
 // PipelineConfig holds configuration for a triggered pipeline.
 type PipelineConfig struct {
 	PipelineInfo
-	PVC     string `json:"pvc"`
-	Tasks   []tekton.PipelineTask
-	Finally []tekton.PipelineTask
+	PVC string `json:"pvc"`
+	// WorkspaceSize is the requested size of the PVC. May be empty.
+	WorkspaceSize string
+	Extends       string
+	Overrides     []config.TaskOverride
+	Params        []tekton.ParamSpec
+	Workspaces    []config.Workspace
+	RunSpec       *config.RunSpec
+	Tasks         []config.PipelineTask
+	Finally       []config.PipelineTask
+	// ChangedFiles are the files changed by the triggering event. Nil if
+	// unknown.
+	ChangedFiles []string
 }
 
 // createPipelineRun creates a PipelineRun resource
@@ -45,14 +65,14 @@ func createPipelineRun(tektonClient tektonClient.ClientPipelineRunInterface, ctx
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: fmt.Sprintf("%s-", pData.Name),
 			Labels:       pipelineLabels(pData),
+			Annotations:  map[string]string{gitRefAnnotation: pData.GitRef},
 		},
 		TypeMeta: metav1.TypeMeta{
 			APIVersion: tektonAPIVersion,
 			Kind:       "PipelineRun",
 		},
 		Spec: tekton.PipelineRunSpec{
-			PipelineRef:        &tekton.PipelineRef{Name: pData.Name},
-			ServiceAccountName: "pipeline", // TODO
+			PipelineRef: &tekton.PipelineRef{Name: pData.Name},
 			Workspaces: []tekton.WorkspaceBinding{
 				{
 					Name: sharedWorkspaceName,
@@ -63,6 +83,30 @@ func createPipelineRun(tektonClient tektonClient.ClientPipelineRunInterface, ctx
 			},
 		},
 	}
+	if pData.RunSpec != nil {
+		pr.Spec.ServiceAccountName = pData.RunSpec.ServiceAccountName
+		pr.Spec.PodTemplate = pData.RunSpec.PodTemplate
+		pr.Spec.Timeout = pData.RunSpec.Timeout
+		pr.Spec.TaskRunSpecs = pData.RunSpec.TaskRunSpecs
+	}
+	for _, w := range pData.Workspaces {
+		pr.Spec.Workspaces = append(pr.Spec.Workspaces, tekton.WorkspaceBinding{
+			Name:      w.Name,
+			Secret:    w.Secret,
+			ConfigMap: w.ConfigMap,
+			EmptyDir:  w.EmptyDir,
+		})
+	}
+	if len(pData.PromoteFrom) > 0 {
+		// The pipeline of a target environment is shared by all promotions,
+		// so pass the commit explicitly in case the run is queued and the
+		// pipeline is updated by another promotion in the meantime.
+		pr.Spec.Params = append(pr.Spec.Params,
+			tektonStringParam("git-commit-sha", pData.GitSHA),
+			tektonStringParam("promote-from", pData.PromoteFrom),
+		)
+	}
+	pr.Spec.Params = append(pr.Spec.Params, changedPathsParams(pData)...)
 	if needQueueing {
 		pr.Spec.Status = tekton.PipelineRunSpecStatusPending
 	}
@@ -147,13 +191,20 @@ func assemblePipeline(cfg PipelineConfig, taskKind tekton.TaskKind, taskSuffix s
 			tektonStringParam("version", "$(params.version)"),
 		},
 	})
+	if len(cfg.PromoteFrom) > 0 {
+		tasks[0].Params = append(tasks[0].Params,
+			tektonStringParam("git-commit-sha", "$(params.git-commit-sha)"),
+			tektonStringParam("promote-from", "$(params.promote-from)"),
+		)
+	}
 	if len(cfg.Tasks) > 0 {
-		cfg.Tasks[0].RunAfter = append(cfg.Tasks[0].RunAfter, "ods-start")
-		tasks = append(tasks, cfg.Tasks...)
+		cfgTasks := tektonPipelineTasks(cfg.Tasks, cfg)
+		cfgTasks[0].RunAfter = append(cfgTasks[0].RunAfter, "ods-start")
+		tasks = append(tasks, cfgTasks...)
 	}
 
 	var finallyTasks []tekton.PipelineTask
-	finallyTasks = append(finallyTasks, cfg.Finally...)
+	finallyTasks = append(finallyTasks, tektonPipelineTasks(cfg.Finally, cfg)...)
 
 	finallyTasks = append(finallyTasks, tekton.PipelineTask{
 		Name:       "ods-finish",
@@ -165,6 +216,45 @@ func assemblePipeline(cfg PipelineConfig, taskKind tekton.TaskKind, taskSuffix s
 		},
 	})
 
+	params := []tekton.ParamSpec{
+		tektonStringParamSpec("repository", cfg.Repository),
+		tektonStringParamSpec("project", cfg.Project),
+		tektonStringParamSpec("component", cfg.Component),
+		tektonStringParamSpec("git-repo-url", cfg.GitURI),
+		tektonStringParamSpec("git-full-ref", cfg.GitFullRef),
+		tektonStringParamSpec("pr-key", strconv.Itoa(cfg.PullRequestKey)),
+		tektonStringParamSpec("pr-base", cfg.PullRequestBase),
+		tektonStringParamSpec("environment", cfg.Environment),
+		tektonStringParamSpec("version", cfg.Version),
+		tektonStringParamSpec("stage", cfg.Stage),
+		tektonStringParamSpec("is-pr", strconv.FormatBool(cfg.PullRequestKey > 0)),
+		tektonStringParamSpec("trigger-event", cfg.TriggerEvent),
+		tektonStringParamSpec("git-ref", cfg.GitRef),
+	}
+	if len(cfg.PromoteFrom) > 0 {
+		params = append(params,
+			tektonStringParamSpec("git-commit-sha", cfg.GitSHA),
+			tektonStringParamSpec("promote-from", cfg.PromoteFrom),
+		)
+	}
+	params = append(params, changedPathsParamSpecs(cfg)...)
+	for _, ps := range cfg.Params {
+		if ps.Type == "" {
+			ps.Type = tekton.ParamTypeString
+			if ps.Default != nil {
+				ps.Type = ps.Default.Type
+			}
+		}
+		params = append(params, ps)
+	}
+
+	workspaces := []tekton.PipelineWorkspaceDeclaration{
+		{Name: sharedWorkspaceName},
+	}
+	for _, w := range cfg.Workspaces {
+		workspaces = append(workspaces, tekton.PipelineWorkspaceDeclaration{Name: w.Name})
+	}
+
 	p := &tekton.Pipeline{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:   cfg.Name,
@@ -176,22 +266,10 @@ func assemblePipeline(cfg PipelineConfig, taskKind tekton.TaskKind, taskSuffix s
 		},
 		Spec: tekton.PipelineSpec{
 			Description: "ODS",
-			Params: []tekton.ParamSpec{
-				tektonStringParamSpec("repository", cfg.Repository),
-				tektonStringParamSpec("project", cfg.Project),
-				tektonStringParamSpec("component", cfg.Component),
-				tektonStringParamSpec("git-repo-url", cfg.GitURI),
-				tektonStringParamSpec("git-full-ref", cfg.GitFullRef),
-				tektonStringParamSpec("pr-key", strconv.Itoa(cfg.PullRequestKey)),
-				tektonStringParamSpec("pr-base", cfg.PullRequestBase),
-				tektonStringParamSpec("environment", cfg.Environment),
-				tektonStringParamSpec("version", cfg.Version),
-			},
-			Tasks: tasks,
-			Workspaces: []tekton.PipelineWorkspaceDeclaration{
-				{Name: sharedWorkspaceName},
-			},
-			Finally: finallyTasks,
+			Params:      params,
+			Tasks:       tasks,
+			Workspaces:  workspaces,
+			Finally:     finallyTasks,
 		},
 	}
 	return p
@@ -3,12 +3,14 @@ package manager
 import (
 	"context"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
 	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
 	"github.com/opendevstack/pipeline/pkg/config"
 	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -175,19 +177,23 @@ func TestAssemblePipeline(t *testing.T) {
 			PullRequestBase: "integration",
 		},
 		PVC: "pvc",
-		Tasks: []tekton.PipelineTask{
+		Tasks: []config.PipelineTask{
 			{
-				Name:    "build",
-				TaskRef: &tekton.TaskRef{Kind: taskKind, Name: "ods-build-go" + taskSuffix},
-				Workspaces: []tekton.WorkspacePipelineTaskBinding{
-					{Name: "source", Workspace: sharedWorkspaceName},
+				PipelineTask: tekton.PipelineTask{
+					Name:    "build",
+					TaskRef: &tekton.TaskRef{Kind: taskKind, Name: "ods-build-go" + taskSuffix},
+					Workspaces: []tekton.WorkspacePipelineTaskBinding{
+						{Name: "source", Workspace: sharedWorkspaceName},
+					},
 				},
 			},
 		},
-		Finally: []tekton.PipelineTask{
+		Finally: []config.PipelineTask{
 			{
-				Name:    "final",
-				TaskRef: &tekton.TaskRef{Kind: taskKind, Name: "final" + taskSuffix},
+				PipelineTask: tekton.PipelineTask{
+					Name:    "final",
+					TaskRef: &tekton.TaskRef{Kind: taskKind, Name: "final" + taskSuffix},
+				},
 			},
 		},
 	}
@@ -217,6 +223,10 @@ func TestAssemblePipeline(t *testing.T) {
 				tektonStringParamSpec("pr-base", cfg.PullRequestBase),
 				tektonStringParamSpec("environment", cfg.Environment),
 				tektonStringParamSpec("version", cfg.Version),
+				tektonStringParamSpec("stage", cfg.Stage),
+				tektonStringParamSpec("is-pr", "true"),
+				tektonStringParamSpec("trigger-event", cfg.TriggerEvent),
+				tektonStringParamSpec("git-ref", cfg.GitRef),
 			},
 			Tasks: []tekton.PipelineTask{
 				{
@@ -267,3 +277,83 @@ func TestAssemblePipeline(t *testing.T) {
 		t.Fatalf("expected (-want +got):\n%s", diff)
 	}
 }
+
+func TestAssemblePipelineWithCustomParamsAndWorkspaces(t *testing.T) {
+	cfg := PipelineConfig{
+		PipelineInfo: PipelineInfo{Name: "pipeline"},
+		Params: []tekton.ParamSpec{
+			{Name: "maven-profile", Default: &tekton.ArrayOrString{Type: tekton.ParamTypeString, StringVal: "ci"}},
+			{Name: "test-suites", Default: &tekton.ArrayOrString{Type: tekton.ParamTypeArray, ArrayVal: []string{"unit"}}},
+			{Name: "no-type", Default: &tekton.ArrayOrString{Type: tekton.ParamTypeString, StringVal: "foo"}},
+		},
+		Workspaces: []config.Workspace{
+			{Name: "maven-settings", Secret: &corev1.SecretVolumeSource{SecretName: "maven-settings"}},
+		},
+	}
+	got := assemblePipeline(cfg, tekton.NamespacedTaskKind, "")
+	wantParams := []tekton.ParamSpec{
+		{Name: "maven-profile", Type: tekton.ParamTypeString, Default: &tekton.ArrayOrString{Type: tekton.ParamTypeString, StringVal: "ci"}},
+		{Name: "test-suites", Type: tekton.ParamTypeArray, Default: &tekton.ArrayOrString{Type: tekton.ParamTypeArray, ArrayVal: []string{"unit"}}},
+		{Name: "no-type", Type: tekton.ParamTypeString, Default: &tekton.ArrayOrString{Type: tekton.ParamTypeString, StringVal: "foo"}},
+	}
+	if diff := cmp.Diff(wantParams, got.Spec.Params[len(got.Spec.Params)-3:]); diff != "" {
+		t.Fatalf("params mismatch (-want +got):\n%s", diff)
+	}
+	wantWorkspaces := []tekton.PipelineWorkspaceDeclaration{
+		{Name: sharedWorkspaceName},
+		{Name: "maven-settings"},
+	}
+	if diff := cmp.Diff(wantWorkspaces, got.Spec.Workspaces); diff != "" {
+		t.Fatalf("workspaces mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAssemblePipelineBuiltinParams(t *testing.T) {
+	cfg := PipelineConfig{
+		PipelineInfo: PipelineInfo{Name: "pipeline", PromoteFrom: "qa"},
+		Tasks: []config.PipelineTask{
+			{
+				PipelineTask: tekton.PipelineTask{Name: "deploy"},
+				RunIf:        &config.RunIf{ChangedPaths: []string{"chart/*"}},
+			},
+		},
+	}
+	got := assemblePipeline(cfg, tekton.NamespacedTaskKind, "")
+	gotNames := []string{}
+	for _, ps := range got.Spec.Params {
+		if !strings.HasPrefix(ps.Name, config.ChangedPathsParamPrefix) {
+			gotNames = append(gotNames, ps.Name)
+		}
+	}
+	if diff := cmp.Diff(config.BuiltinParamNames, gotNames); diff != "" {
+		t.Fatalf("builtin params mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestCreatePipelineRunWithCustomWorkspacesAndRunSpec(t *testing.T) {
+	tc := &tektonClient.TestClient{}
+	pData := PipelineConfig{
+		PipelineInfo: PipelineInfo{Name: "foo"},
+		PVC:          "pvc",
+		RunSpec:      &config.RunSpec{ServiceAccountName: "pipeline"},
+		Workspaces: []config.Workspace{
+			{Name: "npmrc", ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "npmrc"}}},
+			{Name: "scratch", EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		},
+	}
+	pr, err := createPipelineRun(tc, context.TODO(), pData, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []tekton.WorkspaceBinding{
+		{Name: sharedWorkspaceName, PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{ClaimName: "pvc"}},
+		{Name: "npmrc", ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "npmrc"}}},
+		{Name: "scratch", EmptyDir: &corev1.EmptyDirVolumeSource{}},
+	}
+	if diff := cmp.Diff(want, pr.Spec.Workspaces); diff != "" {
+		t.Fatalf("workspaces mismatch (-want +got):\n%s", diff)
+	}
+	if pr.Spec.ServiceAccountName != "pipeline" {
+		t.Fatalf("Expected service account to be pipeline, got: %s", pr.Spec.ServiceAccountName)
+	}
+}
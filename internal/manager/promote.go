@@ -0,0 +1,239 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+
+	intrepo "github.com/opendevstack/pipeline/internal/repository"
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+const (
+	// promoteTriggerEvent is the trigger event of promotion pipeline runs.
+	promoteTriggerEvent = "promote"
+	// promoteDefaultBranch is the branch used to select the pipeline of a
+	// promotion if the request does not specify one.
+	promoteDefaultBranch = "master"
+	// deployTaskPrefix is the prefix of the task references kept in
+	// promotion pipelines.
+	deployTaskPrefix = "ods-deploy-"
+)
+
+var commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// stageOrder defines the order in which commits move through the stages.
+var stageOrder = map[config.Stage]int{
+	config.DevStage:  0,
+	config.QAStage:   1,
+	config.ProdStage: 2,
+}
+
+// promoteRequest is the payload of a promotion request.
+type promoteRequest struct {
+	Repository string `json:"repository"`
+	// Commit is the full SHA of the commit to promote.
+	Commit string `json:"commit"`
+	// Branch selects the pipeline definition (e.g. via trigger branches)
+	// and is used as Git ref of the pipeline run. Defaults to "master".
+	Branch string `json:"branch"`
+	// From is the environment the commit has been deployed to already.
+	From string `json:"from"`
+	// To is the environment to deploy the commit to.
+	To string `json:"to"`
+}
+
+// HandlePromote handles requests to promote a previously built commit from
+// one environment to another. The triggered pipeline run only contains the
+// deploy tasks of the selected pipeline, which deploy the artifacts built for
+// the commit. Requests must be signed with the webhook secret, in the same
+// way Bitbucket signs webhook requests.
+func (s *BitbucketWebhookReceiver) HandlePromote(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "could not read body"
+		s.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if err := validatePayload(r.Header, body, []byte(s.WebhookSecret)); err != nil {
+		msg := "failed to validate incoming request"
+		s.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	req := &promoteRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		msg := fmt.Sprintf("cannot parse JSON: %s", err)
+		s.Logger.Errorf(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo := strings.ToLower(req.Repository)
+	project := strings.ToLower(s.Project)
+	component := strings.TrimPrefix(repo, project+"-")
+	branch := req.Branch
+	if branch == "" {
+		branch = promoteDefaultBranch
+	}
+	pInfo := PipelineInfo{
+		Name:       makePipelineName(component, "promote-"+req.To),
+		Project:    project,
+		Component:  component,
+		Repository: repo,
+		GitRef:     strings.ToLower(branch),
+		GitFullRef: "refs/heads/" + branch,
+		GitSHA:     req.Commit,
+		RepoBase:   s.RepoBase,
+		// Assemble GitURI from scratch instead of using user-supplied URI to
+		// protect against attacks from external Bitbucket servers and/or projects.
+		GitURI:       fmt.Sprintf("%s/%s/%s.git", s.RepoBase, project, repo),
+		Namespace:    s.Namespace,
+		TriggerEvent: promoteTriggerEvent,
+		Environment:  req.To,
+		PromoteFrom:  req.From,
+	}
+
+	if _, err := s.BitbucketClient.CommitGet(pInfo.Project, pInfo.Repository, pInfo.GitSHA); err != nil {
+		msg := fmt.Sprintf("could not find commit %s in repo %s", pInfo.GitSHA, pInfo.Repository)
+		s.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	// Read the configuration of the promoted commit, not of the branch head,
+	// as the branch may have moved on since the commit was built.
+	odsConfig, err := intrepo.GetODSConfig(s.BitbucketClient, pInfo.Project, pInfo.Repository, pInfo.GitSHA)
+	if err != nil {
+		msg := fmt.Sprintf("could not download ODS config for repo %s", pInfo.Repository)
+		s.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	fromEnv, err := odsConfig.Environment(req.From)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid source environment: %s", err), http.StatusBadRequest)
+		return
+	}
+	toEnv, err := odsConfig.Environment(req.To)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid target environment: %s", err), http.StatusBadRequest)
+		return
+	}
+	if stageOrder[toEnv.Stage] < stageOrder[fromEnv.Stage] {
+		msg := fmt.Sprintf(
+			"cannot promote from environment %s (stage %s) to environment %s (stage %s)",
+			fromEnv.Name, fromEnv.Stage, toEnv.Name, toEnv.Stage,
+		)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	pInfo.Stage = string(toEnv.Stage)
+	pInfo.Version = odsConfig.Version
+
+	// Select the pipeline as if the branch had been pushed, so that the
+	// same deploy tasks are used as when the commit was built.
+	pipeline := selectPipeline(odsConfig.PipelineDefinitions(), PipelineInfo{
+		GitRef:       pInfo.GitRef,
+		TriggerEvent: "repo:refs_changed",
+	})
+	if pipeline == nil {
+		msg := "No pipeline matches the trigger conditions"
+		s.Logger.Infof("%s: %s@%s (%s)", msg, pInfo.Repository, pInfo.GitRef, pInfo.TriggerEvent)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	// Tasks of templates are only known to the scheduler, which rejects
+	// promotions without deploy tasks as well.
+	if pipeline.Extends == "" && len(promotionTasks(pipeline.Tasks)) == 0 {
+		msg := fmt.Sprintf("pipeline does not contain any %s* tasks", deployTaskPrefix)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	s.Logger.Infof("%+v", pInfo)
+
+	cfg := PipelineConfig{
+		PipelineInfo:  pInfo,
+		PVC:           makePVCName(component),
+		WorkspaceSize: odsConfig.Workspace.Size,
+		Extends:       pipeline.Extends,
+		Overrides:     pipeline.Overrides,
+		Params:        pipeline.Params,
+		Workspaces:    pipeline.Workspaces,
+		RunSpec:       pipeline.RunSpec,
+		Tasks:         pipeline.Tasks,
+		Finally:       pipeline.Finally,
+	}
+	s.TriggeredPipelines <- cfg
+
+	err = json.NewEncoder(w).Encode(pInfo)
+	if err != nil {
+		s.Logger.Errorf("cannot write body: %s", err)
+	}
+}
+
+// validate checks that all required fields are given.
+func (r *promoteRequest) validate() error {
+	if r.Repository == "" {
+		return fmt.Errorf("repository must be given")
+	}
+	if !commitSHAPattern.MatchString(r.Commit) {
+		return fmt.Errorf("commit must be a full commit SHA, got '%s'", r.Commit)
+	}
+	if r.From == "" || r.To == "" {
+		return fmt.Errorf("from and to environments must be given")
+	}
+	if r.From == r.To {
+		return fmt.Errorf("from and to environments must differ")
+	}
+	return nil
+}
+
+// promotionTasks returns the deploy tasks of tasks. References in runAfter to
+// tasks which are not kept are removed. Deploy tasks which ran after removed
+// tasks only run after the preceding deploy task instead, so that deployments
+// happen in the same order as in the full pipeline.
+func promotionTasks(tasks []config.PipelineTask) []config.PipelineTask {
+	kept := map[string]bool{}
+	for _, t := range tasks {
+		if isDeployTask(t.PipelineTask) {
+			kept[t.Name] = true
+		}
+	}
+	var promotion []config.PipelineTask
+	for _, t := range tasks {
+		if !kept[t.Name] {
+			continue
+		}
+		var runAfter []string
+		for _, ra := range t.RunAfter {
+			if kept[ra] {
+				runAfter = append(runAfter, ra)
+			}
+		}
+		if len(runAfter) == 0 && len(t.RunAfter) > 0 && len(promotion) > 0 {
+			runAfter = []string{promotion[len(promotion)-1].Name}
+		}
+		t.RunAfter = runAfter
+		promotion = append(promotion, t)
+	}
+	return promotion
+}
+
+func isDeployTask(t tekton.PipelineTask) bool {
+	return t.TaskRef != nil && strings.HasPrefix(t.TaskRef.Name, deployTaskPrefix)
+}
@@ -0,0 +1,288 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+const testPromoteODSConfig = `environments:
+- name: dev
+  stage: dev
+- name: qa
+  stage: qa
+- name: prod
+  stage: prod
+pipeline:
+  tasks:
+  - name: build
+    taskRef:
+      kind: Task
+      name: ods-build-go
+  - name: deploy
+    taskRef:
+      kind: Task
+      name: ods-deploy-helm
+    runAfter:
+    - build
+  finally:
+  - name: notify
+    taskRef:
+      kind: Task
+      name: notify
+`
+
+const testPromoteCommit = "0e183aa3bc3c6deb8f40b93fb2fc4354533cf62f"
+
+func TestPromote(t *testing.T) {
+	tests := map[string]struct {
+		body       string
+		odsConfig  string
+		wantStatus int
+		wantBody   string
+	}{
+		"promotes commit": {
+			body:       `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "qa", "to": "prod"}`,
+			wantStatus: http.StatusOK,
+		},
+		"requires full commit SHA": {
+			body:       `{"repository": "bar-foo", "commit": "0e183aa", "from": "qa", "to": "prod"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "commit must be a full commit SHA",
+		},
+		"requires different environments": {
+			body:       `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "qa", "to": "qa"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "from and to environments must differ",
+		},
+		"unknown commit": {
+			body:       `{"repository": "bar-foo", "commit": "8d351a10fb428c0c1239530256e21cf24f136e73", "from": "qa", "to": "prod"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "could not find commit",
+		},
+		"unknown environment": {
+			body:       `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "qa", "to": "staging"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "invalid target environment",
+		},
+		"refuses to promote to lower stage": {
+			body:       `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "prod", "to": "dev"}`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "cannot promote from environment prod (stage prod) to environment dev (stage dev)",
+		},
+		"pipeline without deploy tasks": {
+			body: `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "qa", "to": "prod"}`,
+			odsConfig: `environments:
+- name: qa
+  stage: qa
+- name: prod
+  stage: prod
+pipeline:
+  tasks:
+  - name: build
+    taskRef:
+      kind: Task
+      name: ods-build-go
+`,
+			wantStatus: http.StatusBadRequest,
+			wantBody:   "pipeline does not contain any ods-deploy-* tasks",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			odsConfig := tc.odsConfig
+			if odsConfig == "" {
+				odsConfig = testPromoteODSConfig
+			}
+			ch := make(chan PipelineConfig, 1)
+			r := &BitbucketWebhookReceiver{
+				TriggeredPipelines: ch,
+				Namespace:          "bar-cd",
+				Project:            "bar",
+				WebhookSecret:      testWebhookSecret,
+				RepoBase:           "https://domain.com",
+				BitbucketClient: &bitbucket.TestClient{
+					Commits: []bitbucket.Commit{{ID: testPromoteCommit}},
+					Files:   map[string][]byte{"ods.yaml": []byte(odsConfig)},
+				},
+				Logger: &logging.LeveledLogger{Level: logging.LevelNull},
+			}
+			ts := httptest.NewServer(http.HandlerFunc(r.HandlePromote))
+			defer ts.Close()
+			body := []byte(tc.body)
+			req, err := http.NewRequest("POST", ts.URL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(signatureHeader, hmacHeader(t, testWebhookSecret, body))
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantStatus {
+				t.Fatalf("Got status: %v, want: %v", res.StatusCode, tc.wantStatus)
+			}
+			gotBody, err := ioutil.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(gotBody), tc.wantBody) {
+				t.Fatalf("want body containing %q, got: %s", tc.wantBody, gotBody)
+			}
+			select {
+			case cfg := <-ch:
+				if tc.wantStatus != http.StatusOK {
+					t.Fatal("want no pipeline config, got one")
+				}
+				want := PipelineInfo{
+					Name:         "foo-promote-prod",
+					Project:      "bar",
+					Component:    "foo",
+					Repository:   "bar-foo",
+					Stage:        "prod",
+					Environment:  "prod",
+					GitRef:       "master",
+					GitFullRef:   "refs/heads/master",
+					GitSHA:       testPromoteCommit,
+					RepoBase:     "https://domain.com",
+					GitURI:       "https://domain.com/bar/bar-foo.git",
+					Namespace:    "bar-cd",
+					TriggerEvent: "promote",
+					PromoteFrom:  "qa",
+				}
+				if diff := cmp.Diff(want, cfg.PipelineInfo); diff != "" {
+					t.Fatalf("pipeline info mismatch (-want +got):\n%s", diff)
+				}
+			default:
+				if tc.wantStatus == http.StatusOK {
+					t.Fatal("want pipeline config, got none")
+				}
+			}
+		})
+	}
+}
+
+func TestPromoteWrongSignature(t *testing.T) {
+	ch := make(chan PipelineConfig, 1)
+	r := &BitbucketWebhookReceiver{
+		TriggeredPipelines: ch,
+		WebhookSecret:      testWebhookSecret,
+		BitbucketClient:    &bitbucket.TestClient{},
+		Logger:             &logging.LeveledLogger{Level: logging.LevelNull},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(r.HandlePromote))
+	defer ts.Close()
+	body := `{"repository": "bar-foo", "commit": "` + testPromoteCommit + `", "from": "qa", "to": "prod"}`
+	req, err := http.NewRequest("POST", ts.URL, bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(signatureHeader, "foobar")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Got status: %v, want: %v", res.StatusCode, http.StatusBadRequest)
+	}
+	if len(ch) > 0 {
+		t.Fatal("want no pipeline config, got one")
+	}
+}
+
+func TestPromotionTasks(t *testing.T) {
+	task := func(name, taskRef string, runAfter ...string) config.PipelineTask {
+		return config.PipelineTask{PipelineTask: tekton.PipelineTask{
+			Name:     name,
+			TaskRef:  &tekton.TaskRef{Name: taskRef},
+			RunAfter: runAfter,
+		}}
+	}
+	tests := map[string]struct {
+		tasks []config.PipelineTask
+		want  []config.PipelineTask
+	}{
+		"keeps deploy tasks only": {
+			tasks: []config.PipelineTask{
+				task("build", "ods-build-go"),
+				task("deploy", "ods-deploy-helm", "build"),
+			},
+			want: []config.PipelineTask{
+				task("deploy", "ods-deploy-helm"),
+			},
+		},
+		"keeps order of deploy tasks": {
+			tasks: []config.PipelineTask{
+				task("build", "ods-build-go"),
+				task("deploy-db", "ods-deploy-helm", "build"),
+				task("test", "ods-test"),
+				task("deploy-app", "ods-deploy-helm", "test"),
+				task("deploy-docs", "ods-deploy-helm", "build", "deploy-db"),
+			},
+			want: []config.PipelineTask{
+				task("deploy-db", "ods-deploy-helm"),
+				task("deploy-app", "ods-deploy-helm", "deploy-db"),
+				task("deploy-docs", "ods-deploy-helm", "deploy-db"),
+			},
+		},
+		"no deploy tasks": {
+			tasks: []config.PipelineTask{
+				task("build", "ods-build-go"),
+				{PipelineTask: tekton.PipelineTask{Name: "inline"}},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := promotionTasks(tc.tasks)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("tasks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCreatePromotionPipelineRun(t *testing.T) {
+	pData := PipelineConfig{
+		PipelineInfo: PipelineInfo{Name: "foo-promote-prod", GitSHA: testPromoteCommit, PromoteFrom: "qa"},
+		PVC:          "pvc",
+	}
+	p := assemblePipeline(pData, tekton.NamespacedTaskKind, "")
+	wantStartParams := []tekton.Param{
+		tektonStringParam("git-commit-sha", "$(params.git-commit-sha)"),
+		tektonStringParam("promote-from", "$(params.promote-from)"),
+	}
+	startParams := p.Spec.Tasks[0].Params
+	if diff := cmp.Diff(wantStartParams, startParams[len(startParams)-2:]); diff != "" {
+		t.Fatalf("ods-start params mismatch (-want +got):\n%s", diff)
+	}
+	wantParamSpecs := []tekton.ParamSpec{
+		tektonStringParamSpec("git-commit-sha", testPromoteCommit),
+		tektonStringParamSpec("promote-from", "qa"),
+	}
+	if diff := cmp.Diff(wantParamSpecs, p.Spec.Params[len(p.Spec.Params)-2:]); diff != "" {
+		t.Fatalf("params mismatch (-want +got):\n%s", diff)
+	}
+	pr, err := createPipelineRun(&tektonClient.TestClient{}, context.TODO(), pData, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantRunParams := []tekton.Param{
+		tektonStringParam("git-commit-sha", testPromoteCommit),
+		tektonStringParam("promote-from", "qa"),
+	}
+	if diff := cmp.Diff(wantRunParams, pr.Spec.Params); diff != "" {
+		t.Fatalf("run params mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -2,8 +2,12 @@ package manager
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
 	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
 	"github.com/opendevstack/pipeline/pkg/config"
 	"github.com/opendevstack/pipeline/pkg/logging"
@@ -24,6 +28,9 @@ const (
 // It's behaviour can be controlled through MinKeepHours and MaxKeepRuns.
 // When pruning, it keeps MaxKeepRuns number of pipeline runs per stage,
 // however it always keeps all pipelines less than MinKeepHours old.
+// Retention rules in the "ods-pipeline" ConfigMap may override these settings
+// per stage and branch pattern. Failed runs are kept longer than successful
+// ones, and runs which created a release tag are always kept.
 // If pruning would prune all pipeline runs of one pipeline (identified by
 // label "tekton.dev/pipeline"), then the pipeline is pruned instead (removing
 // all dependent pipeline runs through propagation).
@@ -32,13 +39,26 @@ type Pruner struct {
 	TriggeredRepos chan string
 	// TektonClient is a client to interact with Tekton.
 	TektonClient tektonClient.ClientInterface
-	Logger       logging.LeveledLoggerInterface
+	// KubernetesClient is used to retrieve retention rules. If nil, only
+	// MinKeepHours and MaxKeepRuns apply.
+	KubernetesClient kubernetesClient.ClientConfigMapInterface
+	Logger           logging.LeveledLoggerInterface
 	// MinKeepHours specifies the minimum hours to keep a pipeline run.
 	// This setting has precendence over MaxKeepRuns.
 	MinKeepHours int
 	// MaxKeepRuns is the maximum number of pipeline runs to keep per stage.
-	MaxKeepRuns   int
+	MaxKeepRuns int
+	// DryRun reports prunable resources without deleting them.
+	DryRun bool
+	// Archiver archives pipeline runs before they are deleted. If nil,
+	// pipeline runs are deleted without archiving them.
+	Archiver *Archiver
+	// WebhookSecret is the shared secret used to validate prune requests.
+	WebhookSecret string
 	upcomingPrune map[string]time.Time
+	// reports holds the latest report per repository.
+	reports   map[string]*PruneReport
+	reportsMu sync.Mutex
 }
 
 // prunableResources holds pipelines and runs that can be pruned.
@@ -61,7 +81,7 @@ func (p *Pruner) Run(ctx context.Context) {
 // run actually starts the pruning process.
 func (p *Pruner) run(ctx context.Context, pr pruner, delay time.Duration) {
 	p.upcomingPrune = make(map[string]time.Time)
-	p.Logger.Debugf("Prune settings: MinKeepHours=%d MaxKeepRuns=%d", p.MinKeepHours, p.MaxKeepRuns)
+	p.Logger.Debugf("Prune settings: MinKeepHours=%d MaxKeepRuns=%d DryRun=%v", p.MinKeepHours, p.MaxKeepRuns, p.DryRun)
 	for {
 		select {
 		case repo := <-p.TriggeredRepos:
@@ -85,35 +105,83 @@ func (p *Pruner) run(ctx context.Context, pr pruner, delay time.Duration) {
 // prune prunes runs within pipelineRuns which can be cleaned up according to
 // the strategy in Pruner.
 func (p *Pruner) prune(ctx context.Context, repository string) error {
+	_, err := p.pruneRepository(ctx, repository, p.DryRun)
+	return err
+}
+
+// pruneRepository prunes the resources of repository which can be cleaned up
+// according to the strategy in Pruner, and returns a report of them. If
+// dryRun is true, the resources are only reported, not deleted.
+func (p *Pruner) pruneRepository(ctx context.Context, repository string, dryRun bool) (*PruneReport, error) {
 	ctxt, cancel := context.WithTimeout(ctx, pruneTimeout)
 	defer cancel()
+	var rules []RetentionRule
+	if p.KubernetesClient != nil {
+		r, err := loadRetentionRules(ctxt, p.KubernetesClient)
+		if err != nil {
+			return nil, fmt.Errorf("will not prune %s: %w", repository, err)
+		}
+		rules = r
+	}
 	pipelineRuns, err := listPipelineRuns(ctxt, p.TektonClient, repository)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	p.Logger.Debugf("Found %d pipeline runs related to repository %s.", len(pipelineRuns.Items), repository)
+	report := &PruneReport{
+		Repository:   repository,
+		Time:         time.Now(),
+		DryRun:       dryRun,
+		Pipelines:    []string{},
+		PipelineRuns: []string{},
+	}
 	prByStage := p.categorizePipelineRunsByStage(pipelineRuns.Items)
 	for stage, prs := range prByStage {
 		p.Logger.Debugf("Calculating prunable pipelines / pipeline runs for stage %s ...", stage)
-		prunable := p.findPrunableResources(prs)
+		prunable := p.findPrunableResources(stage, prs, rules, dryRun)
+		report.Pipelines = append(report.Pipelines, prunable.pipelines...)
+		report.PipelineRuns = append(report.PipelineRuns, prunable.pipelineRuns...)
+
+		if dryRun {
+			continue
+		}
 
 		p.Logger.Debugf("Pruning %d \"%s\" stage pipelines and their dependent runs ...", len(prunable.pipelines), stage)
 		for _, name := range prunable.pipelines {
+			if err := p.archiveRuns(ctxt, prs, func(pr tekton.PipelineRun) bool {
+				return pr.Labels[tektonPipelineLabel] == name
+			}); err != nil {
+				p.Logger.Warnf("Will not prune pipeline %s: %s", name, err)
+				report.Failed = append(report.Failed, name)
+				continue
+			}
 			err := p.prunePipeline(ctxt, name)
 			if err != nil {
 				p.Logger.Warnf("Failed to prune pipeline %s: %s", name, err)
+				report.Failed = append(report.Failed, name)
 			}
 		}
 
 		p.Logger.Debugf("Pruning %d \"%s\" stage pipeline runs ...", len(prunable.pipelineRuns), stage)
 		for _, name := range prunable.pipelineRuns {
+			if err := p.archiveRuns(ctxt, prs, func(pr tekton.PipelineRun) bool {
+				return pr.Name == name
+			}); err != nil {
+				p.Logger.Warnf("Will not prune pipeline run %s: %s", name, err)
+				report.Failed = append(report.Failed, name)
+				continue
+			}
 			err := p.pruneRun(ctxt, name)
 			if err != nil {
 				p.Logger.Warnf("Failed to prune pipeline run %s: %s", name, err)
+				report.Failed = append(report.Failed, name)
 			}
 		}
 	}
-	return nil
+	sort.Strings(report.Pipelines)
+	sort.Strings(report.PipelineRuns)
+	p.recordReport(report)
+	return report, nil
 }
 
 // categorizePipelineRunsByStage assigns the given pipelineRuns into buckets
@@ -135,26 +203,44 @@ func (p *Pruner) categorizePipelineRunsByStage(pipelineRuns []tekton.PipelineRun
 }
 
 // findPrunableResources finds resources that can be pruned within the given
-// pipeline runs. Returned resources are either pipelines or pipeline runs.
+// pipeline runs of stage. Returned resources are either pipelines or pipeline runs.
 // If all pipeline runs of one pipeline can be pruned, the pipeline is
 // returned instead of the individual pipeline runs.
-func (s *Pruner) findPrunableResources(pipelineRuns []tekton.PipelineRun) *prunableResources {
+// Each run is evaluated against the first retention rule matching its branch,
+// and the decision is logged (at debug level only if dryRun is set).
+func (s *Pruner) findPrunableResources(stage string, pipelineRuns []tekton.PipelineRun, rules []RetentionRule, dryRun bool) *prunableResources {
 	sortPipelineRunsDescending(pipelineRuns)
 
 	// Apply cleanup to each bucket.
 	prunablePipelines := []string{}
 	prunablePipelineRuns := []string{}
 
-	cutoff := time.Now().Add(time.Duration(s.MinKeepHours*-1) * time.Hour)
+	now := time.Now()
 	protectedRuns := []tekton.PipelineRun{}
 	prunableRuns := []tekton.PipelineRun{}
+	// Number of protected runs per policy (and branch if the policy applies
+	// per branch).
+	protectedCount := map[string]int{}
 	// Categorize runs as either "protected" or "prunable".
-	// A run is protected if it is newer than the cutoff time, or if MaxKeepRuns
-	// is not reached yet.
+	// A run is protected if it created a release tag, if it is newer than the
+	// cutoff time of its policy, or if MaxKeepRuns of its policy is not reached yet.
 	for _, p := range pipelineRuns {
-		if p.CreationTimestamp.Time.After(cutoff) || len(protectedRuns) < s.MaxKeepRuns {
+		branch := pipelineRunBranch(p)
+		policy := s.retentionPolicyFor(rules, stage, branch)
+		bucket := policy.name
+		if policy.perBranch {
+			bucket = bucket + "/" + branch
+		}
+		protected, reason := retentionDecision(p, policy, protectedCount[bucket], now)
+		if protected {
+			s.Logger.Debugf("Keeping pipeline run %s: %s", p.Name, reason)
+			protectedCount[bucket]++
 			protectedRuns = append(protectedRuns, p)
+		} else if dryRun {
+			s.Logger.Debugf("Would prune pipeline run %s: %s", p.Name, reason)
+			prunableRuns = append(prunableRuns, p)
 		} else {
+			s.Logger.Infof("Pruning pipeline run %s: %s", p.Name, reason)
 			prunableRuns = append(prunableRuns, p)
 		}
 	}
@@ -186,6 +272,25 @@ func pipelineIsProtected(pipelineName string, protected []tekton.PipelineRun) bo
 	return false
 }
 
+// archiveRuns archives all pipeline runs within pipelineRuns for which
+// selected returns true. Archiving is skipped if no archiver is configured.
+func (p *Pruner) archiveRuns(ctxt context.Context, pipelineRuns []tekton.PipelineRun, selected func(pr tekton.PipelineRun) bool) error {
+	if p.Archiver == nil {
+		return nil
+	}
+	for _, pr := range pipelineRuns {
+		if !selected(pr) {
+			continue
+		}
+		link, err := p.Archiver.archive(ctxt, pr)
+		if err != nil {
+			return err
+		}
+		p.Logger.Infof("Archived pipeline run %s at %s.", pr.Name, link)
+	}
+	return nil
+}
+
 // pruneRun removes the pipeline run identified by name. The deletion is
 // propagated to dependents.
 func (p *Pruner) pruneRun(ctxt context.Context, name string) error {
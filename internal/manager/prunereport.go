@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// pruneMetrics exposes pruning statistics via expvar (served under
+// /debug/vars). In dry-run mode, only the prunable counters increase.
+var pruneMetrics = expvar.NewMap("prune")
+
+// PruneReport describes the resources of a repository which were pruned, or
+// which would be pruned in dry-run mode.
+type PruneReport struct {
+	Repository   string    `json:"repository"`
+	Time         time.Time `json:"time"`
+	DryRun       bool      `json:"dryRun"`
+	Pipelines    []string  `json:"pipelines"`
+	PipelineRuns []string  `json:"pipelineRuns"`
+	// Failed lists resources which could not be deleted.
+	Failed []string `json:"failed,omitempty"`
+}
+
+// pruneRequest is the payload of an on-demand prune request.
+// If Repository is empty, all repositories are pruned.
+type pruneRequest struct {
+	Repository string `json:"repository"`
+	DryRun     bool   `json:"dryRun"`
+}
+
+// recordReport stores report as latest report of its repository and updates
+// the metrics.
+func (p *Pruner) recordReport(report *PruneReport) {
+	p.reportsMu.Lock()
+	defer p.reportsMu.Unlock()
+	if p.reports == nil {
+		p.reports = map[string]*PruneReport{}
+	}
+	p.reports[report.Repository] = report
+
+	pruneMetrics.Add("prunablePipelines", int64(len(report.Pipelines)))
+	pruneMetrics.Add("prunablePipelineRuns", int64(len(report.PipelineRuns)))
+	if !report.DryRun {
+		pruneMetrics.Add("prunedPipelines", int64(len(report.Pipelines)))
+		pruneMetrics.Add("prunedPipelineRuns", int64(len(report.PipelineRuns)))
+		pruneMetrics.Add("failedDeletions", int64(len(report.Failed)))
+	}
+}
+
+// latestReports returns the latest report of each repository, sorted by
+// repository name.
+func (p *Pruner) latestReports() []*PruneReport {
+	p.reportsMu.Lock()
+	defer p.reportsMu.Unlock()
+	reports := []*PruneReport{}
+	for _, r := range p.reports {
+		reports = append(reports, r)
+	}
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Repository < reports[j].Repository
+	})
+	return reports
+}
+
+// HandleStatus responds with the latest prune report of each repository.
+// The query parameter "repository" restricts the response to one repository.
+func (p *Pruner) HandleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	reports := p.latestReports()
+	if repository := strings.ToLower(r.URL.Query().Get("repository")); repository != "" {
+		filtered := []*PruneReport{}
+		for _, report := range reports {
+			if report.Repository == repository {
+				filtered = append(filtered, report)
+			}
+		}
+		reports = filtered
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(reports)
+	if err != nil {
+		p.Logger.Errorf("cannot write body: %s", err)
+	}
+}
+
+// HandlePrune handles requests to prune one repository, or all repositories,
+// immediately. It responds with the reports of the pruned repositories.
+// Requests must be signed with the webhook secret, in the same way Bitbucket
+// signs webhook requests.
+func (p *Pruner) HandlePrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "could not read body"
+		p.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if err := validatePayload(r.Header, body, []byte(p.WebhookSecret)); err != nil {
+		msg := "failed to validate incoming request"
+		p.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	req := &pruneRequest{}
+	if len(body) > 0 {
+		if err := json.Unmarshal(body, &req); err != nil {
+			msg := fmt.Sprintf("cannot parse JSON: %s", err)
+			p.Logger.Errorf(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+	reports, err := p.pruneOnDemand(r.Context(), strings.ToLower(req.Repository), req.DryRun || p.DryRun)
+	if err != nil {
+		msg := fmt.Sprintf("could not prune: %s", err)
+		p.Logger.Errorf(msg)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(reports)
+	if err != nil {
+		p.Logger.Errorf("cannot write body: %s", err)
+	}
+}
+
+// pruneOnDemand prunes repository, or all repositories with pipeline runs if
+// repository is empty.
+func (p *Pruner) pruneOnDemand(ctx context.Context, repository string, dryRun bool) ([]*PruneReport, error) {
+	repositories := []string{repository}
+	if repository == "" {
+		r, err := p.repositories(ctx)
+		if err != nil {
+			return nil, err
+		}
+		repositories = r
+	}
+	reports := []*PruneReport{}
+	for _, repo := range repositories {
+		p.Logger.Infof("Pruning repository %s on demand (dry-run: %v) ...", repo, dryRun)
+		report, err := p.pruneRepository(ctx, repo, dryRun)
+		if err != nil {
+			return reports, fmt.Errorf("repository %s: %w", repo, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// repositories returns the names of all repositories which have pipeline runs.
+func (p *Pruner) repositories(ctx context.Context) ([]string, error) {
+	ctxt, cancel := context.WithTimeout(ctx, pruneTimeout)
+	defer cancel()
+	pipelineRuns, err := p.TektonClient.ListPipelineRuns(
+		ctxt, metav1.ListOptions{LabelSelector: repositoryLabel},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not list pipeline runs: %w", err)
+	}
+	repositories := []string{}
+	for _, pr := range pipelineRuns.Items {
+		if r := pr.Labels[repositoryLabel]; r != "" {
+			repositories = append(repositories, r)
+		}
+	}
+	repositories = unique(repositories)
+	sort.Strings(repositories)
+	return repositories, nil
+}
@@ -0,0 +1,163 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+func TestPruneDryRun(t *testing.T) {
+	tclient := &tektonClient.TestClient{
+		PipelineRuns: []*tekton.PipelineRun{
+			pipelineRun("pr-a", "p-one", config.DevStage, time.Now().Add(time.Minute*-1)),
+			pipelineRun("pr-b", "p-one", config.DevStage, time.Now().Add(time.Hour*-4)),
+			pipelineRun("pr-c", "p-two", config.DevStage, time.Now().Add(time.Hour*-5)),
+		},
+	}
+	p := &Pruner{
+		TektonClient: tclient,
+		Logger:       &logging.LeveledLogger{Level: logging.LevelNull},
+		MinKeepHours: 2,
+		MaxKeepRuns:  1,
+		DryRun:       true,
+	}
+	err := p.prune(context.TODO(), "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tclient.DeletedPipelineRuns) > 0 || len(tclient.DeletedPipelines) > 0 {
+		t.Fatal("should not have deleted anything in dry-run mode")
+	}
+	reports := p.latestReports()
+	if len(reports) != 1 {
+		t.Fatalf("Want one report, got: %d", len(reports))
+	}
+	got := reports[0]
+	if !got.DryRun || got.Repository != "repo" {
+		t.Fatalf("Want dry-run report for repo, got: %+v", got)
+	}
+	if diff := cmp.Diff([]string{"pr-b"}, got.PipelineRuns); diff != "" {
+		t.Fatalf("pipeline runs mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"p-two"}, got.Pipelines); diff != "" {
+		t.Fatalf("pipelines mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHandlePrune(t *testing.T) {
+	tests := map[string]struct {
+		body            string
+		wantRepos       []string
+		wantDeletedRuns []string
+	}{
+		"prunes one repository": {
+			body:            `{"repository": "foo-bar"}`,
+			wantRepos:       []string{"foo-bar"},
+			wantDeletedRuns: []string{"pr-b"},
+		},
+		"reports all repositories in dry-run mode": {
+			body:            `{"dryRun": true}`,
+			wantRepos:       []string{"foo-bar", "foo-baz"},
+			wantDeletedRuns: nil,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			a := pipelineRun("pr-a", "p-one", config.DevStage, time.Now().Add(time.Minute*-1))
+			a.Labels[repositoryLabel] = "foo-bar"
+			b := pipelineRun("pr-b", "p-one", config.DevStage, time.Now().Add(time.Hour*-4))
+			b.Labels[repositoryLabel] = "foo-bar"
+			c := pipelineRun("pr-c", "p-one", config.DevStage, time.Now().Add(time.Minute*-2))
+			c.Labels[repositoryLabel] = "foo-baz"
+			tclient := &tektonClient.TestClient{PipelineRuns: []*tekton.PipelineRun{a, b, c}}
+			p := &Pruner{
+				TektonClient:  tclient,
+				Logger:        &logging.LeveledLogger{Level: logging.LevelNull},
+				MinKeepHours:  2,
+				MaxKeepRuns:   1,
+				WebhookSecret: testWebhookSecret,
+			}
+			ts := httptest.NewServer(http.HandlerFunc(p.HandlePrune))
+			defer ts.Close()
+			body := []byte(tc.body)
+			req, err := http.NewRequest("POST", ts.URL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(signatureHeader, hmacHeader(t, testWebhookSecret, body))
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != http.StatusOK {
+				t.Fatalf("Got status: %v, want: %v", res.StatusCode, http.StatusOK)
+			}
+			var reports []PruneReport
+			err = json.NewDecoder(res.Body).Decode(&reports)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRepos := []string{}
+			for _, r := range reports {
+				gotRepos = append(gotRepos, r.Repository)
+			}
+			if diff := cmp.Diff(tc.wantRepos, gotRepos); diff != "" {
+				t.Fatalf("repositories mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantDeletedRuns, tclient.DeletedPipelineRuns); diff != "" {
+				t.Fatalf("deleted pipeline runs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestHandlePruneStatus(t *testing.T) {
+	p := &Pruner{Logger: &logging.LeveledLogger{Level: logging.LevelNull}}
+	p.recordReport(&PruneReport{Repository: "foo-baz", DryRun: true, PipelineRuns: []string{"pr-c"}})
+	p.recordReport(&PruneReport{Repository: "foo-bar", DryRun: true, PipelineRuns: []string{"pr-a"}})
+	ts := httptest.NewServer(http.HandlerFunc(p.HandleStatus))
+	defer ts.Close()
+	tests := map[string]struct {
+		query     string
+		wantRepos []string
+	}{
+		"all repositories": {
+			query:     "",
+			wantRepos: []string{"foo-bar", "foo-baz"},
+		},
+		"one repository": {
+			query:     "?repository=foo-baz",
+			wantRepos: []string{"foo-baz"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := http.Get(ts.URL + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var reports []PruneReport
+			err = json.NewDecoder(res.Body).Decode(&reports)
+			if err != nil {
+				t.Fatal(err)
+			}
+			gotRepos := []string{}
+			for _, r := range reports {
+				gotRepos = append(gotRepos, r.Repository)
+			}
+			if diff := cmp.Diff(tc.wantRepos, gotRepos); diff != "" {
+				t.Fatalf("repositories mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/pkg/logging"
 	corev1 "k8s.io/api/core/v1"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
@@ -18,42 +20,93 @@ const (
 	pvcProtectionFinalizer = "kubernetes.io/pvc-protection"
 )
 
-// createPVCIfRequired if it does not exist yet
+// createPVCIfRequired creates the PVC if it does not exist yet. If the PVC
+// exists but is smaller than requested, it is expanded.
 func (s *Scheduler) createPVCIfRequired(ctxt context.Context, pData PipelineConfig) error {
-	_, err := s.KubernetesClient.GetPersistentVolumeClaim(ctxt, pData.PVC, metav1.GetOptions{})
+	size, err := pvcSize(s.StorageConfig.Size, pData.WorkspaceSize)
+	if err != nil {
+		return err
+	}
+	pvc, err := s.KubernetesClient.GetPersistentVolumeClaim(ctxt, pData.PVC, metav1.GetOptions{})
 	if err != nil {
 		if !kerrors.IsNotFound(err) {
 			return fmt.Errorf("could not determine if %s already exists: %w", pData.PVC, err)
 		}
-		vm := corev1.PersistentVolumeFilesystem
-		pvc := &corev1.PersistentVolumeClaim{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:        pData.PVC,
-				Labels:      map[string]string{repositoryLabel: pData.Repository},
-				Finalizers:  []string{pvcProtectionFinalizer},
-				Annotations: map[string]string{},
-			},
-			Spec: corev1.PersistentVolumeClaimSpec{
-				AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
-				Resources: corev1.ResourceRequirements{
-					Requests: corev1.ResourceList{
-						corev1.ResourceName(corev1.ResourceStorage): resource.MustParse(s.StorageConfig.Size),
-					},
+		return createPVC(ctxt, s.KubernetesClient, s.Logger, s.StorageConfig, pData.PVC, pData.Project, pData.Repository, size)
+	}
+	if pvc.DeletionTimestamp != nil {
+		return fmt.Errorf("PVC %s is being deleted, retry once the deletion has finished", pData.PVC)
+	}
+	s.expandPVCIfRequired(ctxt, pvc, size)
+	return nil
+}
+
+// expandPVCIfRequired expands the PVC if its storage request is smaller than
+// size. Expansion requires a storage class which allows volume expansion,
+// therefore failures are only logged.
+func (s *Scheduler) expandPVCIfRequired(ctxt context.Context, pvc *corev1.PersistentVolumeClaim, size resource.Quantity) {
+	current := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	if size.Cmp(current) <= 0 {
+		return
+	}
+	s.Logger.Infof("Expanding PVC %s from %s to %s ...", pvc.Name, current.String(), size.String())
+	if pvc.Spec.Resources.Requests == nil {
+		pvc.Spec.Resources.Requests = corev1.ResourceList{}
+	}
+	pvc.Spec.Resources.Requests[corev1.ResourceStorage] = size
+	_, err := s.KubernetesClient.UpdatePersistentVolumeClaim(ctxt, pvc, metav1.UpdateOptions{})
+	if err != nil {
+		s.Logger.Warnf("Could not expand PVC %s: %s", pvc.Name, err)
+	}
+}
+
+// createPVC creates a PVC with given name and size for repository.
+func createPVC(ctxt context.Context, client kubernetesClient.ClientPersistentVolumeClaimInterface, logger logging.LeveledLoggerInterface, storageConfig StorageConfig, name, project, repository string, size resource.Quantity) error {
+	vm := corev1.PersistentVolumeFilesystem
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{projectLabel: project, repositoryLabel: repository},
+			Finalizers:  []string{pvcProtectionFinalizer},
+			Annotations: map[string]string{},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes: []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{
+					corev1.ResourceName(corev1.ResourceStorage): size,
 				},
-				StorageClassName: &s.StorageConfig.ClassName,
-				VolumeMode:       &vm,
 			},
-		}
-		if s.StorageConfig.Provisioner != "" {
-			pvc.Annotations[storageProvisionerAnnotation] = s.StorageConfig.Provisioner
-		}
-		s.Logger.Debugf("Creating PVC %s ...", pvc)
-		_, err := s.KubernetesClient.CreatePersistentVolumeClaim(ctxt, pvc, metav1.CreateOptions{})
-		if err != nil {
-			return err
-		}
+			StorageClassName: &storageConfig.ClassName,
+			VolumeMode:       &vm,
+		},
 	}
-	return nil
+	if storageConfig.Provisioner != "" {
+		pvc.Annotations[storageProvisionerAnnotation] = storageConfig.Provisioner
+	}
+	logger.Debugf("Creating PVC %s ...", pvc)
+	_, err := client.CreatePersistentVolumeClaim(ctxt, pvc, metav1.CreateOptions{})
+	return err
+}
+
+// pvcSize returns the larger one of defaultSize and requestedSize.
+// requestedSize may be empty.
+func pvcSize(defaultSize, requestedSize string) (resource.Quantity, error) {
+	size, err := resource.ParseQuantity(defaultSize)
+	if err != nil {
+		return size, fmt.Errorf("invalid default PVC size '%s': %w", defaultSize, err)
+	}
+	if len(requestedSize) == 0 {
+		return size, nil
+	}
+	requested, err := resource.ParseQuantity(requestedSize)
+	if err != nil {
+		return size, fmt.Errorf("invalid PVC size '%s': %w", requestedSize, err)
+	}
+	if requested.Cmp(size) > 0 {
+		return requested, nil
+	}
+	return size, nil
 }
 
 func makePVCName(component string) string {
@@ -3,6 +3,7 @@ package manager
 import (
 	"context"
 	"testing"
+	"time"
 
 	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
 	"github.com/opendevstack/pipeline/pkg/config"
@@ -69,3 +70,57 @@ func TestCreatePVCIfRequired(t *testing.T) {
 		})
 	}
 }
+
+func TestExpandPVC(t *testing.T) {
+	tests := map[string]struct {
+		existingSize  string
+		workspaceSize string
+		wantUpdate    bool
+	}{
+		"no size requested": {
+			existingSize:  "1Gi",
+			workspaceSize: "",
+			wantUpdate:    false,
+		},
+		"larger size requested": {
+			existingSize:  "1Gi",
+			workspaceSize: "5Gi",
+			wantUpdate:    true,
+		},
+		"smaller size requested": {
+			existingSize:  "10Gi",
+			workspaceSize: "5Gi",
+			wantUpdate:    false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := &kubernetesClient.TestClient{
+				PVCs: []*corev1.PersistentVolumeClaim{testPVC("pvc", "repo", tc.existingSize, time.Now())},
+			}
+			s := &Scheduler{
+				KubernetesClient: c,
+				StorageConfig:    StorageConfig{ClassName: "class", Size: "1Gi"},
+				Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+			}
+			pData := PipelineConfig{
+				PipelineInfo:  PipelineInfo{Repository: "repo"},
+				PVC:           "pvc",
+				WorkspaceSize: tc.workspaceSize,
+			}
+			err := s.createPVCIfRequired(context.TODO(), pData)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.wantUpdate && len(c.UpdatedPVCs) == 0 {
+				t.Fatal("should have expanded the PVC")
+			}
+			if !tc.wantUpdate && len(c.UpdatedPVCs) > 0 {
+				t.Fatal("should not have expanded the PVC")
+			}
+			if len(c.CreatedPVCs) > 0 {
+				t.Fatal("should not have created a PVC")
+			}
+		})
+	}
+}
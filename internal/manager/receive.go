@@ -55,6 +55,9 @@ type PipelineInfo struct {
 	Comment         string `json:"comment"`
 	PullRequestKey  int    `json:"prKey"`
 	PullRequestBase string `json:"prBase"`
+	// PromoteFrom is the environment a promoted commit has been deployed to
+	// already. Empty unless the pipeline run promotes a commit.
+	PromoteFrom string `json:"promoteFrom,omitempty"`
 }
 
 // Handle handles Bitbucket requests. It extracts pipeline data from the request
@@ -90,6 +93,7 @@ func (s *BitbucketWebhookReceiver) Handle(w http.ResponseWriter, r *http.Request
 	var projectParam string
 	var component string
 	var commitSHA string
+	var fromCommitSHA string
 	commentText := ""
 
 	if req.EventKey == "repo:refs_changed" {
@@ -100,6 +104,9 @@ func (s *BitbucketWebhookReceiver) Handle(w http.ResponseWriter, r *http.Request
 
 		projectParam = req.Repository.Project.Key
 		commitSHA = change.ToHash
+		if strings.Trim(change.FromHash, "0") != "" {
+			fromCommitSHA = change.FromHash
+		}
 
 		if change.Ref.Type != allowedChangeRefType {
 			msg := fmt.Sprintf(
@@ -211,13 +218,48 @@ func (s *BitbucketWebhookReceiver) Handle(w http.ResponseWriter, r *http.Request
 	}
 	pInfo.Version = odsConfig.Version
 
+	pipeline := selectPipeline(odsConfig.PipelineDefinitions(), pInfo)
+	if pipeline == nil {
+		msg := "No pipeline matches the trigger conditions"
+		s.Logger.Infof("%s: %s@%s (%s)", msg, pInfo.Repository, pInfo.GitRef, pInfo.TriggerEvent)
+		// According to MDN (https://developer.mozilla.org/en-US/docs/Web/HTTP/Status/418),
+		// "some websites use this response for requests they do not wish to handle [..]".
+		http.Error(w, msg, http.StatusTeapot)
+		return
+	}
+	if len(pipeline.Name) > 0 {
+		// Named pipelines get their own Tekton pipeline per branch.
+		pInfo.Name = makePipelineName(component, pipeline.Name+"-"+gitRef)
+	}
+
+	var changedFiles []string
+	if usesChangedPaths(*pipeline) {
+		since := fromCommitSHA
+		if strings.HasPrefix(pInfo.TriggerEvent, "pr:") {
+			since = pInfo.PullRequestBase
+		}
+		cf, err := getChangedFiles(s.BitbucketClient, pInfo.Project, pInfo.Repository, commitSHA, since)
+		if err != nil {
+			s.Logger.Warnf("Could not determine changed files, assuming all paths changed: %s", err)
+		} else {
+			changedFiles = cf
+		}
+	}
+
 	s.Logger.Infof("%+v", pInfo)
 
 	cfg := PipelineConfig{
-		PipelineInfo: pInfo,
-		PVC:          makePVCName(component),
-		Tasks:        odsConfig.Pipeline.Tasks,
-		Finally:      odsConfig.Pipeline.Finally,
+		PipelineInfo:  pInfo,
+		PVC:           makePVCName(component),
+		WorkspaceSize: odsConfig.Workspace.Size,
+		Extends:       pipeline.Extends,
+		Overrides:     pipeline.Overrides,
+		Params:        pipeline.Params,
+		Workspaces:    pipeline.Workspaces,
+		RunSpec:       pipeline.RunSpec,
+		Tasks:         pipeline.Tasks,
+		Finally:       pipeline.Finally,
+		ChangedFiles:  changedFiles,
 	}
 	s.TriggeredPipelines <- cfg
 
@@ -80,6 +80,58 @@ func TestSelectEnvironmentFromMapping(t *testing.T) {
 	}
 }
 
+func TestSelectPipeline(t *testing.T) {
+	yes := true
+	no := false
+	pipelines := []config.Pipeline{
+		{Name: "pr", Trigger: &config.Trigger{Events: []string{"pr:*"}, PullRequest: &yes}},
+		{Name: "release", Trigger: &config.Trigger{Branches: []string{"master", "release/*"}, PullRequest: &no}},
+		{Name: "push", Trigger: &config.Trigger{Events: []string{"repo:refs_changed"}, Branches: []string{"feature/*"}}},
+	}
+	tests := map[string]struct {
+		pipelines []config.Pipeline
+		pInfo     PipelineInfo
+		want      string
+	}{
+		"pull request event": {
+			pipelines: pipelines,
+			pInfo:     PipelineInfo{TriggerEvent: "pr:opened", GitRef: "feature/foo", PullRequestKey: 1},
+			want:      "pr",
+		},
+		"push to master": {
+			pipelines: pipelines,
+			pInfo:     PipelineInfo{TriggerEvent: "repo:refs_changed", GitRef: "master"},
+			want:      "release",
+		},
+		"push to release branch with open pull request": {
+			pipelines: pipelines,
+			pInfo:     PipelineInfo{TriggerEvent: "repo:refs_changed", GitRef: "release/1.0", PullRequestKey: 1},
+			want:      "<none>",
+		},
+		"push to feature branch": {
+			pipelines: pipelines,
+			pInfo:     PipelineInfo{TriggerEvent: "repo:refs_changed", GitRef: "feature/foo", PullRequestKey: 1},
+			want:      "push",
+		},
+		"pipeline without trigger": {
+			pipelines: []config.Pipeline{{}},
+			pInfo:     PipelineInfo{TriggerEvent: "repo:refs_changed", GitRef: "foo"},
+			want:      "",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := "<none>"
+			if p := selectPipeline(tc.pipelines, tc.pInfo); p != nil {
+				got = p.Name
+			}
+			if got != tc.want {
+				t.Fatalf("Want pipeline '%s', got '%s'", tc.want, got)
+			}
+		})
+	}
+}
+
 func TestIsCiSkipInCommitMessage(t *testing.T) {
 	tests := []struct {
 		message string
@@ -175,6 +227,20 @@ func TestWebhookHandling(t *testing.T) {
 			wantStatus:         http.StatusOK,
 			wantPipelineConfig: true,
 		},
+		"events not matching any pipeline trigger are not processed": {
+			requestBodyFixture: "manager/payload.json",
+			bitbucketClient: &bitbucket.TestClient{
+				Files: map[string][]byte{
+					"ods.yaml": []byte(`pipelines:
+- name: pr
+  trigger:
+    events: ["pr:*"]`),
+				},
+			},
+			wantStatus:         http.StatusTeapot,
+			wantBody:           "No pipeline matches the trigger conditions",
+			wantPipelineConfig: false,
+		},
 		"pr:opened triggers pipeline": {
 			requestBodyFixture: "manager/payload-pr-opened.json",
 			bitbucketClient: &bitbucket.TestClient{
@@ -0,0 +1,207 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"time"
+
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// retentionRulesKey is the key of the "ods-pipeline" ConfigMap holding
+	// the retention rules of the pruner.
+	retentionRulesKey = "pruneRules"
+	// releaseTagResult is the name of the ods-start task result holding the
+	// release tag created by the pipeline run (empty if none).
+	releaseTagResult = "release-tag"
+	// failedMinKeepHoursFactor is applied to MinKeepHours to determine how
+	// long failed runs are kept if a rule does not set FailedMinKeepHours.
+	failedMinKeepHoursFactor = 2
+)
+
+// RetentionRule defines how many pipeline runs to keep for the runs it
+// matches. Runs are matched by stage and branch pattern. Fields which are not
+// set fall back to the settings of the pruner.
+type RetentionRule struct {
+	// Stage of runs this rule applies to. Applies to all stages if empty.
+	Stage config.Stage `json:"stage,omitempty"`
+	// Branch pattern of runs this rule applies to (e.g. "feature/*"). If set,
+	// MaxKeepRuns applies per branch, otherwise per stage.
+	Branch string `json:"branch,omitempty"`
+	// MinKeepHours specifies the minimum hours to keep a successful run.
+	MinKeepHours *int `json:"minKeepHours,omitempty"`
+	// FailedMinKeepHours specifies the minimum hours to keep a failed run.
+	// Defaults to twice the value of MinKeepHours.
+	FailedMinKeepHours *int `json:"failedMinKeepHours,omitempty"`
+	// MaxKeepRuns is the maximum number of runs to keep.
+	MaxKeepRuns *int `json:"maxKeepRuns,omitempty"`
+}
+
+// retentionPolicy is a retention rule with all settings resolved.
+type retentionPolicy struct {
+	name               string
+	perBranch          bool
+	minKeepHours       int
+	failedMinKeepHours int
+	maxKeepRuns        int
+}
+
+// readRetentionRules reads retention rules from given byte slice.
+func readRetentionRules(body []byte) ([]RetentionRule, error) {
+	var rules []RetentionRule
+	err := yaml.UnmarshalStrict(body, &rules, func(dec *json.Decoder) *json.Decoder {
+		dec.DisallowUnknownFields()
+		return dec
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, fmt.Errorf("invalid rule #%d: %w", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r RetentionRule) validate() error {
+	switch r.Stage {
+	case "", config.DevStage, config.QAStage, config.ProdStage:
+	default:
+		return fmt.Errorf("invalid stage value '%s'", r.Stage)
+	}
+	if r.Branch != "" {
+		if _, err := path.Match(r.Branch, ""); err != nil {
+			return fmt.Errorf("invalid branch pattern '%s'", r.Branch)
+		}
+	}
+	for name, v := range map[string]*int{
+		"minKeepHours":       r.MinKeepHours,
+		"failedMinKeepHours": r.FailedMinKeepHours,
+		"maxKeepRuns":        r.MaxKeepRuns,
+	} {
+		if v != nil && *v < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+	return nil
+}
+
+// matches checks whether the rule applies to runs of given stage and branch.
+func (r RetentionRule) matches(stage, branch string) bool {
+	if r.Stage != "" && string(r.Stage) != stage {
+		return false
+	}
+	if r.Branch == "" {
+		return true
+	}
+	if mappingBranchMatch(r.Branch, branch) {
+		return true
+	}
+	matched, _ := path.Match(r.Branch, branch)
+	return matched
+}
+
+// loadRetentionRules retrieves the retention rules from the "ods-pipeline"
+// ConfigMap. A missing ConfigMap or key results in no rules.
+func loadRetentionRules(ctxt context.Context, client kubernetesClient.ClientConfigMapInterface) ([]RetentionRule, error) {
+	cm, err := client.GetConfigMap(ctxt, pipelineConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if kerrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get ConfigMap %s: %w", pipelineConfigMapName, err)
+	}
+	body, ok := cm.Data[retentionRulesKey]
+	if !ok {
+		return nil, nil
+	}
+	rules, err := readRetentionRules([]byte(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not read retention rules: %w", err)
+	}
+	return rules, nil
+}
+
+// retentionPolicyFor returns the policy of the first rule matching given stage
+// and branch. If no rule matches, the defaults of the pruner apply.
+func (p *Pruner) retentionPolicyFor(rules []RetentionRule, stage, branch string) retentionPolicy {
+	policy := retentionPolicy{
+		name:         "default",
+		minKeepHours: p.MinKeepHours,
+		maxKeepRuns:  p.MaxKeepRuns,
+	}
+	var failedMinKeepHours *int
+	for i, r := range rules {
+		if !r.matches(stage, branch) {
+			continue
+		}
+		policy.name = fmt.Sprintf("rule #%d", i+1)
+		policy.perBranch = r.Branch != ""
+		if r.MinKeepHours != nil {
+			policy.minKeepHours = *r.MinKeepHours
+		}
+		if r.MaxKeepRuns != nil {
+			policy.maxKeepRuns = *r.MaxKeepRuns
+		}
+		failedMinKeepHours = r.FailedMinKeepHours
+		break
+	}
+	if failedMinKeepHours != nil {
+		policy.failedMinKeepHours = *failedMinKeepHours
+	} else {
+		policy.failedMinKeepHours = policy.minKeepHours * failedMinKeepHoursFactor
+	}
+	return policy
+}
+
+// retentionDecision decides whether run pr is protected given the policy and
+// the number of runs already protected by it. It returns the reason for the
+// decision.
+func retentionDecision(pr tekton.PipelineRun, policy retentionPolicy, protectedCount int, now time.Time) (bool, string) {
+	if tag := releaseTag(pr); tag != "" {
+		return true, fmt.Sprintf("created release tag %s", tag)
+	}
+	minKeepHours := policy.minKeepHours
+	if pipelineRunFailed(pr) {
+		minKeepHours = policy.failedMinKeepHours
+	}
+	cutoff := now.Add(time.Duration(minKeepHours*-1) * time.Hour)
+	if pr.CreationTimestamp.Time.After(cutoff) {
+		return true, fmt.Sprintf("younger than %d hours (%s)", minKeepHours, policy.name)
+	}
+	if protectedCount < policy.maxKeepRuns {
+		return true, fmt.Sprintf("within the last %d runs (%s)", policy.maxKeepRuns, policy.name)
+	}
+	return false, fmt.Sprintf("older than %d hours and not within the last %d runs (%s)", minKeepHours, policy.maxKeepRuns, policy.name)
+}
+
+// releaseTag returns the release tag created by pr, if any.
+func releaseTag(pr tekton.PipelineRun) string {
+	return taskRunResult(pr, releaseTagResult)
+}
+
+// pipelineRunFailed returns true if pr finished unsuccessfully.
+func pipelineRunFailed(pr tekton.PipelineRun) bool {
+	c := pr.Status.GetCondition(apis.ConditionSucceeded)
+	return c != nil && c.Status == corev1.ConditionFalse
+}
+
+// pipelineRunBranch returns the branch of pr. The exact Git ref is taken from
+// the annotation, falling back to the (sanitized) label for older runs.
+func pipelineRunBranch(pr tekton.PipelineRun) string {
+	if ref, ok := pr.Annotations[gitRefAnnotation]; ok {
+		return ref
+	}
+	return pr.Labels[gitRefLabel]
+}
@@ -0,0 +1,227 @@
+package manager
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+)
+
+func TestReadRetentionRules(t *testing.T) {
+	tests := map[string]struct {
+		rules     string
+		wantError string
+	}{
+		"valid": {
+			rules: `- stage: prod
+  maxKeepRuns: 50
+- stage: qa
+  minKeepHours: 720
+- branch: feature/*
+  maxKeepRuns: 5
+  failedMinKeepHours: 168`,
+		},
+		"empty": {
+			rules: `[]`,
+		},
+		"invalid stage": {
+			rules:     `- stage: staging`,
+			wantError: "invalid rule #1: invalid stage value 'staging'",
+		},
+		"invalid branch pattern": {
+			rules: `- stage: dev
+- branch: "[feature"`,
+			wantError: "invalid rule #2: invalid branch pattern '[feature'",
+		},
+		"negative value": {
+			rules:     `- maxKeepRuns: -1`,
+			wantError: "invalid rule #1: maxKeepRuns must not be negative",
+		},
+		"unknown field": {
+			rules:     `- maxKeepDays: 1`,
+			wantError: `error unmarshaling JSON: while decoding JSON: json: unknown field "maxKeepDays"`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := readRetentionRules([]byte(tc.rules))
+			if len(tc.wantError) == 0 && err != nil {
+				t.Fatal(err)
+			} else if len(tc.wantError) > 0 {
+				if err == nil || tc.wantError != err.Error() {
+					t.Fatalf("Want error: %s, got: %s", tc.wantError, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRetentionPolicyFor(t *testing.T) {
+	p := &Pruner{MinKeepHours: 48, MaxKeepRuns: 20}
+	rules := []RetentionRule{
+		{Stage: config.ProdStage, MaxKeepRuns: intPtr(50)},
+		{Branch: "feature/*", MaxKeepRuns: intPtr(5), FailedMinKeepHours: intPtr(72)},
+		{Stage: config.QAStage, MinKeepHours: intPtr(720)},
+	}
+	tests := map[string]struct {
+		stage  string
+		branch string
+		want   retentionPolicy
+	}{
+		"no matching rule": {
+			stage:  config.DevStage,
+			branch: "master",
+			want:   retentionPolicy{name: "default", minKeepHours: 48, failedMinKeepHours: 96, maxKeepRuns: 20},
+		},
+		"stage rule": {
+			stage:  config.ProdStage,
+			branch: "feature/foo",
+			want:   retentionPolicy{name: "rule #1", minKeepHours: 48, failedMinKeepHours: 96, maxKeepRuns: 50},
+		},
+		"branch rule": {
+			stage:  config.QAStage,
+			branch: "feature/foo",
+			want:   retentionPolicy{name: "rule #2", perBranch: true, minKeepHours: 48, failedMinKeepHours: 72, maxKeepRuns: 5},
+		},
+		"rule with min keep hours": {
+			stage:  config.QAStage,
+			branch: "master",
+			want:   retentionPolicy{name: "rule #3", minKeepHours: 720, failedMinKeepHours: 1440, maxKeepRuns: 20},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := p.retentionPolicyFor(rules, tc.stage, tc.branch)
+			if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(retentionPolicy{})); diff != "" {
+				t.Fatalf("policy mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestPruneWithRetentionRules(t *testing.T) {
+	tclient := &tektonClient.TestClient{
+		PipelineRuns: []*tekton.PipelineRun{
+			// not pruned, within last 2 runs of feature/a
+			branchPipelineRun("pr-a1", "p-a", "feature/a", time.Now().Add(time.Hour*-10)),
+			// not pruned, within last 2 runs of feature/a
+			branchPipelineRun("pr-a2", "p-a", "feature/a", time.Now().Add(time.Hour*-11)),
+			// pruned, only 2 runs per feature branch are kept
+			branchPipelineRun("pr-a3", "p-a", "feature/a", time.Now().Add(time.Hour*-12)),
+			// not pruned, within last 2 runs of feature/b
+			branchPipelineRun("pr-b1", "p-b", "feature/b", time.Now().Add(time.Hour*-13)),
+			// not pruned, failed runs are kept for 20 hours
+			failedPipelineRun(branchPipelineRun("pr-c1", "p-c", "master", time.Now().Add(time.Hour*-14))),
+			// pruned, older than 20 hours
+			failedPipelineRun(branchPipelineRun("pr-c2", "p-c", "master", time.Now().Add(time.Hour*-24))),
+			// not pruned, created release tag
+			taggedPipelineRun(branchPipelineRun("pr-c3", "p-c", "master", time.Now().Add(time.Hour*-30)), "v1.0.0-rc.1"),
+			// pruned, older than 2 hours and no runs are kept by count
+			branchPipelineRun("pr-c4", "p-c", "master", time.Now().Add(time.Hour*-40)),
+		},
+	}
+	kclient := &kubernetesClient.TestClient{
+		CMs: []*corev1.ConfigMap{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: pipelineConfigMapName},
+				Data: map[string]string{
+					retentionRulesKey: `- branch: feature/*
+  maxKeepRuns: 2
+- minKeepHours: 2
+  failedMinKeepHours: 20
+  maxKeepRuns: 0`,
+				},
+			},
+		},
+	}
+	p := &Pruner{
+		TektonClient:     tclient,
+		KubernetesClient: kclient,
+		Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+		MinKeepHours:     1,
+		MaxKeepRuns:      1,
+	}
+	err := p.prune(context.TODO(), "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tclient.DeletedPipelineRuns)
+	if diff := cmp.Diff([]string{"pr-a3", "pr-c2", "pr-c4"}, tclient.DeletedPipelineRuns); diff != "" {
+		t.Fatalf("pipeline run prune mismatch (-want +got):\n%s", diff)
+	}
+	if len(tclient.DeletedPipelines) > 0 {
+		t.Fatalf("Want no pipelines to be pruned, got: %v", tclient.DeletedPipelines)
+	}
+}
+
+func TestPruneWithInvalidRetentionRules(t *testing.T) {
+	tclient := &tektonClient.TestClient{
+		PipelineRuns: []*tekton.PipelineRun{
+			pipelineRun("pr-a", "p-one", config.DevStage, time.Now().Add(time.Hour*-10)),
+		},
+	}
+	kclient := &kubernetesClient.TestClient{
+		CMs: []*corev1.ConfigMap{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: pipelineConfigMapName},
+				Data:       map[string]string{retentionRulesKey: `- stage: staging`},
+			},
+		},
+	}
+	p := &Pruner{
+		TektonClient:     tclient,
+		KubernetesClient: kclient,
+		Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+	}
+	err := p.prune(context.TODO(), "repo")
+	if err == nil {
+		t.Fatal("want error for invalid rules")
+	}
+	if len(tclient.DeletedPipelineRuns) > 0 || len(tclient.DeletedPipelines) > 0 {
+		t.Fatal("should not have pruned anything")
+	}
+}
+
+func branchPipelineRun(name, pipeline, branch string, creationTime time.Time) *tekton.PipelineRun {
+	pr := pipelineRun(name, pipeline, config.DevStage, creationTime)
+	pr.Annotations = map[string]string{gitRefAnnotation: branch}
+	return pr
+}
+
+func failedPipelineRun(pr *tekton.PipelineRun) *tekton.PipelineRun {
+	pr.Status.Status = duckv1beta1.Status{
+		Conditions: duckv1beta1.Conditions{
+			{Type: apis.ConditionSucceeded, Status: corev1.ConditionFalse},
+		},
+	}
+	return pr
+}
+
+func taggedPipelineRun(pr *tekton.PipelineRun, tag string) *tekton.PipelineRun {
+	pr.Status.TaskRuns = map[string]*tekton.PipelineRunTaskRunStatus{
+		pr.Name + "-ods-start": {
+			PipelineTaskName: "ods-start",
+			Status: &tekton.TaskRunStatus{
+				TaskRunStatusFields: tekton.TaskRunStatusFields{
+					TaskRunResults: []tekton.TaskRunResult{{Name: releaseTagResult, Value: tag}},
+				},
+			},
+		},
+	}
+	return pr
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// tektonPipelineTasks turns given tasks into Tekton pipeline tasks, translating
+// their runIf conditions into "when" expressions.
+func tektonPipelineTasks(tasks []config.PipelineTask, cfg PipelineConfig) []tekton.PipelineTask {
+	var pipelineTasks []tekton.PipelineTask
+	for _, t := range tasks {
+		pt := t.PipelineTask
+		if t.RunIf != nil {
+			pt.WhenExpressions = append(pt.WhenExpressions, runIfWhenExpressions(pt.Name, *t.RunIf, cfg)...)
+		}
+		pipelineTasks = append(pipelineTasks, pt)
+	}
+	return pipelineTasks
+}
+
+// runIfWhenExpressions returns "when" expressions which guard a task
+// according to the given runIf conditions.
+// Stage and pull request conditions are checked against pipeline params.
+// As "when" expressions do not support patterns, branch conditions are
+// resolved against the branch of cfg when the pipeline is assembled, and
+// changed paths conditions are checked against a param of the task, which
+// is set per pipeline run (see changedPathsParams).
+func runIfWhenExpressions(task string, runIf config.RunIf, cfg PipelineConfig) []tekton.WhenExpression {
+	var whenExpressions []tekton.WhenExpression
+	if len(runIf.Stage) > 0 {
+		var stages []string
+		for _, s := range runIf.Stage {
+			stages = append(stages, string(s))
+		}
+		whenExpressions = append(whenExpressions, tekton.WhenExpression{
+			Input:    "$(params.stage)",
+			Operator: selection.In,
+			Values:   stages,
+		})
+	}
+	if len(runIf.Branch) > 0 {
+		whenExpressions = append(whenExpressions, tekton.WhenExpression{
+			Input:    "$(params.git-ref)",
+			Operator: selection.In,
+			Values:   branchValues(runIf.Branch, cfg.GitRef),
+		})
+	}
+	if runIf.PullRequest != nil {
+		whenExpressions = append(whenExpressions, tekton.WhenExpression{
+			Input:    "$(params.is-pr)",
+			Operator: selection.In,
+			Values:   []string{strconv.FormatBool(*runIf.PullRequest)},
+		})
+	}
+	if len(runIf.ChangedPaths) > 0 {
+		whenExpressions = append(whenExpressions, tekton.WhenExpression{
+			Input:    fmt.Sprintf("$(params.%s)", changedPathsParamName(task)),
+			Operator: selection.In,
+			Values:   []string{"true"},
+		})
+	}
+	return whenExpressions
+}
+
+// changedPathsParamName returns the name of the pipeline param holding
+// whether files matching the changedPaths condition of task have changed.
+func changedPathsParamName(task string) string {
+	return changedPathsParamPrefix + task
+}
+
+// changedPathsParamSpecs returns the param specs for all tasks of cfg with
+// a changedPaths condition. Params default to "true" so that tasks run if
+// a pipeline run does not pass them.
+func changedPathsParamSpecs(cfg PipelineConfig) []tekton.ParamSpec {
+	var params []tekton.ParamSpec
+	for _, t := range append(cfg.Tasks, cfg.Finally...) {
+		if t.RunIf != nil && len(t.RunIf.ChangedPaths) > 0 {
+			params = append(params, tektonStringParamSpec(changedPathsParamName(t.Name), "true"))
+		}
+	}
+	return params
+}
+
+// changedPathsParams returns the params for all tasks of cfg with a
+// changedPaths condition, set to whether any of the changed files of cfg
+// matches. As the pipeline is shared by all runs of a branch, the values
+// need to be passed per pipeline run.
+func changedPathsParams(cfg PipelineConfig) []tekton.Param {
+	var params []tekton.Param
+	for _, t := range append(cfg.Tasks, cfg.Finally...) {
+		if t.RunIf != nil && len(t.RunIf.ChangedPaths) > 0 {
+			params = append(params, tektonStringParam(
+				changedPathsParamName(t.Name),
+				strconv.FormatBool(anyPathMatch(t.RunIf.ChangedPaths, cfg.ChangedFiles)),
+			))
+		}
+	}
+	return params
+}
+
+// branchValues returns the values to compare the branch of a pipeline run
+// against. Next to the given branches, gitRef is included if it matches one
+// of the prefix patterns (like "release/*") in branches. Git does not allow
+// "*" in branch names, so patterns never equal an actual branch.
+func branchValues(branches []string, gitRef string) []string {
+	values := append([]string{}, branches...)
+	for _, b := range branches {
+		if strings.HasSuffix(b, "*") && mappingBranchMatch(b, gitRef) {
+			values = append(values, gitRef)
+			break
+		}
+	}
+	return values
+}
+
+// anyPathMatch checks if any of the given files matches any of the given
+// patterns. Patterns are either understood by path.Match, or a directory
+// prefix like "docs/*" matching all files below the directory. If files is
+// nil (changed files are unknown), true is returned.
+func anyPathMatch(patterns []string, files []string) bool {
+	if files == nil {
+		return true
+	}
+	for _, f := range files {
+		for _, p := range patterns {
+			if matched, _ := path.Match(p, f); matched {
+				return true
+			}
+			if strings.HasSuffix(p, "/*") && strings.HasPrefix(f, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// usesChangedPaths checks if any task of the pipeline (or the template it
+// extends) might need to know the changed files.
+func usesChangedPaths(p config.Pipeline) bool {
+	if len(p.Extends) > 0 {
+		return true
+	}
+	for _, t := range append(p.Tasks, p.Finally...) {
+		if t.RunIf != nil && len(t.RunIf.ChangedPaths) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package manager
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+func TestRunIfWhenExpressions(t *testing.T) {
+	yes := true
+	tests := map[string]struct {
+		runIf config.RunIf
+		cfg   PipelineConfig
+		want  []tekton.WhenExpression
+	}{
+		"no conditions": {
+			runIf: config.RunIf{},
+			want:  nil,
+		},
+		"stage": {
+			runIf: config.RunIf{Stage: []config.Stage{config.QAStage, config.ProdStage}},
+			want: []tekton.WhenExpression{
+				{Input: "$(params.stage)", Operator: selection.In, Values: []string{"qa", "prod"}},
+			},
+		},
+		"branch matching prefix": {
+			runIf: config.RunIf{Branch: []string{"master", "release/*"}},
+			cfg:   PipelineConfig{PipelineInfo: PipelineInfo{GitRef: "release/1.0"}},
+			want: []tekton.WhenExpression{
+				{Input: "$(params.git-ref)", Operator: selection.In, Values: []string{"master", "release/*", "release/1.0"}},
+			},
+		},
+		"branch not matching prefix": {
+			runIf: config.RunIf{Branch: []string{"master", "release/*"}},
+			cfg:   PipelineConfig{PipelineInfo: PipelineInfo{GitRef: "feature/foo"}},
+			want: []tekton.WhenExpression{
+				{Input: "$(params.git-ref)", Operator: selection.In, Values: []string{"master", "release/*"}},
+			},
+		},
+		"pull request": {
+			runIf: config.RunIf{PullRequest: &yes},
+			want: []tekton.WhenExpression{
+				{Input: "$(params.is-pr)", Operator: selection.In, Values: []string{"true"}},
+			},
+		},
+		"changed paths": {
+			runIf: config.RunIf{ChangedPaths: []string{"chart/*"}},
+			cfg:   PipelineConfig{ChangedFiles: []string{"README.md"}},
+			want: []tekton.WhenExpression{
+				{Input: "$(params.changed-paths-deploy)", Operator: selection.In, Values: []string{"true"}},
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := runIfWhenExpressions("deploy", tc.runIf, tc.cfg)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("when expressions mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTektonPipelineTasks(t *testing.T) {
+	tasks := []config.PipelineTask{
+		{
+			PipelineTask: tekton.PipelineTask{
+				Name: "deploy",
+				WhenExpressions: []tekton.WhenExpression{
+					{Input: "$(params.foo)", Operator: selection.NotIn, Values: []string{"bar"}},
+				},
+			},
+			RunIf: &config.RunIf{Stage: []config.Stage{config.ProdStage}},
+		},
+		{
+			PipelineTask: tekton.PipelineTask{Name: "notify"},
+		},
+	}
+	got := tektonPipelineTasks(tasks, PipelineConfig{})
+	want := []tekton.PipelineTask{
+		{
+			Name: "deploy",
+			WhenExpressions: []tekton.WhenExpression{
+				{Input: "$(params.foo)", Operator: selection.NotIn, Values: []string{"bar"}},
+				{Input: "$(params.stage)", Operator: selection.In, Values: []string{"prod"}},
+			},
+		},
+		{Name: "notify"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("tasks mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestChangedPathsParams(t *testing.T) {
+	cfg := PipelineConfig{
+		Tasks: []config.PipelineTask{
+			{
+				PipelineTask: tekton.PipelineTask{Name: "deploy"},
+				RunIf:        &config.RunIf{ChangedPaths: []string{"chart/*"}},
+			},
+			{
+				PipelineTask: tekton.PipelineTask{Name: "build"},
+				RunIf:        &config.RunIf{ChangedPaths: []string{"*.go"}},
+			},
+			{
+				PipelineTask: tekton.PipelineTask{Name: "test"},
+				RunIf:        &config.RunIf{Stage: []config.Stage{config.DevStage}},
+			},
+		},
+		Finally: []config.PipelineTask{
+			{
+				PipelineTask: tekton.PipelineTask{Name: "notify"},
+				RunIf:        &config.RunIf{ChangedPaths: []string{"docs/*"}},
+			},
+		},
+	}
+	tests := map[string]struct {
+		changedFiles []string
+		want         []tekton.Param
+	}{
+		"changed paths matching": {
+			changedFiles: []string{"README.md", "chart/templates/deployment.yaml", "docs/foo.md"},
+			want: []tekton.Param{
+				tektonStringParam("changed-paths-deploy", "true"),
+				tektonStringParam("changed-paths-build", "false"),
+				tektonStringParam("changed-paths-notify", "true"),
+			},
+		},
+		"changed paths not matching": {
+			changedFiles: []string{"README.md", "src/docs/foo.go"},
+			want: []tekton.Param{
+				tektonStringParam("changed-paths-deploy", "false"),
+				tektonStringParam("changed-paths-build", "false"),
+				tektonStringParam("changed-paths-notify", "false"),
+			},
+		},
+		"changed paths unknown": {
+			changedFiles: nil,
+			want: []tekton.Param{
+				tektonStringParam("changed-paths-deploy", "true"),
+				tektonStringParam("changed-paths-build", "true"),
+				tektonStringParam("changed-paths-notify", "true"),
+			},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := cfg
+			c.ChangedFiles = tc.changedFiles
+			got := changedPathsParams(c)
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("params mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	wantSpecs := []tekton.ParamSpec{
+		tektonStringParamSpec("changed-paths-deploy", "true"),
+		tektonStringParamSpec("changed-paths-build", "true"),
+		tektonStringParamSpec("changed-paths-notify", "true"),
+	}
+	if diff := cmp.Diff(wantSpecs, changedPathsParamSpecs(cfg)); diff != "" {
+		t.Fatalf("param specs mismatch (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+)
+
+// RunSpecConfig holds cluster-wide settings for pipeline runs, restricting
+// what can be configured in the runSpec of an ods.yaml pipeline.
+type RunSpecConfig struct {
+	// DefaultServiceAccountName is the service account used for pipeline runs
+	// which do not specify a service account.
+	DefaultServiceAccountName string
+	// AllowedServiceAccounts are service accounts which may be used next to
+	// the default service account.
+	AllowedServiceAccounts []string
+	// AllowedPodTemplateFields are pod template fields which may be set,
+	// e.g. "nodeSelector" or "tolerations".
+	AllowedPodTemplateFields []string
+}
+
+// resolveRunSpec validates given runSpec against the allowlist in c and
+// returns a run spec with defaults applied.
+func (c RunSpecConfig) resolveRunSpec(runSpec *config.RunSpec) (*config.RunSpec, error) {
+	resolved := &config.RunSpec{}
+	if runSpec != nil {
+		*resolved = *runSpec
+	}
+	if len(resolved.ServiceAccountName) == 0 {
+		resolved.ServiceAccountName = c.DefaultServiceAccountName
+	}
+	if err := c.validateServiceAccount(resolved.ServiceAccountName); err != nil {
+		return nil, err
+	}
+	if err := c.validatePodTemplate(resolved.PodTemplate); err != nil {
+		return nil, err
+	}
+	for _, trs := range resolved.TaskRunSpecs {
+		if len(trs.TaskServiceAccountName) > 0 {
+			if err := c.validateServiceAccount(trs.TaskServiceAccountName); err != nil {
+				return nil, fmt.Errorf("task %s: %w", trs.PipelineTaskName, err)
+			}
+		}
+		if err := c.validatePodTemplate(trs.TaskPodTemplate); err != nil {
+			return nil, fmt.Errorf("task %s: %w", trs.PipelineTaskName, err)
+		}
+	}
+	return resolved, nil
+}
+
+// validateServiceAccount checks whether the service account sa may be used.
+func (c RunSpecConfig) validateServiceAccount(sa string) error {
+	if sa == c.DefaultServiceAccountName || contains(c.AllowedServiceAccounts, sa) {
+		return nil
+	}
+	return fmt.Errorf("service account %s is not allowed", sa)
+}
+
+// validatePodTemplate checks whether all fields set in the pod template may
+// be used.
+func (c RunSpecConfig) validatePodTemplate(podTemplate *tekton.PodTemplate) error {
+	if podTemplate == nil {
+		return nil
+	}
+	b, err := json.Marshal(podTemplate)
+	if err != nil {
+		return fmt.Errorf("could not marshal pod template: %w", err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return fmt.Errorf("could not unmarshal pod template: %w", err)
+	}
+	var names []string
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !contains(c.AllowedPodTemplateFields, name) {
+			return fmt.Errorf("pod template field %s is not allowed", name)
+		}
+	}
+	return nil
+}
+
+// contains checks if s is in list.
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestResolveRunSpec(t *testing.T) {
+	c := RunSpecConfig{
+		DefaultServiceAccountName: "pipeline",
+		AllowedServiceAccounts:    []string{"pipeline-deployer"},
+		AllowedPodTemplateFields:  []string{"nodeSelector", "tolerations"},
+	}
+	tests := map[string]struct {
+		runSpec   *config.RunSpec
+		want      *config.RunSpec
+		wantError string
+	}{
+		"no run spec": {
+			runSpec: nil,
+			want:    &config.RunSpec{ServiceAccountName: "pipeline"},
+		},
+		"allowed settings": {
+			runSpec: &config.RunSpec{
+				ServiceAccountName: "pipeline-deployer",
+				PodTemplate:        &tekton.PodTemplate{NodeSelector: map[string]string{"size": "large"}},
+				Timeout:            &metav1.Duration{Duration: 2 * time.Hour},
+				TaskRunSpecs: []tekton.PipelineTaskRunSpec{
+					{
+						PipelineTaskName: "build",
+						TaskPodTemplate: &tekton.PodTemplate{
+							Tolerations: []corev1.Toleration{{Key: "build", Operator: corev1.TolerationOpExists}},
+						},
+					},
+				},
+			},
+			want: &config.RunSpec{
+				ServiceAccountName: "pipeline-deployer",
+				PodTemplate:        &tekton.PodTemplate{NodeSelector: map[string]string{"size": "large"}},
+				Timeout:            &metav1.Duration{Duration: 2 * time.Hour},
+				TaskRunSpecs: []tekton.PipelineTaskRunSpec{
+					{
+						PipelineTaskName: "build",
+						TaskPodTemplate: &tekton.PodTemplate{
+							Tolerations: []corev1.Toleration{{Key: "build", Operator: corev1.TolerationOpExists}},
+						},
+					},
+				},
+			},
+		},
+		"service account not allowed": {
+			runSpec:   &config.RunSpec{ServiceAccountName: "default"},
+			wantError: "service account default is not allowed",
+		},
+		"pod template field not allowed": {
+			runSpec: &config.RunSpec{
+				PodTemplate: &tekton.PodTemplate{HostNetwork: true},
+			},
+			wantError: "pod template field hostNetwork is not allowed",
+		},
+		"task service account not allowed": {
+			runSpec: &config.RunSpec{
+				TaskRunSpecs: []tekton.PipelineTaskRunSpec{
+					{PipelineTaskName: "deploy", TaskServiceAccountName: "admin"},
+				},
+			},
+			wantError: "task deploy: service account admin is not allowed",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := c.resolveRunSpec(tc.runSpec)
+			if len(tc.wantError) > 0 {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("Want error: %s, got: %s", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("run spec mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
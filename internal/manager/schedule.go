@@ -38,6 +38,8 @@ type Scheduler struct {
 	TaskSuffix string
 
 	StorageConfig StorageConfig
+	// RunSpecConfig restricts and defaults the run spec of pipeline runs.
+	RunSpecConfig RunSpecConfig
 }
 
 // Run starts the scheduling process.
@@ -60,6 +62,30 @@ func (s *Scheduler) schedule(ctx context.Context, pData PipelineConfig) bool {
 	ctxt, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 
+	if len(pData.Extends) > 0 {
+		err := s.applyPipelineTemplate(ctxt, &pData)
+		if err != nil {
+			s.Logger.Errorf(err.Error())
+			return false
+		}
+	}
+
+	if len(pData.PromoteFrom) > 0 {
+		pData.Tasks = promotionTasks(pData.Tasks)
+		pData.Finally = nil
+		if len(pData.Tasks) == 0 {
+			s.Logger.Errorf("cannot promote %s: pipeline does not contain any %s* tasks", pData.Repository, deployTaskPrefix)
+			return false
+		}
+	}
+
+	runSpec, err := s.RunSpecConfig.resolveRunSpec(pData.RunSpec)
+	if err != nil {
+		s.Logger.Errorf("invalid run spec for pipeline %s: %s", pData.Name, err)
+		return false
+	}
+	pData.RunSpec = runSpec
+
 	newPipeline := assemblePipeline(pData, s.TaskKind, s.TaskSuffix)
 
 	existingPipeline, err := s.TektonClient.GetPipeline(ctxt, pData.Name, metav1.GetOptions{})
@@ -123,6 +149,42 @@ func selectEnvironmentFromMapping(mapping []config.BranchToEnvironmentMapping, b
 	return ""
 }
 
+// selectPipeline selects the first pipeline which trigger matches given
+// pipeline info. Pipelines without a trigger match any pipeline info.
+// If no pipeline matches, nil is returned.
+func selectPipeline(pipelines []config.Pipeline, pInfo PipelineInfo) *config.Pipeline {
+	for _, p := range pipelines {
+		if p.Trigger == nil || triggerMatches(*p.Trigger, pInfo) {
+			return &p
+		}
+	}
+	return nil
+}
+
+// triggerMatches checks if all conditions of the trigger are met by given
+// pipeline info.
+func triggerMatches(trigger config.Trigger, pInfo PipelineInfo) bool {
+	if len(trigger.Events) > 0 && !anyMappingBranchMatch(trigger.Events, pInfo.TriggerEvent) {
+		return false
+	}
+	if len(trigger.Branches) > 0 && !anyMappingBranchMatch(trigger.Branches, pInfo.GitRef) {
+		return false
+	}
+	if trigger.PullRequest != nil && *trigger.PullRequest != (pInfo.PullRequestKey > 0) {
+		return false
+	}
+	return true
+}
+
+func anyMappingBranchMatch(mappingBranches []string, testBranch string) bool {
+	for _, mb := range mappingBranches {
+		if mappingBranchMatch(mb, testBranch) {
+			return true
+		}
+	}
+	return false
+}
+
 func mappingBranchMatch(mappingBranch, testBranch string) bool {
 	// exact match
 	if mappingBranch == testBranch {
@@ -0,0 +1,153 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/opendevstack/pipeline/pkg/config"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// pipelineConfigMapName is the name of the ConfigMap holding pipeline templates.
+	pipelineConfigMapName = "ods-pipeline"
+	// pipelineTemplateKeyPrefix is the prefix of ConfigMap keys holding pipeline templates.
+	pipelineTemplateKeyPrefix = "template-"
+)
+
+// pipelineTemplate represents a pipeline template which can be extended from
+// an ods.yaml file.
+type pipelineTemplate struct {
+	Params     []tekton.ParamSpec    `json:"params,omitempty"`
+	Workspaces []config.Workspace    `json:"workspaces,omitempty"`
+	Tasks      []config.PipelineTask `json:"tasks,omitempty"`
+	Finally    []config.PipelineTask `json:"finally,omitempty"`
+}
+
+// applyPipelineTemplate retrieves the template referenced by pData.Extends
+// from the "ods-pipeline" ConfigMap and merges it into pData. The params and
+// workspaces of the merged pipeline are validated like those in ods.yaml.
+func (s *Scheduler) applyPipelineTemplate(ctxt context.Context, pData *PipelineConfig) error {
+	key := pipelineTemplateKeyPrefix + pData.Extends
+	body, err := s.KubernetesClient.GetConfigMapKey(ctxt, pipelineConfigMapName, key, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("could not get pipeline template %s: %w", pData.Extends, err)
+	}
+	template, err := readPipelineTemplate([]byte(body))
+	if err != nil {
+		return fmt.Errorf("could not read pipeline template %s: %w", pData.Extends, err)
+	}
+	s.Logger.Debugf("Extending pipeline template %s for pipeline %s ...", pData.Extends, pData.Name)
+	err = mergePipelineTemplate(template, pData)
+	if err != nil {
+		return err
+	}
+	err = config.ValidateParamsAndWorkspaces(pData.Params, pData.Workspaces)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline template %s: %w", pData.Extends, err)
+	}
+	return nil
+}
+
+// readPipelineTemplate reads a pipeline template from given byte slice.
+func readPipelineTemplate(body []byte) (*pipelineTemplate, error) {
+	var template *pipelineTemplate
+	err := yaml.UnmarshalStrict(body, &template, func(dec *json.Decoder) *json.Decoder {
+		dec.DisallowUnknownFields()
+		return dec
+	})
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, fmt.Errorf("template is empty")
+	}
+	return template, nil
+}
+
+// mergePipelineTemplate merges given template into pData. Overrides of pData
+// are applied to the template tasks, then the tasks of pData are appended to
+// the template tasks. Params and workspaces of pData replace those of the
+// template with the same name.
+func mergePipelineTemplate(template *pipelineTemplate, pData *PipelineConfig) error {
+	tasks := append([]config.PipelineTask{}, template.Tasks...)
+	finally := append([]config.PipelineTask{}, template.Finally...)
+	for _, o := range pData.Overrides {
+		if !overrideTaskParams(tasks, o) && !overrideTaskParams(finally, o) {
+			return fmt.Errorf("cannot override params of task %s: task not found in template %s", o.Task, pData.Extends)
+		}
+	}
+	names := map[string]bool{}
+	for _, t := range append(tasks, finally...) {
+		names[t.Name] = true
+	}
+	for _, t := range append(pData.Tasks, pData.Finally...) {
+		if names[t.Name] {
+			return fmt.Errorf("task %s is already defined in template %s", t.Name, pData.Extends)
+		}
+	}
+	params := []tekton.ParamSpec{}
+	for _, tp := range template.Params {
+		if !paramSpecDeclared(pData.Params, tp.Name) {
+			params = append(params, tp)
+		}
+	}
+	pData.Params = append(params, pData.Params...)
+	workspaces := []config.Workspace{}
+	for _, tw := range template.Workspaces {
+		if !workspaceDeclared(pData.Workspaces, tw.Name) {
+			workspaces = append(workspaces, tw)
+		}
+	}
+	pData.Workspaces = append(workspaces, pData.Workspaces...)
+	pData.Tasks = append(tasks, pData.Tasks...)
+	pData.Finally = append(finally, pData.Finally...)
+	return nil
+}
+
+// overrideTaskParams applies the override to the matching task in tasks.
+// It returns false if no task matches.
+func overrideTaskParams(tasks []config.PipelineTask, override config.TaskOverride) bool {
+	for i, t := range tasks {
+		if t.Name != override.Task {
+			continue
+		}
+		params := append([]tekton.Param{}, t.Params...)
+		for _, op := range override.Params {
+			replaced := false
+			for j, p := range params {
+				if p.Name == op.Name {
+					params[j] = op
+					replaced = true
+				}
+			}
+			if !replaced {
+				params = append(params, op)
+			}
+		}
+		tasks[i].Params = params
+		return true
+	}
+	return false
+}
+
+func paramSpecDeclared(params []tekton.ParamSpec, name string) bool {
+	for _, p := range params {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func workspaceDeclared(workspaces []config.Workspace, name string) bool {
+	for _, w := range workspaces {
+		if w.Name == name {
+			return true
+		}
+	}
+	return false
+}
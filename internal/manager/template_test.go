@@ -0,0 +1,170 @@
+package manager
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const testPipelineTemplate = `params:
+- name: go-version
+  default: "1.16"
+workspaces:
+- name: scratch
+  emptyDir: {}
+tasks:
+- name: build
+  taskRef:
+    kind: Task
+    name: ods-build-go
+  params:
+  - name: go-os
+    value: linux
+  - name: go-arch
+    value: amd64
+finally:
+- name: notify
+  taskRef:
+    kind: Task
+    name: notify
+`
+
+func TestMergePipelineTemplate(t *testing.T) {
+	tests := map[string]struct {
+		pData       PipelineConfig
+		wantTasks   []string
+		wantFinally []string
+		wantParams  []tekton.Param
+		wantError   string
+	}{
+		"template only": {
+			pData:       PipelineConfig{Extends: "go"},
+			wantTasks:   []string{"build"},
+			wantFinally: []string{"notify"},
+			wantParams: []tekton.Param{
+				tektonStringParam("go-os", "linux"),
+				tektonStringParam("go-arch", "amd64"),
+			},
+		},
+		"additional tasks and overrides": {
+			pData: PipelineConfig{
+				Extends: "go",
+				Overrides: []config.TaskOverride{
+					{
+						Task: "build",
+						Params: []tekton.Param{
+							tektonStringParam("go-os", "darwin"),
+							tektonStringParam("sonar-skip", "true"),
+						},
+					},
+				},
+				Tasks:   []config.PipelineTask{{PipelineTask: tekton.PipelineTask{Name: "package"}}},
+				Finally: []config.PipelineTask{{PipelineTask: tekton.PipelineTask{Name: "cleanup"}}},
+			},
+			wantTasks:   []string{"build", "package"},
+			wantFinally: []string{"notify", "cleanup"},
+			wantParams: []tekton.Param{
+				tektonStringParam("go-os", "darwin"),
+				tektonStringParam("go-arch", "amd64"),
+				tektonStringParam("sonar-skip", "true"),
+			},
+		},
+		"override of unknown task": {
+			pData: PipelineConfig{
+				Extends:   "go",
+				Overrides: []config.TaskOverride{{Task: "deploy"}},
+			},
+			wantError: "cannot override params of task deploy: task not found in template go",
+		},
+		"duplicate task": {
+			pData: PipelineConfig{
+				Extends: "go",
+				Tasks:   []config.PipelineTask{{PipelineTask: tekton.PipelineTask{Name: "build"}}},
+			},
+			wantError: "task build is already defined in template go",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			template, err := readPipelineTemplate([]byte(testPipelineTemplate))
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = mergePipelineTemplate(template, &tc.pData)
+			if len(tc.wantError) > 0 {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("Want error: %s, got: %s", tc.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.wantTasks, taskNames(tc.pData.Tasks)); diff != "" {
+				t.Fatalf("tasks mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantFinally, taskNames(tc.pData.Finally)); diff != "" {
+				t.Fatalf("finally mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tc.wantParams, tc.pData.Tasks[0].Params); diff != "" {
+				t.Fatalf("params mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestApplyPipelineTemplate(t *testing.T) {
+	kc := &kubernetesClient.TestClient{
+		CMs: []*corev1.ConfigMap{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: pipelineConfigMapName},
+				Data: map[string]string{
+					"template-go":       testPipelineTemplate,
+					"template-reserved": "params:\n- name: stage\n  default: dev\n",
+				},
+			},
+		},
+	}
+	s := &Scheduler{
+		KubernetesClient: kc,
+		Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+	}
+	pData := &PipelineConfig{Extends: "go"}
+	if err := s.applyPipelineTemplate(context.TODO(), pData); err != nil {
+		t.Fatal(err)
+	}
+	if len(pData.Tasks) != 1 || pData.Tasks[0].Name != "build" {
+		t.Fatalf("Want task build from template, got: %v", pData.Tasks)
+	}
+	if len(pData.Params) != 1 || pData.Params[0].Name != "go-version" {
+		t.Fatalf("Want param go-version from template, got: %v", pData.Params)
+	}
+	if len(pData.Workspaces) != 1 || pData.Workspaces[0].Name != "scratch" {
+		t.Fatalf("Want workspace scratch from template, got: %v", pData.Workspaces)
+	}
+	pData = &PipelineConfig{Extends: "reserved"}
+	wantError := "invalid pipeline template reserved: param name stage is reserved"
+	if err := s.applyPipelineTemplate(context.TODO(), pData); err == nil || err.Error() != wantError {
+		t.Fatalf("Want error: %s, got: %s", wantError, err)
+	}
+	pData = &PipelineConfig{Extends: "python"}
+	wantError = "could not get pipeline template python: key template-python not found"
+	if err := s.applyPipelineTemplate(context.TODO(), pData); err == nil || err.Error() != wantError {
+		t.Fatalf("Want error: %s, got: %s", wantError, err)
+	}
+}
+
+func taskNames(tasks []config.PipelineTask) []string {
+	names := []string{}
+	for _, t := range tasks {
+		names = append(names, t.Name)
+	}
+	return names
+}
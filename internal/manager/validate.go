@@ -1,9 +1,15 @@
 package manager
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/logging"
 
 	// The github package is used here because the Bitbucket interceptor of
 	// Tekton Triggers uses it to validate incoming webhook requests, see
@@ -11,7 +17,15 @@ import (
 	github "github.com/google/go-github/v42/github"
 )
 
-const signatureHeader = "X-Hub-Signature"
+const (
+	signatureHeader = "X-Hub-Signature"
+	// timestampHeader holds the time (in Unix seconds) at which a request to
+	// an endpoint wrapped by RequireSignature has been signed.
+	timestampHeader = "X-Request-Timestamp"
+	// maxSignatureAge is how far the signing time of a request may deviate
+	// from the current time.
+	maxSignatureAge = 5 * time.Minute
+)
 
 // Canonical updates the map keys to use the Canonical name
 func canonicalHeader(h map[string][]string) http.Header {
@@ -38,3 +52,54 @@ func validatePayload(h http.Header, payload, secretToken []byte) error {
 	}
 	return nil
 }
+
+// RequireSignature wraps handler so that it only serves requests signed
+// recently with the webhook secret. The signature is computed in the same way
+// Bitbucket signs webhook requests, but over the value of the
+// X-Request-Timestamp header followed by the body. As requests signed more
+// than maxSignatureAge ago are refused, a signature cannot be replayed later
+// on, even if the body is empty (such as for GET requests).
+func RequireSignature(webhookSecret string, logger logging.LeveledLoggerInterface, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			msg := "could not read body"
+			logger.Errorf("%s: %s", msg, err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		timestamp := r.Header.Get(timestampHeader)
+		if err := validateTimestamp(timestamp, time.Now()); err != nil {
+			msg := "failed to validate incoming request"
+			logger.Errorf("%s: %s", msg, err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		payload := append([]byte(timestamp), body...)
+		if err := validatePayload(r.Header, payload, []byte(webhookSecret)); err != nil {
+			msg := "failed to validate incoming request"
+			logger.Errorf("%s: %s", msg, err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// validateTimestamp errors if timestamp (in Unix seconds) deviates from now by
+// more than maxSignatureAge.
+func validateTimestamp(timestamp string, now time.Time) error {
+	if timestamp == "" {
+		return fmt.Errorf("no %s set", timestampHeader)
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", timestampHeader, err)
+	}
+	age := now.Sub(time.Unix(seconds, 0))
+	if age > maxSignatureAge || age < -maxSignatureAge {
+		return fmt.Errorf("%s %s is not within %s of the current time", timestampHeader, timestamp, maxSignatureAge)
+	}
+	return nil
+}
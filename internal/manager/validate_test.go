@@ -2,7 +2,12 @@ package manager
 
 import (
 	"net/http"
+	"net/http/httptest"
+	"strconv"
 	"testing"
+	"time"
+
+	"github.com/opendevstack/pipeline/pkg/logging"
 )
 
 const testWebhookSecret = "s3cr3t"
@@ -73,3 +78,115 @@ func TestValidatePayload(t *testing.T) {
 		})
 	}
 }
+
+func TestRequireSignature(t *testing.T) {
+	handler := RequireSignature(
+		testWebhookSecret,
+		&logging.LeveledLogger{Level: logging.LevelNull},
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	stale := strconv.FormatInt(time.Now().Add(-maxSignatureAge-time.Minute).Unix(), 10)
+	tests := map[string]struct {
+		timestamp  string
+		signature  string
+		wantStatus int
+	}{
+		"unsigned": {
+			timestamp:  now,
+			signature:  "",
+			wantStatus: http.StatusBadRequest,
+		},
+		"wrong signature": {
+			timestamp:  now,
+			signature:  "foobar",
+			wantStatus: http.StatusBadRequest,
+		},
+		"signed without timestamp": {
+			timestamp:  "",
+			signature:  hmacHeader(t, testWebhookSecret, []byte{}),
+			wantStatus: http.StatusBadRequest,
+		},
+		"signature of other timestamp": {
+			timestamp:  now,
+			signature:  hmacHeader(t, testWebhookSecret, []byte(stale)),
+			wantStatus: http.StatusBadRequest,
+		},
+		"signed long ago": {
+			timestamp:  stale,
+			signature:  hmacHeader(t, testWebhookSecret, []byte(stale)),
+			wantStatus: http.StatusBadRequest,
+		},
+		"signed": {
+			timestamp:  now,
+			signature:  hmacHeader(t, testWebhookSecret, []byte(now)),
+			wantStatus: http.StatusOK,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest("GET", ts.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.timestamp != "" {
+				req.Header.Set(timestampHeader, tc.timestamp)
+			}
+			if tc.signature != "" {
+				req.Header.Set(signatureHeader, tc.signature)
+			}
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantStatus {
+				t.Fatalf("Got status: %v, want: %v", res.StatusCode, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestValidateTimestamp(t *testing.T) {
+	now := time.Unix(1633096800, 0)
+	tests := map[string]struct {
+		timestamp string
+		wantErr   bool
+	}{
+		"missing": {
+			timestamp: "",
+			wantErr:   true,
+		},
+		"invalid": {
+			timestamp: "yesterday",
+			wantErr:   true,
+		},
+		"current": {
+			timestamp: "1633096800",
+			wantErr:   false,
+		},
+		"slightly old": {
+			timestamp: "1633096560",
+			wantErr:   false,
+		},
+		"too old": {
+			timestamp: "1633096440",
+			wantErr:   true,
+		},
+		"too far ahead": {
+			timestamp: "1633097160",
+			wantErr:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validateTimestamp(tc.timestamp, now)
+			if tc.wantErr != (err != nil) {
+				t.Fatalf("want err: %v, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
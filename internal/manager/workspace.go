@@ -0,0 +1,302 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// workspaceGCInterval defines how often unused PVCs are collected.
+	workspaceGCInterval = 24 * time.Hour
+	// workspaceGCDelay defines when the first collection happens after boot.
+	workspaceGCDelay = 10 * time.Minute
+	// workspaceGCTimeout defines how long one collection is allowed to take.
+	workspaceGCTimeout = 5 * time.Minute
+	// workspaceResetTimeout defines how long to wait for a PVC to be deleted
+	// when resetting a workspace.
+	workspaceResetTimeout = 2 * time.Minute
+	// workspaceResetPollInterval defines how often to check whether a PVC is
+	// deleted when resetting a workspace.
+	workspaceResetPollInterval = 2 * time.Second
+)
+
+// errPipelineRunInProgress is returned when a workspace cannot be reset
+// because a pipeline run is using it.
+var errPipelineRunInProgress = errors.New("a pipeline run is in progress")
+
+// WorkspaceManager manages the lifecycle of workspace PVCs. It resets
+// (deletes and recreates) PVCs on request, and periodically deletes PVCs of
+// repositories which no longer exist or have not been used for a while.
+type WorkspaceManager struct {
+	KubernetesClient kubernetesClient.ClientInterface
+	TektonClient     tektonClient.ClientInterface
+	BitbucketClient  bitbucket.RepoClientInterface
+	Logger           logging.LeveledLoggerInterface
+	StorageConfig    StorageConfig
+	// WebhookSecret is the shared secret used to validate reset requests.
+	WebhookSecret string
+	// Project is the Bitbucket project to which this server corresponds.
+	Project string
+	// MaxIdleDays specifies after how many days without pipeline runs the
+	// PVC of a repository is deleted. Zero disables deletion of idle PVCs.
+	MaxIdleDays int
+}
+
+// resetRequest is the payload of a workspace reset request.
+type resetRequest struct {
+	Repository string `json:"repository"`
+}
+
+// Run starts the periodic garbage collection of PVCs.
+func (m *WorkspaceManager) Run(ctx context.Context) {
+	m.Logger.Debugf("Workspace settings: MaxIdleDays=%d", m.MaxIdleDays)
+	timer := time.NewTimer(workspaceGCDelay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			err := m.collectGarbage(ctx)
+			if err != nil {
+				m.Logger.Errorf(err.Error())
+			}
+			timer.Reset(workspaceGCInterval)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// HandleReset handles requests to reset the workspace of a repository.
+// Requests must be signed with the webhook secret, in the same way Bitbucket
+// signs webhook requests.
+func (m *WorkspaceManager) HandleReset(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		msg := "could not read body"
+		m.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if err := validatePayload(r.Header, body, []byte(m.WebhookSecret)); err != nil {
+		msg := "failed to validate incoming request"
+		m.Logger.Errorf("%s: %s", msg, err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	req := &resetRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		msg := fmt.Sprintf("cannot parse JSON: %s", err)
+		m.Logger.Errorf(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	repository := strings.ToLower(req.Repository)
+	if repository == "" {
+		http.Error(w, "repository must be given", http.StatusBadRequest)
+		return
+	}
+	ctxt, cancel := context.WithTimeout(r.Context(), workspaceResetTimeout+time.Minute)
+	defer cancel()
+	name, err := m.reset(ctxt, repository)
+	if err != nil {
+		msg := fmt.Sprintf("could not reset workspace of repository %s: %s", repository, err)
+		m.Logger.Errorf(msg)
+		status := http.StatusInternalServerError
+		if errors.Is(err, errPipelineRunInProgress) {
+			status = http.StatusConflict
+		}
+		http.Error(w, msg, status)
+		return
+	}
+	err = json.NewEncoder(w).Encode(map[string]string{"pvc": name})
+	if err != nil {
+		m.Logger.Errorf("cannot write body: %s", err)
+	}
+}
+
+// reset deletes the PVC of repository, waits until it is gone, and creates
+// it again with the same size. It returns the name of the PVC.
+func (m *WorkspaceManager) reset(ctxt context.Context, repository string) (string, error) {
+	pvc, err := m.findPVC(ctxt, repository)
+	if err != nil {
+		return "", err
+	}
+	pipelineRuns, err := listPipelineRuns(ctxt, m.TektonClient, repository)
+	if err != nil {
+		return "", err
+	}
+	for _, pr := range pipelineRuns.Items {
+		if pipelineRunIsProgressing(pr) {
+			return "", fmt.Errorf("%w: %s", errPipelineRunInProgress, pr.Name)
+		}
+	}
+	m.Logger.Infof("Resetting PVC %s of repository %s ...", pvc.Name, repository)
+	err = m.KubernetesClient.DeletePersistentVolumeClaim(ctxt, pvc.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return "", fmt.Errorf("could not delete PVC %s: %w", pvc.Name, err)
+	}
+	err = wait.PollImmediate(workspaceResetPollInterval, workspaceResetTimeout, func() (bool, error) {
+		_, err := m.KubernetesClient.GetPersistentVolumeClaim(ctxt, pvc.Name, metav1.GetOptions{})
+		if err != nil && kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("PVC %s was not deleted in time: %w", pvc.Name, err)
+	}
+	storageConfig := m.StorageConfig
+	if pvc.Spec.StorageClassName != nil {
+		storageConfig.ClassName = *pvc.Spec.StorageClassName
+	}
+	size := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+	project := pvc.Labels[projectLabel]
+	if project == "" {
+		project = m.Project
+	}
+	err = createPVC(ctxt, m.KubernetesClient, m.Logger, storageConfig, pvc.Name, project, repository, size)
+	if err != nil {
+		return "", fmt.Errorf("could not create PVC %s: %w", pvc.Name, err)
+	}
+	return pvc.Name, nil
+}
+
+// findPVC returns the PVC belonging to repository.
+func (m *WorkspaceManager) findPVC(ctxt context.Context, repository string) (*corev1.PersistentVolumeClaim, error) {
+	labelMap := map[string]string{repositoryLabel: repository}
+	pvcs, err := m.KubernetesClient.ListPersistentVolumeClaims(
+		ctxt, metav1.ListOptions{LabelSelector: labels.Set(labelMap).String()},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not list PVCs: %w", err)
+	}
+	for _, pvc := range pvcs.Items {
+		if pvc.Labels[repositoryLabel] == repository {
+			return &pvc, nil
+		}
+	}
+	return nil, fmt.Errorf("no PVC found for repository %s", repository)
+}
+
+// collectGarbage deletes PVCs of repositories which no longer exist in
+// Bitbucket, or which have not had pipeline runs for MaxIdleDays.
+// Repositories are looked up in the project recorded on the PVC. PVCs
+// without project (created by earlier versions) are only deleted when idle.
+func (m *WorkspaceManager) collectGarbage(ctx context.Context) error {
+	ctxt, cancel := context.WithTimeout(ctx, workspaceGCTimeout)
+	defer cancel()
+	pvcs, err := m.KubernetesClient.ListPersistentVolumeClaims(
+		ctxt, metav1.ListOptions{LabelSelector: repositoryLabel},
+	)
+	if err != nil {
+		return fmt.Errorf("could not list PVCs: %w", err)
+	}
+	projectRepos := map[string]map[string]bool{}
+	var failedProjects []string
+	cutoff := time.Now().AddDate(0, 0, -m.MaxIdleDays)
+	for _, pvc := range pvcs.Items {
+		repository := pvc.Labels[repositoryLabel]
+		if repository == "" || pvc.DeletionTimestamp != nil {
+			continue
+		}
+		if project := pvc.Labels[projectLabel]; project != "" {
+			repos, ok := projectRepos[project]
+			if !ok {
+				repos, err = m.repositories(project)
+				if err != nil {
+					m.Logger.Warnf("Skipping collection of PVCs of project %s: %s", project, err)
+					failedProjects = append(failedProjects, project)
+				}
+				projectRepos[project] = repos
+			}
+			if repos == nil {
+				continue
+			}
+			if !repos[repository] {
+				m.deletePVC(ctxt, pvc.Name, fmt.Sprintf("repository %s does not exist anymore in project %s", repository, project))
+				continue
+			}
+		}
+		if m.MaxIdleDays < 1 {
+			continue
+		}
+		lastUsed, inUse, err := m.lastUsed(ctxt, pvc)
+		if err != nil {
+			m.Logger.Warnf("Could not determine when PVC %s was last used: %s", pvc.Name, err)
+			continue
+		}
+		if !inUse && lastUsed.Before(cutoff) {
+			m.deletePVC(ctxt, pvc.Name, fmt.Sprintf("no pipeline runs since %s", lastUsed.Format(time.RFC3339)))
+		}
+	}
+	if len(failedProjects) > 0 {
+		return fmt.Errorf("skipped collection of PVCs of projects %s", strings.Join(failedProjects, ", "))
+	}
+	return nil
+}
+
+// repositories returns the (lowercased) slugs of the repositories of
+// project. It fails if there are none, to avoid deleting all PVCs of the
+// project in case Bitbucket returns no repositories.
+func (m *WorkspaceManager) repositories(project string) (map[string]bool, error) {
+	repoPage, err := m.BitbucketClient.RepoList(project)
+	if err != nil {
+		return nil, fmt.Errorf("could not list repositories: %w", err)
+	}
+	if len(repoPage.Values) == 0 {
+		return nil, errors.New("no repositories found")
+	}
+	repos := map[string]bool{}
+	for _, r := range repoPage.Values {
+		repos[strings.ToLower(r.Slug)] = true
+	}
+	return repos, nil
+}
+
+// lastUsed returns when the PVC was last used by a pipeline run (or created,
+// if there are no pipeline runs), and whether it is currently in use.
+func (m *WorkspaceManager) lastUsed(ctxt context.Context, pvc corev1.PersistentVolumeClaim) (time.Time, bool, error) {
+	lastUsed := pvc.CreationTimestamp.Time
+	pipelineRuns, err := listPipelineRuns(ctxt, m.TektonClient, pvc.Labels[repositoryLabel])
+	if err != nil {
+		return lastUsed, false, err
+	}
+	for _, pr := range pipelineRuns.Items {
+		if pr.IsPending() || pipelineRunIsProgressing(pr) {
+			return lastUsed, true, nil
+		}
+		if pr.CreationTimestamp.Time.After(lastUsed) {
+			lastUsed = pr.CreationTimestamp.Time
+		}
+	}
+	return lastUsed, false, nil
+}
+
+// deletePVC deletes the PVC identified by name, logging the given reason.
+func (m *WorkspaceManager) deletePVC(ctxt context.Context, name, reason string) {
+	m.Logger.Infof("Deleting PVC %s: %s", name, reason)
+	err := m.KubernetesClient.DeletePersistentVolumeClaim(ctxt, name, metav1.DeleteOptions{})
+	if err != nil {
+		m.Logger.Warnf("Failed to delete PVC %s: %s", name, err)
+	}
+}
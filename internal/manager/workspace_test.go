@@ -0,0 +1,273 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	kubernetesClient "github.com/opendevstack/pipeline/internal/kubernetes"
+	tektonClient "github.com/opendevstack/pipeline/internal/tekton"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/logging"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+)
+
+func TestWorkspaceReset(t *testing.T) {
+	tests := map[string]struct {
+		body         string
+		pipelineRuns []*tekton.PipelineRun
+		wantStatus   int
+		wantCreated  bool
+	}{
+		"resets PVC": {
+			body:        `{"repository": "foo-bar"}`,
+			wantStatus:  http.StatusOK,
+			wantCreated: true,
+		},
+		"refuses to reset PVC in use": {
+			body: `{"repository": "foo-bar"}`,
+			pipelineRuns: []*tekton.PipelineRun{
+				{ObjectMeta: metav1.ObjectMeta{Name: "bar-master-abcde"}},
+			},
+			wantStatus:  http.StatusConflict,
+			wantCreated: false,
+		},
+		"unknown repository": {
+			body:        `{"repository": "foo-baz"}`,
+			wantStatus:  http.StatusInternalServerError,
+			wantCreated: false,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kc := &kubernetesClient.TestClient{
+				PVCs: []*corev1.PersistentVolumeClaim{testPVC("ods-workspace-bar", "foo-bar", "5Gi", time.Now())},
+			}
+			m := &WorkspaceManager{
+				KubernetesClient: kc,
+				TektonClient:     &tektonClient.TestClient{PipelineRuns: tc.pipelineRuns},
+				Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+				StorageConfig:    StorageConfig{ClassName: "standard", Size: "2Gi"},
+				WebhookSecret:    testWebhookSecret,
+			}
+			ts := httptest.NewServer(http.HandlerFunc(m.HandleReset))
+			defer ts.Close()
+			body := []byte(tc.body)
+			req, err := http.NewRequest("POST", ts.URL, bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(signatureHeader, hmacHeader(t, testWebhookSecret, body))
+			res, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.StatusCode != tc.wantStatus {
+				t.Fatalf("Got status: %v, want: %v", res.StatusCode, tc.wantStatus)
+			}
+			if !tc.wantCreated {
+				if len(kc.CreatedPVCs) > 0 {
+					t.Fatalf("Want no PVC to be created, got: %v", kc.CreatedPVCs)
+				}
+				return
+			}
+			if diff := cmp.Diff([]string{"ods-workspace-bar"}, kc.DeletedPVCs); diff != "" {
+				t.Fatalf("deleted PVCs mismatch (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff([]string{"ods-workspace-bar"}, kc.CreatedPVCs); diff != "" {
+				t.Fatalf("created PVCs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkspaceResetWrongSignature(t *testing.T) {
+	kc := &kubernetesClient.TestClient{}
+	m := &WorkspaceManager{
+		KubernetesClient: kc,
+		TektonClient:     &tektonClient.TestClient{},
+		Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+		WebhookSecret:    testWebhookSecret,
+	}
+	ts := httptest.NewServer(http.HandlerFunc(m.HandleReset))
+	defer ts.Close()
+	req, err := http.NewRequest("POST", ts.URL, bytes.NewReader([]byte(`{"repository": "foo-bar"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(signatureHeader, "foobar")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Got status: %v, want: %v", res.StatusCode, http.StatusBadRequest)
+	}
+	if len(kc.DeletedPVCs) > 0 {
+		t.Fatalf("Want no PVC to be deleted, got: %v", kc.DeletedPVCs)
+	}
+}
+
+func TestWorkspaceCollectGarbage(t *testing.T) {
+	old := time.Now().AddDate(0, 0, -60)
+	tests := map[string]struct {
+		repos        []bitbucket.Repo
+		projectRepos map[string][]bitbucket.Repo
+		pvcs         []*corev1.PersistentVolumeClaim
+		pipelineRuns []*tekton.PipelineRun
+		maxIdleDays  int
+		wantDeleted  []string
+		wantError    string
+	}{
+		"deletes PVC of removed repository": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", time.Now()),
+				testPVC("ods-workspace-baz", "foo-baz", "2Gi", time.Now()),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{"ods-workspace-baz"},
+		},
+		"deletes idle PVC": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", old),
+			},
+			pipelineRuns: []*tekton.PipelineRun{
+				testDonePipelineRun("bar-master-abcde", old.Add(time.Hour)),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{"ods-workspace-bar"},
+		},
+		"keeps recently used PVC": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", old),
+			},
+			pipelineRuns: []*tekton.PipelineRun{
+				testDonePipelineRun("bar-master-abcde", time.Now().AddDate(0, 0, -2)),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{},
+		},
+		"keeps idle PVC if disabled": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", old),
+			},
+			maxIdleDays: 0,
+			wantDeleted: []string{},
+		},
+		"keeps all PVCs if no repositories are found": {
+			repos: []bitbucket.Repo{},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", old),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{},
+			wantError:   "skipped collection of PVCs of projects foo",
+		},
+		"looks up repositories in project of PVC": {
+			projectRepos: map[string][]bitbucket.Repo{
+				"foo":   {{Slug: "foo-bar"}},
+				"other": {{Slug: "other-baz"}},
+			},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				testPVC("ods-workspace-bar", "foo-bar", "2Gi", time.Now()),
+				withProject(testPVC("ods-workspace-baz", "other-baz", "2Gi", time.Now()), "other"),
+				withProject(testPVC("ods-workspace-qux", "other-qux", "2Gi", time.Now()), "other"),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{"ods-workspace-qux"},
+		},
+		"keeps PVC without project of unknown repository": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				withProject(testPVC("ods-workspace-baz", "other-baz", "2Gi", time.Now()), ""),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{},
+		},
+		"deletes idle PVC without project": {
+			repos: []bitbucket.Repo{{Slug: "foo-bar"}},
+			pvcs: []*corev1.PersistentVolumeClaim{
+				withProject(testPVC("ods-workspace-baz", "other-baz", "2Gi", old), ""),
+			},
+			maxIdleDays: 30,
+			wantDeleted: []string{"ods-workspace-baz"},
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			kc := &kubernetesClient.TestClient{PVCs: tc.pvcs}
+			m := &WorkspaceManager{
+				KubernetesClient: kc,
+				TektonClient:     &tektonClient.TestClient{PipelineRuns: tc.pipelineRuns},
+				BitbucketClient:  &bitbucket.TestClient{Repos: tc.repos, ProjectRepos: tc.projectRepos},
+				Logger:           &logging.LeveledLogger{Level: logging.LevelNull},
+				Project:          "foo",
+				MaxIdleDays:      tc.maxIdleDays,
+			}
+			err := m.collectGarbage(context.TODO())
+			if len(tc.wantError) > 0 {
+				if err == nil || err.Error() != tc.wantError {
+					t.Fatalf("Want error: %s, got: %s", tc.wantError, err)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			got := append([]string{}, kc.DeletedPVCs...)
+			if diff := cmp.Diff(tc.wantDeleted, got); diff != "" {
+				t.Fatalf("deleted PVCs mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func testPVC(name, repository, size string, created time.Time) *corev1.PersistentVolumeClaim {
+	return &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			Labels:            map[string]string{projectLabel: "foo", repositoryLabel: repository},
+			CreationTimestamp: metav1.Time{Time: created},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			Resources: corev1.ResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse(size)},
+			},
+		},
+	}
+}
+
+func testDonePipelineRun(name string, created time.Time) *tekton.PipelineRun {
+	return &tekton.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.Time{Time: created}},
+		Status: tekton.PipelineRunStatus{
+			Status: duckv1beta1.Status{
+				Conditions: duckv1beta1.Conditions{
+					{Type: apis.ConditionSucceeded, Status: corev1.ConditionTrue},
+				},
+			},
+		},
+	}
+}
+
+// withProject sets the project label of pvc, or removes it if project is
+// empty.
+func withProject(pvc *corev1.PersistentVolumeClaim, project string) *corev1.PersistentVolumeClaim {
+	if project == "" {
+		delete(pvc.Labels, projectLabel)
+	} else {
+		pvc.Labels[projectLabel] = project
+	}
+	return pvc
+}
@@ -0,0 +1,282 @@
+package manifest
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"helm.sh/helm/v3/pkg/releaseutil"
+	"sigs.k8s.io/yaml"
+)
+
+// RedactedValue replaces the values of secrets in diffs.
+const RedactedValue = "++++++++"
+
+// secretDataKeyPattern matches the start of the data fields of a secret.
+var secretDataKeyPattern = regexp.MustCompile(`^(data|stringData):\s*$`)
+
+// DiffOptions configures how manifests are compared.
+type DiffOptions struct {
+	// Context is the number of unchanged lines shown around changes. All
+	// lines are shown if negative.
+	Context int
+	// SuppressSecrets redacts the values of secrets.
+	SuppressSecrets bool
+}
+
+// resource is one document of a manifest.
+type resource struct {
+	manifest string
+	isSecret bool
+}
+
+// Diff compares the resources of the current manifest with those of next
+// and returns a report of the changed resources, and whether there are any
+// changes. Resources without namespace are assumed to be in
+// defaultNamespace. Resources are reported in a stable order, independent
+// of the order in the manifests.
+func Diff(current, next, defaultNamespace string, opts DiffOptions) (string, bool, error) {
+	currentResources, err := splitResources(current, defaultNamespace)
+	if err != nil {
+		return "", false, fmt.Errorf("could not parse current manifest: %w", err)
+	}
+	nextResources, err := splitResources(next, defaultNamespace)
+	if err != nil {
+		return "", false, fmt.Errorf("could not parse new manifest: %w", err)
+	}
+
+	keys := []string{}
+	for k := range currentResources {
+		keys = append(keys, k)
+	}
+	for k := range nextResources {
+		if _, ok := currentResources[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	changed := false
+	for _, k := range keys {
+		cur, inCurrent := currentResources[k]
+		nxt, inNext := nextResources[k]
+		curManifest, nxtManifest := cur.manifest, nxt.manifest
+		if opts.SuppressSecrets && (cur.isSecret || nxt.isSecret) {
+			curManifest, nxtManifest = redactSecrets(curManifest, nxtManifest)
+		}
+		switch {
+		case !inCurrent:
+			changed = true
+			fmt.Fprintf(&sb, "%s has been added:\n", k)
+			writeLines(&sb, "+ ", splitLines(nxtManifest))
+		case !inNext:
+			changed = true
+			fmt.Fprintf(&sb, "%s has been removed:\n", k)
+			writeLines(&sb, "- ", splitLines(curManifest))
+		case cur.manifest != nxt.manifest:
+			changed = true
+			fmt.Fprintf(&sb, "%s has changed:\n", k)
+			writeDiff(&sb, splitLines(curManifest), splitLines(nxtManifest), opts.Context)
+		}
+	}
+	return sb.String(), changed, nil
+}
+
+// splitResources splits a manifest into its resources, keyed by namespace,
+// name, kind and API group like helm-diff does.
+func splitResources(manifest, defaultNamespace string) (map[string]resource, error) {
+	resources := map[string]resource{}
+	for _, m := range releaseutil.SplitManifests(manifest) {
+		var head struct {
+			APIVersion string `json:"apiVersion"`
+			Kind       string `json:"kind"`
+			Metadata   struct {
+				Name      string `json:"name"`
+				Namespace string `json:"namespace"`
+			} `json:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(m), &head); err != nil {
+			return nil, err
+		}
+		if head.Kind == "" {
+			continue
+		}
+		namespace := head.Metadata.Namespace
+		if namespace == "" {
+			namespace = defaultNamespace
+		}
+		// For the core API group, helm-diff shows the version instead.
+		group := strings.SplitN(head.APIVersion, "/", 2)[0]
+		key := fmt.Sprintf("%s, %s, %s (%s)", namespace, head.Metadata.Name, head.Kind, group)
+		resources[key] = resource{
+			manifest: strings.TrimSpace(m),
+			isSecret: head.Kind == "Secret",
+		}
+	}
+	return resources, nil
+}
+
+// redactSecrets replaces the values of the data and stringData fields of
+// the given secret manifests. Values which differ between both manifests
+// are marked as changed so that the diff still shows them.
+func redactSecrets(current, next string) (string, string) {
+	currentData := secretData(current)
+	nextData := secretData(next)
+	return redactSecret(current, nextData), redactSecret(next, currentData)
+}
+
+// secretData returns the values of the data and stringData fields of a
+// secret manifest, keyed by field and key.
+func secretData(manifest string) map[string]string {
+	data := map[string]string{}
+	field := ""
+	for _, line := range splitLines(manifest) {
+		if m := secretDataKeyPattern.FindStringSubmatch(line); m != nil {
+			field = m[1]
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			field = ""
+			continue
+		}
+		if field == "" {
+			continue
+		}
+		if kv := strings.SplitN(strings.TrimSpace(line), ":", 2); len(kv) == 2 {
+			data[field+"."+kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+	return data
+}
+
+func redactSecret(manifest string, other map[string]string) string {
+	if manifest == "" {
+		return manifest
+	}
+	lines := splitLines(manifest)
+	field := ""
+	for i, line := range lines {
+		if m := secretDataKeyPattern.FindStringSubmatch(line); m != nil {
+			field = m[1]
+			continue
+		}
+		if !strings.HasPrefix(line, " ") {
+			field = ""
+			continue
+		}
+		if field == "" {
+			continue
+		}
+		kv := strings.SplitN(line, ":", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(kv[1])
+		redacted := fmt.Sprintf("%s: %s # (%d bytes)", kv[0], RedactedValue, len(value))
+		if o, ok := other[field+"."+strings.TrimSpace(kv[0])]; ok && o != value {
+			redacted += " changed"
+		}
+		lines[i] = redacted
+	}
+	return strings.Join(lines, "\n")
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, "\n")
+}
+
+func writeLines(sb *strings.Builder, prefix string, lines []string) {
+	for _, l := range lines {
+		sb.WriteString(prefix + l + "\n")
+	}
+}
+
+// lineDiffOp is one line of a line-based diff.
+type lineDiffOp struct {
+	// kind is one of ' ', '-' and '+'.
+	kind byte
+	line string
+}
+
+// writeDiff writes the line diff between a and b. Unchanged lines further
+// than context lines away from a change are collapsed, unless context is
+// negative.
+func writeDiff(sb *strings.Builder, a, b []string, context int) {
+	ops := diffLines(a, b)
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if context < 0 {
+			show[i] = true
+			continue
+		}
+		if op.kind == ' ' {
+			continue
+		}
+		for j := i - context; j <= i+context; j++ {
+			if j >= 0 && j < len(ops) {
+				show[j] = true
+			}
+		}
+	}
+	skipped := false
+	for i, op := range ops {
+		if !show[i] {
+			if !skipped {
+				sb.WriteString("...\n")
+				skipped = true
+			}
+			continue
+		}
+		skipped = false
+		sb.WriteString(string(op.kind) + " " + op.line + "\n")
+	}
+}
+
+// diffLines computes a minimal line diff between a and b based on their
+// longest common subsequence.
+func diffLines(a, b []string) []lineDiffOp {
+	// lcs[i][j] is the length of the LCS of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []lineDiffOp
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, lineDiffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, lineDiffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, lineDiffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, lineDiffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, lineDiffOp{'+', b[j]})
+	}
+	return ops
+}
@@ -0,0 +1,64 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+// PinClientInterface is the part of the Bitbucket client needed to resolve
+// pinned subrepositories.
+type PinClientInterface interface {
+	bitbucket.TagClientInterface
+	bitbucket.CommitClientInterface
+}
+
+// PinnedRevision describes the tag or commit a subrepository is pinned to.
+type PinnedRevision struct {
+	// GitFullRef is the ref the commit is associated with. This is the tag
+	// for pinned tags, and the configured branch for pinned commits.
+	GitFullRef string
+	// Revision is the revision to check out (tag ref or full commit SHA).
+	Revision string
+	// CommitSHA is the full SHA of the pinned commit.
+	CommitSHA string
+}
+
+// ResolvePinnedRevision validates that the tag or commit given subrepository
+// is pinned to exists, and returns the resolved revision. It returns nil if
+// the subrepository is not pinned.
+func ResolvePinnedRevision(bitbucketClient PinClientInterface, project string, subrepo config.Repository) (*PinnedRevision, error) {
+	if len(subrepo.Tag) > 0 {
+		tagName := strings.TrimPrefix(subrepo.Tag, "refs/tags/")
+		tag, err := bitbucketClient.TagGet(project, subrepo.Name, tagName)
+		if err != nil {
+			return nil, fmt.Errorf("could not get tag %s of subrepository %s: %w", tagName, subrepo.Name, err)
+		}
+		return &PinnedRevision{
+			GitFullRef: tag.ID,
+			Revision:   tag.ID,
+			CommitSHA:  tag.LatestCommit,
+		}, nil
+	}
+	if len(subrepo.Commit) > 0 {
+		commit, err := bitbucketClient.CommitGet(project, subrepo.Name, subrepo.Commit)
+		if err != nil {
+			return nil, fmt.Errorf("could not get commit %s of subrepository %s: %w", subrepo.Commit, subrepo.Name, err)
+		}
+		gitFullRef := config.DefaultBranch
+		if len(subrepo.Branch) > 0 {
+			gitFullRef = subrepo.Branch
+			if !strings.HasPrefix(gitFullRef, "refs/") {
+				gitFullRef = fmt.Sprintf("refs/heads/%s", gitFullRef)
+			}
+		}
+		return &PinnedRevision{
+			GitFullRef: gitFullRef,
+			Revision:   commit.ID,
+			CommitSHA:  commit.ID,
+		}, nil
+	}
+	return nil, nil
+}
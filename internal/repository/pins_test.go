@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+func TestResolvePinnedRevision(t *testing.T) {
+	bitbucketClient := &bitbucket.TestClient{
+		Tags: []bitbucket.Tag{
+			{ID: "refs/tags/v1.0.0", DisplayID: "v1.0.0", LatestCommit: "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e"},
+		},
+		Commits: []bitbucket.Commit{
+			{ID: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+		},
+	}
+	tests := map[string]struct {
+		subrepo config.Repository
+		want    *PinnedRevision
+		wantErr string
+	}{
+		"not pinned": {
+			subrepo: config.Repository{Name: "foo", Branch: "develop"},
+			want:    nil,
+		},
+		"pinned to tag": {
+			subrepo: config.Repository{Name: "foo", Tag: "v1.0.0"},
+			want: &PinnedRevision{
+				GitFullRef: "refs/tags/v1.0.0",
+				Revision:   "refs/tags/v1.0.0",
+				CommitSHA:  "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e",
+			},
+		},
+		"pinned to commit": {
+			subrepo: config.Repository{Name: "foo", Commit: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+			want: &PinnedRevision{
+				GitFullRef: config.DefaultBranch,
+				Revision:   "8d351a10fb428c0c1239530256e21cf24f136e73",
+				CommitSHA:  "8d351a10fb428c0c1239530256e21cf24f136e73",
+			},
+		},
+		"pinned to commit of branch": {
+			subrepo: config.Repository{Name: "foo", Branch: "develop", Commit: "8d351a10fb428c0c1239530256e21cf24f136e73"},
+			want: &PinnedRevision{
+				GitFullRef: "refs/heads/develop",
+				Revision:   "8d351a10fb428c0c1239530256e21cf24f136e73",
+				CommitSHA:  "8d351a10fb428c0c1239530256e21cf24f136e73",
+			},
+		},
+		"non-existing tag": {
+			subrepo: config.Repository{Name: "foo", Tag: "v2.0.0"},
+			wantErr: "could not get tag v2.0.0 of subrepository foo",
+		},
+		"non-existing commit": {
+			subrepo: config.Repository{Name: "foo", Commit: "0000000"},
+			wantErr: "could not get commit 0000000 of subrepository foo",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := ResolvePinnedRevision(bitbucketClient, "PRJ", tc.subrepo)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("want err: %s, got: %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Fatalf("revision mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+// maxReleaseNotesCommits limits the number of commits listed per repository,
+// e.g. for the first release of a repository with a long history.
+const maxReleaseNotesCommits = 500
+
+const (
+	breakingSectionType = "breaking"
+	otherSectionType    = "other"
+)
+
+// releaseNotesSections defines the order and titles of the sections. Commits
+// with types not listed here end up in the "other" section.
+var releaseNotesSections = []artifact.ReleaseNotesSection{
+	{Type: breakingSectionType, Title: "Breaking Changes"},
+	{Type: "feat", Title: "Features"},
+	{Type: "fix", Title: "Bug Fixes"},
+	{Type: "perf", Title: "Performance Improvements"},
+	{Type: "revert", Title: "Reverts"},
+	{Type: "refactor", Title: "Code Refactoring"},
+	{Type: "docs", Title: "Documentation"},
+	{Type: "test", Title: "Tests"},
+	{Type: "build", Title: "Build System"},
+	{Type: "ci", Title: "Continuous Integration"},
+	{Type: otherSectionType, Title: "Other Changes"},
+}
+
+var semVerPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+\.[0-9]+$`)
+
+// ReleaseNotesClientInterface is the part of the Bitbucket client needed to
+// collect release notes.
+type ReleaseNotesClientInterface interface {
+	bitbucket.TagClientInterface
+	bitbucket.CommitClientInterface
+}
+
+// RepositoryReleaseNotes collects the changes of the repository identified by
+// ctxt between the previous final tag and ctxt.GitCommitSHA. The previous final
+// tag is the one with the highest version below ctxt.Version. Merge commits are
+// skipped. Links point to the Bitbucket instance at bitbucketURL.
+func RepositoryReleaseNotes(client ReleaseNotesClientInterface, ctxt *pipelinectxt.ODSContext, scheme *TagScheme, bitbucketURL string) (*artifact.ReleaseNotesRepository, error) {
+	notes := &artifact.ReleaseNotesRepository{
+		Name:      ctxt.Repository,
+		CommitSHA: ctxt.GitCommitSHA,
+		Sections:  []artifact.ReleaseNotesSection{},
+	}
+	previousTag, err := previousFinalTag(client, ctxt, scheme)
+	if err != nil {
+		return nil, err
+	}
+	since := ""
+	if previousTag != nil {
+		notes.PreviousTag = previousTag.DisplayID
+		since = previousTag.LatestCommit
+	}
+	commits, truncated, err := listCommits(client, ctxt.Project, ctxt.Repository, since, ctxt.GitCommitSHA, maxReleaseNotesCommits)
+	if err != nil {
+		return nil, fmt.Errorf("could not list commits of %s/%s: %w", ctxt.Project, ctxt.Repository, err)
+	}
+	notes.Truncated = truncated
+
+	repoURL := fmt.Sprintf("%s/projects/%s/repos/%s", strings.TrimSuffix(bitbucketURL, "/"), ctxt.Project, ctxt.Repository)
+	changes := map[string][]artifact.ReleaseNotesChange{}
+	for _, c := range commits {
+		if len(c.Parents) > 1 {
+			continue
+		}
+		change := artifact.ReleaseNotesChange{
+			CommitSHA: c.ID,
+			CommitURL: fmt.Sprintf("%s/commits/%s", repoURL, c.ID),
+			Author:    c.Author.Name,
+		}
+		sectionType := otherSectionType
+		if cc, ok := parseConventionalCommit(c.Message); ok {
+			change.Scope = cc.Scope
+			change.Description = cc.Description
+			sectionType = cc.Type
+			if cc.Breaking {
+				sectionType = breakingSectionType
+			} else if !knownSectionType(sectionType) {
+				sectionType = otherSectionType
+			}
+		} else {
+			change.Description = firstLine(c.Message)
+		}
+		prPage, err := client.CommitPullRequestList(ctxt.Project, ctxt.Repository, c.ID)
+		if err != nil {
+			return nil, fmt.Errorf("could not list pull requests of commit %s: %w", c.ID, err)
+		}
+		for _, pr := range prPage.Values {
+			if pr.State != "MERGED" {
+				continue
+			}
+			change.PullRequests = append(change.PullRequests, artifact.ReleaseNotesPullRequest{
+				ID:    pr.ID,
+				Title: pr.Title,
+				URL:   fmt.Sprintf("%s/pull-requests/%d", repoURL, pr.ID),
+			})
+		}
+		changes[sectionType] = append(changes[sectionType], change)
+	}
+	for _, s := range releaseNotesSections {
+		if len(changes[s.Type]) > 0 {
+			s.Changes = changes[s.Type]
+			notes.Sections = append(notes.Sections, s)
+		}
+	}
+	return notes, nil
+}
+
+// ReleaseNotesMarkdown renders notes as Markdown.
+func ReleaseNotesMarkdown(notes artifact.ReleaseNotes) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Release Notes for %s\n", notes.Tag)
+	for _, r := range notes.Repositories {
+		fmt.Fprintf(&b, "\n## %s\n\n", r.Name)
+		if r.PreviousTag != "" {
+			fmt.Fprintf(&b, "Changes since %s up to commit %s.\n", r.PreviousTag, shortCommitSHA(r.CommitSHA))
+		} else {
+			fmt.Fprintf(&b, "Changes up to commit %s (no previous release).\n", shortCommitSHA(r.CommitSHA))
+		}
+		if r.Truncated {
+			fmt.Fprintf(&b, "\nOnly the latest %d commits are listed.\n", maxReleaseNotesCommits)
+		}
+		if len(r.Sections) == 0 {
+			b.WriteString("\nNo changes.\n")
+		}
+		for _, s := range r.Sections {
+			fmt.Fprintf(&b, "\n### %s\n\n", s.Title)
+			for _, c := range s.Changes {
+				b.WriteString("- ")
+				if c.Scope != "" {
+					fmt.Fprintf(&b, "**%s:** ", c.Scope)
+				}
+				fmt.Fprintf(&b, "%s ([%s](%s))", c.Description, shortCommitSHA(c.CommitSHA), c.CommitURL)
+				for _, pr := range c.PullRequests {
+					fmt.Fprintf(&b, " ([#%d](%s))", pr.ID, pr.URL)
+				}
+				b.WriteString("\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// previousFinalTag returns the final tag with the highest version below
+// ctxt.Version, or nil if there is none.
+func previousFinalTag(client bitbucket.TagClientInterface, ctxt *pipelinectxt.ODSContext, scheme *TagScheme) (*bitbucket.Tag, error) {
+	tags, err := listTags(client, ctxt.Project, ctxt.Repository, scheme.FinalFilterText())
+	if err != nil {
+		return nil, fmt.Errorf("could not list tags of %s/%s: %w", ctxt.Project, ctxt.Repository, err)
+	}
+	var currentVersion []int
+	if semVerPattern.MatchString(ctxt.Version) {
+		currentVersion = parseVersion(ctxt.Version)
+	}
+	var previousTag *bitbucket.Tag
+	var previousVersion []int
+	for i, t := range tags {
+		v, ok := scheme.FinalVersion(t.ID)
+		if !ok || v == ctxt.Version {
+			continue
+		}
+		parsed := parseVersion(v)
+		if currentVersion != nil && compareVersions(parsed, currentVersion) > 0 {
+			continue
+		}
+		if previousVersion == nil || compareVersions(parsed, previousVersion) > 0 {
+			previousTag = &tags[i]
+			previousVersion = parsed
+		}
+	}
+	return previousTag, nil
+}
+
+func knownSectionType(t string) bool {
+	for _, s := range releaseNotesSections {
+		if s.Type == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opendevstack/pipeline/pkg/artifact"
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+)
+
+func TestRepositoryReleaseNotes(t *testing.T) {
+	ctxt := &pipelinectxt.ODSContext{
+		Project:      "FOO",
+		Repository:   "foo-bar",
+		Version:      "1.3.0",
+		GitCommitSHA: "8d351a10fb428c0c1239530256e21cf24f136e73",
+	}
+	commit := func(id, message string, parents int) bitbucket.Commit {
+		c := bitbucket.Commit{ID: id, Message: message}
+		c.Author.Name = "Jane"
+		for i := 0; i < parents; i++ {
+			c.Parents = append(c.Parents, struct {
+				ID        string `json:"id"`
+				DisplayID string `json:"displayId"`
+			}{})
+		}
+		return c
+	}
+	bitbucketClient := &bitbucket.TestClient{
+		Tags: []bitbucket.Tag{
+			{ID: "refs/tags/v1.1.0", DisplayID: "v1.1.0", LatestCommit: "1111111111111111111111111111111111111111"},
+			{ID: "refs/tags/v1.2.0", DisplayID: "v1.2.0", LatestCommit: "2222222222222222222222222222222222222222"},
+			{ID: "refs/tags/v1.3.0-rc.1", DisplayID: "v1.3.0-rc.1", LatestCommit: ctxt.GitCommitSHA},
+			{ID: "refs/tags/v1.4.0", DisplayID: "v1.4.0", LatestCommit: "4444444444444444444444444444444444444444"},
+		},
+		Commits: []bitbucket.Commit{
+			commit("aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "Merge pull request #7 in FOO/foo-bar from feature to master", 2),
+			commit("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "feat(ui): add dark mode\n\nUsers can switch in the settings.", 1),
+			commit("cccccccccccccccccccccccccccccccccccccccc", "fix!: drop legacy endpoint", 1),
+			commit("dddddddddddddddddddddddddddddddddddddddd", "chore: bump dependencies", 1),
+			commit("eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", "Update README", 1),
+		},
+		PullRequests: []bitbucket.PullRequest{
+			{ID: 7, Title: "Dark mode", State: "MERGED"},
+			{ID: 8, Title: "Work in progress", State: "OPEN"},
+		},
+	}
+	got, err := RepositoryReleaseNotes(bitbucketClient, ctxt, NewTagScheme(config.ReleaseTags{}), "https://bitbucket.example.com/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoURL := "https://bitbucket.example.com/projects/FOO/repos/foo-bar"
+	pullRequests := []artifact.ReleaseNotesPullRequest{{ID: 7, Title: "Dark mode", URL: repoURL + "/pull-requests/7"}}
+	change := func(sha, scope, description string) artifact.ReleaseNotesChange {
+		return artifact.ReleaseNotesChange{
+			CommitSHA:    sha,
+			CommitURL:    repoURL + "/commits/" + sha,
+			Scope:        scope,
+			Description:  description,
+			Author:       "Jane",
+			PullRequests: pullRequests,
+		}
+	}
+	want := &artifact.ReleaseNotesRepository{
+		Name:        "foo-bar",
+		CommitSHA:   ctxt.GitCommitSHA,
+		PreviousTag: "v1.2.0",
+		Sections: []artifact.ReleaseNotesSection{
+			{Type: "breaking", Title: "Breaking Changes", Changes: []artifact.ReleaseNotesChange{
+				change("cccccccccccccccccccccccccccccccccccccccc", "", "drop legacy endpoint"),
+			}},
+			{Type: "feat", Title: "Features", Changes: []artifact.ReleaseNotesChange{
+				change("bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb", "ui", "add dark mode"),
+			}},
+			{Type: "other", Title: "Other Changes", Changes: []artifact.ReleaseNotesChange{
+				change("dddddddddddddddddddddddddddddddddddddddd", "", "bump dependencies"),
+				change("eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee", "", "Update README"),
+			}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("release notes mismatch (-want +got):\n%s", diff)
+	}
+
+	wantMarkdown := `# Release Notes for v1.3.0-rc.1
+
+## foo-bar
+
+Changes since v1.2.0 up to commit 8d351a1.
+
+### Breaking Changes
+
+- drop legacy endpoint ([ccccccc](` + repoURL + `/commits/cccccccccccccccccccccccccccccccccccccccc)) ([#7](` + repoURL + `/pull-requests/7))
+
+### Features
+
+- **ui:** add dark mode ([bbbbbbb](` + repoURL + `/commits/bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb)) ([#7](` + repoURL + `/pull-requests/7))
+
+### Other Changes
+
+- bump dependencies ([ddddddd](` + repoURL + `/commits/dddddddddddddddddddddddddddddddddddddddd)) ([#7](` + repoURL + `/pull-requests/7))
+- Update README ([eeeeeee](` + repoURL + `/commits/eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee)) ([#7](` + repoURL + `/pull-requests/7))
+`
+	gotMarkdown := ReleaseNotesMarkdown(artifact.ReleaseNotes{
+		Version:      "1.3.0",
+		Tag:          "v1.3.0-rc.1",
+		Repositories: []artifact.ReleaseNotesRepository{*got},
+	})
+	if diff := cmp.Diff(wantMarkdown, gotMarkdown); diff != "" {
+		t.Fatalf("markdown mismatch (-want +got):\n%s", diff)
+	}
+}
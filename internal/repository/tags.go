@@ -1,39 +1,106 @@
 package repository
 
 import (
-	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
 	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
 )
 
+// shortCommitSHALength is the length of commit SHAs rendered for
+// config.TagShortCommitSHAPlaceholder.
+const shortCommitSHALength = 7
+
+var tagPlaceholderPattern = regexp.MustCompile(`{{[^}]*}}`)
+
+// TagScheme renders and parses release tag names according to the templates
+// configured in ods.yaml.
+type TagScheme struct {
+	candidate string
+	final     string
+}
+
+// NewTagScheme returns a scheme for the given configuration, using the
+// default templates for fields which are not set.
+func NewTagScheme(c config.ReleaseTags) *TagScheme {
+	candidate, final := c.Templates()
+	return &TagScheme{candidate: candidate, final: final}
+}
+
+// CandidateTag returns the name of the release candidate tag with given number.
+func (s *TagScheme) CandidateTag(version string, number int, commitSHA string) string {
+	return renderTag(s.candidate, version, strconv.Itoa(number), commitSHA)
+}
+
+// FinalTag returns the name of the final version tag.
+func (s *TagScheme) FinalTag(version, commitSHA string) string {
+	return renderTag(s.final, version, "", commitSHA)
+}
+
+// FilterText returns a text to filter the tag list of a repository by, which
+// matches all candidate and final tags of version.
+func (s *TagScheme) FilterText(version string) string {
+	candidatePrefix := renderTag(literalPrefix(s.candidate), version, "", "")
+	finalPrefix := renderTag(literalPrefix(s.final), version, "", "")
+	i := 0
+	for i < len(candidatePrefix) && i < len(finalPrefix) && candidatePrefix[i] == finalPrefix[i] {
+		i++
+	}
+	filter := candidatePrefix[:i]
+	if !strings.Contains(filter, version) {
+		// Bitbucket matches tags containing the filter text.
+		return version
+	}
+	return filter
+}
+
+// FinalVersion returns the version of the final tag identified by tagID
+// (a full ref), and whether tagID is a final tag at all. Only versions of the
+// format MAJOR.MINOR.PATCH are recognized.
+func (s *TagScheme) FinalVersion(tagID string) (string, bool) {
+	m := tagPattern(s.final, `([0-9]+\.[0-9]+\.[0-9]+)`).FindStringSubmatch(tagID)
+	if m == nil {
+		return "", false
+	}
+	return m[1], true
+}
+
+// FinalFilterText returns a text to filter the tag list of a repository by,
+// which matches all final tags.
+func (s *TagScheme) FinalFilterText() string {
+	return s.final[:tagPlaceholderPattern.FindStringIndex(s.final)[0]]
+}
+
 // TagListContainsFinalVersion checks if the list of tags contains a tag
 // corresponding to the version (without pre-release/build suffix).
-func TagListContainsFinalVersion(tags []bitbucket.Tag, version string) bool {
-	searchID := fmt.Sprintf("refs/tags/v%s", version)
+func TagListContainsFinalVersion(tags []bitbucket.Tag, scheme *TagScheme, version string) bool {
+	pattern := tagPattern(scheme.final, regexp.QuoteMeta(version))
 	for _, t := range tags {
-		if t.ID == searchID {
+		if pattern.MatchString(t.ID) {
 			return true
 		}
 	}
 	return false
 }
 
-// LatestReleaseCandidate returns the highest number of all tags of
-// format "v<VERSION>-rc.<NUMBER>".
-func LatestReleaseCandidate(tags []bitbucket.Tag, version string) (*bitbucket.Tag, int) {
+// LatestReleaseCandidate returns the release candidate tag with the highest
+// number, and the number itself.
+func LatestReleaseCandidate(tags []bitbucket.Tag, scheme *TagScheme, version string) (*bitbucket.Tag, int) {
 	var highestNumber int
 	var latestTag *bitbucket.Tag
-	prefix := fmt.Sprintf("refs/tags/v%s-rc.", version)
-	for _, t := range tags {
-		if strings.HasPrefix(t.ID, prefix) {
-			i, err := strconv.Atoi(strings.TrimPrefix(t.ID, prefix))
-			if err == nil && i > highestNumber {
-				highestNumber = i
-				latestTag = &t
-			}
+	pattern := tagPattern(scheme.candidate, regexp.QuoteMeta(version))
+	for i, t := range tags {
+		m := pattern.FindStringSubmatch(t.ID)
+		if m == nil {
+			continue
+		}
+		n, err := strconv.Atoi(m[1])
+		if err == nil && n > highestNumber {
+			highestNumber = n
+			latestTag = &tags[i]
 		}
 	}
 	return latestTag, highestNumber
@@ -51,3 +118,57 @@ func CreateTag(bitbucketClient *bitbucket.Client, ctxt *pipelinectxt.ODSContext,
 		},
 	)
 }
+
+func renderTag(template, version, number, commitSHA string) string {
+	return strings.NewReplacer(
+		config.TagVersionPlaceholder, version,
+		config.TagNumberPlaceholder, number,
+		config.TagCommitSHAPlaceholder, commitSHA,
+		config.TagShortCommitSHAPlaceholder, shortCommitSHA(commitSHA),
+	).Replace(template)
+}
+
+func shortCommitSHA(commitSHA string) string {
+	if len(commitSHA) > shortCommitSHALength {
+		return commitSHA[:shortCommitSHALength]
+	}
+	return commitSHA
+}
+
+// literalPrefix returns the part of template before the first placeholder
+// other than the version.
+func literalPrefix(template string) string {
+	for _, loc := range tagPlaceholderPattern.FindAllStringIndex(template, -1) {
+		if template[loc[0]:loc[1]] != config.TagVersionPlaceholder {
+			return template[:loc[0]]
+		}
+	}
+	return template
+}
+
+// tagPattern returns a regular expression matching the full ref of tags
+// rendered from template for versions matching versionPattern. The first group
+// captures the number (candidate templates) or the version (final templates,
+// if versionPattern contains a group).
+func tagPattern(template, versionPattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^refs/tags/")
+	last := 0
+	for _, loc := range tagPlaceholderPattern.FindAllStringIndex(template, -1) {
+		b.WriteString(regexp.QuoteMeta(template[last:loc[0]]))
+		switch template[loc[0]:loc[1]] {
+		case config.TagVersionPlaceholder:
+			b.WriteString(versionPattern)
+		case config.TagNumberPlaceholder:
+			b.WriteString(`([0-9]+)`)
+		case config.TagCommitSHAPlaceholder:
+			b.WriteString(`[0-9a-f]{40}`)
+		case config.TagShortCommitSHAPlaceholder:
+			b.WriteString(`[0-9a-f]{7,40}`)
+		}
+		last = loc[1]
+	}
+	b.WriteString(regexp.QuoteMeta(template[last:]))
+	b.WriteString("$")
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+func TestTagScheme(t *testing.T) {
+	commitSHA := "8d351a10fb428c0c1239530256e21cf24f136e73"
+	tests := map[string]struct {
+		releaseTags   config.ReleaseTags
+		tags          []string
+		wantCandidate string
+		wantFinal     string
+		wantFilter    string
+		wantLatest    int
+		wantLatestTag string
+		wantFinalTag  bool
+	}{
+		"default scheme": {
+			tags:          []string{"v1.0.0-rc.1", "v1.0.0-rc.10", "v1.0.0-rc.2", "v1.0.0-rc.x", "v1.0.0.1-rc.11", "v1.0.1"},
+			wantCandidate: "v1.0.0-rc.11",
+			wantFinal:     "v1.0.0",
+			wantFilter:    "v1.0.0",
+			wantLatest:    10,
+			wantLatestTag: "v1.0.0-rc.10",
+		},
+		"default scheme with final tag": {
+			tags:          []string{"v1.0.0-rc.1", "v1.0.0"},
+			wantCandidate: "v1.0.0-rc.2",
+			wantFinal:     "v1.0.0",
+			wantFilter:    "v1.0.0",
+			wantLatest:    1,
+			wantLatestTag: "v1.0.0-rc.1",
+			wantFinalTag:  true,
+		},
+		"custom scheme": {
+			releaseTags: config.ReleaseTags{
+				Candidate: "release/{{.Version}}/rc-{{.Number}}-{{.ShortCommitSHA}}",
+				Final:     "release/{{.Version}}/final",
+			},
+			tags:          []string{"release/1.0.0/rc-3-0e183aa", "v1.0.0-rc.4", "release/1.0.0/final"},
+			wantCandidate: "release/1.0.0/rc-4-8d351a1",
+			wantFinal:     "release/1.0.0/final",
+			wantFilter:    "release/1.0.0/",
+			wantLatest:    3,
+			wantLatestTag: "release/1.0.0/rc-3-0e183aa",
+			wantFinalTag:  true,
+		},
+		"scheme without common prefix": {
+			releaseTags: config.ReleaseTags{
+				Candidate: "rc-{{.Version}}.{{.Number}}",
+				Final:     "{{.Version}}-{{.CommitSHA}}",
+			},
+			tags:          []string{"rc-1.0.0.1", "1.0.0-" + commitSHA},
+			wantCandidate: "rc-1.0.0.2",
+			wantFinal:     "1.0.0-" + commitSHA,
+			wantFilter:    "1.0.0",
+			wantLatest:    1,
+			wantLatestTag: "rc-1.0.0.1",
+			wantFinalTag:  true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			scheme := NewTagScheme(tc.releaseTags)
+			tags := []bitbucket.Tag{}
+			for _, tag := range tc.tags {
+				tags = append(tags, bitbucket.Tag{ID: "refs/tags/" + tag, DisplayID: tag})
+			}
+			latest, number := LatestReleaseCandidate(tags, scheme, "1.0.0")
+			if number != tc.wantLatest {
+				t.Fatalf("want latest release candidate: %d, got: %d", tc.wantLatest, number)
+			}
+			if latest == nil || latest.DisplayID != tc.wantLatestTag {
+				t.Fatalf("want latest release candidate tag: %s, got: %v", tc.wantLatestTag, latest)
+			}
+			if got := scheme.CandidateTag("1.0.0", number+1, commitSHA); got != tc.wantCandidate {
+				t.Fatalf("want candidate tag: %s, got: %s", tc.wantCandidate, got)
+			}
+			if got := scheme.FinalTag("1.0.0", commitSHA); got != tc.wantFinal {
+				t.Fatalf("want final tag: %s, got: %s", tc.wantFinal, got)
+			}
+			if got := scheme.FilterText("1.0.0"); got != tc.wantFilter {
+				t.Fatalf("want filter text: %s, got: %s", tc.wantFilter, got)
+			}
+			if got := TagListContainsFinalVersion(tags, scheme, "1.0.0"); got != tc.wantFinalTag {
+				t.Fatalf("want final tag to exist: %v, got: %v", tc.wantFinalTag, got)
+			}
+		})
+	}
+}
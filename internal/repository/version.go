@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+)
+
+// initialVersion is the version used if no final tag exists yet.
+const initialVersion = "1.0.0"
+
+// VersionClientInterface is the part of the Bitbucket client needed to derive
+// the next version of a repository.
+type VersionClientInterface interface {
+	bitbucket.TagClientInterface
+	bitbucket.CommitClientInterface
+}
+
+type versionBump int
+
+const (
+	bumpPatch versionBump = iota
+	bumpMinor
+	bumpMajor
+)
+
+var (
+	conventionalCommitPattern = regexp.MustCompile(`^([a-zA-Z]+)(\([^)]*\))?(!)?: `)
+	breakingChangePattern     = regexp.MustCompile(`(?m)^BREAKING[ -]CHANGE: `)
+)
+
+// NextVersion computes the version of commitSHA from the highest final
+// release tag and the conventional commit messages of the commits between
+// that tag and commitSHA: breaking changes bump the major version, features
+// ("feat") the minor version and any other change the patch version.
+// If commitSHA has a final tag already, the version of that tag is returned.
+// If there is no final tag yet, the version is 1.0.0.
+func NextVersion(client VersionClientInterface, project, repository, commitSHA string, scheme *TagScheme) (string, error) {
+	tags, err := listTags(client, project, repository, scheme.FinalFilterText())
+	if err != nil {
+		return "", fmt.Errorf("could not list tags: %w", err)
+	}
+	var latestTag *bitbucket.Tag
+	var latestVersion []int
+	for i, t := range tags {
+		v, ok := scheme.FinalVersion(t.ID)
+		if !ok {
+			continue
+		}
+		if t.LatestCommit == commitSHA {
+			return v, nil
+		}
+		parsed := parseVersion(v)
+		if latestVersion == nil || compareVersions(parsed, latestVersion) > 0 {
+			latestTag = &tags[i]
+			latestVersion = parsed
+		}
+	}
+	if latestTag == nil {
+		return initialVersion, nil
+	}
+
+	commits, _, err := listCommits(client, project, repository, latestTag.LatestCommit, commitSHA, 0)
+	if err != nil {
+		return "", fmt.Errorf("could not list commits since %s: %w", latestTag.DisplayID, err)
+	}
+	if len(commits) == 0 {
+		return formatVersion(latestVersion), nil
+	}
+	bump := bumpPatch
+	for _, c := range commits {
+		if b := commitBump(c.Message); b > bump {
+			bump = b
+		}
+	}
+	next := append([]int{}, latestVersion...)
+	switch bump {
+	case bumpMajor:
+		next = []int{next[0] + 1, 0, 0}
+	case bumpMinor:
+		next = []int{next[0], next[1] + 1, 0}
+	default:
+		next[2]++
+	}
+	return formatVersion(next), nil
+}
+
+// conventionalCommit is a commit message following the conventional commits
+// specification (https://www.conventionalcommits.org).
+type conventionalCommit struct {
+	Type        string
+	Scope       string
+	Description string
+	Breaking    bool
+}
+
+// parseConventionalCommit parses message, returning false if it does not
+// follow the conventional commits specification.
+func parseConventionalCommit(message string) (conventionalCommit, bool) {
+	m := conventionalCommitPattern.FindStringSubmatch(message)
+	if m == nil {
+		return conventionalCommit{}, false
+	}
+	return conventionalCommit{
+		Type:        strings.ToLower(m[1]),
+		Scope:       strings.Trim(m[2], "()"),
+		Description: firstLine(strings.TrimPrefix(message, m[0])),
+		Breaking:    m[3] == "!" || breakingChangePattern.MatchString(message),
+	}, true
+}
+
+// commitBump determines the version bump required by a commit message
+// following the conventional commits specification. Messages not following
+// the specification require a patch bump.
+func commitBump(message string) versionBump {
+	c, ok := parseConventionalCommit(message)
+	if !ok {
+		return bumpPatch
+	}
+	if c.Breaking {
+		return bumpMajor
+	}
+	if c.Type == "feat" {
+		return bumpMinor
+	}
+	return bumpPatch
+}
+
+func firstLine(s string) string {
+	return strings.TrimSpace(strings.SplitN(s, "\n", 2)[0])
+}
+
+// listTags retrieves all pages of tags matching filterText.
+func listTags(client bitbucket.TagClientInterface, project, repository, filterText string) ([]bitbucket.Tag, error) {
+	tags := []bitbucket.Tag{}
+	start := 0
+	for {
+		page, err := client.TagList(project, repository, bitbucket.TagListParams{FilterText: filterText, Start: start})
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, page.Values...)
+		// Guard against responses without valid paging information.
+		if page.IsLastPage || page.NextPageStart <= start {
+			return tags, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// listCommits retrieves all pages of commits reachable from until but not
+// from since. If max is greater than 0, at most max commits are retrieved and
+// the returned bool reports whether there are more.
+func listCommits(client bitbucket.CommitClientInterface, project, repository, since, until string, max int) ([]bitbucket.Commit, bool, error) {
+	commits := []bitbucket.Commit{}
+	start := 0
+	for {
+		page, err := client.CommitList(project, repository, bitbucket.CommitListParams{Since: since, Until: until, Start: start})
+		if err != nil {
+			return nil, false, err
+		}
+		commits = append(commits, page.Values...)
+		if max > 0 && len(commits) >= max {
+			return commits[:max], len(commits) > max || !page.IsLastPage, nil
+		}
+		// Guard against responses without valid paging information.
+		if page.IsLastPage || page.NextPageStart <= start {
+			return commits, false, nil
+		}
+		start = page.NextPageStart
+	}
+}
+
+// parseVersion splits a version of format MAJOR.MINOR.PATCH (as matched by
+// TagScheme.FinalVersion) into its parts.
+func parseVersion(version string) []int {
+	parts := []int{}
+	for _, p := range strings.Split(version, ".") {
+		i, _ := strconv.Atoi(p)
+		parts = append(parts, i)
+	}
+	return parts
+}
+
+func compareVersions(a, b []int) int {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+func formatVersion(v []int) string {
+	return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2])
+}
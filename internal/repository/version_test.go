@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/opendevstack/pipeline/pkg/bitbucket"
+	"github.com/opendevstack/pipeline/pkg/config"
+)
+
+func TestNextVersion(t *testing.T) {
+	headSHA := "8d351a10fb428c0c1239530256e21cf24f136e73"
+	tags := []bitbucket.Tag{
+		{ID: "refs/tags/v1.2.0", DisplayID: "v1.2.0", LatestCommit: "0e183aa3bc3f7c7b7c6bd6f2d4a8b5e5c0bb3f6e"},
+		{ID: "refs/tags/v1.10.1", DisplayID: "v1.10.1", LatestCommit: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+		{ID: "refs/tags/v1.11.0-rc.1", DisplayID: "v1.11.0-rc.1", LatestCommit: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+		{ID: "refs/tags/v2.0.0-beta", DisplayID: "v2.0.0-beta", LatestCommit: "6c1c4bd1a4ca4e4d2a0d3e7e2b4a9e3cd5f0a9b8"},
+	}
+	tests := map[string]struct {
+		tags     []bitbucket.Tag
+		messages []string
+		want     string
+	}{
+		"no final tags": {
+			tags:     []bitbucket.Tag{{ID: "refs/tags/v1.0.0-rc.1", LatestCommit: headSHA}},
+			messages: []string{"feat: initial"},
+			want:     "1.0.0",
+		},
+		"commit has final tag": {
+			tags: append([]bitbucket.Tag{{ID: "refs/tags/v1.3.0", LatestCommit: headSHA}}, tags...),
+			want: "1.3.0",
+		},
+		"no commits since final tag": {
+			tags: tags,
+			want: "1.10.1",
+		},
+		"fixes and non-conventional commits": {
+			tags:     tags,
+			messages: []string{"fix(api): handle empty body", "Merge pull request #1 in FOO/bar from fix to master", "chore: bump deps"},
+			want:     "1.10.2",
+		},
+		"feature": {
+			tags:     tags,
+			messages: []string{"fix: typo", "feat(ui): add dark mode"},
+			want:     "1.11.0",
+		},
+		"breaking change marker": {
+			tags:     tags,
+			messages: []string{"feat: add search", "refactor!: drop v1 API"},
+			want:     "2.0.0",
+		},
+		"breaking change footer": {
+			tags:     tags,
+			messages: []string{"fix: change config format\n\nBREAKING CHANGE: foo is renamed to bar"},
+			want:     "2.0.0",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			commits := []bitbucket.Commit{}
+			for _, m := range tc.messages {
+				commits = append(commits, bitbucket.Commit{Message: m})
+			}
+			bitbucketClient := &bitbucket.TestClient{Tags: tc.tags, Commits: commits}
+			got, err := NextVersion(bitbucketClient, "FOO", "bar", headSHA, NewTagScheme(config.ReleaseTags{}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("want version: %s, got: %s", tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package artifact
+
+// DeploymentApproval records who approved a deployment to an environment
+// which requires approvals. It is created by ods-deploy-helm and
+// ods-deploy-kustomize in the deployments artifacts directory.
+type DeploymentApproval struct {
+	// Environment is the name of the approved target environment.
+	Environment string `json:"environment"`
+	// CommitSHA is the SHA of the approved commit.
+	CommitSHA string `json:"commitSha"`
+	// RequiredApprovals is the number of distinct approvers required.
+	RequiredApprovals int `json:"requiredApprovals"`
+	// Approvals lists the approvals given, ordered by date.
+	Approvals []Approval `json:"approvals"`
+}
+
+// Approval is a single approval given by a Bitbucket user.
+type Approval struct {
+	// User is the Bitbucket user slug of the approver.
+	User string `json:"user"`
+	// DisplayName is the display name of the approver.
+	DisplayName string `json:"displayName"`
+	// Date is the time of the approval in RFC 3339 format.
+	Date string `json:"date"`
+}
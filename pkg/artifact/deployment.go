@@ -0,0 +1,69 @@
+package artifact
+
+// Deployment records a Helm release or Kustomize manifests deployed to an
+// environment. It is created by ods-deploy-helm and ods-deploy-kustomize in
+// the deployments artifacts directory, and marks the commit as deployed to
+// the environment when promoting it.
+type Deployment struct {
+	// Environment is the name of the target environment.
+	Environment string `json:"environment"`
+	// Namespace is the namespace deployed into.
+	Namespace string `json:"namespace"`
+	// APIServer is the API server of the target cluster. Empty if the
+	// release is deployed to the cluster in which the pipeline runs.
+	APIServer string `json:"apiServer,omitempty"`
+	// Release is the name of the Helm release.
+	Release string `json:"release,omitempty"`
+	// Revision is the Helm revision created by the deployment.
+	Revision int `json:"revision,omitempty"`
+	// Chart is the name of the deployed chart.
+	Chart string `json:"chart,omitempty"`
+	// ChartVersion is the version of the deployed chart.
+	ChartVersion string `json:"chartVersion,omitempty"`
+	// AppVersion is the app version of the deployed chart.
+	AppVersion string `json:"appVersion,omitempty"`
+	// Manifests is the rendered directory of the manifests deployed by
+	// ods-deploy-kustomize.
+	Manifests string `json:"manifests,omitempty"`
+	// CommitSHA is the Git commit SHA which has been deployed.
+	CommitSHA string `json:"commitSHA"`
+	// Images are the images copied into the target namespace.
+	Images []DeployedImage `json:"images"`
+	// ValuesFiles are the Helm values files used, in order of precedence.
+	ValuesFiles []DeployedValuesFile `json:"valuesFiles,omitempty"`
+	// SetValues are the Helm values set in addition to the values files.
+	SetValues []string `json:"setValues,omitempty"`
+	// PipelineRun is the name of the pipeline run which deployed the commit.
+	PipelineRun string `json:"pipelineRun"`
+	// Date is the time of the deployment in RFC 3339 format.
+	Date string `json:"date"`
+	// Unchanged is set if the deployment found nothing to change, e.g.
+	// because the commit has been deployed before. The record then describes
+	// what is already deployed in the environment.
+	Unchanged bool `json:"unchanged,omitempty"`
+}
+
+// DeployedImage is an image which has been deployed.
+type DeployedImage struct {
+	// Name is the name of the image (stream).
+	Name string `json:"name"`
+	// Image is the image reference in the target registry.
+	Image string `json:"image"`
+	// Digest is the digest of the image.
+	Digest string `json:"digest"`
+	// Subrepo is the name of the subrepository which built the image. Empty
+	// if the image was built by the repository itself.
+	Subrepo string `json:"subrepo,omitempty"`
+}
+
+// DeployedValuesFile is a values file used for a deployment.
+type DeployedValuesFile struct {
+	// Path of the values file, relative to the repository root.
+	Path string `json:"path"`
+	// Encrypted is set if the file has been encrypted. All values of
+	// encrypted files and of secrets files (secrets.yaml and
+	// secrets.<STAGE|ENVIRONMENT>.yaml, even if unencrypted) are redacted.
+	Encrypted bool `json:"encrypted,omitempty"`
+	// Values of the file.
+	Values map[string]interface{} `json:"values"`
+}
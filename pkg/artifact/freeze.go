@@ -0,0 +1,17 @@
+package artifact
+
+// FreezeOverride records that a deployment was performed during a freeze
+// window. It is created by ods-deploy-helm and ods-deploy-kustomize in the
+// deployments artifacts directory.
+type FreezeOverride struct {
+	// Environment is the name of the target environment.
+	Environment string `json:"environment"`
+	// CommitSHA is the SHA of the deployed commit.
+	CommitSHA string `json:"commitSha"`
+	// Freeze is the name (or description) of the active freeze window.
+	Freeze string `json:"freeze"`
+	// Reason is the justification given for the override.
+	Reason string `json:"reason"`
+	// Date is the time of the deployment in RFC 3339 format.
+	Date string `json:"date"`
+}
@@ -0,0 +1,18 @@
+package artifact
+
+// PipelineRunArtifact records the outcome of a pipeline run. It is created by
+// ods-finish in the pipeline-runs artifacts directory.
+type PipelineRunArtifact struct {
+	// Name is the pipeline run name.
+	Name string `json:"name"`
+	// AggregateTaskStatus is the aggregate Tekton task status.
+	AggregateTaskStatus string `json:"aggregateTaskStatus"`
+}
+
+// Successful returns true if no task of the pipeline run failed.
+// "Succeeded" means all tasks have succeeded, "Completed" means all tasks
+// completed successfully including one or more skipped tasks.
+// See https://tekton.dev/docs/pipelines/pipelines/#using-aggregate-execution-status-of-all-tasks.
+func (p PipelineRunArtifact) Successful() bool {
+	return p.AggregateTaskStatus == "Succeeded" || p.AggregateTaskStatus == "Completed"
+}
@@ -0,0 +1,56 @@
+package artifact
+
+// ReleaseNotes summarizes the changes released with a release candidate or
+// final tag, for the repository and all its subrepositories.
+type ReleaseNotes struct {
+	// Version which has been tagged.
+	Version string `json:"version"`
+	// Tag is the name of the created tag.
+	Tag string `json:"tag"`
+	// Repositories lists the changes of the repository first, followed by
+	// the changes of its subrepositories.
+	Repositories []ReleaseNotesRepository `json:"repositories"`
+}
+
+// ReleaseNotesRepository lists the changes of one repository.
+type ReleaseNotesRepository struct {
+	// Name of the repository.
+	Name string `json:"name"`
+	// CommitSHA is the SHA of the tagged commit.
+	CommitSHA string `json:"commitSha"`
+	// PreviousTag is the final tag the changes are listed since. Empty if
+	// there is no previous release.
+	PreviousTag string `json:"previousTag,omitempty"`
+	// Sections group the changes by conventional commit type.
+	Sections []ReleaseNotesSection `json:"sections"`
+	// Truncated is set if not all changes are listed.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// ReleaseNotesSection groups changes of one kind, e.g. features.
+type ReleaseNotesSection struct {
+	// Type is the conventional commit type, "breaking" for breaking changes
+	// and "other" for all commits not following conventional commits.
+	Type string `json:"type"`
+	// Title is the heading of the section.
+	Title   string               `json:"title"`
+	Changes []ReleaseNotesChange `json:"changes"`
+}
+
+// ReleaseNotesChange describes one commit.
+type ReleaseNotesChange struct {
+	CommitSHA   string `json:"commitSha"`
+	CommitURL   string `json:"commitUrl"`
+	Scope       string `json:"scope,omitempty"`
+	Description string `json:"description"`
+	Author      string `json:"author"`
+	// PullRequests lists the merged pull requests containing the commit.
+	PullRequests []ReleaseNotesPullRequest `json:"pullRequests,omitempty"`
+}
+
+// ReleaseNotesPullRequest references a merged pull request.
+type ReleaseNotesPullRequest struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+}
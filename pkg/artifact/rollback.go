@@ -0,0 +1,24 @@
+package artifact
+
+// Rollback records that a Helm release has been rolled back (or uninstalled
+// if there was no revision to roll back to). Rollbacks are created by
+// ods-deploy-helm as a list in the deployments artifacts directory.
+type Rollback struct {
+	// Release is the name of the Helm release.
+	Release string `json:"release"`
+	// Namespace is the namespace of the Helm release.
+	Namespace string `json:"namespace"`
+	// Reason describes why the release has been rolled back.
+	Reason string `json:"reason"`
+	// FromRevision is the revision which has been rolled back.
+	FromRevision int `json:"fromRevision"`
+	// ToRevision is the revision rolled back to. Zero if uninstalled.
+	ToRevision int `json:"toRevision,omitempty"`
+	// Uninstalled is set if the release has been uninstalled because there
+	// was no previous revision which had been deployed successfully.
+	Uninstalled bool `json:"uninstalled,omitempty"`
+	// Error is set if the rollback failed.
+	Error string `json:"error,omitempty"`
+	// Date is the time of the rollback in RFC 3339 format.
+	Date string `json:"date"`
+}
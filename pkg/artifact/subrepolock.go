@@ -0,0 +1,22 @@
+package artifact
+
+// SubrepoLock records the exact commits of all subrepositories checked out
+// by a pipeline run of an umbrella repository.
+type SubrepoLock struct {
+	Repositories []SubrepoLockEntry `json:"repositories"`
+}
+
+// SubrepoLockEntry records the checked out commit of one subrepository.
+type SubrepoLockEntry struct {
+	// Name of the subrepository.
+	Name string `json:"name"`
+	// URL of the subrepository.
+	URL string `json:"url"`
+	// GitFullRef is the ref the commit was checked out from.
+	GitFullRef string `json:"gitFullRef"`
+	// Pin is "tag" or "commit" if the subrepository is pinned in ods.yaml,
+	// and empty if the branch was resolved at run time.
+	Pin string `json:"pin,omitempty"`
+	// CommitSHA is the full SHA of the checked out commit.
+	CommitSHA string `json:"commitSha"`
+}
@@ -0,0 +1,64 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+type Comment struct {
+	ID          int    `json:"id"`
+	Version     int    `json:"version"`
+	Text        string `json:"text"`
+	Author      User   `json:"author"`
+	CreatedDate int64  `json:"createdDate"`
+	UpdatedDate int64  `json:"updatedDate"`
+}
+
+type CommentPage struct {
+	Size          int       `json:"size"`
+	Limit         int       `json:"limit"`
+	IsLastPage    bool      `json:"isLastPage"`
+	Values        []Comment `json:"values"`
+	Start         int       `json:"start"`
+	NextPageStart int       `json:"nextPageStart"`
+}
+
+type CommitCommentListParams struct {
+	// Start is the index of the first comment to retrieve (for paging).
+	Start int `json:"start"`
+}
+
+type CommentClientInterface interface {
+	CommitCommentList(projectKey, repositorySlug, commitID string, params CommitCommentListParams) (*CommentPage, error)
+}
+
+// CommitCommentList retrieves a page of comments on the specified commit.
+// The authenticated user must have REPO_READ permission for the specified repository to call this resource.
+// https://docs.atlassian.com/bitbucket-server/rest/7.13.0/bitbucket-rest.html#idp219
+func (c *Client) CommitCommentList(projectKey, repositorySlug, commitID string, params CommitCommentListParams) (*CommentPage, error) {
+	q := url.Values{}
+	if params.Start > 0 {
+		q.Add("start", strconv.Itoa(params.Start))
+	}
+	urlPath := fmt.Sprintf(
+		"/rest/api/1.0/projects/%s/repos/%s/commits/%s/comments?%s",
+		projectKey,
+		repositorySlug,
+		commitID,
+		q.Encode(),
+	)
+	statusCode, response, err := c.get(urlPath)
+	if err != nil {
+		return nil, fmt.Errorf("request returned error: %w", err)
+	}
+	var commentPage CommentPage
+	err = json.Unmarshal(response, &commentPage)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"could not unmarshal response: %w. status code: %d, body: %s", err, statusCode, string(response),
+		)
+	}
+	return &commentPage, nil
+}
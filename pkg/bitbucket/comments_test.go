@@ -0,0 +1,31 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/opendevstack/pipeline/test/testserver"
+)
+
+func TestCommitCommentList(t *testing.T) {
+	sha := "abcdef0123abcdef4567abcdef8987abcdef6543"
+
+	srv, cleanup := testserver.NewTestServer(t)
+	defer cleanup()
+	bitbucketClient := testClient(srv.Server.URL)
+
+	srv.EnqueueResponse(
+		t, "/rest/api/1.0/projects/myproject/repos/my-repo/commits/"+sha+"/comments",
+		200, "bitbucket/commit-comment-list.json",
+	)
+
+	l, err := bitbucketClient.CommitCommentList("myproject", "my-repo", sha, CommitCommentListParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Size != 1 {
+		t.Fatalf("got %d, want %d", l.Size, 1)
+	}
+	if l.Values[0].Author.Slug != "jcitizen" {
+		t.Fatalf("got %s, want %s", l.Values[0].Author.Slug, "jcitizen")
+	}
+}
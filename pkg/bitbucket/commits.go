@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 )
 
 type Commit struct {
@@ -27,13 +28,14 @@ type Commit struct {
 }
 
 type CommitPage struct {
-	Size        int      `json:"size"`
-	Limit       int      `json:"limit"`
-	IsLastPage  bool     `json:"isLastPage"`
-	Values      []Commit `json:"values"`
-	Start       int      `json:"start"`
-	AuthorCount int      `json:"authorCount"`
-	TotalCount  int      `json:"totalCount"`
+	Size          int      `json:"size"`
+	Limit         int      `json:"limit"`
+	IsLastPage    bool     `json:"isLastPage"`
+	Values        []Commit `json:"values"`
+	Start         int      `json:"start"`
+	NextPageStart int      `json:"nextPageStart"`
+	AuthorCount   int      `json:"authorCount"`
+	TotalCount    int      `json:"totalCount"`
 }
 
 type PullRequestPage struct {
@@ -107,12 +109,47 @@ type User struct {
 type CommitListParams struct {
 	Since string `json:"since"`
 	Until string `json:"until"`
+	// Start is the index of the first commit to retrieve (for paging).
+	Start int `json:"start"`
+}
+
+type Change struct {
+	ContentID     string `json:"contentId"`
+	FromContentID string `json:"fromContentId"`
+	Path          Path   `json:"path"`
+	Executable    bool   `json:"executable"`
+	Type          string `json:"type"`
+	NodeType      string `json:"nodeType"`
+	SrcPath       *Path  `json:"srcPath,omitempty"`
+}
+
+type Path struct {
+	Components []string `json:"components"`
+	Parent     string   `json:"parent"`
+	Name       string   `json:"name"`
+	Extension  string   `json:"extension"`
+	ToString   string   `json:"toString"`
+}
+
+type ChangePage struct {
+	Size          int      `json:"size"`
+	Limit         int      `json:"limit"`
+	IsLastPage    bool     `json:"isLastPage"`
+	Values        []Change `json:"values"`
+	Start         int      `json:"start"`
+	NextPageStart int      `json:"nextPageStart"`
+}
+
+type CommitChangeListParams struct {
+	Since string `json:"since"`
+	Start int    `json:"start"`
 }
 
 type CommitClientInterface interface {
 	CommitList(projectKey string, repositorySlug string, params CommitListParams) (*CommitPage, error)
 	CommitGet(projectKey, repositorySlug, commitID string) (*Commit, error)
 	CommitPullRequestList(projectKey, repositorySlug, commitID string) (*PullRequestPage, error)
+	CommitChangeList(projectKey, repositorySlug, commitID string, params CommitChangeListParams) (*ChangePage, error)
 }
 
 // CommitList retrieves a page of commits from a given starting commit or "between" two commits. If no explicit commit is specified, the tip of the repository's default branch is assumed. commits may be identified by branch or tag name or by ID. A path may be supplied to restrict the returned commits to only those which affect that path.
@@ -123,6 +160,9 @@ func (c *Client) CommitList(projectKey string, repositorySlug string, params Com
 	q := url.Values{}
 	q.Add("since", params.Since)
 	q.Add("until", params.Until)
+	if params.Start > 0 {
+		q.Add("start", strconv.Itoa(params.Start))
+	}
 
 	urlPath := fmt.Sprintf(
 		"/rest/api/1.0/projects/%s/repos/%s/commits?%s",
@@ -189,3 +229,34 @@ func (c *Client) CommitPullRequestList(projectKey, repositorySlug, commitID stri
 	}
 	return &prPage, nil
 }
+
+// CommitChangeList retrieves a page of changes made in a specified commit. If since is given, the changes between since and the commit are returned, otherwise the changes compared to the first parent of the commit.
+// The authenticated user must have REPO_READ permission for the specified repository to call this resource.
+// https://docs.atlassian.com/bitbucket-server/rest/7.13.0/bitbucket-rest.html
+func (c *Client) CommitChangeList(projectKey, repositorySlug, commitID string, params CommitChangeListParams) (*ChangePage, error) {
+	q := url.Values{}
+	if len(params.Since) > 0 {
+		q.Add("since", params.Since)
+	}
+	q.Add("start", strconv.Itoa(params.Start))
+
+	urlPath := fmt.Sprintf(
+		"/rest/api/1.0/projects/%s/repos/%s/commits/%s/changes?%s",
+		projectKey,
+		repositorySlug,
+		commitID,
+		q.Encode(),
+	)
+	statusCode, response, err := c.get(urlPath)
+	if err != nil {
+		return nil, fmt.Errorf("request returned error: %w", err)
+	}
+	var changePage ChangePage
+	err = json.Unmarshal(response, &changePage)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"could not unmarshal response: %w. status code: %d, body: %s", err, statusCode, string(response),
+		)
+	}
+	return &changePage, nil
+}
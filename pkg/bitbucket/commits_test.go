@@ -66,3 +66,27 @@ func TestCommitPullRequestList(t *testing.T) {
 		t.Fatalf("got %d, want %d", l.Size, 1)
 	}
 }
+
+func TestCommitChangeList(t *testing.T) {
+	sha := "abcdef0123abcdef4567abcdef8987abcdef6543"
+
+	srv, cleanup := testserver.NewTestServer(t)
+	defer cleanup()
+	bitbucketClient := testClient(srv.Server.URL)
+
+	srv.EnqueueResponse(
+		t, "/rest/api/1.0/projects/myproject/repos/my-repo/commits/"+sha+"/changes",
+		200, "bitbucket/commit-change-list.json",
+	)
+
+	l, err := bitbucketClient.CommitChangeList("myproject", "my-repo", sha, CommitChangeListParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Size != 2 {
+		t.Fatalf("got %d, want %d", l.Size, 2)
+	}
+	if l.Values[1].Path.ToString != "docs/README.md" {
+		t.Fatalf("got %s, want %s", l.Values[1].Path.ToString, "docs/README.md")
+	}
+}
@@ -0,0 +1,50 @@
+package bitbucket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+type UserPage struct {
+	Size          int    `json:"size"`
+	Limit         int    `json:"limit"`
+	IsLastPage    bool   `json:"isLastPage"`
+	Values        []User `json:"values"`
+	Start         int    `json:"start"`
+	NextPageStart int    `json:"nextPageStart"`
+}
+
+type GroupMemberListParams struct {
+	// Start is the index of the first member to retrieve (for paging).
+	Start int `json:"start"`
+}
+
+type GroupClientInterface interface {
+	GroupMemberList(group string, params GroupMemberListParams) (*UserPage, error)
+}
+
+// GroupMemberList retrieves a page of users who are members of the specified group.
+// The authenticated user must have the LICENSED_USER permission to call this resource.
+// https://docs.atlassian.com/bitbucket-server/rest/7.13.0/bitbucket-rest.html#idp20
+func (c *Client) GroupMemberList(group string, params GroupMemberListParams) (*UserPage, error) {
+	q := url.Values{}
+	q.Add("context", group)
+	if params.Start > 0 {
+		q.Add("start", strconv.Itoa(params.Start))
+	}
+	urlPath := fmt.Sprintf("/rest/api/1.0/admin/groups/more-members?%s", q.Encode())
+	statusCode, response, err := c.get(urlPath)
+	if err != nil {
+		return nil, fmt.Errorf("request returned error: %w", err)
+	}
+	var userPage UserPage
+	err = json.Unmarshal(response, &userPage)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"could not unmarshal response: %w. status code: %d, body: %s", err, statusCode, string(response),
+		)
+	}
+	return &userPage, nil
+}
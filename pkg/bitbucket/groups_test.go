@@ -0,0 +1,33 @@
+package bitbucket
+
+import (
+	"testing"
+
+	"github.com/opendevstack/pipeline/test/testserver"
+)
+
+func TestGroupMemberList(t *testing.T) {
+	srv, cleanup := testserver.NewTestServer(t)
+	defer cleanup()
+	bitbucketClient := testClient(srv.Server.URL)
+
+	srv.EnqueueResponse(
+		t, "/rest/api/1.0/admin/groups/more-members",
+		200, "bitbucket/group-member-list.json",
+	)
+
+	l, err := bitbucketClient.GroupMemberList("release-managers", GroupMemberListParams{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Size != 1 {
+		t.Fatalf("got %d, want %d", l.Size, 1)
+	}
+	req, err := srv.LastRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.URL.Query().Get("context"); got != "release-managers" {
+		t.Fatalf("got context %s, want %s", got, "release-managers")
+	}
+}
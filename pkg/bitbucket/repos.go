@@ -29,11 +29,12 @@ type Repo struct {
 }
 
 type RepoPage struct {
-	Size       int    `json:"size"`
-	Limit      int    `json:"limit"`
-	IsLastPage bool   `json:"isLastPage"`
-	Values     []Repo `json:"values"`
-	Start      int    `json:"start"`
+	Size          int    `json:"size"`
+	Limit         int    `json:"limit"`
+	IsLastPage    bool   `json:"isLastPage"`
+	Values        []Repo `json:"values"`
+	Start         int    `json:"start"`
+	NextPageStart int    `json:"nextPageStart"`
 }
 
 type RepoCreatePayload struct {
@@ -49,24 +50,44 @@ type RepoClientInterface interface {
 }
 
 // RepoList retrieves repositories from the project corresponding to the supplied projectKey.
+// All pages are retrieved, so the returned page contains all repositories of the project.
+// An error is returned if any page cannot be retrieved or has invalid paging information,
+// as the list would be incomplete otherwise.
 // The authenticated user must have REPO_READ permission for the context repository to call this resource.
 // https://docs.atlassian.com/bitbucket-server/rest/7.13.0/bitbucket-rest.html#idp175
 func (c *Client) RepoList(projectKey string) (*RepoPage, error) {
-
-	urlPath := fmt.Sprintf(
-		"/rest/api/1.0/projects/%s/repos",
-		projectKey,
-	)
-	_, response, err := c.get(urlPath)
-	if err != nil {
-		return nil, err
-	}
-	var repoPage RepoPage
-	err = json.Unmarshal(response, &repoPage)
-	if err != nil {
-		return nil, err
+	repoPage := &RepoPage{IsLastPage: true, Values: []Repo{}}
+	start := 0
+	for {
+		urlPath := fmt.Sprintf(
+			"/rest/api/1.0/projects/%s/repos?start=%d",
+			projectKey,
+			start,
+		)
+		statusCode, response, err := c.get(urlPath)
+		if err != nil {
+			return nil, err
+		}
+		if statusCode != 200 {
+			return nil, fmt.Errorf("request returned unexpected response code: %d, body: %s", statusCode, string(response))
+		}
+		var page RepoPage
+		err = json.Unmarshal(response, &page)
+		if err != nil {
+			return nil, err
+		}
+		repoPage.Values = append(repoPage.Values, page.Values...)
+		repoPage.Limit = page.Limit
+		if page.IsLastPage {
+			break
+		}
+		if page.NextPageStart <= start {
+			return nil, fmt.Errorf("invalid next page start %d after page starting at %d", page.NextPageStart, start)
+		}
+		start = page.NextPageStart
 	}
-	return &repoPage, nil
+	repoPage.Size = len(repoPage.Values)
+	return repoPage, nil
 }
 
 // RepoCreate creates a new repository. Requires an existing project in which this repository will be created. The only parameters which will be used are name and scmId.
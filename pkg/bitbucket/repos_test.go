@@ -45,3 +45,71 @@ func TestRepoList(t *testing.T) {
 		t.Fatalf("got %d, want %d", l.Size, 1)
 	}
 }
+
+func TestRepoListMultiplePages(t *testing.T) {
+	srv, cleanup := testserver.NewTestServer(t)
+	defer cleanup()
+	bitbucketClient := testClient(srv.Server.URL)
+
+	srv.EnqueueResponse(
+		t, "/rest/api/1.0/projects/PRJ/repos",
+		200, "bitbucket/repo-list-first-page.json",
+	)
+	srv.EnqueueResponse(
+		t, "/rest/api/1.0/projects/PRJ/repos",
+		200, "bitbucket/repo-list.json",
+	)
+
+	l, err := bitbucketClient.RepoList("PRJ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Size != 2 {
+		t.Fatalf("got %d, want %d", l.Size, 2)
+	}
+	req, err := srv.LastRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.Query().Get("start") != "1" {
+		t.Fatalf("got start %s, want %s", req.URL.Query().Get("start"), "1")
+	}
+}
+
+func TestRepoListErrors(t *testing.T) {
+	tests := map[string]struct {
+		secondPageStatusCode int
+		secondPageFixture    string
+	}{
+		"failed later page": {
+			secondPageStatusCode: 500,
+			secondPageFixture:    "bitbucket/repo-list.json",
+		},
+		"invalid next page start": {
+			secondPageStatusCode: 200,
+			secondPageFixture:    "bitbucket/repo-list-first-page.json",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			srv, cleanup := testserver.NewTestServer(t)
+			defer cleanup()
+			bitbucketClient := testClient(srv.Server.URL)
+
+			srv.EnqueueResponse(
+				t, "/rest/api/1.0/projects/PRJ/repos",
+				200, "bitbucket/repo-list-first-page.json",
+			)
+			srv.EnqueueResponse(
+				t, "/rest/api/1.0/projects/PRJ/repos",
+				tc.secondPageStatusCode, tc.secondPageFixture,
+			)
+
+			l, err := bitbucketClient.RepoList("PRJ")
+			if err == nil {
+				t.Fatalf("want error, got %d repositories", l.Size)
+			}
+		})
+	}
+}
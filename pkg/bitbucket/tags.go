@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/url"
+	"strconv"
 )
 
 type Tag struct {
@@ -16,11 +17,12 @@ type Tag struct {
 }
 
 type TagPage struct {
-	Size       int   `json:"size"`
-	Limit      int   `json:"limit"`
-	IsLastPage bool  `json:"isLastPage"`
-	Values     []Tag `json:"values"`
-	Start      int   `json:"start"`
+	Size          int   `json:"size"`
+	Limit         int   `json:"limit"`
+	IsLastPage    bool  `json:"isLastPage"`
+	Values        []Tag `json:"values"`
+	Start         int   `json:"start"`
+	NextPageStart int   `json:"nextPageStart"`
 }
 
 type TagCreatePayload struct {
@@ -37,6 +39,8 @@ type TagListParams struct {
 	// OrderBy determines ordering of refs.
 	// Either ALPHABETICAL (by name) or MODIFICATION (last updated).
 	OrderBy string `json:"orderBy"`
+	// Start is the index of the first tag to retrieve (for paging).
+	Start int `json:"start"`
 }
 
 type TagClientInterface interface {
@@ -53,6 +57,9 @@ func (c *Client) TagList(projectKey string, repositorySlug string, params TagLis
 	q := url.Values{}
 	q.Add("filterText", params.FilterText)
 	q.Add("orderBy", params.OrderBy)
+	if params.Start > 0 {
+		q.Add("start", strconv.Itoa(params.Start))
+	}
 
 	urlPath := fmt.Sprintf(
 		"/rest/api/1.0/projects/%s/repos/%s/tags?%s",
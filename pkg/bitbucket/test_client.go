@@ -7,13 +7,20 @@ import (
 
 // TestClient returns mocked branches and tags.
 type TestClient struct {
-	Branches     []Branch
-	Tags         []Tag
-	Repos        []Repo
+	Branches []Branch
+	Tags     []Tag
+	Repos    []Repo
+	// ProjectRepos contains the repositories per project key, taking
+	// precedence over Repos
+	ProjectRepos map[string][]Repo
 	Commits      []Commit
 	PullRequests []PullRequest
+	Changes      []Change
+	Comments     []Comment
 	// Files contains byte slices for filenames
 	Files map[string][]byte
+	// GroupMembers contains the members of groups
+	GroupMembers map[string][]User
 }
 
 func (c *TestClient) BranchList(projectKey string, repositorySlug string, params BranchListParams) (*BranchPage, error) {
@@ -42,8 +49,15 @@ func (c *TestClient) TagCreate(projectKey string, repositorySlug string, payload
 }
 
 func (c *TestClient) RepoList(projectKey string) (*RepoPage, error) {
+	if repos, ok := c.ProjectRepos[projectKey]; ok {
+		return &RepoPage{
+			Values:     repos,
+			IsLastPage: true,
+		}, nil
+	}
 	return &RepoPage{
-		Values: c.Repos,
+		Values:     c.Repos,
+		IsLastPage: true,
 	}, nil
 }
 
@@ -74,3 +88,15 @@ func (c *TestClient) CommitGet(projectKey, repositorySlug, commitID string) (*Co
 func (c *TestClient) CommitPullRequestList(projectKey, repositorySlug, commitID string) (*PullRequestPage, error) {
 	return &PullRequestPage{Values: c.PullRequests}, nil
 }
+
+func (c *TestClient) CommitChangeList(projectKey, repositorySlug, commitID string, params CommitChangeListParams) (*ChangePage, error) {
+	return &ChangePage{Values: c.Changes, IsLastPage: true}, nil
+}
+
+func (c *TestClient) CommitCommentList(projectKey, repositorySlug, commitID string, params CommitCommentListParams) (*CommentPage, error) {
+	return &CommentPage{Values: c.Comments, IsLastPage: true}, nil
+}
+
+func (c *TestClient) GroupMemberList(group string, params GroupMemberListParams) (*UserPage, error) {
+	return &UserPage{Values: c.GroupMembers[group], IsLastPage: true}, nil
+}
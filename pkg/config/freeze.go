@@ -0,0 +1,320 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// maxRecurringFreezeDuration limits the duration of recurring freeze windows.
+// Longer freezes should be declared as date range.
+const maxRecurringFreezeDuration = 31 * 24 * time.Hour
+
+// freezeDateLayout is the layout of dates without time of day.
+const freezeDateLayout = "2006-01-02"
+
+// FreezeWindow defines a period during which deployments are not allowed.
+// A window is either a date range (Start and End) or recurring (Schedule and
+// Duration).
+type FreezeWindow struct {
+	// Name describes the freeze, e.g. "year-end".
+	Name string `json:"name,omitempty"`
+	// Start of the freeze, either a date (YYYY-MM-DD) or a RFC 3339 timestamp.
+	Start string `json:"start,omitempty"`
+	// End of the freeze, either a date (YYYY-MM-DD, inclusive) or a RFC 3339
+	// timestamp.
+	End string `json:"end,omitempty"`
+	// Schedule is a cron expression (minute, hour, day of month, month, day of
+	// week) defining when a recurring freeze starts.
+	Schedule string `json:"schedule,omitempty"`
+	// Duration of a recurring freeze.
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// Timezone (IANA name) in which dates and the schedule are interpreted.
+	// Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// ClusterFreezeWindow is a freeze window declared in the cluster-wide
+// configuration, optionally restricted to some stages.
+type ClusterFreezeWindow struct {
+	FreezeWindow `json:",inline"`
+	// Stages the freeze applies to. Applies to all stages if empty.
+	Stages []Stage `json:"stages,omitempty"`
+}
+
+// String returns the name of the window, or a description of it if it has
+// no name.
+func (f FreezeWindow) String() string {
+	if f.Name != "" {
+		return f.Name
+	}
+	if f.Schedule != "" {
+		return fmt.Sprintf("%q for %s", f.Schedule, f.Duration.Duration)
+	}
+	return fmt.Sprintf("%s to %s", f.Start, f.End)
+}
+
+// Validate checks that the window is either a valid date range or a valid
+// recurring window.
+func (f FreezeWindow) Validate() error {
+	if _, err := f.location(); err != nil {
+		return err
+	}
+	dateRange := f.Start != "" || f.End != ""
+	recurring := f.Schedule != "" || f.Duration != nil
+	if dateRange == recurring {
+		return errors.New("either start and end or schedule and duration must be given")
+	}
+	if dateRange {
+		start, end, err := f.dateRange()
+		if err != nil {
+			return err
+		}
+		if !end.After(start) {
+			return fmt.Errorf("end %s must be after start %s", f.End, f.Start)
+		}
+		return nil
+	}
+	if f.Schedule == "" || f.Duration == nil {
+		return errors.New("schedule and duration must both be given")
+	}
+	if _, err := parseCronSchedule(f.Schedule); err != nil {
+		return fmt.Errorf("invalid schedule %q: %w", f.Schedule, err)
+	}
+	if f.Duration.Duration <= 0 || f.Duration.Duration > maxRecurringFreezeDuration {
+		return fmt.Errorf("duration must be positive and at most %s, got %s", maxRecurringFreezeDuration, f.Duration.Duration)
+	}
+	return nil
+}
+
+// Active returns true if t is within the freeze window. The window must be
+// valid.
+func (f FreezeWindow) Active(t time.Time) (bool, error) {
+	loc, err := f.location()
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+	if f.Schedule == "" {
+		start, end, err := f.dateRange()
+		if err != nil {
+			return false, err
+		}
+		return !t.Before(start) && t.Before(end), nil
+	}
+	schedule, err := parseCronSchedule(f.Schedule)
+	if err != nil {
+		return false, err
+	}
+	// Check whether the freeze started within the last duration. The
+	// schedule has minute granularity.
+	earliest := t.Add(-f.Duration.Duration)
+	for s := t.Truncate(time.Minute); s.After(earliest); s = s.Add(-time.Minute) {
+		if schedule.matches(s) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActiveFreeze returns the first window active at t, or nil.
+func ActiveFreeze(windows []FreezeWindow, t time.Time) (*FreezeWindow, error) {
+	for i, w := range windows {
+		active, err := w.Active(t)
+		if err != nil {
+			return nil, fmt.Errorf("freeze window %s: %w", w, err)
+		}
+		if active {
+			return &windows[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// ReadClusterFreezeWindows reads cluster-wide freeze windows from given byte
+// slice, as found in the "freezeWindows" key of the "ods-cluster" ConfigMap.
+func ReadClusterFreezeWindows(body []byte) ([]ClusterFreezeWindow, error) {
+	var windows []ClusterFreezeWindow
+	err := yaml.UnmarshalStrict(body, &windows, func(dec *json.Decoder) *json.Decoder {
+		dec.DisallowUnknownFields()
+		return dec
+	})
+	if err != nil {
+		return nil, err
+	}
+	for i, w := range windows {
+		if err := w.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid freeze window #%d: %w", i+1, err)
+		}
+		for _, s := range w.Stages {
+			switch s {
+			case DevStage, QAStage, ProdStage:
+			default:
+				return nil, fmt.Errorf("invalid stage value '%s' of freeze window #%d", s, i+1)
+			}
+		}
+	}
+	return windows, nil
+}
+
+// FreezeWindowsForStage returns the windows of clusterWindows which apply to
+// given stage.
+func FreezeWindowsForStage(clusterWindows []ClusterFreezeWindow, stage Stage) []FreezeWindow {
+	var windows []FreezeWindow
+	for _, cw := range clusterWindows {
+		if len(cw.Stages) == 0 {
+			windows = append(windows, cw.FreezeWindow)
+			continue
+		}
+		for _, s := range cw.Stages {
+			if s == stage {
+				windows = append(windows, cw.FreezeWindow)
+				break
+			}
+		}
+	}
+	return windows
+}
+
+func (f FreezeWindow) location() (*time.Location, error) {
+	if f.Timezone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", f.Timezone, err)
+	}
+	return loc, nil
+}
+
+// dateRange returns the start and (exclusive) end of a date range window.
+func (f FreezeWindow) dateRange() (time.Time, time.Time, error) {
+	loc, err := f.location()
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	start, _, err := parseFreezeTime(f.Start, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %w", err)
+	}
+	end, dateOnly, err := parseFreezeTime(f.End, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %w", err)
+	}
+	if dateOnly {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// parseFreezeTime parses a date or RFC 3339 timestamp. Dates are interpreted
+// in loc.
+func parseFreezeTime(s string, loc *time.Location) (time.Time, bool, error) {
+	if s == "" {
+		return time.Time{}, false, errors.New("must not be empty")
+	}
+	if t, err := time.ParseInLocation(freezeDateLayout, s, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%q is neither a date (YYYY-MM-DD) nor a RFC 3339 timestamp", s)
+	}
+	return t, false, nil
+}
+
+// cronSchedule holds the allowed values of each field of a cron expression.
+type cronSchedule struct {
+	minutes, hours, daysOfMonth, months, daysOfWeek map[int]bool
+	// Whether day of month and day of week are restricted. If both are, a
+	// time matches if either matches (as in crontab).
+	domRestricted, dowRestricted bool
+}
+
+func (c cronSchedule) matches(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+	dom := c.daysOfMonth[t.Day()]
+	dow := c.daysOfWeek[int(t.Weekday())]
+	if c.domRestricted && c.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// parseCronSchedule parses a cron expression with five fields. Each field
+// may be "*", a number, a range ("1-5") or a list thereof, optionally with
+// a step ("*/15"). Day of week 7 is an alias for Sunday (0).
+func parseCronSchedule(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("want 5 fields, got %d", len(fields))
+	}
+	var c cronSchedule
+	var err error
+	if c.minutes, err = parseCronField(fields[0], 0, 59); err != nil {
+		return c, fmt.Errorf("minute: %w", err)
+	}
+	if c.hours, err = parseCronField(fields[1], 0, 23); err != nil {
+		return c, fmt.Errorf("hour: %w", err)
+	}
+	if c.daysOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return c, fmt.Errorf("day of month: %w", err)
+	}
+	if c.months, err = parseCronField(fields[3], 1, 12); err != nil {
+		return c, fmt.Errorf("month: %w", err)
+	}
+	if c.daysOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return c, fmt.Errorf("day of week: %w", err)
+	}
+	if c.daysOfWeek[7] {
+		c.daysOfWeek[0] = true
+	}
+	c.domRestricted = fields[2] != "*"
+	c.dowRestricted = fields[4] != "*"
+	return c, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			rangePart, step = part[:i], s
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return nil, fmt.Errorf("invalid value %q", part)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return nil, fmt.Errorf("invalid value %q", part)
+				}
+			} else if step > 1 {
+				hi = max
+			}
+		}
+		if lo < min || hi > max || lo > hi {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for v := lo; v <= hi; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFreezeWindowActive(t *testing.T) {
+	duration := func(d time.Duration) *metav1.Duration {
+		return &metav1.Duration{Duration: d}
+	}
+	tests := map[string]struct {
+		window FreezeWindow
+		time   time.Time
+		want   bool
+	}{
+		"within date range": {
+			window: FreezeWindow{Start: "2021-12-20", End: "2022-01-02"},
+			time:   time.Date(2021, 12, 24, 12, 0, 0, 0, time.UTC),
+			want:   true,
+		},
+		"on inclusive end date": {
+			window: FreezeWindow{Start: "2021-12-20", End: "2022-01-02"},
+			time:   time.Date(2022, 1, 2, 23, 59, 0, 0, time.UTC),
+			want:   true,
+		},
+		"after date range": {
+			window: FreezeWindow{Start: "2021-12-20", End: "2022-01-02"},
+			time:   time.Date(2022, 1, 3, 0, 0, 0, 0, time.UTC),
+			want:   false,
+		},
+		"before timestamp range": {
+			window: FreezeWindow{Start: "2021-12-20T18:00:00Z", End: "2021-12-21T06:00:00Z"},
+			time:   time.Date(2021, 12, 20, 17, 59, 0, 0, time.UTC),
+			want:   false,
+		},
+		"date range in timezone": {
+			window: FreezeWindow{Start: "2021-12-20", End: "2021-12-20", Timezone: "Europe/Berlin"},
+			time:   time.Date(2021, 12, 19, 23, 30, 0, 0, time.UTC),
+			want:   true,
+		},
+		"within recurring window": {
+			// Fridays from 16:00 for the weekend.
+			window: FreezeWindow{Schedule: "0 16 * * 5", Duration: duration(62 * time.Hour)},
+			time:   time.Date(2021, 10, 3, 12, 0, 0, 0, time.UTC), // Sunday
+			want:   true,
+		},
+		"outside recurring window": {
+			window: FreezeWindow{Schedule: "0 16 * * 5", Duration: duration(62 * time.Hour)},
+			time:   time.Date(2021, 10, 4, 6, 0, 0, 0, time.UTC), // Monday
+			want:   false,
+		},
+		"start of recurring window": {
+			window: FreezeWindow{Schedule: "0 16 * * 5", Duration: duration(time.Hour)},
+			time:   time.Date(2021, 10, 1, 16, 0, 0, 0, time.UTC),
+			want:   true,
+		},
+		"end of recurring window": {
+			window: FreezeWindow{Schedule: "0 16 * * 5", Duration: duration(time.Hour)},
+			time:   time.Date(2021, 10, 1, 17, 0, 0, 0, time.UTC),
+			want:   false,
+		},
+		"recurring window with ranges and steps": {
+			window: FreezeWindow{Schedule: "*/30 9-17 1,15 * *", Duration: duration(10 * time.Minute)},
+			time:   time.Date(2021, 10, 15, 17, 35, 0, 0, time.UTC),
+			want:   true,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if err := tc.window.Validate(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := tc.window.Active(tc.time)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Fatalf("want active: %v, got: %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFreezeWindowValidate(t *testing.T) {
+	tests := map[string]struct {
+		window  FreezeWindow
+		wantErr string
+	}{
+		"neither range nor schedule": {
+			window:  FreezeWindow{Name: "year-end"},
+			wantErr: "either start and end or schedule and duration must be given",
+		},
+		"range and schedule": {
+			window:  FreezeWindow{Start: "2021-12-20", End: "2022-01-02", Schedule: "0 0 * * *"},
+			wantErr: "either start and end or schedule and duration must be given",
+		},
+		"end before start": {
+			window:  FreezeWindow{Start: "2022-01-02", End: "2021-12-20"},
+			wantErr: "end 2021-12-20 must be after start 2022-01-02",
+		},
+		"invalid date": {
+			window:  FreezeWindow{Start: "20.12.2021", End: "2022-01-02"},
+			wantErr: `invalid start: "20.12.2021" is neither a date (YYYY-MM-DD) nor a RFC 3339 timestamp`,
+		},
+		"schedule without duration": {
+			window:  FreezeWindow{Schedule: "0 16 * * 5"},
+			wantErr: "schedule and duration must both be given",
+		},
+		"invalid schedule": {
+			window:  FreezeWindow{Schedule: "0 16 * * fri", Duration: &metav1.Duration{Duration: time.Hour}},
+			wantErr: `invalid schedule "0 16 * * fri": day of week: invalid value "fri"`,
+		},
+		"schedule out of range": {
+			window:  FreezeWindow{Schedule: "0 24 * * *", Duration: &metav1.Duration{Duration: time.Hour}},
+			wantErr: `invalid schedule "0 24 * * *": hour: "24" is out of range 0-23`,
+		},
+		"invalid timezone": {
+			window:  FreezeWindow{Start: "2021-12-20", End: "2022-01-02", Timezone: "Mars/Olympus"},
+			wantErr: `invalid timezone "Mars/Olympus": unknown time zone Mars/Olympus`,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tc.window.Validate()
+			if err == nil || err.Error() != tc.wantErr {
+				t.Fatalf("want err: %q, got: %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestReadClusterFreezeWindows(t *testing.T) {
+	windows, err := ReadClusterFreezeWindows([]byte(`- name: year-end
+  start: "2021-12-20"
+  end: "2022-01-02"
+- name: weekend
+  schedule: "0 16 * * 5"
+  duration: 62h
+  stages: [prod]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := FreezeWindowsForStage(windows, DevStage); len(got) != 1 || got[0].Name != "year-end" {
+		t.Fatalf("want year-end window for dev, got: %v", got)
+	}
+	if got := FreezeWindowsForStage(windows, ProdStage); len(got) != 2 {
+		t.Fatalf("want two windows for prod, got: %v", got)
+	}
+	_, err = ReadClusterFreezeWindows([]byte(`- name: weekend
+  schedule: "0 16 * * 5"
+  duration: 62h
+  stages: [production]
+`))
+	want := "invalid stage value 'production' of freeze window #1"
+	if err == nil || err.Error() != want {
+		t.Fatalf("want err: %q, got: %v", want, err)
+	}
+}
@@ -6,11 +6,15 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
 
 	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/yaml"
 )
 
@@ -31,6 +35,24 @@ const (
 
 var ODSFileCandidates = []string{ODSYAMLFile, ODSYMLFile}
 
+// VersioningAuto derives the version from the Git history instead of
+// requiring it to be set via Version.
+const VersioningAuto = "auto"
+
+// Placeholders which may be used in release tag templates.
+const (
+	TagVersionPlaceholder        = "{{.Version}}"
+	TagNumberPlaceholder         = "{{.Number}}"
+	TagCommitSHAPlaceholder      = "{{.CommitSHA}}"
+	TagShortCommitSHAPlaceholder = "{{.ShortCommitSHA}}"
+)
+
+// Default release tag templates, e.g. "v1.0.0-rc.1" and "v1.0.0".
+const (
+	DefaultCandidateTag = "v" + TagVersionPlaceholder + "-rc." + TagNumberPlaceholder
+	DefaultFinalTag     = "v" + TagVersionPlaceholder
+)
+
 // ODS represents the ODS pipeline configuration for one repository.
 type ODS struct {
 	// Repositories specifies the subrepositores, making the current repository
@@ -42,8 +64,41 @@ type ODS struct {
 	BranchToEnvironmentMapping []BranchToEnvironmentMapping `json:"branchToEnvironmentMapping,omitempty"`
 	// Pipeline allows to define the Tekton pipeline tasks.
 	Pipeline Pipeline `json:"pipeline,omitempty"`
+	// Pipelines allows to define multiple named pipelines, each with its own
+	// trigger conditions. Cannot be used together with Pipeline.
+	Pipelines []Pipeline `json:"pipelines,omitempty"`
 	// Version is the application version and must follow SemVer.
 	Version string `json:"version,omitempty"`
+	// Versioning may be set to "auto" to compute the next version from
+	// existing release tags and conventional commit messages. Cannot be used
+	// together with Version.
+	Versioning string `json:"versioning,omitempty"`
+	// Workspace configures the workspace shared by all tasks.
+	Workspace SharedWorkspace `json:"workspace,omitempty"`
+	// ReleaseTags configures the names of release tags.
+	ReleaseTags ReleaseTags `json:"releaseTags,omitempty"`
+}
+
+// ReleaseTags configures the names of the Git tags applied for environments
+// of stage QA (release candidates) and PROD (final versions). Templates may
+// contain the placeholders {{.Version}}, {{.Number}} (number of the release
+// candidate), {{.CommitSHA}} and {{.ShortCommitSHA}}.
+type ReleaseTags struct {
+	// Candidate is the template of release candidate tags. It must contain
+	// {{.Version}} and {{.Number}}. Defaults to "v{{.Version}}-rc.{{.Number}}".
+	Candidate string `json:"candidate,omitempty"`
+	// Final is the template of final version tags. It must contain
+	// {{.Version}} but not {{.Number}}. Defaults to "v{{.Version}}".
+	Final string `json:"final,omitempty"`
+}
+
+// SharedWorkspace represents the workspace shared by all tasks, which is
+// backed by a PVC.
+type SharedWorkspace struct {
+	// Size of the PVC backing the workspace, e.g. "5Gi". If the PVC is smaller,
+	// it is expanded. Sizes below the default size of the installation have
+	// no effect.
+	Size string `json:"size,omitempty"`
 }
 
 // Repository represents a Git repository.
@@ -60,6 +115,15 @@ type Repository struct {
 	// the "master" branch.
 	// Example: "develop"
 	Branch string `json:"branch"`
+	// Tag of Git repository (optional). Pins the repository to the given tag
+	// instead of a branch. Cannot be used together with Branch or Commit.
+	// Example: "v1.0.0"
+	Tag string `json:"tag,omitempty"`
+	// Commit of Git repository (optional). Pins the repository to the given
+	// commit SHA. Branch may still be given to describe where the commit is
+	// from. Cannot be used together with Tag.
+	// Example: "8d351a10fb428c0c1239530256e21cf24f136e73"
+	Commit string `json:"commit,omitempty"`
 }
 
 type BranchToEnvironmentMapping struct {
@@ -88,16 +152,137 @@ type Environment struct {
 	// Additional configuration of the target. This may be used by tasks outside
 	// the ODS catalog.
 	Config map[string]interface{} `json:"config,omitempty"`
+	// Approval requires deployments to the environment to be approved.
+	Approval *Approval `json:"approval,omitempty"`
+	// Freezes lists periods during which deployments to the environment are
+	// not allowed.
+	Freezes []FreezeWindow `json:"freezes,omitempty"`
 	// APIToken holds the token of the environment, if any.
 	// The value is retrieved from the "token" field in the secret referenced by APICredentialsSecret.
 	// Cannot be set from JSON.
 	APIToken string `json:"-"`
 }
 
+// Approval configures who needs to approve deployments to an environment.
+// Approvals are given by commenting "/approve <ENVIRONMENT>" on the deployed
+// commit in Bitbucket.
+type Approval struct {
+	// Approvers lists the Bitbucket users (slugs) allowed to approve.
+	Approvers []string `json:"approvers,omitempty"`
+	// Groups lists the Bitbucket groups whose members are allowed to approve.
+	Groups []string `json:"groups,omitempty"`
+	// MinApprovals is the number of distinct approvers required.
+	// Defaults to 1.
+	MinApprovals int `json:"minApprovals,omitempty"`
+	// Timeout is how long to wait for approvals before the deployment fails.
+	// Defaults to 30 minutes.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// AllowSelfApproval allows the author of the deployed commit to approve
+	// its deployment. Defaults to false.
+	AllowSelfApproval bool `json:"allowSelfApproval,omitempty"`
+}
+
 // Pipeline represents a Tekton pipeline.
 type Pipeline struct {
-	Tasks   []tekton.PipelineTask `json:"tasks,omitempty"`
-	Finally []tekton.PipelineTask `json:"finally,omitempty"`
+	// Name of the pipeline. Required when the pipeline is defined in
+	// Pipelines, must be blank otherwise.
+	Name string `json:"name,omitempty"`
+	// Trigger restricts which webhook events start the pipeline. If not given,
+	// the pipeline is triggered by every event.
+	Trigger *Trigger `json:"trigger,omitempty"`
+	// Extends is the name of a pipeline template defined centrally in the
+	// "ods-pipeline" ConfigMap. Tasks and Finally are appended to the tasks
+	// of the template.
+	Extends string `json:"extends,omitempty"`
+	// Overrides allows to override params of tasks defined in the template.
+	Overrides []TaskOverride `json:"overrides,omitempty"`
+	// Params declares additional pipeline params (of type string or array),
+	// which tasks can reference via $(params.<name>).
+	Params []tekton.ParamSpec `json:"params,omitempty"`
+	// Workspaces declares additional pipeline workspaces, which tasks can bind
+	// to their own workspaces.
+	Workspaces []Workspace `json:"workspaces,omitempty"`
+	// RunSpec configures the pipeline runs of the pipeline. What may be
+	// configured is restricted by the administrators of the cluster.
+	RunSpec *RunSpec       `json:"runSpec,omitempty"`
+	Tasks   []PipelineTask `json:"tasks,omitempty"`
+	Finally []PipelineTask `json:"finally,omitempty"`
+}
+
+// RunSpec represents settings applied to pipeline runs.
+type RunSpec struct {
+	// ServiceAccountName is the service account used to execute the tasks.
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+	// PodTemplate is applied to the pods of all tasks, e.g. to set a node
+	// selector, tolerations or a security context.
+	PodTemplate *tekton.PodTemplate `json:"podTemplate,omitempty"`
+	// Timeout of the pipeline run. Timeouts of individual tasks can be set
+	// via the "timeout" field of the task.
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+	// TaskRunSpecs allows to set the service account and pod template per task.
+	TaskRunSpecs []tekton.PipelineTaskRunSpec `json:"taskRunSpecs,omitempty"`
+}
+
+// PipelineTask represents a Tekton pipeline task, which may additionally
+// define under which conditions it runs.
+type PipelineTask struct {
+	tekton.PipelineTask `json:",inline"`
+	// RunIf restricts under which conditions the task runs. The conditions
+	// are translated into Tekton "when" expressions.
+	RunIf *RunIf `json:"runIf,omitempty"`
+}
+
+// RunIf represents conditions under which a task runs.
+// All given conditions must be met for the task to run.
+type RunIf struct {
+	// Stage is a list of target stages, e.g. ["qa", "prod"].
+	Stage []Stage `json:"stage,omitempty"`
+	// Branch is a list of Git branch names. An item may also be a prefix
+	// like "release/*".
+	Branch []string `json:"branch,omitempty"`
+	// PullRequest restricts the task to commits which are part of an open
+	// pull request (true), or to commits which are not (false).
+	PullRequest *bool `json:"pullRequest,omitempty"`
+	// ChangedPaths is a list of path patterns (as understood by path.Match),
+	// of which at least one must match a file changed by the triggering
+	// event. An item may also be a directory prefix like "docs/*".
+	ChangedPaths []string `json:"changedPaths,omitempty"`
+}
+
+// Workspace represents an additional pipeline workspace. Exactly one of
+// Secret, ConfigMap and EmptyDir must be set.
+type Workspace struct {
+	// Name of the workspace.
+	Name string `json:"name"`
+	// Secret backing the workspace.
+	Secret *corev1.SecretVolumeSource `json:"secret,omitempty"`
+	// ConfigMap backing the workspace.
+	ConfigMap *corev1.ConfigMapVolumeSource `json:"configMap,omitempty"`
+	// EmptyDir backing the workspace.
+	EmptyDir *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+}
+
+// TaskOverride represents params to override for one task of a pipeline
+// template.
+type TaskOverride struct {
+	// Task is the name of the task in the template.
+	Task string `json:"task"`
+	// Params replace params of the same name, other params are added.
+	Params []tekton.Param `json:"params,omitempty"`
+}
+
+// Trigger represents the conditions under which a pipeline is run.
+// All given conditions must be met for the trigger to match.
+type Trigger struct {
+	// Events is a list of Bitbucket event keys, e.g. "repo:refs_changed" or
+	// "pr:opened". An item may also be a prefix like "pr:*".
+	Events []string `json:"events,omitempty"`
+	// Branches is a list of Git branch names. An item may also be a prefix
+	// like "release/*".
+	Branches []string `json:"branches,omitempty"`
+	// PullRequest restricts the trigger to commits which are part of an open
+	// pull request (true), or to commits which are not (false).
+	PullRequest *bool `json:"pullRequest,omitempty"`
 }
 
 func (o *ODS) Validate() error {
@@ -106,6 +291,256 @@ func (o *ODS) Validate() error {
 			return err
 		}
 	}
+	for _, r := range o.Repositories {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+	}
+	if len(o.Versioning) > 0 {
+		if o.Versioning != VersioningAuto {
+			return fmt.Errorf("invalid versioning '%s', must be '%s'", o.Versioning, VersioningAuto)
+		}
+		if len(o.Version) > 0 {
+			return errors.New("version and versioning cannot be used together")
+		}
+	}
+	if err := o.ReleaseTags.Validate(); err != nil {
+		return err
+	}
+	if len(o.Workspace.Size) > 0 {
+		if _, err := resource.ParseQuantity(o.Workspace.Size); err != nil {
+			return fmt.Errorf("invalid workspace size '%s'", o.Workspace.Size)
+		}
+	}
+	if len(o.Pipelines) > 0 {
+		if len(o.Pipeline.Name) > 0 || o.Pipeline.Trigger != nil || len(o.Pipeline.Extends) > 0 ||
+			len(o.Pipeline.Tasks) > 0 || len(o.Pipeline.Finally) > 0 {
+			return errors.New("pipeline and pipelines cannot be used together")
+		}
+	} else if len(o.Pipeline.Name) > 0 || o.Pipeline.Trigger != nil {
+		return errors.New("name and trigger can only be set for items in pipelines")
+	}
+	names := map[string]bool{}
+	for _, p := range o.Pipelines {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+		if names[p.Name] {
+			return fmt.Errorf("pipeline name %s is not unique", p.Name)
+		}
+		names[p.Name] = true
+	}
+	for _, p := range o.PipelineDefinitions() {
+		if len(p.Overrides) > 0 && len(p.Extends) == 0 {
+			return errors.New("overrides can only be used together with extends")
+		}
+		if err := ValidateParamsAndWorkspaces(p.Params, p.Workspaces); err != nil {
+			return err
+		}
+		for _, t := range append(p.Tasks, p.Finally...) {
+			if err := t.RunIf.Validate(); err != nil {
+				return fmt.Errorf("invalid runIf of task %s: %w", t.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// BuiltinParamNames are the names of the params the pipeline manager
+// declares for every pipeline (git-commit-sha and promote-from only for
+// promotions). Custom params must not use them.
+var BuiltinParamNames = []string{
+	"repository",
+	"project",
+	"component",
+	"git-repo-url",
+	"git-full-ref",
+	"pr-key",
+	"pr-base",
+	"environment",
+	"version",
+	"stage",
+	"is-pr",
+	"trigger-event",
+	"git-ref",
+	"git-commit-sha",
+	"promote-from",
+}
+
+const (
+	// ChangedPathsParamPrefix is the prefix of the params the pipeline
+	// manager declares for tasks with a changedPaths condition, holding
+	// whether the condition is met.
+	ChangedPathsParamPrefix = "changed-paths-"
+	// SharedWorkspaceName is the name of the workspace the pipeline manager
+	// declares for every pipeline, shared by all tasks.
+	SharedWorkspaceName = "shared-workspace"
+)
+
+// ValidateParamsAndWorkspaces validates the custom params and workspaces of
+// a pipeline, which must not clash with the builtin ones.
+func ValidateParamsAndWorkspaces(params []tekton.ParamSpec, workspaces []Workspace) error {
+	builtin := map[string]bool{}
+	for _, name := range BuiltinParamNames {
+		builtin[name] = true
+	}
+	names := map[string]bool{}
+	for _, ps := range params {
+		if len(ps.Name) == 0 {
+			return errors.New("name of param must not be blank")
+		}
+		if builtin[ps.Name] || strings.HasPrefix(ps.Name, ChangedPathsParamPrefix) {
+			return fmt.Errorf("param name %s is reserved", ps.Name)
+		}
+		if names[ps.Name] {
+			return fmt.Errorf("param name %s is not unique", ps.Name)
+		}
+		names[ps.Name] = true
+		switch ps.Type {
+		case "", tekton.ParamTypeString, tekton.ParamTypeArray:
+		default:
+			return fmt.Errorf("invalid type '%s' for param %s", ps.Type, ps.Name)
+		}
+		if ps.Default == nil {
+			return fmt.Errorf("param %s must have a default value", ps.Name)
+		}
+	}
+	workspaceNames := map[string]bool{}
+	for _, w := range workspaces {
+		if err := w.Validate(); err != nil {
+			return err
+		}
+		if w.Name == SharedWorkspaceName {
+			return fmt.Errorf("workspace name %s is reserved", w.Name)
+		}
+		if workspaceNames[w.Name] {
+			return fmt.Errorf("workspace name %s is not unique", w.Name)
+		}
+		workspaceNames[w.Name] = true
+	}
+	return nil
+}
+
+func (r *RunIf) Validate() error {
+	if r == nil {
+		return nil
+	}
+	for _, s := range r.Stage {
+		switch s {
+		case DevStage, QAStage, ProdStage:
+		default:
+			return fmt.Errorf("invalid stage value '%s'", s)
+		}
+	}
+	for _, p := range r.ChangedPaths {
+		if _, err := path.Match(p, ""); err != nil {
+			return fmt.Errorf("invalid path pattern '%s'", p)
+		}
+	}
+	return nil
+}
+
+func (r Repository) Validate() error {
+	if len(r.Name) == 0 {
+		return errors.New("name of repository must not be blank")
+	}
+	if len(r.Tag) > 0 && (len(r.Branch) > 0 || len(r.Commit) > 0) {
+		return fmt.Errorf("repository %s must not specify tag together with branch or commit", r.Name)
+	}
+	if len(r.Commit) > 0 {
+		pattern := "^[0-9a-f]{7,40}$"
+		matched, err := regexp.MatchString(pattern, r.Commit)
+		if err != nil || !matched {
+			return fmt.Errorf("commit of repository %s must match %s", r.Name, pattern)
+		}
+	}
+	return nil
+}
+
+// Pinned returns true if the repository is pinned to a tag or commit.
+func (r Repository) Pinned() bool {
+	return len(r.Tag) > 0 || len(r.Commit) > 0
+}
+
+func (r ReleaseTags) Validate() error {
+	candidate, final := r.Templates()
+	if err := validateTagTemplate(candidate, true); err != nil {
+		return fmt.Errorf("invalid release candidate tag template '%s': %w", candidate, err)
+	}
+	if err := validateTagTemplate(final, false); err != nil {
+		return fmt.Errorf("invalid final tag template '%s': %w", final, err)
+	}
+	return nil
+}
+
+// Templates returns the candidate and final tag templates, falling back to
+// the defaults.
+func (r ReleaseTags) Templates() (candidate, final string) {
+	candidate, final = DefaultCandidateTag, DefaultFinalTag
+	if len(r.Candidate) > 0 {
+		candidate = r.Candidate
+	}
+	if len(r.Final) > 0 {
+		final = r.Final
+	}
+	return candidate, final
+}
+
+var tagPlaceholderPattern = regexp.MustCompile(`{{[^}]*}}`)
+
+func validateTagTemplate(template string, candidate bool) error {
+	for _, p := range tagPlaceholderPattern.FindAllString(template, -1) {
+		switch p {
+		case TagVersionPlaceholder, TagNumberPlaceholder, TagCommitSHAPlaceholder, TagShortCommitSHAPlaceholder:
+		default:
+			return fmt.Errorf("unknown placeholder %s", p)
+		}
+	}
+	if strings.Count(template, TagVersionPlaceholder) != 1 {
+		return fmt.Errorf("must contain %s exactly once", TagVersionPlaceholder)
+	}
+	numbers := strings.Count(template, TagNumberPlaceholder)
+	if candidate && numbers != 1 {
+		return fmt.Errorf("must contain %s exactly once", TagNumberPlaceholder)
+	}
+	if !candidate && numbers != 0 {
+		return fmt.Errorf("must not contain %s", TagNumberPlaceholder)
+	}
+	if strings.ContainsAny(tagPlaceholderPattern.ReplaceAllString(template, ""), " ~^:?*[\\") {
+		return errors.New("contains characters not allowed in Git tags")
+	}
+	return nil
+}
+
+func (w Workspace) Validate() error {
+	if len(w.Name) == 0 {
+		return errors.New("name of workspace must not be blank")
+	}
+	sources := 0
+	if w.Secret != nil {
+		sources++
+	}
+	if w.ConfigMap != nil {
+		sources++
+	}
+	if w.EmptyDir != nil {
+		sources++
+	}
+	if sources != 1 {
+		return fmt.Errorf("workspace %s must specify exactly one of secret, configMap or emptyDir", w.Name)
+	}
+	return nil
+}
+
+func (p Pipeline) Validate() error {
+	if len(p.Name) == 0 {
+		return errors.New("name of pipeline must not be blank")
+	}
+	pattern := "^[a-z0-9-]*$"
+	matched, err := regexp.MatchString(pattern, p.Name)
+	if err != nil || !matched {
+		return fmt.Errorf("name of pipeline must match %s", pattern)
+	}
 	return nil
 }
 
@@ -120,10 +555,44 @@ func (e Environment) Validate() error {
 	}
 	switch e.Stage {
 	case DevStage, QAStage, ProdStage:
-		return nil
 	default:
 		return fmt.Errorf("invalid stage value '%s' for environment %s", e.Stage, e.Name)
 	}
+	if e.Approval != nil {
+		if err := e.Approval.Validate(); err != nil {
+			return fmt.Errorf("invalid approval of environment %s: %w", e.Name, err)
+		}
+	}
+	for i, f := range e.Freezes {
+		if err := f.Validate(); err != nil {
+			return fmt.Errorf("invalid freeze #%d of environment %s: %w", i+1, e.Name, err)
+		}
+	}
+	return nil
+}
+
+func (a *Approval) Validate() error {
+	if len(a.Approvers) == 0 && len(a.Groups) == 0 {
+		return errors.New("approvers or groups must be given")
+	}
+	if a.MinApprovals < 0 {
+		return fmt.Errorf("minApprovals must not be negative, got %d", a.MinApprovals)
+	}
+	if len(a.Groups) == 0 && a.MinApprovals > len(a.Approvers) {
+		return fmt.Errorf("minApprovals (%d) exceeds the number of approvers (%d)", a.MinApprovals, len(a.Approvers))
+	}
+	if a.Timeout != nil && a.Timeout.Duration <= 0 {
+		return fmt.Errorf("timeout must be positive, got %s", a.Timeout.Duration)
+	}
+	return nil
+}
+
+// RequiredApprovals returns the number of distinct approvers required.
+func (a *Approval) RequiredApprovals() int {
+	if a.MinApprovals > 0 {
+		return a.MinApprovals
+	}
+	return 1
 }
 
 // Environment searches the list of configured environments for an environment
@@ -140,6 +609,15 @@ func (o *ODS) Environment(environment string) (*Environment, error) {
 	return nil, fmt.Errorf("no environment matched '%s', have: %s", environment, strings.Join(envs, ", "))
 }
 
+// PipelineDefinitions returns all configured pipelines. If Pipelines is
+// not used, the (unnamed) pipeline configured in Pipeline is returned.
+func (o *ODS) PipelineDefinitions() []Pipeline {
+	if len(o.Pipelines) > 0 {
+		return o.Pipelines
+	}
+	return []Pipeline{o.Pipeline}
+}
+
 // Read reads an ods config from given byte slice or errors.
 func Read(body []byte) (*ODS, error) {
 	if len(body) == 0 {
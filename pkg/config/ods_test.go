@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/opendevstack/pipeline/internal/projectpath"
+	tekton "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
 )
 
 func TestReadFromDir(t *testing.T) {
@@ -96,6 +97,297 @@ environments:
   stage: qa`),
 			WantError: "",
 		},
+		"valid approval": {
+			Fixture: []byte(`environments:
+- name: prod
+  stage: prod
+  approval:
+    approvers: [jdoe, jcitizen]
+    groups: [release-managers]
+    minApprovals: 2
+    timeout: 2h`),
+			WantError: "",
+		},
+		"approval without approvers": {
+			Fixture: []byte(`environments:
+- name: prod
+  stage: prod
+  approval:
+    minApprovals: 1`),
+			WantError: "invalid approval of environment prod: approvers or groups must be given",
+		},
+		"approval requiring more approvers than listed": {
+			Fixture: []byte(`environments:
+- name: prod
+  stage: prod
+  approval:
+    approvers: [jdoe]
+    minApprovals: 2`),
+			WantError: "invalid approval of environment prod: minApprovals (2) exceeds the number of approvers (1)",
+		},
+		"invalid freeze": {
+			Fixture: []byte(`environments:
+- name: prod
+  stage: prod
+  freezes:
+  - name: year-end
+    start: "2021-12-20"`),
+			WantError: "invalid freeze #1 of environment prod: invalid end: must not be empty",
+		},
+		"pipeline and pipelines": {
+			Fixture: []byte(`pipeline:
+  tasks:
+  - name: build
+pipelines:
+- name: foo`),
+			WantError: "pipeline and pipelines cannot be used together",
+		},
+		"name of single pipeline": {
+			Fixture: []byte(`pipeline:
+  name: foo`),
+			WantError: "name and trigger can only be set for items in pipelines",
+		},
+		"blank pipeline name": {
+			Fixture: []byte(`pipelines:
+- tasks: []`),
+			WantError: "name of pipeline must not be blank",
+		},
+		"invalid pipeline name": {
+			Fixture: []byte(`pipelines:
+- name: Foo`),
+			WantError: "name of pipeline must match ^[a-z0-9-]*$",
+		},
+		"duplicate pipeline name": {
+			Fixture: []byte(`pipelines:
+- name: foo
+- name: foo`),
+			WantError: "pipeline name foo is not unique",
+		},
+		"overrides without extends": {
+			Fixture: []byte(`pipeline:
+  overrides:
+  - task: build
+    params:
+    - name: go-os
+      value: darwin`),
+			WantError: "overrides can only be used together with extends",
+		},
+		"valid extends": {
+			Fixture: []byte(`pipeline:
+  extends: go-service
+  overrides:
+  - task: build
+    params:
+    - name: go-os
+      value: darwin
+  tasks:
+  - name: lint`),
+			WantError: "",
+		},
+		"invalid param type": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: foo
+    type: object`),
+			WantError: "invalid type 'object' for param foo",
+		},
+		"duplicate param name": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: foo
+    default: bar
+  - name: foo
+    default: baz`),
+			WantError: "param name foo is not unique",
+		},
+		"param without default": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: foo`),
+			WantError: "param foo must have a default value",
+		},
+		"reserved param name": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: git-commit-sha
+    default: abc`),
+			WantError: "param name git-commit-sha is reserved",
+		},
+		"reserved param name prefix": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: changed-paths-build
+    default: "true"`),
+			WantError: "param name changed-paths-build is reserved",
+		},
+		"reserved workspace name": {
+			Fixture: []byte(`pipeline:
+  workspaces:
+  - name: shared-workspace
+    emptyDir: {}`),
+			WantError: "workspace name shared-workspace is reserved",
+		},
+		"workspace without source": {
+			Fixture: []byte(`pipeline:
+  workspaces:
+  - name: settings`),
+			WantError: "workspace settings must specify exactly one of secret, configMap or emptyDir",
+		},
+		"workspace with multiple sources": {
+			Fixture: []byte(`pipeline:
+  workspaces:
+  - name: settings
+    emptyDir: {}
+    secret:
+      secretName: maven-settings`),
+			WantError: "workspace settings must specify exactly one of secret, configMap or emptyDir",
+		},
+		"valid params and workspaces": {
+			Fixture: []byte(`pipeline:
+  params:
+  - name: maven-profile
+    default: ci
+  - name: test-suites
+    type: array
+    default: [unit, integration]
+  workspaces:
+  - name: maven-settings
+    secret:
+      secretName: maven-settings
+  - name: npmrc
+    configMap:
+      name: npmrc
+  - name: scratch
+    emptyDir: {}`),
+			WantError: "",
+		},
+		"invalid runIf stage": {
+			Fixture: []byte(`pipeline:
+  tasks:
+  - name: deploy
+    runIf:
+      stage: [staging]`),
+			WantError: "invalid runIf of task deploy: invalid stage value 'staging'",
+		},
+		"invalid runIf path pattern": {
+			Fixture: []byte(`pipeline:
+  tasks:
+  - name: build
+    runIf:
+      changedPaths: ["[docs"]`),
+			WantError: "invalid runIf of task build: invalid path pattern '[docs'",
+		},
+		"valid runIf": {
+			Fixture: []byte(`pipeline:
+  tasks:
+  - name: deploy
+    taskRef:
+      kind: Task
+      name: ods-deploy-helm
+    runIf:
+      stage: [qa, prod]
+      branch: ["release/*"]
+      pullRequest: false
+      changedPaths: ["chart/*"]`),
+			WantError: "",
+		},
+		"valid runSpec": {
+			Fixture: []byte(`pipeline:
+  runSpec:
+    serviceAccountName: pipeline-deployer
+    timeout: 2h
+    podTemplate:
+      nodeSelector:
+        size: large
+    taskRunSpecs:
+    - pipelineTaskName: build
+      taskPodTemplate:
+        tolerations:
+        - key: build
+          operator: Exists`),
+			WantError: "",
+		},
+		"invalid workspace size": {
+			Fixture: []byte(`workspace:
+  size: 5 GB`),
+			WantError: "invalid workspace size '5 GB'",
+		},
+		"valid workspace size": {
+			Fixture: []byte(`workspace:
+  size: 5Gi`),
+			WantError: "",
+		},
+		"repository pinned to tag": {
+			Fixture: []byte(`repositories:
+- name: foo
+  tag: v1.0.0`),
+			WantError: "",
+		},
+		"repository pinned to commit of branch": {
+			Fixture: []byte(`repositories:
+- name: foo
+  branch: develop
+  commit: 8d351a1`),
+			WantError: "",
+		},
+		"repository pinned to tag and commit": {
+			Fixture: []byte(`repositories:
+- name: foo
+  tag: v1.0.0
+  commit: 8d351a1`),
+			WantError: "repository foo must not specify tag together with branch or commit",
+		},
+		"repository pinned to invalid commit": {
+			Fixture: []byte(`repositories:
+- name: foo
+  commit: HEAD~1`),
+			WantError: "commit of repository foo must match ^[0-9a-f]{7,40}$",
+		},
+		"automatic versioning": {
+			Fixture:   []byte(`versioning: auto`),
+			WantError: "",
+		},
+		"invalid versioning": {
+			Fixture:   []byte(`versioning: semver`),
+			WantError: "invalid versioning 'semver', must be 'auto'",
+		},
+		"automatic versioning with version": {
+			Fixture: []byte(`version: 1.0.0
+versioning: auto`),
+			WantError: "version and versioning cannot be used together",
+		},
+		"custom release tags": {
+			Fixture: []byte(`releaseTags:
+  candidate: "release/{{.Version}}-rc{{.Number}}"
+  final: "release/{{.Version}}"`),
+			WantError: "",
+		},
+		"release candidate tag without number": {
+			Fixture: []byte(`releaseTags:
+  candidate: "v{{.Version}}-rc"`),
+			WantError: "invalid release candidate tag template 'v{{.Version}}-rc': must contain {{.Number}} exactly once",
+		},
+		"final tag with number": {
+			Fixture: []byte(`releaseTags:
+  final: "v{{.Version}}.{{.Number}}"`),
+			WantError: "invalid final tag template 'v{{.Version}}.{{.Number}}': must not contain {{.Number}}",
+		},
+		"release tag with unknown placeholder": {
+			Fixture: []byte(`releaseTags:
+  final: "v{{.Version}}-{{.Date}}"`),
+			WantError: "invalid final tag template 'v{{.Version}}-{{.Date}}': unknown placeholder {{.Date}}",
+		},
+		"valid pipelines": {
+			Fixture: []byte(`pipelines:
+- name: pr
+  trigger:
+    events: ["pr:*"]
+    pullRequest: true
+- name: release
+  trigger:
+    branches: ["master", "release/*"]`),
+			WantError: "",
+		},
 	}
 
 	for name, tc := range tests {
@@ -133,3 +425,16 @@ func TestEnvironment(t *testing.T) {
 		t.Fatalf("Want env: b, got: %s", got.Name)
 	}
 }
+
+func TestPipelineDefinitions(t *testing.T) {
+	single := &ODS{Pipeline: Pipeline{Tasks: []PipelineTask{{PipelineTask: tekton.PipelineTask{Name: "a"}}}}}
+	got := single.PipelineDefinitions()
+	if len(got) != 1 || got[0].Tasks[0].Name != "a" {
+		t.Fatalf("Want single pipeline with task a, got: %v", got)
+	}
+	multiple := &ODS{Pipelines: []Pipeline{{Name: "a"}, {Name: "b"}}}
+	got = multiple.PipelineDefinitions()
+	if len(got) != 2 || got[1].Name != "b" {
+		t.Fatalf("Want pipelines a and b, got: %v", got)
+	}
+}
@@ -39,6 +39,25 @@ const (
 	ArtifactsManifestFilename = "manifest.json"
 )
 
+// PipelineRunArchivesDir holds archives of pruned pipeline runs in Nexus.
+// Archives are not downloaded together with the other artifacts.
+const PipelineRunArchivesDir = "pipeline-run-archives"
+
+const (
+	// SubrepoLockDir holds the commits of all subrepos checked out by a
+	// pipeline run of an umbrella repository.
+	SubrepoLockDir      = "subrepo-lock"
+	SubrepoLockPath     = ArtifactsPath + "/" + SubrepoLockDir
+	SubrepoLockFilename = "subrepos.lock.json"
+)
+
+// ReleaseNotesDir holds the release notes (Markdown and JSON) of the release
+// candidate or final tag created by a pipeline run.
+const (
+	ReleaseNotesDir  = "release-notes"
+	ReleaseNotesPath = ArtifactsPath + "/" + ReleaseNotesDir
+)
+
 // ArtifactsManifest represents all downloaded artifacts.
 type ArtifactsManifest struct {
 	// SourceRepository identifies the repository artifacts where downloaded from
@@ -211,10 +230,16 @@ func DownloadGroup(nexusClient nexus.ClientInterface, repositories []string, gro
 // skipping any further repositories that are given.
 func searchForAssets(nexusClient nexus.ClientInterface, searchGroup string, repositories []string, logger logging.LeveledLoggerInterface) (string, []string, error) {
 	for _, r := range repositories {
-		urls, err := nexusClient.Search(r, searchGroup)
+		found, err := nexusClient.Search(r, searchGroup)
 		if err != nil {
 			return "", nil, err
 		}
+		urls := []string{}
+		for _, u := range found {
+			if !strings.Contains(u, "/"+PipelineRunArchivesDir+"/") {
+				urls = append(urls, u)
+			}
+		}
 		if len(urls) > 0 {
 			logger.Infof("Found artifacts in repository %s inside group %s ...", r, searchGroup)
 			return r, urls, nil
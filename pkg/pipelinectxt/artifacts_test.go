@@ -86,6 +86,17 @@ func TestDownloadGroup(t *testing.T) {
 			},
 			wantSelectedRepo: nexus.PermanentRepositoryDefault,
 		},
+		"pipeline run archives are ignored": {
+			urls: map[string][]string{
+				nexus.PermanentRepositoryDefault: {
+					fmt.Sprintf("%s/%s%s/%s/pr-a.tar.gz", nexusURL, nexus.PermanentRepositoryDefault, group, PipelineRunArchivesDir),
+				},
+				nexus.TemporaryRepositoryDefault: {
+					temporaryBaseURL + "/t1.txt", temporaryBaseURL + "/t2.txt",
+				},
+			},
+			wantSelectedRepo: nexus.TemporaryRepositoryDefault,
+		},
 		"artifacts in no repo": {
 			urls:             map[string][]string{},
 			wantSelectedRepo: "",
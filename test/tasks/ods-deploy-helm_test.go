@@ -84,6 +84,14 @@ func TestTaskODSDeployHelm(t *testing.T) {
 						"STATUS: deployed",
 						"REVISION: 1",
 					)
+					checkFileContentContains(
+						t, wsDir,
+						filepath.Join(pipelinectxt.DeploymentsPath, "deployment-dev.json"),
+						`"environment":"dev"`,
+						fmt.Sprintf(`"namespace":"%s"`, separateReleaseNamespace),
+						`"revision":1`,
+						`"path":"chart/secrets.yaml","encrypted":true,"values":{"password":"++++++++"}`,
+					)
 					resourceName := fmt.Sprintf("%s-%s", ctxt.ODS.Component, "helm-sample-app")
 					_, err := checkService(ctxt.Clients.KubernetesClientSet, separateReleaseNamespace, resourceName)
 					if err != nil {
@@ -94,11 +102,7 @@ func TestTaskODSDeployHelm(t *testing.T) {
 						t.Fatal(err)
 					}
 
-					// Verify log output massaging
-					doNotWantLogMsg := "/usr/local/helm/plugins/helm-secrets/scripts/commands/helm.sh: line 34: xargs: command not found"
-					if strings.Contains(string(ctxt.CollectedLogs), doNotWantLogMsg) {
-						t.Fatalf("Do not want:\n%s\n\nGot:\n%s", doNotWantLogMsg, string(ctxt.CollectedLogs))
-					}
+					// Verify the diff outcome is logged
 					wantLogMsg := "identified at least one change"
 					if !strings.Contains(string(ctxt.CollectedLogs), wantLogMsg) {
 						t.Fatalf("Want:\n%s\n\nGot:\n%s", wantLogMsg, string(ctxt.CollectedLogs))
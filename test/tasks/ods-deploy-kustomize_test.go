@@ -0,0 +1,98 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opendevstack/pipeline/pkg/pipelinectxt"
+	"github.com/opendevstack/pipeline/pkg/tasktesting"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTaskODSDeployKustomize(t *testing.T) {
+	var separateNamespace string
+	runTaskTestCases(t,
+		"ods-deploy-kustomize",
+		[]tasktesting.Service{},
+		map[string]tasktesting.TestCase{
+			"should skip when no environment selected": {
+				WorkspaceDirMapping: map[string]string{"source": "kustomize-sample-app"},
+				PreRunFunc: func(t *testing.T, ctxt *tasktesting.TaskRunContext) {
+					wsDir := ctxt.Workspaces["source"]
+					ctxt.ODS = tasktesting.SetupGitRepo(t, ctxt.Namespace, wsDir)
+					// simulate empty environment
+					writeContextFile(t, wsDir, "environment", "")
+				},
+				WantRunSuccess: true,
+			},
+			"should apply dev overlay in separate namespace": {
+				WorkspaceDirMapping: map[string]string{"source": "kustomize-sample-app"},
+				PreRunFunc: func(t *testing.T, ctxt *tasktesting.TaskRunContext) {
+					wsDir := ctxt.Workspaces["source"]
+					ctxt.ODS = tasktesting.SetupGitRepo(t, ctxt.Namespace, wsDir)
+
+					externalNamespace, err := createReleaseNamespace(ctxt.Clients.KubernetesClientSet, ctxt.Namespace)
+					if err != nil {
+						t.Fatal(err)
+					}
+					separateNamespace = externalNamespace
+					ctxt.Cleanup = func() {
+						if err := ctxt.Clients.KubernetesClientSet.CoreV1().Namespaces().Delete(context.TODO(), externalNamespace, metav1.DeleteOptions{}); err != nil {
+							t.Errorf("Failed to delete namespace %s: %s", externalNamespace, err)
+						}
+					}
+
+					err = createHelmODSYML(wsDir, externalNamespace)
+					if err != nil {
+						t.Fatal(err)
+					}
+				},
+				WantRunSuccess: true,
+				PostRunFunc: func(t *testing.T, ctxt *tasktesting.TaskRunContext) {
+					wsDir := ctxt.Workspaces["source"]
+					checkFileContentContains(
+						t, wsDir,
+						filepath.Join(pipelinectxt.DeploymentsPath, "diff-dev.txt"),
+						fmt.Sprintf("%s, kustomize-sample-app, Deployment (apps) has been added", separateNamespace),
+						fmt.Sprintf("%s, kustomize-sample-app, Service (v1) has been added", separateNamespace),
+						"ConfigMap (v1) has been added",
+					)
+					checkFileContentContains(
+						t, wsDir,
+						filepath.Join(pipelinectxt.DeploymentsPath, "apply-dev.txt"),
+						"deployment.apps/kustomize-sample-app serverside-applied",
+						"service/kustomize-sample-app serverside-applied",
+					)
+					checkFileContentContains(
+						t, wsDir,
+						filepath.Join(pipelinectxt.DeploymentsPath, "deployment-dev.json"),
+						`"environment":"dev"`,
+						fmt.Sprintf(`"namespace":"%s"`, separateNamespace),
+						`"manifests":"deploy/overlays/dev"`,
+					)
+					_, err := checkService(ctxt.Clients.KubernetesClientSet, separateNamespace, "kustomize-sample-app")
+					if err != nil {
+						t.Fatal(err)
+					}
+					d, err := checkDeployment(ctxt.Clients.KubernetesClientSet, separateNamespace, "kustomize-sample-app")
+					if err != nil {
+						t.Fatal(err)
+					}
+					gotLabel := d.Labels["pipeline.opendevstack.org/deployment"]
+					if gotLabel != ctxt.ODS.Component {
+						t.Fatalf("Want deployment label %s, got: %s", ctxt.ODS.Component, gotLabel)
+					}
+
+					// Verify the diff outcome is logged
+					wantLogMsg := "identified at least one change"
+					if !strings.Contains(string(ctxt.CollectedLogs), wantLogMsg) {
+						t.Fatalf("Want:\n%s\n\nGot:\n%s", wantLogMsg, string(ctxt.CollectedLogs))
+					}
+				},
+			},
+		},
+	)
+}